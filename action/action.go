@@ -11,6 +11,10 @@ import (
 	"github.com/tsuru/tsuru/log"
 )
 
+// ErrCanceled is the error returned by Execute when the pipeline is canceled
+// before running all its actions.
+var ErrCanceled = errors.New("pipeline canceled")
+
 // Result is the value returned by Forward. It is used in the call of the next
 // action, and also when rolling back the actions.
 type Result interface{}
@@ -67,6 +71,11 @@ type Action struct {
 	// Minimum number of parameters that this action requires to run.
 	MinParams int
 
+	// PointOfNoReturn tells the executor to stop checking whether the
+	// pipeline has been canceled once this action has run, so that a
+	// cancellation never rolls back the pipeline past this action.
+	PointOfNoReturn bool
+
 	// Result of the action. Stored for use in the backward phase.
 	result Result
 
@@ -74,11 +83,16 @@ type Action struct {
 	rMutex sync.Mutex
 }
 
+// Canceled is the function called by the pipeline executor before running
+// each action, to check whether the pipeline has been canceled.
+type Canceled func() bool
+
 // Pipeline is a list of actions. Each pipeline is atomic: either all actions
 // are successfully executed, or none of them are. For that, it's fundamental
 // that all actions are really small and atomic.
 type Pipeline struct {
-	actions []*Action
+	actions  []*Action
+	canceled Canceled
 }
 
 // NewPipeline creates a new pipeline instance with the given list of actions.
@@ -95,6 +109,13 @@ func NewPipeline(actions ...*Action) *Pipeline {
 
 }
 
+// SetCanceled defines the function used to check whether the pipeline has
+// been canceled. A canceled pipeline stops at the next action boundary and
+// rolls back the completed actions.
+func (p *Pipeline) SetCanceled(canceled Canceled) {
+	p.canceled = canceled
+}
+
 // Result returns the result of the last action.
 func (p *Pipeline) Result() Result {
 	action := p.actions[len(p.actions)-1]
@@ -115,6 +136,10 @@ func (p *Pipeline) Result() Result {
 //
 // After rolling back all completed actions, it returns the original error
 // returned by the action that failed.
+//
+// If the pipeline is canceled, the executor also switches to the backward
+// phase before running the next action, returning ErrCanceled, unless an
+// action marked as PointOfNoReturn has already run.
 func (p *Pipeline) Execute(params ...interface{}) error {
 	var (
 		r   Result
@@ -124,7 +149,13 @@ func (p *Pipeline) Execute(params ...interface{}) error {
 		return errors.New("No actions to execute.")
 	}
 	fwCtx := FWContext{Params: params}
+	cancelable := p.canceled != nil
 	for i, a := range p.actions {
+		if cancelable && p.canceled() {
+			log.Debugf("[pipeline] canceled before running the Forward for the %s action", a.Name)
+			p.rollback(i-1, params)
+			return ErrCanceled
+		}
 		log.Debugf("[pipeline] running the Forward for the %s action", a.Name)
 		if a.Forward == nil {
 			err = errors.New("All actions must define the forward function.")
@@ -142,6 +173,9 @@ func (p *Pipeline) Execute(params ...interface{}) error {
 			p.rollback(i-1, params)
 			return err
 		}
+		if a.PointOfNoReturn {
+			cancelable = false
+		}
 	}
 	return nil
 }
@@ -155,3 +155,101 @@ func (s *S) TestDoesntOverwriteResult(c *check.C) {
 	r2 := pipeline2.Result()
 	c.Assert(r2, check.Equals, "result2")
 }
+
+func (s *S) TestExecuteCanceled(c *check.C) {
+	var forwards, backwards []string
+	canceled := false
+	actions := []*Action{
+		{
+			Name: "first",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwards = append(forwards, "first")
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				c.Assert(ctx.FWResult, check.Equals, "ok")
+				backwards = append(backwards, "first")
+			},
+		},
+		{
+			Name: "second",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwards = append(forwards, "second")
+				canceled = true
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				backwards = append(backwards, "second")
+			},
+		},
+		{
+			Name: "third",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwards = append(forwards, "third")
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				backwards = append(backwards, "third")
+			},
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	pipeline.SetCanceled(func() bool {
+		return canceled
+	})
+	err := pipeline.Execute("hello")
+	c.Assert(err, check.Equals, ErrCanceled)
+	c.Assert(forwards, check.DeepEquals, []string{"first", "second"})
+	c.Assert(backwards, check.DeepEquals, []string{"second", "first"})
+}
+
+func (s *S) TestExecuteNotCanceled(c *check.C) {
+	pipeline := NewPipeline(&helloAction, &helloAction)
+	pipeline.SetCanceled(func() bool {
+		return false
+	})
+	err := pipeline.Execute("hello")
+	c.Assert(err, check.IsNil)
+	c.Assert(pipeline.Result(), check.Equals, "success")
+}
+
+func (s *S) TestExecuteNotCanceledAfterPointOfNoReturn(c *check.C) {
+	var forwards, backwards []string
+	canceled := false
+	actions := []*Action{
+		{
+			Name: "first",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwards = append(forwards, "first")
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				backwards = append(backwards, "first")
+			},
+			PointOfNoReturn: true,
+		},
+		{
+			Name: "second",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwards = append(forwards, "second")
+				canceled = true
+				return "ok", nil
+			},
+		},
+		{
+			Name: "third",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwards = append(forwards, "third")
+				return "ok", nil
+			},
+		},
+	}
+	pipeline := NewPipeline(actions...)
+	pipeline.SetCanceled(func() bool {
+		return canceled
+	})
+	err := pipeline.Execute("hello")
+	c.Assert(err, check.IsNil)
+	c.Assert(forwards, check.DeepEquals, []string{"first", "second", "third"})
+	c.Assert(backwards, check.HasLen, 0)
+}
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tsuru/go-gandalfclient"
 	"github.com/tsuru/tsuru/api/context"
@@ -23,6 +24,7 @@ import (
 	"github.com/tsuru/tsuru/errors"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/log"
+	mongoMetrics "github.com/tsuru/tsuru/metrics/mongodb"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/rec"
@@ -217,18 +219,19 @@ func addUnits(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
+	process := r.URL.Query().Get("process")
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
-	rec.Log(u.Email, "add-units", "app="+appName, fmt.Sprintf("units=%d", n))
+	rec.Log(u.Email, "add-units", processLogArgs(process, "app="+appName, fmt.Sprintf("units=%d", n))...)
 	app, err := getApp(appName, u)
 	if err != nil {
 		return err
 	}
 	w.Header().Set("Content-Type", "application/json")
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(w)}
-	err = app.AddUnits(n, writer)
+	err = app.AddUnits(n, process, writer)
 	if err != nil {
 		writer.Encode(tsuruIo.SimpleJsonMessage{Error: err.Error()})
 		return nil
@@ -246,13 +249,27 @@ func removeUnits(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	rec.Log(u.Email, "remove-units", "app="+appName, fmt.Sprintf("units=%d", n))
+	process := r.URL.Query().Get("process")
+	rec.Log(u.Email, "remove-units", processLogArgs(process, "app="+appName, fmt.Sprintf("units=%d", n))...)
 	app, err := getApp(appName, u)
 	if err != nil {
 		return err
 	}
 	context.SetPreventUnlock(r)
-	return app.RemoveUnits(uint(n))
+	err = app.RemoveUnits(uint(n), process)
+	if err == provision.ErrProcessRequired {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// processLogArgs appends the process to the arguments logged for an action,
+// when it's set.
+func processLogArgs(process string, args ...interface{}) []interface{} {
+	if process != "" {
+		args = append(args, "process="+process)
+	}
+	return args
 }
 
 func setUnitStatus(w http.ResponseWriter, r *http.Request, t auth.Token) error {
@@ -681,6 +698,52 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+// parseMetricsTime parses a unix timestamp from the given query parameter,
+// returning def when the parameter is not present.
+func parseMetricsTime(r *http.Request, param string, def time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return def, nil
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("Parameter %q must be a unix timestamp.", param)
+		return time.Time{}, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+func appMetrics(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	now := time.Now()
+	to, err := parseMetricsTime(r, "to", now)
+	if err != nil {
+		return err
+	}
+	from, err := parseMetricsTime(r, "from", to.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if from.After(to) {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "from" must be before "to".`}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	rec.Log(u.Email, "app-metrics", "app="+appName, fmt.Sprintf("from=%d", from.Unix()), fmt.Sprintf("to=%d", to.Unix()))
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	samples, err := mongoMetrics.List(a.Name, from, to)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(samples)
+}
+
 func getServiceInstance(instanceName, appName string, u *auth.User) (*service.ServiceInstance, *app.App, error) {
 	var app app.App
 	conn, err := db.Conn()
@@ -777,6 +840,41 @@ func restart(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+func changeAppPool(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	pool := r.FormValue("pool")
+	rec.Log(u.Email, "change-app-pool", "app="+appName, "pool="+pool)
+	locked, err := app.AcquireApplicationLock(appName, t.GetUserName(), fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	if err != nil {
+		return err
+	}
+	if locked {
+		defer app.ReleaseApplicationLock(appName)
+	}
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return &errors.HTTP{Code: http.StatusConflict, Message: fmt.Sprintf("%s", &instance.Lock)}
+	}
+	w.Header().Set("Content-Type", "text")
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(w)}
+	err = instance.ChangePool(pool, writer)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		writer.Encode(tsuruIo.SimpleJsonMessage{Error: err.Error()})
+		return err
+	}
+	return nil
+}
+
 func addLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	queryValues := r.URL.Query()
 	app, err := app.GetByName(queryValues.Get(":app"))
@@ -880,12 +978,13 @@ func start(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	rec.Log(u.Email, "start", appName)
+	process := r.URL.Query().Get("process")
+	rec.Log(u.Email, "start", processLogArgs(process, appName)...)
 	app, err := getApp(appName, u)
 	if err != nil {
 		return err
 	}
-	return app.Start(w)
+	return app.Start(w, process)
 }
 
 func stop(w http.ResponseWriter, r *http.Request, t auth.Token) error {
@@ -895,12 +994,13 @@ func stop(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	rec.Log(u.Email, "stop", appName)
+	process := r.URL.Query().Get("process")
+	rec.Log(u.Email, "stop", processLogArgs(process, appName)...)
 	app, err := getApp(appName, u)
 	if err != nil {
 		return err
 	}
-	return app.Stop(w)
+	return app.Stop(w, process)
 }
 
 func forceDeleteLock(w http.ResponseWriter, r *http.Request, t auth.Token) error {
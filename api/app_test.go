@@ -26,6 +26,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
+	mongoMetrics "github.com/tsuru/tsuru/metrics/mongodb"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/queue"
 	"github.com/tsuru/tsuru/quota"
@@ -67,7 +68,7 @@ func (s *S) TestAppIsAvailableHandlerShouldReturn200WhenAppUnitStatusIsStarted(c
 	defer s.conn.Logs(a.Name).DropCollection()
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
 	request, err := http.NewRequest("GET", url, nil)
 	c.Assert(err, check.IsNil)
@@ -575,6 +576,39 @@ func (s *S) TestAddUnits(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, `{"Message":"added 3 units"}`+"\n")
 }
 
+func (s *S) TestAddUnitsWithProcess(c *check.C) {
+	a := app.App{
+		Name:     "armorandsword",
+		Platform: "python",
+		Teams:    []string{s.team.Name},
+		Quota:    quota.Unlimited,
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs(a.Name).DropCollection()
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	body := strings.NewReader("2")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:app=armorandsword&process=worker", body)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addUnits(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	units := s.provisioner.GetUnits(&a)
+	c.Assert(units, check.HasLen, 2)
+	for _, unit := range units {
+		c.Assert(unit.ProcessName, check.Equals, "worker")
+	}
+	action := rectest.Action{
+		Action: "add-units",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=armorandsword", "units=2", "process=worker"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
 func (s *S) TestAddUnitsReturns404IfAppDoesNotExist(c *check.C) {
 	body := strings.NewReader("1")
 	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:app=armorandsword", body)
@@ -675,7 +709,7 @@ func (s *S) TestRemoveUnits(c *check.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3, nil)
+	s.provisioner.AddUnits(&a, 3, "", nil)
 	body := strings.NewReader("2")
 	request, err := http.NewRequest("DELETE", "/apps/velha/units?:app=velha", body)
 	c.Assert(err, check.IsNil)
@@ -695,6 +729,32 @@ func (s *S) TestRemoveUnits(c *check.C) {
 	c.Assert(action, rectest.IsRecorded)
 }
 
+func (s *S) TestRemoveUnitsReturns400IfProcessIsRequired(c *check.C) {
+	a := app.App{
+		Name:     "velha",
+		Platform: "python",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs(a.Name).DropCollection()
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 2, "worker", nil)
+	s.provisioner.AddUnits(&a, 1, "clock", nil)
+	body := strings.NewReader("1")
+	request, err := http.NewRequest("DELETE", "/apps/velha/units?:app=velha", body)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeUnits(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, provision.ErrProcessRequired.Error())
+}
+
 func (s *S) TestRemoveUnitsReturns404IfAppDoesNotExist(c *check.C) {
 	body := strings.NewReader("1")
 	request, err := http.NewRequest("DELETE", "/apps/fetisha/units?:app=fetisha", body)
@@ -773,7 +833,7 @@ func (s *S) TestSetUnitStatus(c *check.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3, nil)
+	s.provisioner.AddUnits(&a, 3, "", nil)
 	body := strings.NewReader("status=error")
 	unit := a.Units()[0]
 	request, err := http.NewRequest("POST", "/apps/telegram/units/<unit-name>?:app=telegram&:unit="+unit.Name, body)
@@ -846,7 +906,7 @@ func (s *S) TestSetUnitStatusDoesntRequireLock(c *check.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	unit := a.Units()[0]
 	body := strings.NewReader("status=error")
 	request, err := http.NewRequest("POST", "/apps/telegram/units/"+unit.Name, body)
@@ -1275,7 +1335,7 @@ func (s *S) TestRunOnceHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	defer s.conn.Logs(a.Name).DropCollection()
 	url := fmt.Sprintf("/apps/%s/run/?:app=%s&once=true", a.Name, a.Name)
@@ -1310,7 +1370,7 @@ func (s *S) TestRunHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	defer s.conn.Logs(a.Name).DropCollection()
 	url := fmt.Sprintf("/apps/%s/run/?:app=%s", a.Name, a.Name)
@@ -1348,7 +1408,7 @@ func (s *S) TestRunHandlerReturnsTheOutputOfTheCommandEvenIfItFails(c *check.C)
 	defer s.conn.Logs(a.Name).DropCollection()
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	url := fmt.Sprintf("/apps/%s/run/?:app=%s", a.Name, a.Name)
 	request, err := http.NewRequest("POST", url, strings.NewReader("ls"))
 	c.Assert(err, check.IsNil)
@@ -2497,6 +2557,69 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	c.Assert(logs[2].Message, check.Equals, "14")
 }
 
+func (s *S) TestAppMetrics(c *check.C) {
+	a := app.App{
+		Name:     "lost",
+		Platform: "vougan",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	now := time.Now().Truncate(time.Second)
+	err = mongoMetrics.Add(
+		mongoMetrics.Sample{App: a.Name, Unit: "u1", Timestamp: now.Add(-2 * time.Hour), CPU: 10},
+		mongoMetrics.Sample{App: a.Name, Unit: "u1", Timestamp: now.Add(-time.Minute), CPU: 20, Memory: 1024},
+		mongoMetrics.Sample{App: "other", Unit: "u2", Timestamp: now.Add(-time.Minute), CPU: 30},
+	)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection("units_metrics").DropCollection()
+	url := fmt.Sprintf("/apps/%s/metrics?:app=%s&to=%d", a.Name, a.Name, now.Unix())
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appMetrics(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var samples []mongoMetrics.Sample
+	err = json.NewDecoder(recorder.Body).Decode(&samples)
+	c.Assert(err, check.IsNil)
+	c.Assert(samples, check.HasLen, 1)
+	c.Assert(samples[0].Unit, check.Equals, "u1")
+	c.Assert(samples[0].CPU, check.Equals, 20.0)
+	c.Assert(samples[0].Memory, check.Equals, uint64(1024))
+	action := rectest.Action{
+		Action: "app-metrics",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, fmt.Sprintf("from=%d", now.Add(-time.Hour).Unix()), fmt.Sprintf("to=%d", now.Unix())},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestAppMetricsInvalidTimestamp(c *check.C) {
+	request, err := http.NewRequest("GET", "/apps/lost/metrics?:app=lost&from=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appMetrics(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, `Parameter "from" must be a unix timestamp.`)
+}
+
+func (s *S) TestAppMetricsAppNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/apps/unknown/metrics?:app=unknown", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appMetrics(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
 func (s *S) TestAppLogShouldReturnLogByApp(c *check.C) {
 	app1 := app.App{
 		Name:     "app1",
@@ -2579,7 +2702,7 @@ func (s *S) TestBindHandlerEndpointIsDown(c *check.C) {
 	defer s.conn.Logs(a.Name).DropCollection()
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	url := fmt.Sprintf("/services/instances/%s/%s?:instance=%s&:app=%s", instance.Name, a.Name, instance.Name, a.Name)
 	request, err := http.NewRequest("PUT", url, nil)
 	c.Assert(err, check.IsNil)
@@ -2618,7 +2741,7 @@ func (s *S) TestBindHandler(c *check.C) {
 	defer s.conn.Logs(a.Name).DropCollection()
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	url := fmt.Sprintf("/services/instances/%s/%s?:instance=%s&:app=%s", instance.Name, a.Name, instance.Name, a.Name)
 	request, err := http.NewRequest("PUT", url, nil)
 	c.Assert(err, check.IsNil)
@@ -2780,7 +2903,7 @@ func (s *S) TestUnbindHandler(c *check.C) {
 	defer app.Delete(&a)
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	otherApp, err := app.GetByName(a.Name)
 	c.Assert(err, check.IsNil)
 	otherApp.Env["DATABASE_HOST"] = bind.EnvVar{
@@ -2958,6 +3081,76 @@ func (s *S) TestRestartHandler(c *check.C) {
 	c.Assert(action, rectest.IsRecorded)
 }
 
+func (s *S) TestChangeAppPool(c *check.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}, TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	body := strings.NewReader("pool=pool2")
+	request, err := http.NewRequest("POST", "/apps/stress/pool", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.admintoken.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(s.provisioner.Pool(&a), check.Equals, "pool2")
+	retrievedApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrievedApp.Pool, check.Equals, "pool2")
+	c.Assert(retrievedApp.Lock.Locked, check.Equals, false)
+	action := rectest.Action{
+		Action: "change-app-pool",
+		User:   s.adminuser.Email,
+		Extra:  []interface{}{"app=" + a.Name, "pool=pool2"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestChangeAppPoolInvalidPool(c *check.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}, TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.PrepareFailure("ValidateAppPool", fmt.Errorf(`pool "pool2" not found`))
+	request, err := http.NewRequest("POST", "/apps/stress/pool?:app=stress", strings.NewReader("pool=pool2"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = changeAppPool(recorder, request, s.admintoken)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, `pool "pool2" not found`)
+}
+
+func (s *S) TestChangeAppPoolAppLocked(c *check.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}, TeamOwner: s.team.Name, Lock: app.AppLock{
+		Locked: true, Reason: "/test", Owner: "x",
+	}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/stress/pool?:app=stress", strings.NewReader("pool=pool2"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = changeAppPool(recorder, request, s.admintoken)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusConflict)
+	c.Assert(e.Message, check.Matches, "App locked by x, running /test. Acquired in .*")
+	retrievedApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrievedApp.Lock.Locked, check.Equals, true)
+	c.Assert(retrievedApp.Pool, check.Equals, "")
+}
+
 func (s *S) TestRestartHandlerReturns404IfTheAppDoesNotExist(c *check.C) {
 	request, err := http.NewRequest("GET", "/apps/unknown/restart?:app=unknown", nil)
 	c.Assert(err, check.IsNil)
@@ -3269,6 +3462,36 @@ func (s *S) TestStopHandler(c *check.C) {
 	c.Assert(action, rectest.IsRecorded)
 }
 
+func (s *S) TestStopHandlerWithProcess(c *check.C) {
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs(a.Name).DropCollection()
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	s.provisioner.AddUnits(&a, 1, "worker", nil)
+	url := fmt.Sprintf("/apps/%s/stop?:app=%s&process=worker", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = stop(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	units := s.provisioner.GetUnits(&a)
+	c.Assert(units[0].Status, check.Equals, provision.StatusStarted)
+	c.Assert(units[1].Status, check.Equals, provision.StatusStopped)
+	action := rectest.Action{
+		Action: "stop",
+		User:   s.user.Email,
+		Extra:  []interface{}{a.Name, "process=worker"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
 func (s *S) TestForceDeleteLock(c *check.C) {
 	a := app.App{
 		Name: "locked",
@@ -3330,7 +3553,7 @@ func (s *S) TestRegisterUnit(c *check.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	units := a.Units()
 	oldIp := units[0].Ip
 	body := strings.NewReader("hostname=" + units[0].Name)
@@ -3398,7 +3621,7 @@ func (s *S) TestRegisterUnitWithCustomData(c *check.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	units := a.Units()
 	oldIp := units[0].Ip
 	v := url.Values{}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
 )
 
 func autoScaleHistoryHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
@@ -54,3 +55,54 @@ func autoScaleConfig(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	err = json.Unmarshal(body, &a.AutoScaleConfig)
 	return app.SetAutoScaleConfig(a, a.AutoScaleConfig)
 }
+
+func autoScaleListSchedules(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := app.GetByName(appName)
+	if err != nil {
+		return err
+	}
+	schedules := []app.ScheduleRule{}
+	if a.AutoScaleConfig != nil && a.AutoScaleConfig.Schedules != nil {
+		schedules = a.AutoScaleConfig.Schedules
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(schedules)
+}
+
+func autoScaleAddSchedule(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := app.GetByName(appName)
+	if err != nil {
+		return err
+	}
+	var rule app.ScheduleRule
+	defer r.Body.Close()
+	err = json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	added, err := app.AddAutoScaleSchedule(a, rule)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(added)
+}
+
+func autoScaleRemoveSchedule(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := app.GetByName(appName)
+	if err != nil {
+		return err
+	}
+	err = app.RemoveAutoScaleSchedule(a, r.URL.Query().Get(":id"))
+	if err == app.ErrScheduleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
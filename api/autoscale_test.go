@@ -165,3 +165,97 @@ func (s *AutoScaleSuite) TestAutoScaleConfig(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(gotApp.AutoScaleConfig, check.DeepEquals, &config)
 }
+
+func (s *AutoScaleSuite) TestAutoScaleListSchedules(c *check.C) {
+	a := app.App{
+		Name:     "myApp",
+		Platform: "Django",
+		AutoScaleConfig: &app.AutoScaleConfig{
+			Schedules: []app.ScheduleRule{{ID: "weekdays", Schedule: "* 8-19 * * 1-5", Units: 10}},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/autoscale/myApp/schedules", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var schedules []app.ScheduleRule
+	err = json.Unmarshal(recorder.Body.Bytes(), &schedules)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.DeepEquals, a.AutoScaleConfig.Schedules)
+}
+
+func (s *AutoScaleSuite) TestAutoScaleAddSchedule(c *check.C) {
+	a := app.App{Name: "myApp", Platform: "Django"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := bytes.NewBufferString(`{"schedule": "* 8-19 * * 1-5", "units": 10, "timezone": "America/Sao_Paulo"}`)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/autoscale/myApp/schedules", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var rule app.ScheduleRule
+	err = json.Unmarshal(recorder.Body.Bytes(), &rule)
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.ID, check.Not(check.Equals), "")
+	c.Assert(rule.Units, check.Equals, uint(10))
+	var gotApp app.App
+	err = s.conn.Apps().Find(bson.M{"name": "myApp"}).One(&gotApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(gotApp.AutoScaleConfig.Schedules, check.DeepEquals, []app.ScheduleRule{rule})
+}
+
+func (s *AutoScaleSuite) TestAutoScaleAddScheduleInvalid(c *check.C) {
+	a := app.App{Name: "myApp", Platform: "Django"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := bytes.NewBufferString(`{"schedule": "weekdays", "units": 10}`)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/autoscale/myApp/schedules", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrInvalidSchedule.Message+"\n")
+}
+
+func (s *AutoScaleSuite) TestAutoScaleRemoveSchedule(c *check.C) {
+	a := app.App{
+		Name:     "myApp",
+		Platform: "Django",
+		AutoScaleConfig: &app.AutoScaleConfig{
+			Schedules: []app.ScheduleRule{{ID: "weekdays", Schedule: "* 8-19 * * 1-5", Units: 10}},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/autoscale/myApp/schedules/weekdays", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var gotApp app.App
+	err = s.conn.Apps().Find(bson.M{"name": "myApp"}).One(&gotApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(gotApp.AutoScaleConfig.Schedules, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("DELETE", "/autoscale/myApp/schedules/weekdays", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
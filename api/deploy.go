@@ -17,6 +17,8 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/rec"
 	"github.com/tsuru/tsuru/service"
 )
 
@@ -34,10 +36,11 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}
 	version := r.PostFormValue("version")
 	archiveURL := r.PostFormValue("archive-url")
-	if version == "" && archiveURL == "" && file == nil {
+	image := r.PostFormValue("image")
+	if version == "" && archiveURL == "" && image == "" && file == nil {
 		return &errors.HTTP{
 			Code:    http.StatusBadRequest,
-			Message: "you must specify either the version, the archive-url or upload a file",
+			Message: "you must specify either the version, the archive-url, the image or upload a file",
 		}
 	}
 	if version != "" && archiveURL != "" {
@@ -46,6 +49,42 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 			Message: "you must specify either the version or the archive-url, but not both",
 		}
 	}
+	if image != "" && (version != "" || archiveURL != "" || file != nil) {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "you must specify either the image, the version, the archive-url or upload a file, but not more than one",
+		}
+	}
+	var canaryWeight int
+	if weight := r.PostFormValue("canary-weight"); weight != "" {
+		var err error
+		canaryWeight, err = strconv.Atoi(weight)
+		if err != nil || canaryWeight < 1 || canaryWeight > 99 {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "the canary weight must be a number between 1 and 99",
+			}
+		}
+	}
+	var rolling provision.TsuruYamlDeploy
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{
+		{"max-surge", &rolling.MaxSurge},
+		{"max-unavailable", &rolling.MaxUnavailable},
+	} {
+		if value := r.PostFormValue(param.name); value != "" {
+			var err error
+			*param.value, err = strconv.Atoi(value)
+			if err != nil || *param.value < 0 {
+				return &errors.HTTP{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("the %s must be a non-negative number", param.name),
+				}
+			}
+		}
+	}
 	commit := r.PostFormValue("commit")
 	w.Header().Set("Content-Type", "text")
 	appName := r.URL.Query().Get(":appname")
@@ -60,6 +99,10 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		user = t.GetUserName()
 	}
+	var origin string
+	if image != "" {
+		origin = "image"
+	}
 	err = app.Deploy(app.DeployOptions{
 		App:          instance,
 		Version:      version,
@@ -68,6 +111,52 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		ArchiveURL:   archiveURL,
 		OutputStream: writer,
 		User:         user,
+		Image:        image,
+		Origin:       origin,
+		CanaryWeight: canaryWeight,
+		Rolling:      rolling,
+	})
+	if err == nil {
+		fmt.Fprintln(w, "\nOK")
+	}
+	return err
+}
+
+// deployDockerfile deploys the app building the image from an uploaded
+// build context, a tar archive containing a Dockerfile.
+func deployDockerfile(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "you must upload the build context",
+		}
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	appName := r.URL.Query().Get(":appname")
+	instance, err := app.GetByName(appName)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	var user string
+	if t.IsAppToken() {
+		user = r.PostFormValue("user")
+	} else {
+		user = t.GetUserName()
+	}
+	w.Header().Set("Content-Type", "text")
+	writer := io.NewKeepAliveWriter(w, 30*time.Second, "please wait...")
+	err = app.Deploy(app.DeployOptions{
+		App:          instance,
+		File:         file,
+		Dockerfile:   true,
+		OutputStream: writer,
+		User:         user,
 	})
 	if err == nil {
 		fmt.Fprintln(w, "\nOK")
@@ -102,6 +191,142 @@ func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	return nil
 }
 
+// cancelDeploy signals the deploy in progress of the app to stop. It doesn't
+// wait for the deploy to be rolled back.
+func cancelDeploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":appname")
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	rec.Log(u.Email, "cancel-deploy", "app="+appName)
+	err = app.CancelDeploy(instance.Name)
+	if err == app.ErrDeployNotRunning {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deployQueue lists the deploys waiting for the lock of the app, in the
+// order they'll run.
+func deployQueue(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	instance, err := getApp(r.URL.Query().Get(":appname"), u)
+	if err != nil {
+		return err
+	}
+	queue, err := app.ListDeployQueue(instance.Name)
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(queue)
+}
+
+// removeQueuedDeploy cancels a deploy waiting in the queue of the app.
+func removeQueuedDeploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":appname")
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	id := r.URL.Query().Get(":id")
+	rec.Log(u.Email, "remove-queued-deploy", "app="+appName, "id="+id)
+	err = app.RemoveQueuedDeploy(instance.Name, id)
+	if err == app.ErrQueuedDeployNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func setCanaryWeight(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	weight, err := strconv.Atoi(r.PostFormValue("weight"))
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "the canary weight must be a number between 1 and 99",
+		}
+	}
+	appName := r.URL.Query().Get(":appname")
+	rec.Log(u.Email, "set-canary-weight", "app="+appName, fmt.Sprintf("weight=%d", weight))
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	err = instance.SetCanaryWeight(weight)
+	if err == app.ErrInvalidCanaryWeight {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+func promoteCanary(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":appname")
+	rec.Log(u.Email, "promote-canary", "app="+appName)
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writer := &io.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(w)}
+	err = instance.PromoteCanary(writer)
+	if err != nil {
+		writer.Encode(io.SimpleJsonMessage{Error: err.Error()})
+	}
+	return nil
+}
+
+func abortCanary(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":appname")
+	rec.Log(u.Email, "abort-canary", "app="+appName)
+	instance, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writer := &io.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(w)}
+	err = instance.AbortCanary(writer)
+	if err != nil {
+		writer.Encode(io.SimpleJsonMessage{Error: err.Error()})
+	}
+	return nil
+}
+
 func deploysList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	u, err := t.User()
 	if err != nil {
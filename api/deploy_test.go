@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/tsuru/auth/native"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/repository/repositorytest"
 	"github.com/tsuru/tsuru/service"
@@ -127,6 +128,34 @@ func (s *DeploySuite) TestDeployArchiveURL(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "Archive deploy called\nOK\n")
 }
 
+func (s *DeploySuite) TestDeployImage(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("image=registry.example.com/team/app:1.0"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Image deploy called\nOK\n")
+	var result map[string]interface{}
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["image"], check.Equals, "registry.example.com/team/app:1.0")
+	c.Assert(result["origin"], check.Equals, "image")
+}
+
 func (s *DeploySuite) TestDeployUploadFile(c *check.C) {
 	a := app.App{
 		Name:     "otherapp",
@@ -158,6 +187,59 @@ func (s *DeploySuite) TestDeployUploadFile(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "Upload deploy called\nOK\n")
 }
 
+func (s *DeploySuite) TestDeployDockerfile(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/deploy/dockerfile", a.Name)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	file, err := writer.CreateFormFile("file", "context.tar")
+	c.Assert(err, check.IsNil)
+	file.Write([]byte("FROM busybox"))
+	writer.Close()
+	request, err := http.NewRequest("POST", url, &body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text")
+	c.Assert(recorder.Body.String(), check.Equals, "Dockerfile deploy called\nOK\n")
+	var deploy app.DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&deploy)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	c.Assert(deploy.Origin, check.Equals, "dockerfile")
+	c.Assert(deploy.Image, check.Equals, "app-image")
+}
+
+func (s *DeploySuite) TestDeployDockerfileWithoutContext(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy/dockerfile", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("user=fulano"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "you must upload the build context\n")
+}
+
 func (s *DeploySuite) TestDeployWithCommit(c *check.C) {
 	a := app.App{
 		Name:     "otherapp",
@@ -248,7 +330,7 @@ func (s *DeploySuite) TestDeployWithoutVersionAndArchiveURL(c *check.C) {
 	server.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
 	message := recorder.Body.String()
-	c.Assert(message, check.Equals, "you must specify either the version, the archive-url or upload a file\n")
+	c.Assert(message, check.Equals, "you must specify either the version, the archive-url, the image or upload a file\n")
 }
 
 func (s *DeploySuite) TestDeployWithVersionAndArchiveURL(c *check.C) {
@@ -273,6 +355,28 @@ func (s *DeploySuite) TestDeployWithVersionAndArchiveURL(c *check.C) {
 	c.Assert(message, check.Equals, "you must specify either the version or the archive-url, but not both\n")
 }
 
+func (s *DeploySuite) TestDeployWithImageAndVersion(c *check.C) {
+	a := app.App{
+		Name:     "abc",
+		Platform: "zend",
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs(a.Name).DropCollection()
+	body := strings.NewReader("version=abcdef&image=registry.example.com/team/app:1.0")
+	request, err := http.NewRequest("POST", "/apps/abc/repository/clone", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	message := recorder.Body.String()
+	c.Assert(message, check.Equals, "you must specify either the image, the version, the archive-url or upload a file, but not more than one\n")
+}
+
 func (s *DeploySuite) TestDeployListNonAdmin(c *check.C) {
 	user := &auth.User{Email: "nonadmin@nonadmin.com", Password: "123456"}
 	nativeScheme := auth.ManagedScheme(native.NativeScheme{})
@@ -662,3 +766,348 @@ func (s *DeploySuite) TestDeployRollbackHandler(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
 	c.Assert(recorder.Body.String(), check.Equals, "{\"Message\":\"Image deploy called\"}\n")
 }
+
+func (s *DeploySuite) TestDeployHandlerWithCanaryWeight(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e&canary-weight=10"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Git deploy called\nOK\n")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 10)
+}
+
+func (s *DeploySuite) TestDeployHandlerWithInvalidCanaryWeight(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e&canary-weight=100"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "the canary weight must be a number between 1 and 99\n")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
+
+func (s *DeploySuite) TestDeployHandlerWithRollingSettings(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e&max-surge=2&max-unavailable=1"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Git deploy called\nOK\n")
+	c.Assert(s.provisioner.RollingDeploy(&a), check.DeepEquals, provision.TsuruYamlDeploy{MaxSurge: 2, MaxUnavailable: 1})
+}
+
+func (s *DeploySuite) TestDeployHandlerWithInvalidRollingSettings(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=a345f3e&max-unavailable=-1"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "the max-unavailable must be a non-negative number\n")
+	c.Assert(s.provisioner.RollingDeploy(&a), check.DeepEquals, provision.TsuruYamlDeploy{})
+}
+
+func (s *DeploySuite) TestSetCanaryWeightHandler(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = s.provisioner.StartCanary(&a, 10)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/canary", a.Name)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("weight=50"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 50)
+}
+
+func (s *DeploySuite) TestSetCanaryWeightHandlerInvalidWeight(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/canary", a.Name)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("weight=0"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *DeploySuite) TestCancelDeployHandler(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.conn.RunningDeploys().Insert(bson.M{"_id": a.Name, "canceled": false})
+	c.Assert(err, check.IsNil)
+	defer s.conn.RunningDeploys().RemoveId(a.Name)
+	locked, err := app.AcquireApplicationLock(a.Name, "someone", "POST /apps/otherapp/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	defer app.ReleaseApplicationLock(a.Name)
+	url := fmt.Sprintf("/apps/%s/deploy/current", a.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	canceled, err := app.IsDeployCanceled(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(canceled, check.Equals, true)
+}
+
+func (s *DeploySuite) TestCancelDeployHandlerNotRunning(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy/current", a.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrDeployNotRunning.Error()+"\n")
+}
+
+func (s *DeploySuite) TestDeployQueueHandler(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	first, err := app.EnqueueDeploy(a.Name, "someone", "POST /apps/otherapp/deploy")
+	c.Assert(err, check.IsNil)
+	second, err := app.EnqueueDeploy(a.Name, "other", "POST /apps/otherapp/deploy/rollback")
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/deploy/queue", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var queue []app.QueuedDeploy
+	err = json.Unmarshal(recorder.Body.Bytes(), &queue)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 2)
+	c.Assert(queue[0].ID, check.Equals, first.ID)
+	c.Assert(queue[0].Owner, check.Equals, "someone")
+	c.Assert(queue[0].Position, check.Equals, 1)
+	c.Assert(queue[1].ID, check.Equals, second.ID)
+	c.Assert(queue[1].Position, check.Equals, 2)
+}
+
+func (s *DeploySuite) TestDeployQueueHandlerEmpty(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy/queue", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *DeploySuite) TestRemoveQueuedDeployHandler(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	queued, err := app.EnqueueDeploy(a.Name, "someone", "POST /apps/otherapp/deploy")
+	c.Assert(err, check.IsNil)
+	locked, err := app.AcquireApplicationLock(a.Name, "someone", "POST /apps/otherapp/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	defer app.ReleaseApplicationLock(a.Name)
+	url := fmt.Sprintf("/apps/%s/deploy/queue/%s", a.Name, queued.ID.Hex())
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	queue, err := app.ListDeployQueue(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 0)
+}
+
+func (s *DeploySuite) TestRemoveQueuedDeployHandlerNotFound(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy/queue/%s", a.Name, bson.NewObjectId().Hex())
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrQueuedDeployNotFound.Error()+"\n")
+}
+
+func (s *DeploySuite) TestPromoteCanaryHandler(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = s.provisioner.StartCanary(&a, 10)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/canary/promote", a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(recorder.Body.String(), check.Equals, "{\"Message\":\"Canary promoted\"}\n")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
+
+func (s *DeploySuite) TestAbortCanaryHandler(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = s.provisioner.StartCanary(&a, 10)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/canary/abort", a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "{\"Message\":\"Canary aborted\"}\n")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// byteCounter counts the bytes written to or read from the wrapped stream.
+type byteCounter struct {
+	w io.Writer
+	r io.Reader
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func unitFilesError(err error) error {
+	if err == app.ErrUnitNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err == app.ErrUnitFilesNotSupported {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// logUnitFilesResult records the outcome of a copy of files from or to a
+// unit: the number of bytes copied, or the error.
+func logUnitFilesResult(user, action, appName, unitName, path string, size int64, err error) {
+	result := fmt.Sprintf("size=%d", size)
+	if err != nil {
+		result = "error=" + err.Error()
+	}
+	rec.Log(user, action+"-result", "app="+appName, "unit="+unitName, "path="+path, result)
+}
+
+func downloadUnitFilesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	unitName := r.URL.Query().Get(":unit")
+	path := r.URL.Query().Get("path")
+	rec.Log(u.Email, "download-unit-files", "app="+appName, "unit="+unitName, "path="+path)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	counter := byteCounter{w: w}
+	err = a.DownloadUnitFiles(unitName, path, &counter)
+	logUnitFilesResult(u.Email, "download-unit-files", appName, unitName, path, counter.n, err)
+	if err != nil {
+		return unitFilesError(err)
+	}
+	return nil
+}
+
+func uploadUnitFilesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":app")
+	unitName := r.URL.Query().Get(":unit")
+	path := r.URL.Query().Get("path")
+	rec.Log(u.Email, "upload-unit-files", "app="+appName, "unit="+unitName, "path="+path)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	counter := byteCounter{r: r.Body}
+	err = a.UploadUnitFiles(unitName, path, &counter)
+	logUnitFilesResult(u.Email, "upload-unit-files", appName, unitName, path, counter.n, err)
+	if err != nil {
+		return unitFilesError(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/rec/rectest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestUploadAndDownloadUnitFiles(c *check.C) {
+	a := app.App{Name: "someapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 1, "", nil)
+	c.Assert(err, check.IsNil)
+	unit := units[0].Name
+	url := fmt.Sprintf("/apps/%s/units/%s/files?:app=%s&:unit=%s&path=/tmp", a.Name, unit, a.Name, unit)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = uploadUnitFilesHandler(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(string(s.provisioner.UnitFiles(&a, unit, "/tmp")), check.Equals, "tar data")
+	action := rectest.Action{
+		Action: "upload-unit-files",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "unit=" + unit, "path=/tmp"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	action = rectest.Action{
+		Action: "upload-unit-files-result",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "unit=" + unit, "path=/tmp", "size=8"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = downloadUnitFilesHandler(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Body.String(), check.Equals, "tar data")
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-tar")
+	action = rectest.Action{
+		Action: "download-unit-files",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "unit=" + unit, "path=/tmp"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	action = rectest.Action{
+		Action: "download-unit-files-result",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "unit=" + unit, "path=/tmp", "size=8"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestDownloadUnitFilesUnitNotFound(c *check.C) {
+	a := app.App{Name: "someapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	url := fmt.Sprintf("/apps/%s/units/abc/files?:app=%s&:unit=abc&path=/tmp", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = downloadUnitFilesHandler(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+	c.Assert(e.Message, check.Equals, app.ErrUnitNotFound.Error())
+	action := rectest.Action{
+		Action: "download-unit-files",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "unit=abc", "path=/tmp"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	action = rectest.Action{
+		Action: "download-unit-files-result",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, "unit=abc", "path=/tmp", "error=" + app.ErrUnitNotFound.Error()},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestUploadUnitFilesRelativePath(c *check.C) {
+	a := app.App{Name: "someapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 1, "", nil)
+	c.Assert(err, check.IsNil)
+	unit := units[0].Name
+	url := fmt.Sprintf("/apps/%s/units/%s/files?:app=%s&:unit=%s&path=tmp", a.Name, unit, a.Name, unit)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = uploadUnitFilesHandler(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, "path must be absolute")
+}
+
+func (s *S) TestUnitFilesForbiddenWhenTheUserDoesNotHaveAccessToTheApp(c *check.C) {
+	a := app.App{Name: "someapp", Platform: "zend"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/units/abc/files?:app=%s&:unit=abc&path=/tmp", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = downloadUnitFilesHandler(recorder, request, s.token)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusForbidden)
+	request, err = http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	err = uploadUnitFilesHandler(recorder, request, s.token)
+	e, ok = err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusForbidden)
+}
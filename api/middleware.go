@@ -5,6 +5,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	stdLog "log"
 	"net/http"
@@ -107,8 +108,25 @@ func authTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.Handl
 	next(w, r)
 }
 
+// appLockMiddleware acquires the lock of the app before running handlers that
+// change it, failing with a conflict when the app is already locked. Queued
+// handlers wait for their turn in the deploy queue of the app instead.
 type appLockMiddleware struct {
 	excludedHandlers []http.Handler
+	queuedHandlers   []http.Handler
+}
+
+func handlerIn(handler http.Handler, handlers []http.Handler) bool {
+	if handler == nil {
+		return false
+	}
+	handlerPtr := reflect.ValueOf(handler).Pointer()
+	for _, h := range handlers {
+		if reflect.ValueOf(h).Pointer() == handlerPtr {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *appLockMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -117,14 +135,9 @@ func (m *appLockMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, ne
 		return
 	}
 	currentHandler := context.GetDelayedHandler(r)
-	if currentHandler != nil {
-		currentHandlerPtr := reflect.ValueOf(currentHandler).Pointer()
-		for _, h := range m.excludedHandlers {
-			if reflect.ValueOf(h).Pointer() == currentHandlerPtr {
-				next(w, r)
-				return
-			}
-		}
+	if handlerIn(currentHandler, m.excludedHandlers) {
+		next(w, r)
+		return
 	}
 	appName := r.URL.Query().Get(":app")
 	if appName == "" {
@@ -143,18 +156,18 @@ func (m *appLockMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, ne
 			owner = t.GetUserName()
 		}
 	}
-	ok, err := app.AcquireApplicationLock(appName, owner, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	reason := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+	if handlerIn(currentHandler, m.queuedHandlers) {
+		m.serveQueued(w, r, next, appName, owner, reason)
+		return
+	}
+	ok, err := app.AcquireApplicationLock(appName, owner, reason)
 	if err != nil {
 		context.AddRequestError(r, fmt.Errorf("Error trying to acquire application lock: %s", err))
 		return
 	}
 	if ok {
-		defer func() {
-			if !context.IsPreventUnlock(r) {
-				app.ReleaseApplicationLock(appName)
-			}
-		}()
-		next(w, r)
+		m.serveLocked(w, r, next, appName)
 		return
 	}
 	a, err := app.GetByName(appName)
@@ -177,6 +190,57 @@ func (m *appLockMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, ne
 	context.AddRequestError(r, httpErr)
 }
 
+// serveQueued enters the deploy queue of the app and waits for its turn to
+// acquire the lock, so requests don't fail while another deploy is running.
+// The position in the queue is streamed to the client while it waits, and
+// the request leaves the queue if the client disconnects.
+func (m *appLockMiddleware) serveQueued(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, appName, owner, reason string) {
+	queued, err := app.EnqueueDeploy(appName, owner, reason)
+	if err != nil {
+		if err == app.ErrAppNotFound {
+			context.AddRequestError(r, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()})
+		} else {
+			context.AddRequestError(r, fmt.Errorf("Error trying to enqueue deploy: %s", err))
+		}
+		return
+	}
+	var abort <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		abort = notifier.CloseNotify()
+	}
+	encoder := json.NewEncoder(w)
+	err = queued.Wait(func(position int) {
+		encoder.Encode(io.SimpleJsonMessage{Message: fmt.Sprintf("Waiting in the deploy queue of the app, position %d.\n", position)})
+	}, abort)
+	if err != nil {
+		if err == app.ErrQueuedDeployAborted {
+			return
+		}
+		if err == app.ErrDeployCanceled {
+			context.AddRequestError(r, &errors.HTTP{Code: http.StatusConflict, Message: "Queued deploy canceled."})
+		} else {
+			context.AddRequestError(r, fmt.Errorf("Error waiting in deploy queue: %s", err))
+		}
+		return
+	}
+	m.serveLocked(w, r, next, appName)
+}
+
+// serveLocked runs the handler holding the lock of the app, renewing it while
+// the handler runs so it doesn't expire, and releases it afterwards. Handlers
+// preventing the unlock hand the lock to operations finishing in background,
+// which renew and release it themselves.
+func (m *appLockMiddleware) serveLocked(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, appName string) {
+	stopRenewing := app.KeepApplicationLock(appName)
+	defer func() {
+		stopRenewing()
+		if !context.IsPreventUnlock(r) {
+			app.ReleaseApplicationLock(appName)
+		}
+	}()
+	next(w, r)
+}
+
 func runDelayedHandler(w http.ResponseWriter, r *http.Request) {
 	h := context.GetDelayedHandler(r)
 	if h != nil {
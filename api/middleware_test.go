@@ -409,6 +409,152 @@ func (s *S) TestAppLockMiddlewareDoesNothingForExcludedHandlers(c *check.C) {
 	c.Assert(log.called, check.Equals, true)
 }
 
+func (s *S) TestAppLockMiddlewareQueuedHandlerWaitsForLock(c *check.C) {
+	myApp := app.App{
+		Name: "my-app",
+	}
+	err := s.conn.Apps().Insert(myApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": myApp.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": myApp.Name})
+	locked, err := app.AcquireApplicationLock(myApp.Name, "someone", "/app/my-app/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/?:app=my-app", nil)
+	c.Assert(err, check.IsNil)
+	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	context.SetDelayedHandler(request, finalHandler)
+	m := &appLockMiddleware{
+		queuedHandlers: []http.Handler{finalHandler},
+	}
+	called := make(chan bool)
+	go m.ServeHTTP(recorder, request, func(w http.ResponseWriter, r *http.Request) {
+		a, err := app.GetByName(myApp.Name)
+		c.Check(err, check.IsNil)
+		c.Check(a.Lock.Locked, check.Equals, true)
+		called <- true
+	})
+	var queue []app.QueuedDeploy
+	for len(queue) == 0 {
+		queue, err = app.ListDeployQueue(myApp.Name)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(queue[0].Owner, check.Equals, "")
+	c.Assert(queue[0].Reason, check.Equals, "POST /")
+	app.ReleaseApplicationLock(myApp.Name)
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the queued handler")
+	}
+	queue, err = app.ListDeployQueue(myApp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 0)
+	c.Assert(recorder.Body.String(), check.Equals, `{"Message":"Waiting in the deploy queue of the app, position 1.\n"}`+"\n")
+}
+
+type closeNotifierRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func (r *closeNotifierRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
+func (s *S) TestAppLockMiddlewareQueuedHandlerClientDisconnects(c *check.C) {
+	myApp := app.App{
+		Name: "my-app",
+	}
+	err := s.conn.Apps().Insert(myApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": myApp.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": myApp.Name})
+	locked, err := app.AcquireApplicationLock(myApp.Name, "someone", "/app/my-app/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	recorder := &closeNotifierRecorder{ResponseRecorder: httptest.NewRecorder(), closed: make(chan bool)}
+	request, err := http.NewRequest("POST", "/?:app=my-app", nil)
+	c.Assert(err, check.IsNil)
+	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	context.SetDelayedHandler(request, finalHandler)
+	h, log := doHandler()
+	m := &appLockMiddleware{
+		queuedHandlers: []http.Handler{finalHandler},
+	}
+	done := make(chan bool)
+	go func() {
+		m.ServeHTTP(recorder, request, h)
+		close(done)
+	}()
+	var queue []app.QueuedDeploy
+	for len(queue) == 0 {
+		queue, err = app.ListDeployQueue(myApp.Name)
+		c.Assert(err, check.IsNil)
+	}
+	close(recorder.closed)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the queued handler")
+	}
+	c.Assert(log.called, check.Equals, false)
+	c.Assert(context.GetRequestError(request), check.IsNil)
+	queue, err = app.ListDeployQueue(myApp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 0)
+	a, err := app.GetByName(myApp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Lock.Owner, check.Equals, "someone")
+}
+
+func (s *S) TestAppLockMiddlewareQueuedHandlerCanceled(c *check.C) {
+	myApp := app.App{
+		Name: "my-app",
+	}
+	err := s.conn.Apps().Insert(myApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": myApp.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": myApp.Name})
+	locked, err := app.AcquireApplicationLock(myApp.Name, "someone", "/app/my-app/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/?:app=my-app", nil)
+	c.Assert(err, check.IsNil)
+	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	context.SetDelayedHandler(request, finalHandler)
+	h, log := doHandler()
+	m := &appLockMiddleware{
+		queuedHandlers: []http.Handler{finalHandler},
+	}
+	done := make(chan bool)
+	go func() {
+		m.ServeHTTP(recorder, request, h)
+		close(done)
+	}()
+	var queue []app.QueuedDeploy
+	for len(queue) == 0 {
+		queue, err = app.ListDeployQueue(myApp.Name)
+		c.Assert(err, check.IsNil)
+	}
+	err = app.RemoveQueuedDeploy(myApp.Name, queue[0].ID.Hex())
+	c.Assert(err, check.IsNil)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the queued handler")
+	}
+	c.Assert(log.called, check.Equals, false)
+	httpErr := context.GetRequestError(request).(*errors.HTTP)
+	c.Assert(httpErr.Code, check.Equals, http.StatusConflict)
+	c.Assert(httpErr.Message, check.Equals, "Queued deploy canceled.")
+	a, err := app.GetByName(myApp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Lock.Owner, check.Equals, "someone")
+}
+
 func (s *S) TestLoggerMiddleware(c *check.C) {
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest("PUT", "/my/path", nil)
@@ -119,9 +119,14 @@ func RunServer(dry bool) http.Handler {
 	m.Add("Get", "/apps/{app}/env", authorizationRequiredHandler(getEnv))
 	m.Add("Post", "/apps/{app}/env", authorizationRequiredHandler(setEnv))
 	m.Add("Delete", "/apps/{app}/env", authorizationRequiredHandler(unsetEnv))
+	m.Add("Get", "/apps/{appname}/volumes", authorizationRequiredHandler(listVolumeBinds))
+	m.Add("Post", "/apps/{appname}/volumes", authorizationRequiredHandler(bindVolume))
+	m.Add("Delete", "/apps/{appname}/volumes/{volume}", authorizationRequiredHandler(unbindVolume))
 	m.Add("Get", "/apps", authorizationRequiredHandler(appList))
 	m.Add("Post", "/apps", authorizationRequiredHandler(createApp))
 	m.Add("Post", "/apps/{app}/team-owner", authorizationRequiredHandler(setTeamOwner))
+	changeAppPoolHandler := AdminRequiredHandler(changeAppPool)
+	m.Add("Post", "/apps/{app}/pool", changeAppPoolHandler)
 	forceDeleteLockHandler := AdminRequiredHandler(forceDeleteLock)
 	m.Add("Delete", "/apps/{app}/lock", forceDeleteLockHandler)
 	m.Add("Put", "/apps/{app}/units", authorizationRequiredHandler(addUnits))
@@ -133,17 +138,34 @@ func RunServer(dry bool) http.Handler {
 	m.Add("Put", "/apps/{app}/teams/{team}", authorizationRequiredHandler(grantAppAccess))
 	m.Add("Delete", "/apps/{app}/teams/{team}", authorizationRequiredHandler(revokeAppAccess))
 	m.Add("Get", "/apps/{app}/log", authorizationRequiredHandler(appLog))
+	m.Add("Get", "/apps/{app}/metrics", authorizationRequiredHandler(appMetrics))
 	logPostHandler := authorizationRequiredHandler(addLog)
 	m.Add("Post", "/apps/{app}/log", logPostHandler)
 	saveCustomDataHandler := authorizationRequiredHandler(saveAppCustomData)
 	m.Add("Post", "/apps/{app}/customdata", saveCustomDataHandler)
-	m.Add("Post", "/apps/{appname}/deploy/rollback", authorizationRequiredHandler(deployRollback))
+	deployRollbackHandler := authorizationRequiredHandler(deployRollback)
+	m.Add("Post", "/apps/{appname}/deploy/rollback", deployRollbackHandler)
+	deployDockerfileHandler := authorizationRequiredHandler(deployDockerfile)
+	m.Add("Post", "/apps/{appname}/deploy/dockerfile", deployDockerfileHandler)
+	cancelDeployHandler := authorizationRequiredHandler(cancelDeploy)
+	m.Add("Delete", "/apps/{appname}/deploy/current", cancelDeployHandler)
+	m.Add("Get", "/apps/{appname}/deploy/queue", authorizationRequiredHandler(deployQueue))
+	removeQueuedDeployHandler := authorizationRequiredHandler(removeQueuedDeploy)
+	m.Add("Delete", "/apps/{appname}/deploy/queue/{id}", removeQueuedDeployHandler)
+	m.Add("Put", "/apps/{appname}/canary", authorizationRequiredHandler(setCanaryWeight))
+	m.Add("Post", "/apps/{appname}/canary/promote", authorizationRequiredHandler(promoteCanary))
+	m.Add("Post", "/apps/{appname}/canary/abort", authorizationRequiredHandler(abortCanary))
 	m.Add("Get", "/apps/{app}/shell", authorizationRequiredHandler(remoteShellHandler))
+	m.Add("Get", "/apps/{app}/units/{unit}/files", authorizationRequiredHandler(downloadUnitFilesHandler))
+	m.Add("Put", "/apps/{app}/units/{unit}/files", authorizationRequiredHandler(uploadUnitFilesHandler))
 
 	m.Add("Get", "/autoscale", authorizationRequiredHandler(autoScaleHistoryHandler))
 	m.Add("Put", "/autoscale/{app}", authorizationRequiredHandler(autoScaleConfig))
 	m.Add("Put", "/autoscale/{app}/enable", authorizationRequiredHandler(autoScaleEnable))
 	m.Add("Put", "/autoscale/{app}/disable", authorizationRequiredHandler(autoScaleDisable))
+	m.Add("Get", "/autoscale/{app}/schedules", authorizationRequiredHandler(autoScaleListSchedules))
+	m.Add("Post", "/autoscale/{app}/schedules", authorizationRequiredHandler(autoScaleAddSchedule))
+	m.Add("Delete", "/autoscale/{app}/schedules/{id}", authorizationRequiredHandler(autoScaleRemoveSchedule))
 
 	m.Add("Get", "/deploys", authorizationRequiredHandler(deploysList))
 	m.Add("Get", "/deploys/{deploy}", authorizationRequiredHandler(deployInfo))
@@ -157,8 +179,9 @@ func RunServer(dry bool) http.Handler {
 	// the token generate for the given app is valid, but these handlers
 	// use a token generated for Gandalf.
 	m.Add("Get", "/apps/{appname}/available", authorizationRequiredHandler(appIsAvailable))
-	m.Add("Post", "/apps/{appname}/repository/clone", authorizationRequiredHandler(deploy))
-	m.Add("Post", "/apps/{appname}/deploy", authorizationRequiredHandler(deploy))
+	deployHandler := authorizationRequiredHandler(deploy)
+	m.Add("Post", "/apps/{appname}/repository/clone", deployHandler)
+	m.Add("Post", "/apps/{appname}/deploy", deployHandler)
 
 	m.Add("Get", "/users", AdminRequiredHandler(listUsers))
 	m.Add("Post", "/users", Handler(createUser))
@@ -215,9 +238,16 @@ func RunServer(dry bool) http.Handler {
 		logPostHandler,
 		runHandler,
 		forceDeleteLockHandler,
+		cancelDeployHandler,
+		changeAppPoolHandler,
+		removeQueuedDeployHandler,
 		registerUnitHandler,
 		saveCustomDataHandler,
 		setUnitStatusHandler,
+	}, queuedHandlers: []http.Handler{
+		deployHandler,
+		deployRollbackHandler,
+		deployDockerfileHandler,
 	}})
 	n.UseHandler(http.HandlerFunc(runDelayedHandler))
 
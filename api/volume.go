@@ -0,0 +1,102 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/rec"
+	"github.com/tsuru/tsuru/volume"
+)
+
+type volumeBindParams struct {
+	Volume     string `json:"volume"`
+	MountPoint string `json:"mountpoint"`
+	ReadOnly   bool   `json:"readonly"`
+}
+
+func listVolumeBinds(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	a, err := getApp(r.URL.Query().Get(":appname"), u)
+	if err != nil {
+		return err
+	}
+	binds, err := volume.ListAppBinds(a.Name)
+	if err != nil {
+		return err
+	}
+	if binds == nil {
+		binds = []volume.AppBind{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(binds)
+}
+
+// bindVolume attaches a volume to the app. Units created after the bind, in
+// the next deploy or restart, mount the volume.
+func bindVolume(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	var params volumeBindParams
+	defer r.Body.Close()
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":appname")
+	rec.Log(u.Email, "bind-volume", "app="+appName, "volume="+params.Volume, "mountpoint="+params.MountPoint, "readonly="+strconv.FormatBool(params.ReadOnly))
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	err = a.BindVolume(params.Volume, params.MountPoint, params.ReadOnly)
+	switch e := err.(type) {
+	case nil:
+	case *errors.ValidationError:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	case *app.VolumeNotAllowedError:
+		return &errors.HTTP{Code: http.StatusForbidden, Message: e.Error()}
+	default:
+		switch err {
+		case volume.ErrVolumeNotFound:
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		case volume.ErrBindAlreadyExists:
+			return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+		}
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func unbindVolume(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	appName := r.URL.Query().Get(":appname")
+	volumeName := r.URL.Query().Get(":volume")
+	mountPoint := r.URL.Query().Get("mountpoint")
+	rec.Log(u.Email, "unbind-volume", "app="+appName, "volume="+volumeName, "mountpoint="+mountPoint)
+	a, err := getApp(appName, u)
+	if err != nil {
+		return err
+	}
+	err = volume.UnbindApp(volumeName, a.Name, mountPoint)
+	if err == volume.ErrVolumeNotFound || err == volume.ErrBindNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/volume"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestBindVolume(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", Teams: []string{s.team.Name}, Pool: "pool1"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	body := strings.NewReader(`{"volume": "data", "mountpoint": "/data", "readonly": true}`)
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []volume.AppBind{
+		{Volume: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1", MountPoint: "/data", ReadOnly: true},
+	})
+	request, err = http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), strings.NewReader(`{"volume": "data", "mountpoint": "/data"}`))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestBindVolumeInAnotherPool(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", Teams: []string{s.team.Name}, Pool: "pool2"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	body := strings.NewReader(`{"volume": "data", "mountpoint": "/data"}`)
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, `volume "data" is in pool "pool1", the app must be moved to this pool before binding it`+"\n")
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+}
+
+func (s *S) TestBindVolumePoolNotAllowed(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", Teams: []string{s.team.Name}, TeamOwner: s.team.Name, Pool: "pool1"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	s.provisioner.PrepareFailure("ValidateAppPool", fmt.Errorf("team is not allowed to use pool"))
+	body := strings.NewReader(`{"volume": "data", "mountpoint": "/data"}`)
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, `volume "data" cannot be bound to the app: team is not allowed to use pool`+"\n")
+}
+
+func (s *S) TestBindVolumeInvalidMountPoint(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"volume": "data", "mountpoint": "data"}`)
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, volume.ErrInvalidMountPoint.Message+"\n")
+}
+
+func (s *S) TestBindVolumeWithoutAccess(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"volume": "data", "mountpoint": "/data"}`)
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestListVolumeBinds(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	err = volume.BindApp("data", a.Name, "/data", false)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", fmt.Sprintf("/apps/%s/volumes", a.Name), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var binds []volume.AppBind
+	err = json.NewDecoder(recorder.Body).Decode(&binds)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []volume.AppBind{
+		{Volume: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1", MountPoint: "/data"},
+	})
+}
+
+func (s *S) TestUnbindVolume(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	err = volume.BindApp("data", a.Name, "/data", false)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", fmt.Sprintf("/apps/%s/volumes/data?mountpoint=/data", a.Name), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
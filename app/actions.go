@@ -311,8 +311,12 @@ var provisionAddUnits = action.Action{
 		if len(ctx.Params) >= 3 {
 			w, _ = ctx.Params[2].(io.Writer)
 		}
+		var process string
+		if len(ctx.Params) >= 4 {
+			process, _ = ctx.Params[3].(string)
+		}
 		n := ctx.Previous.(int)
-		units, err := Provisioner.AddUnits(app, uint(n), w)
+		units, err := Provisioner.AddUnits(app, uint(n), process, w)
 		if err != nil {
 			return nil, err
 		}
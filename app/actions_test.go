@@ -599,7 +599,7 @@ func (s *S) TestProvisionAddUnitsBackward(c *check.C) {
 	}
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	units, err := s.provisioner.AddUnits(&app, 3, nil)
+	units, err := s.provisioner.AddUnits(&app, 3, "", nil)
 	c.Assert(err, check.IsNil)
 	ctx := action.BWContext{Params: []interface{}{&app}, FWResult: units}
 	provisionAddUnits.Backward(ctx)
@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tsuru/config"
 	"github.com/tsuru/go-gandalfclient"
 	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/app/bind"
@@ -26,7 +27,9 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
+	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/volume"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -49,6 +52,9 @@ type AppLock struct {
 	Reason      string
 	Owner       string
 	AcquireDate time.Time
+	// ExpireDate is the date after which the lock may be acquired by
+	// others, unless it's renewed. Locks without it never expire.
+	ExpireDate time.Time `bson:",omitempty"`
 }
 
 func (l *AppLock) String() string {
@@ -73,6 +79,7 @@ type App struct {
 	CName           []string
 	Teams           []string
 	TeamOwner       string
+	Pool            string
 	Owner           string
 	State           string
 	Deploys         uint
@@ -104,8 +111,19 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["owner"] = app.Owner
 	result["deploys"] = app.Deploys
 	result["teamowner"] = app.TeamOwner
+	result["pool"] = app.Pool
 	result["plan"] = app.Plan
 	result["autoScaleConfig"] = app.AutoScaleConfig
+	volumeBinds, err := volume.ListAppBinds(app.Name)
+	if err != nil {
+		return nil, err
+	}
+	result["volumeBinds"] = volumeBinds
+	ports, err := router.AppPorts(app.Name)
+	if err != nil {
+		return nil, err
+	}
+	result["ports"] = ports
 	return json.Marshal(&result)
 }
 
@@ -127,20 +145,85 @@ func AcquireApplicationLock(appName string, owner string, reason string) (bool,
 		return false, err
 	}
 	defer conn.Close()
+	now := time.Now().In(time.UTC)
 	appLock := AppLock{
 		Locked:      true,
 		Reason:      reason,
 		Owner:       owner,
-		AcquireDate: time.Now().In(time.UTC),
+		AcquireDate: now,
 	}
-	err = conn.Apps().Update(bson.M{"name": appName, "lock.locked": bson.M{"$in": []interface{}{false, nil}}}, bson.M{"$set": bson.M{"lock": appLock}})
+	if ttl := LockTTL(); ttl > 0 {
+		appLock.ExpireDate = now.Add(ttl)
+	}
+	query := bson.M{"name": appName, "$or": []bson.M{
+		{"lock.locked": bson.M{"$in": []interface{}{false, nil}}},
+		{"lock.expiredate": bson.M{"$lt": now}},
+	}}
+	err = conn.Apps().Update(query, bson.M{"$set": bson.M{"lock": appLock}})
 	if err == mgo.ErrNotFound {
-		// TODO(cezarsa): Maybe handle lock expiring by checking timestamp
 		return false, nil
 	}
 	return err == nil, err
 }
 
+// LockTTL returns for how long application locks are held without being
+// renewed, defined by the "app-lock:ttl" setting in seconds. Locks don't
+// expire when the setting is missing, zero or negative.
+func LockTTL() time.Duration {
+	ttl, err := config.GetDuration("app-lock:ttl")
+	if err != nil || ttl <= 0 {
+		return 0
+	}
+	return ttl * time.Second
+}
+
+// RenewApplicationLock postpones the expiration of the lock held on the app,
+// it must be called periodically by operations holding the lock for longer
+// than its TTL.
+func RenewApplicationLock(appName string) error {
+	ttl := LockTTL()
+	if ttl == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	expireDate := time.Now().In(time.UTC).Add(ttl)
+	err = conn.Apps().Update(bson.M{"name": appName, "lock.locked": true}, bson.M{"$set": bson.M{"lock.expiredate": expireDate}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// KeepApplicationLock renews the lock held on the app in background, every
+// half of its TTL, until the returned function is called.
+func KeepApplicationLock(appName string) func() {
+	ttl := LockTTL()
+	if ttl == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := RenewApplicationLock(appName)
+				if err != nil {
+					log.Errorf("Error renewing lock of app %q: %s", appName, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
 // ReleaseApplicationLock releases a lock hold on an app, currently it's called
 // by a middleware, however, ideally, it should be called individually by each
 // handler since they might be doing operations in background.
@@ -210,6 +293,10 @@ func CreateApp(app *App, user *auth.User) error {
 	if err != nil {
 		return err
 	}
+	err = app.validatePool()
+	if err != nil {
+		return err
+	}
 	app.Teams = []string{app.TeamOwner}
 	app.Owner = user.Email
 	err = app.validate()
@@ -290,6 +377,8 @@ func Delete(app *App) error {
 	defer wg.Done()
 	go func() {
 		defer ReleaseApplicationLock(appName)
+		stopRenewing := KeepApplicationLock(appName)
+		defer stopRenewing()
 		wg.Wait()
 		conn, err := db.Conn()
 		if err != nil {
@@ -308,6 +397,10 @@ func Delete(app *App) error {
 		if err != nil {
 			log.Errorf("Error trying to mark old deploys as removed for app %s: %s", appName, err.Error())
 		}
+		err = volume.UnbindAllFromApp(appName)
+		if err != nil {
+			log.Errorf("Error trying to unbind volumes from app %s: %s", appName, err.Error())
+		}
 	}()
 	if serverURL, err := repository.ServerURL(); err == nil {
 		gandalfClient := gandalf.Client{Endpoint: serverURL}
@@ -373,39 +466,107 @@ func (app *App) serviceInstances() ([]service.ServiceInstance, error) {
 	return instances, nil
 }
 
-// AddUnits creates n new units within the provisioner, saves new units in the
-// database and enqueues the apprc serialization.
-func (app *App) AddUnits(n uint, writer io.Writer) error {
+// AddUnits creates n new units running the given process, or the default
+// process of the app when the process is empty, within the provisioner, saves
+// new units in the database and enqueues the apprc serialization.
+func (app *App) AddUnits(n uint, process string, writer io.Writer) error {
 	if n == 0 {
 		return stderr.New("Cannot add zero units.")
 	}
-	err := action.NewPipeline(
+	process, err := unitsDefaultProcess(app.Units(), process)
+	if err != nil {
+		return err
+	}
+	err = action.NewPipeline(
 		&reserveUnitsToAdd,
 		&provisionAddUnits,
-	).Execute(app, n, writer)
+	).Execute(app, n, writer, process)
 	return err
 }
 
-// RemoveUnits removes n units from the app. It's a process composed of
+// unitsDefaultProcess resolves an empty process name to the default process
+// of the app, as defined by provision.DefaultProcess, based on the processes
+// run by the given units of the app.
+func unitsDefaultProcess(units []provision.Unit, process string) (string, error) {
+	if process != "" {
+		return process, nil
+	}
+	var processes []string
+	seen := make(map[string]bool)
+	for _, u := range units {
+		if !seen[u.ProcessName] {
+			seen[u.ProcessName] = true
+			processes = append(processes, u.ProcessName)
+		}
+	}
+	return provision.DefaultProcess(processes)
+}
+
+func countProcessUnits(units []provision.Unit, process string) uint {
+	var count uint
+	for _, u := range units {
+		if u.ProcessName == process {
+			count++
+		}
+	}
+	return count
+}
+
+// routableProcess returns whether units running the given process receive
+// the requests of the app from the router.
+func routableProcess(process string) bool {
+	return process == "" || process == "web"
+}
+
+// defaultProcessUnits returns the number of units of the app running its
+// default process, which is the process scaled when no process is given.
+func (app *App) defaultProcessUnits() (uint, error) {
+	units := app.Units()
+	process, err := unitsDefaultProcess(units, "")
+	if err != nil {
+		return 0, err
+	}
+	return countProcessUnits(units, process), nil
+}
+
+// RemoveUnits removes n units running the given process from the app, or its
+// default process when the process is empty. Removing all units of the app,
+// or all units of the process that receives its requests, is not allowed.
+// It's a process composed of
 // multiple steps:
 //
 //     1. Remove units from the provisioner
 //     2. Remove units from the app list
 //     3. Update quota
-func (app *App) RemoveUnits(n uint) error {
+func (app *App) RemoveUnits(n uint, process string) error {
+	units := app.Units()
+	process, err := unitsDefaultProcess(units, process)
+	if err != nil {
+		ReleaseApplicationLock(app.Name)
+		return err
+	}
+	processUnits := countProcessUnits(units, process)
 	if n == 0 {
 		ReleaseApplicationLock(app.Name)
 		return stderr.New("Cannot remove zero units.")
-	} else if l := uint(len(app.Units())); l == n {
+	} else if n > processUnits && process == "" {
+		ReleaseApplicationLock(app.Name)
+		return fmt.Errorf("Cannot remove %d units from this app, it has only %d units.", n, processUnits)
+	} else if n > processUnits {
+		ReleaseApplicationLock(app.Name)
+		return fmt.Errorf("Cannot remove %d units from the process %q, it has only %d units.", n, process, processUnits)
+	} else if l := uint(len(units)); l == n {
 		ReleaseApplicationLock(app.Name)
 		return stderr.New("Cannot remove all units from an app.")
-	} else if n > l {
+	} else if n == processUnits && routableProcess(process) {
 		ReleaseApplicationLock(app.Name)
-		return fmt.Errorf("Cannot remove %d units from this app, it has only %d units.", n, l)
+		return fmt.Errorf("Cannot remove all units from the process %q, it receives the requests of the app.", process)
 	}
 	go func() {
 		defer ReleaseApplicationLock(app.Name)
-		Provisioner.RemoveUnits(app, n)
+		stopRenewing := KeepApplicationLock(app.Name)
+		defer stopRenewing()
+		Provisioner.RemoveUnits(app, n, process)
 		conn, err := db.Conn()
 		if err != nil {
 			log.Errorf("Error: %s", err)
@@ -540,6 +701,63 @@ func (app *App) ValidateTeamOwner(user *auth.User) error {
 	return stderr.New(errorMsg)
 }
 
+// validatePool checks whether the team owner of the app may use the pool
+// chosen for the app, choosing the default pool of the team when the app
+// doesn't have one.
+func (app *App) validatePool() error {
+	poolProvisioner, ok := Provisioner.(provision.PoolProvisioner)
+	if !ok {
+		if app.Pool != "" {
+			return &errors.ValidationError{Message: "The provisioner does not support pools."}
+		}
+		return nil
+	}
+	pool, err := poolProvisioner.ValidateAppPool(app.TeamOwner, app.Pool)
+	if err != nil {
+		return &errors.ValidationError{Message: err.Error()}
+	}
+	app.Pool = pool
+	return nil
+}
+
+// ChangePool moves the app to another pool, replacing its units with new
+// units in the nodes of the pool. An empty pool moves the app to the default
+// pool of its team owner, or back to the pools of the team when there's no
+// default pool.
+func (app *App) ChangePool(pool string, w io.Writer) error {
+	poolProvisioner, ok := Provisioner.(provision.PoolProvisioner)
+	if !ok {
+		return &errors.ValidationError{Message: "The provisioner does not support pools."}
+	}
+	pool, err := poolProvisioner.ValidateAppPool(app.TeamOwner, pool)
+	if err != nil {
+		return &errors.ValidationError{Message: err.Error()}
+	}
+	if pool == app.Pool {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	oldPool := app.Pool
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"pool": pool}})
+	if err != nil {
+		return err
+	}
+	app.Pool = pool
+	err = poolProvisioner.MoveUnitsToPool(app, pool, w)
+	if err != nil {
+		app.Pool = oldPool
+		if rollbackErr := conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"pool": oldPool}}); rollbackErr != nil {
+			log.Errorf("Failed to restore the pool of app %s: %s", app.Name, rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
 // setEnv sets the given environment variable in the app.
 func (app *App) setEnv(env bind.EnvVar) {
 	if app.Env == nil {
@@ -649,9 +867,11 @@ func (app *App) Restart(w io.Writer) error {
 	return nil
 }
 
-func (app *App) Stop(w io.Writer) error {
+// Stop stops the units of the app running the given process, or all the units
+// when the process is empty.
+func (app *App) Stop(w io.Writer, process string) error {
 	log.Write(w, []byte("\n ---> Stopping your app\n"))
-	err := Provisioner.Stop(app)
+	err := Provisioner.Stop(app, process)
 	if err != nil {
 		log.Errorf("[stop] error on stop the app %s - %s", app.Name, err)
 		return err
@@ -1112,10 +1332,10 @@ func Swap(app1, app2 *App) error {
 	return updateCName(app2)
 }
 
-// Start starts the app calling the provisioner.Start method and
-// changing the units state to StatusStarted.
-func (app *App) Start(w io.Writer) error {
-	err := Provisioner.Start(app)
+// Start starts the units of the app running the given process, or all the
+// units when the process is empty.
+func (app *App) Start(w io.Writer, process string) error {
+	err := Provisioner.Start(app, process)
 	if err != nil {
 		log.Errorf("[start] error on start the app %s - %s", app.Name, err)
 		return err
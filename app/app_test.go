@@ -25,8 +25,10 @@ import (
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/repository/repositorytest"
+	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/safe"
 	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/volume"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -86,6 +88,31 @@ func (s *S) TestDelete(c *check.C) {
 	c.Assert(count, check.Equals, 0)
 }
 
+func (s *S) TestDeleteUnbindsVolumes(c *check.C) {
+	h := testHandler{}
+	ts := repositorytest.StartGandalfTestServer(&h)
+	defer ts.Close()
+	a := App{
+		Name:     "ritual",
+		Platform: "python",
+	}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	err = volume.BindApp("data", a.Name, "/data", false)
+	c.Assert(err, check.IsNil)
+	app, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	err = Delete(app)
+	c.Assert(err, check.IsNil)
+	time.Sleep(200 * time.Millisecond)
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+}
+
 func (s *S) TestDeleteWithDeploys(c *check.C) {
 	h := testHandler{}
 	ts := repositorytest.StartGandalfTestServer(&h)
@@ -311,6 +338,68 @@ func (s *S) TestCreateAppTeamOwnerMoreTeamShouldReturnError(c *check.C) {
 	c.Assert(err, check.FitsTypeOf, ManyTeamsError{})
 }
 
+func (s *S) TestCreateAppWithPool(c *check.C) {
+	h := testHandler{}
+	ts := repositorytest.StartGandalfTestServer(&h)
+	defer ts.Close()
+	app := App{Name: "america", Platform: "python", Pool: "pool1"}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	defer Delete(&app)
+	retrievedApp, err := GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrievedApp.Pool, check.Equals, "pool1")
+}
+
+func (s *S) TestCreateAppWithInvalidPool(c *check.C) {
+	h := testHandler{}
+	ts := repositorytest.StartGandalfTestServer(&h)
+	defer ts.Close()
+	s.provisioner.PrepareFailure("ValidateAppPool", fmt.Errorf(`team "tsuruteam" is not allowed to use pool "pool1"`))
+	app := App{Name: "america", Platform: "python", Pool: "pool1"}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Message, check.Equals, `team "tsuruteam" is not allowed to use pool "pool1"`)
+	_, err = GetByName(app.Name)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestChangePool(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Pool: "pool1"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var buf bytes.Buffer
+	err = a.ChangePool("pool2", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Pool, check.Equals, "pool2")
+	c.Assert(s.provisioner.Pool(&a), check.Equals, "pool2")
+	retrievedApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrievedApp.Pool, check.Equals, "pool2")
+}
+
+func (s *S) TestChangePoolRestoresPoolOnFailure(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Pool: "pool1"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareFailure("MoveUnitsToPool", fmt.Errorf("no nodes in pool2"))
+	var buf bytes.Buffer
+	err = a.ChangePool("pool2", &buf)
+	c.Assert(err, check.ErrorMatches, "no nodes in pool2")
+	c.Assert(a.Pool, check.Equals, "pool1")
+	retrievedApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrievedApp.Pool, check.Equals, "pool1")
+}
+
 func (s *S) TestCreateAppTeamOwnerTeamNotFound(c *check.C) {
 	h := testHandler{}
 	ts := repositorytest.StartGandalfTestServer(&h)
@@ -513,10 +602,10 @@ func (s *S) TestAddUnits(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	err = app.AddUnits(5, nil)
+	err = app.AddUnits(5, "", nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(app.Units(), check.HasLen, 5)
-	err = app.AddUnits(2, nil)
+	err = app.AddUnits(2, "", nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(app.Units(), check.HasLen, 7)
 	for _, unit := range app.Units() {
@@ -524,6 +613,25 @@ func (s *S) TestAddUnits(c *check.C) {
 	}
 }
 
+func (s *S) TestAddUnitsWithProcess(c *check.C) {
+	app := App{
+		Name: "warpaint", Platform: "python",
+		Quota: quota.Unlimited,
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	err = app.AddUnits(2, "worker", nil)
+	c.Assert(err, check.IsNil)
+	units := app.Units()
+	c.Assert(units, check.HasLen, 2)
+	for _, unit := range units {
+		c.Assert(unit.ProcessName, check.Equals, "worker")
+	}
+}
+
 func (s *S) TestAddUnitsWithWriter(c *check.C) {
 	app := App{
 		Name: "warpaint", Platform: "python",
@@ -535,7 +643,7 @@ func (s *S) TestAddUnitsWithWriter(c *check.C) {
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
 	var buf bytes.Buffer
-	err = app.AddUnits(2, &buf)
+	err = app.AddUnits(2, "", &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(app.Units(), check.HasLen, 2)
 	for _, unit := range app.Units() {
@@ -555,11 +663,11 @@ func (s *S) TestAddUnitsQuota(c *check.C) {
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
 	otherApp := App{Name: "warpaint"}
-	err = otherApp.AddUnits(5, nil)
+	err = otherApp.AddUnits(5, "", nil)
 	c.Assert(err, check.IsNil)
 	units := s.provisioner.GetUnits(&app)
 	c.Assert(units, check.HasLen, 5)
-	err = otherApp.AddUnits(2, nil)
+	err = otherApp.AddUnits(2, "", nil)
 	c.Assert(err, check.IsNil)
 	units = s.provisioner.GetUnits(&app)
 	c.Assert(units, check.HasLen, 7)
@@ -572,7 +680,7 @@ func (s *S) TestAddUnitsQuotaExceeded(c *check.C) {
 	app := App{Name: "warpaint", Platform: "ruby"}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := app.AddUnits(1, nil)
+	err := app.AddUnits(1, "", nil)
 	e, ok := err.(*quota.QuotaExceededError)
 	c.Assert(ok, check.Equals, true)
 	c.Assert(e.Available, check.Equals, uint(0))
@@ -588,7 +696,7 @@ func (s *S) TestAddUnitsMultiple(c *check.C) {
 	}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := app.AddUnits(11, nil)
+	err := app.AddUnits(11, "", nil)
 	e, ok := err.(*quota.QuotaExceededError)
 	c.Assert(ok, check.Equals, true)
 	c.Assert(e.Available, check.Equals, uint(10))
@@ -597,7 +705,7 @@ func (s *S) TestAddUnitsMultiple(c *check.C) {
 
 func (s *S) TestAddZeroUnits(c *check.C) {
 	app := App{Name: "warpaint", Platform: "ruby"}
-	err := app.AddUnits(0, nil)
+	err := app.AddUnits(0, "", nil)
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "Cannot add zero units.")
 }
@@ -606,7 +714,7 @@ func (s *S) TestAddUnitsFailureInProvisioner(c *check.C) {
 	app := App{Name: "scars", Platform: "golang", Quota: quota.Unlimited}
 	s.conn.Apps().Insert(app)
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
-	err := app.AddUnits(2, nil)
+	err := app.AddUnits(2, "", nil)
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "App is not provisioned.")
 }
@@ -616,7 +724,7 @@ func (s *S) TestAddUnitsIsAtomic(c *check.C) {
 		Name: "warpaint", Platform: "golang",
 		Quota: quota.Unlimited,
 	}
-	err := app.AddUnits(2, nil)
+	err := app.AddUnits(2, "", nil)
 	c.Assert(err, check.NotNil)
 	_, err = GetByName(app.Name)
 	c.Assert(err, check.Equals, ErrAppNotFound)
@@ -632,9 +740,9 @@ func (s *S) TestRemoveUnitsWithQuota(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 5, nil)
+	s.provisioner.AddUnits(&a, 5, "", nil)
 	defer s.provisioner.Destroy(&a)
-	err = a.RemoveUnits(4)
+	err = a.RemoveUnits(4, "")
 	c.Assert(err, check.IsNil)
 	time.Sleep(1e9)
 	app, err := GetByName(a.Name)
@@ -671,8 +779,8 @@ func (s *S) TestRemoveUnits(c *check.C) {
 	c.Assert(err, check.IsNil)
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	app.AddUnits(4, nil)
-	err = app.RemoveUnits(2)
+	app.AddUnits(4, "", nil)
+	err = app.RemoveUnits(2, "")
 	c.Assert(err, check.IsNil)
 	time.Sleep(1e9)
 	ts.Close()
@@ -703,19 +811,111 @@ func (s *S) TestRemoveUnitsInvalidValues(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 3, nil)
+	s.provisioner.AddUnits(&app, 3, "", nil)
 	for _, test := range tests {
-		err := app.RemoveUnits(test.n)
+		err := app.RemoveUnits(test.n, "")
 		c.Check(err, check.NotNil)
 		c.Check(err.Error(), check.Equals, test.expected)
 	}
 }
 
+func (s *S) TestRemoveUnitsInvalidValuesWithProcess(c *check.C) {
+	app := App{
+		Name:     "chemistryii",
+		Platform: "python",
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddUnits(&app, 2, "web", nil)
+	s.provisioner.AddUnits(&app, 1, "worker", nil)
+	err = app.RemoveUnits(2, "worker")
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `Cannot remove 2 units from the process "worker", it has only 1 units.`)
+}
+
+func (s *S) TestRemoveUnitsAllRoutableProcessUnits(c *check.C) {
+	app := App{Name: "chemistryii", Platform: "python"}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddUnits(&app, 2, "web", nil)
+	s.provisioner.AddUnits(&app, 1, "worker", nil)
+	err = app.RemoveUnits(2, "web")
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `Cannot remove all units from the process "web", it receives the requests of the app.`)
+	err = app.RemoveUnits(1, "worker")
+	c.Assert(err, check.IsNil)
+	time.Sleep(1e9)
+	count := map[string]int{}
+	for _, unit := range app.Units() {
+		count[unit.ProcessName]++
+	}
+	c.Assert(count, check.DeepEquals, map[string]int{"web": 2})
+}
+
+func (s *S) TestRemoveUnitsDefaultProcess(c *check.C) {
+	app := App{Name: "chemistryii", Platform: "python"}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddUnits(&app, 2, "web", nil)
+	s.provisioner.AddUnits(&app, 1, "worker", nil)
+	err = app.RemoveUnits(1, "")
+	c.Assert(err, check.IsNil)
+	time.Sleep(1e9)
+	count := map[string]int{}
+	for _, unit := range app.Units() {
+		count[unit.ProcessName]++
+	}
+	c.Assert(count, check.DeepEquals, map[string]int{"web": 1, "worker": 1})
+	err = app.RemoveUnits(2, "")
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `Cannot remove 2 units from the process "web", it has only 1 units.`)
+}
+
+func (s *S) TestRemoveUnitsProcessRequired(c *check.C) {
+	app := App{Name: "chemistryii", Platform: "python"}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddUnits(&app, 2, "worker", nil)
+	s.provisioner.AddUnits(&app, 1, "clock", nil)
+	err = app.RemoveUnits(1, "")
+	c.Assert(err, check.Equals, provision.ErrProcessRequired)
+}
+
+func (s *S) TestAddUnitsDefaultProcess(c *check.C) {
+	app := App{Name: "chemistryii", Platform: "python", Quota: quota.Unlimited}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddUnits(&app, 1, "web", nil)
+	s.provisioner.AddUnits(&app, 1, "worker", nil)
+	err = app.AddUnits(2, "", nil)
+	c.Assert(err, check.IsNil)
+	count := map[string]int{}
+	for _, unit := range app.Units() {
+		count[unit.ProcessName]++
+	}
+	c.Assert(count, check.DeepEquals, map[string]int{"web": 3, "worker": 1})
+}
+
 func (s *S) TestSetUnitStatus(c *check.C) {
 	a := App{Name: "appName", Platform: "python"}
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3, nil)
+	s.provisioner.AddUnits(&a, 3, "", nil)
 	units := a.Units()
 	err := a.SetUnitStatus(units[0].Name, provision.StatusError)
 	c.Assert(err, check.IsNil)
@@ -727,7 +927,7 @@ func (s *S) TestSetUnitStatusPartialID(c *check.C) {
 	a := App{Name: "appName", Platform: "python"}
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3, nil)
+	s.provisioner.AddUnits(&a, 3, "", nil)
 	units := a.Units()
 	name := units[0].Name
 	err := a.SetUnitStatus(name[0:len(name)-2], provision.StatusError)
@@ -984,7 +1184,7 @@ func (s *S) TestUnsetEnvRespectsThePublicOnlyFlagKeepPrivateVariablesWhenItsTrue
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
-	err = a.AddUnits(1, nil)
+	err = a.AddUnits(1, "", nil)
 	c.Assert(err, check.IsNil)
 	err = a.UnsetEnvs([]string{"DATABASE_HOST", "DATABASE_PASSWORD"}, true, nil)
 	c.Assert(err, check.IsNil)
@@ -1026,7 +1226,7 @@ func (s *S) TestUnsetEnvRespectsThePublicOnlyFlagUnsettingAllVariablesWhenItsFal
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
-	err = a.AddUnits(1, nil)
+	err = a.AddUnits(1, "", nil)
 	c.Assert(err, check.IsNil)
 	err = a.UnsetEnvs([]string{"DATABASE_HOST", "DATABASE_PASSWORD"}, false, nil)
 	c.Assert(err, check.IsNil)
@@ -1364,7 +1564,7 @@ func (s *S) TestAddInstanceWithUnits(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	s.provisioner.Provision(a)
 	defer s.provisioner.Destroy(a)
-	err = a.AddUnits(1, nil)
+	err = a.AddUnits(1, "", nil)
 	c.Assert(err, check.IsNil)
 	instance := bind.ServiceInstance{
 		Name: "myinstance",
@@ -1653,7 +1853,7 @@ func (s *S) TestRemoveInstanceWithUnits(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	s.provisioner.Provision(a)
 	defer s.provisioner.Destroy(a)
-	err = a.AddUnits(1, nil)
+	err = a.AddUnits(1, "", nil)
 	c.Assert(err, check.IsNil)
 	instance := bind.ServiceInstance{Name: "mydb", Envs: map[string]string{"DATABASE_NAME": "mydb"}}
 	err = a.RemoveInstance("mysql", instance, nil)
@@ -1735,7 +1935,7 @@ func (s *S) TestStop(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	var buf bytes.Buffer
-	err = a.Stop(&buf)
+	err = a.Stop(&buf, "")
 	c.Assert(err, check.IsNil)
 	err = s.conn.Apps().Find(bson.M{"name": a.GetName()}).One(&a)
 	c.Assert(err, check.IsNil)
@@ -1925,7 +2125,7 @@ func (s *S) TestGetUnits(c *check.C) {
 	app := App{Name: "app"}
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 1, nil)
+	s.provisioner.AddUnits(&app, 1, "", nil)
 	c.Assert(app.GetUnits(), check.HasLen, 1)
 	c.Assert(app.Units()[0].Ip, check.Equals, app.GetUnits()[0].GetIp())
 }
@@ -2010,6 +2210,7 @@ func (s *S) TestAppMarshalJSONReady(c *check.C) {
 		Owner:     "appOwner",
 		Deploys:   7,
 		TeamOwner: "myteam",
+		Pool:      "pool1",
 		Plan:      Plan{Name: "myplan", Memory: 64, Swap: 128, CpuShare: 100},
 	}
 	expected := make(map[string]interface{})
@@ -2023,7 +2224,10 @@ func (s *S) TestAppMarshalJSONReady(c *check.C) {
 	expected["owner"] = "appOwner"
 	expected["deploys"] = float64(7)
 	expected["teamowner"] = "myteam"
+	expected["pool"] = "pool1"
 	expected["autoScaleConfig"] = nil
+	expected["volumeBinds"] = nil
+	expected["ports"] = nil
 	expected["plan"] = map[string]interface{}{"name": "myplan", "memory": float64(64), "swap": float64(128), "cpushare": float64(100)}
 	expected["ready"] = true
 	data, err := app.MarshalJSON()
@@ -2034,6 +2238,25 @@ func (s *S) TestAppMarshalJSONReady(c *check.C) {
 	c.Assert(result, check.DeepEquals, expected)
 }
 
+func (s *S) TestAppMarshalJSONWithPorts(c *check.C) {
+	config.Set("tcp-ports:min", 30000)
+	config.Set("tcp-ports:max", 30010)
+	defer config.Unset("tcp-ports:min")
+	defer config.Unset("tcp-ports:max")
+	_, err := router.AllocatePort("name", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	defer router.ReleaseAppPorts("name")
+	app := App{Name: "name"}
+	data, err := app.MarshalJSON()
+	c.Assert(err, check.IsNil)
+	var result map[string]interface{}
+	err = json.Unmarshal(data, &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["ports"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"ExternalPort": float64(30000), "App": "name", "Port": float64(5432), "Protocol": "tcp"},
+	})
+}
+
 func (s *S) TestRun(c *check.C) {
 	s.provisioner.PrepareOutput([]byte("a lot of files"))
 	app := App{
@@ -2041,7 +2264,7 @@ func (s *S) TestRun(c *check.C) {
 	}
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 1, nil)
+	s.provisioner.AddUnits(&app, 1, "", nil)
 	var buf bytes.Buffer
 	err := app.Run("ls -lh", &buf, false)
 	c.Assert(err, check.IsNil)
@@ -2060,7 +2283,7 @@ func (s *S) TestRunOnce(c *check.C) {
 	}
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 1, nil)
+	s.provisioner.AddUnits(&app, 1, "", nil)
 	var buf bytes.Buffer
 	err := app.Run("ls -lh", &buf, true)
 	c.Assert(err, check.IsNil)
@@ -2079,7 +2302,7 @@ func (s *S) TestRunWithoutEnv(c *check.C) {
 	}
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 1, nil)
+	s.provisioner.AddUnits(&app, 1, "", nil)
 	var buf bytes.Buffer
 	err := app.run("ls -lh", &buf, false)
 	c.Assert(err, check.IsNil)
@@ -2247,7 +2470,7 @@ func (s *S) TestAppUnits(c *check.C) {
 	a := App{Name: "anycolor"}
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	c.Assert(a.Units(), check.HasLen, 1)
 }
 
@@ -2257,9 +2480,9 @@ func (s *S) TestAppAvailable(c *check.C) {
 	}
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	c.Assert(a.Available(), check.Equals, true)
-	s.provisioner.Stop(&a)
+	s.provisioner.Stop(&a, "")
 	c.Assert(a.Available(), check.Equals, false)
 }
 
@@ -2306,7 +2529,7 @@ func (s *S) TestStart(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	var b bytes.Buffer
-	err = a.Start(&b)
+	err = a.Start(&b, "")
 	c.Assert(err, check.IsNil)
 	starts := s.provisioner.Starts(&a)
 	c.Assert(starts, check.Equals, 1)
@@ -2375,6 +2598,117 @@ func (s *S) TestAppAcquireApplicationLockAlreadyLocked(c *check.C) {
 	c.Assert(app.Lock.AcquireDate, check.NotNil)
 }
 
+func (s *S) TestAppAcquireApplicationLockSetsExpireDate(c *check.C) {
+	config.Set("app-lock:ttl", 60)
+	defer config.Unset("app-lock:ttl")
+	a := App{
+		Name: "someApp",
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	locked, err := AcquireApplicationLock(a.Name, "foo", "/something")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	app, err := GetByName("someApp")
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Lock.ExpireDate.Sub(app.Lock.AcquireDate), check.Equals, time.Minute)
+}
+
+func (s *S) TestAppAcquireApplicationLockExpired(c *check.C) {
+	a := App{
+		Name: "someApp",
+		Lock: AppLock{
+			Locked:      true,
+			Reason:      "/app/my-app/deploy",
+			Owner:       "someone",
+			AcquireDate: time.Now().Add(-time.Hour),
+			ExpireDate:  time.Now().Add(-time.Minute),
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	locked, err := AcquireApplicationLock(a.Name, "foo", "/something")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	app, err := GetByName("someApp")
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Lock.Locked, check.Equals, true)
+	c.Assert(app.Lock.Owner, check.Equals, "foo")
+	c.Assert(app.Lock.Reason, check.Equals, "/something")
+}
+
+func (s *S) TestLockTTL(c *check.C) {
+	c.Assert(LockTTL(), check.Equals, time.Duration(0))
+	config.Set("app-lock:ttl", 30)
+	defer config.Unset("app-lock:ttl")
+	c.Assert(LockTTL(), check.Equals, 30*time.Second)
+	config.Set("app-lock:ttl", 0)
+	c.Assert(LockTTL(), check.Equals, time.Duration(0))
+}
+
+func (s *S) TestRenewApplicationLock(c *check.C) {
+	config.Set("app-lock:ttl", 300)
+	defer config.Unset("app-lock:ttl")
+	expireDate := time.Now().Add(time.Second).In(time.UTC)
+	a := App{
+		Name: "someApp",
+		Lock: AppLock{
+			Locked:      true,
+			Reason:      "/app/my-app/deploy",
+			Owner:       "someone",
+			AcquireDate: time.Now(),
+			ExpireDate:  expireDate,
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = RenewApplicationLock(a.Name)
+	c.Assert(err, check.IsNil)
+	app, err := GetByName("someApp")
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Lock.ExpireDate.After(expireDate.Add(4*time.Minute)), check.Equals, true)
+	c.Assert(app.Lock.Owner, check.Equals, "someone")
+}
+
+func (s *S) TestKeepApplicationLock(c *check.C) {
+	config.Set("app-lock:ttl", 1)
+	defer config.Unset("app-lock:ttl")
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	locked, err := AcquireApplicationLock(a.Name, "someone", "/app/my-app/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	stop := KeepApplicationLock(a.Name)
+	time.Sleep(1500 * time.Millisecond)
+	stop()
+	locked, err = AcquireApplicationLock(a.Name, "other", "/app/my-app/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, false)
+	app, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Lock.Owner, check.Equals, "someone")
+}
+
+func (s *S) TestRenewApplicationLockNotLocked(c *check.C) {
+	a := App{
+		Name: "someApp",
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = RenewApplicationLock(a.Name)
+	c.Assert(err, check.IsNil)
+	app, err := GetByName("someApp")
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Lock.Locked, check.Equals, false)
+	c.Assert(app.Lock.ExpireDate.IsZero(), check.Equals, true)
+}
+
 func (s *S) TestAppLockStringUnlocked(c *check.C) {
 	lock := AppLock{Locked: false}
 	c.Assert(lock.String(), check.Equals, "Not locked")
@@ -2394,7 +2728,7 @@ func (s *S) TestAppRegisterUnit(c *check.C) {
 	a := App{Name: "appName", Platform: "python"}
 	s.provisioner.Provision(&a)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3, nil)
+	s.provisioner.AddUnits(&a, 3, "", nil)
 	units := a.Units()
 	var ips []string
 	for _, u := range units {
@@ -2537,7 +2871,7 @@ func (s *S) TestShellToAnApp(c *check.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, check.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 1, nil)
+	s.provisioner.AddUnits(&a, 1, "", nil)
 	buf := safe.NewBuffer([]byte("echo teste"))
 	conn := &provisiontest.FakeConn{buf}
 	err = a.Shell(conn, 10, 10)
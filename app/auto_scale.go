@@ -89,25 +89,39 @@ func expressionIsValid(expression string) bool {
 	return expressionRegex.MatchString(expression)
 }
 
+// expressionPart returns the nth submatch of the expression, or an empty
+// string for actions without a valid expression, like in configs using only
+// scheduled scaling.
+func (action *Action) expressionPart(n int) string {
+	parts := expressionRegex.FindStringSubmatch(action.Expression)
+	if parts == nil {
+		return ""
+	}
+	return parts[n]
+}
+
 func (action *Action) metric() string {
-	return expressionRegex.FindStringSubmatch(action.Expression)[1]
+	return action.expressionPart(1)
 }
 
 func (action *Action) operator() string {
-	return expressionRegex.FindStringSubmatch(action.Expression)[2]
+	return action.expressionPart(2)
 }
 
 func (action *Action) value() (float64, error) {
-	return strconv.ParseFloat(expressionRegex.FindStringSubmatch(action.Expression)[3], 64)
+	return strconv.ParseFloat(action.expressionPart(3), 64)
 }
 
-// AutoScaleConfig represents the App configuration for the auto scale.
+// AutoScaleConfig represents the App configuration for the auto scale. While
+// one of the Schedules is active, it sets the number of units of the app and
+// the Increase and Decrease actions are not evaluated.
 type AutoScaleConfig struct {
-	Increase Action `json:"increase"`
-	Decrease Action `json:"decrease"`
-	MinUnits uint   `json:"minUnits"`
-	MaxUnits uint   `json:"maxUnits"`
-	Enabled  bool   `json:"enabled"`
+	Increase  Action         `json:"increase"`
+	Decrease  Action         `json:"decrease"`
+	MinUnits  uint           `json:"minUnits"`
+	MaxUnits  uint           `json:"maxUnits"`
+	Enabled   bool           `json:"enabled"`
+	Schedules []ScheduleRule `json:"schedules,omitempty" bson:",omitempty"`
 }
 
 func autoScalableApps() ([]App, error) {
@@ -148,10 +162,16 @@ func scaleApplicationIfNeeded(app *App) error {
 	if app.AutoScaleConfig == nil {
 		return errors.New("AutoScale is not configured.")
 	}
+	if rule := app.AutoScaleConfig.activeSchedule(time.Now()); rule != nil {
+		return scaleApplicationToSchedule(app, rule)
+	}
 	increaseMetric, _ := app.Metric(app.AutoScaleConfig.Increase.metric())
 	value, _ := app.AutoScaleConfig.Increase.value()
 	if increaseMetric > value {
-		currentUnits := uint(len(app.Units()))
+		currentUnits, err := app.defaultProcessUnits()
+		if err != nil {
+			return err
+		}
 		maxUnits := app.AutoScaleConfig.MaxUnits
 		if maxUnits == 0 {
 			maxUnits = 1
@@ -164,10 +184,14 @@ func scaleApplicationIfNeeded(app *App) error {
 		} else if wait {
 			return nil
 		}
-		_, err := AcquireApplicationLock(app.Name, InternalAppName, "auto-scale")
+		locked, err := AcquireApplicationLock(app.Name, InternalAppName, "auto-scale")
 		if err != nil {
 			return err
 		}
+		if !locked {
+			log.Debugf("[auto scale] Skipping app %q, it's locked by another operation.", app.Name)
+			return nil
+		}
 		defer ReleaseApplicationLock(app.Name)
 		evt, err := NewAutoScaleEvent(app, "increase")
 		if err != nil {
@@ -177,7 +201,7 @@ func scaleApplicationIfNeeded(app *App) error {
 		if currentUnits+inc > app.AutoScaleConfig.MaxUnits {
 			inc = app.AutoScaleConfig.MaxUnits - currentUnits
 		}
-		addUnitsErr := app.AddUnits(inc, nil)
+		addUnitsErr := app.AddUnits(inc, "", nil)
 		err = evt.update(addUnitsErr)
 		if err != nil {
 			log.Errorf("Error trying to update auto scale event: %s", err.Error())
@@ -187,7 +211,10 @@ func scaleApplicationIfNeeded(app *App) error {
 	decreaseMetric, _ := app.Metric(app.AutoScaleConfig.Decrease.metric())
 	value, _ = app.AutoScaleConfig.Decrease.value()
 	if decreaseMetric < value {
-		currentUnits := uint(len(app.Units()))
+		currentUnits, err := app.defaultProcessUnits()
+		if err != nil {
+			return err
+		}
 		minUnits := app.AutoScaleConfig.MinUnits
 		if minUnits == 0 {
 			minUnits = 1
@@ -200,10 +227,14 @@ func scaleApplicationIfNeeded(app *App) error {
 		} else if wait {
 			return nil
 		}
-		_, err := AcquireApplicationLock(app.Name, InternalAppName, "auto-scale")
+		locked, err := AcquireApplicationLock(app.Name, InternalAppName, "auto-scale")
 		if err != nil {
 			return err
 		}
+		if !locked {
+			log.Debugf("[auto scale] Skipping app %q, it's locked by another operation.", app.Name)
+			return nil
+		}
 		defer ReleaseApplicationLock(app.Name)
 		evt, err := NewAutoScaleEvent(app, "decrease")
 		if err != nil {
@@ -213,7 +244,7 @@ func scaleApplicationIfNeeded(app *App) error {
 		if currentUnits-dec < app.AutoScaleConfig.MinUnits {
 			dec = currentUnits - app.AutoScaleConfig.MinUnits
 		}
-		removeUnitsErr := app.RemoveUnits(dec)
+		removeUnitsErr := app.RemoveUnits(dec, "")
 		err = evt.update(removeUnitsErr)
 		if err != nil {
 			log.Errorf("Error trying to update auto scale event: %s", err.Error())
@@ -0,0 +1,271 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrInvalidSchedule  = &tsuruErrors.ValidationError{Message: "schedule must have five fields: minute, hour, day of month, month and day of week"}
+)
+
+func invalidSchedule(format string, args ...interface{}) error {
+	return &tsuruErrors.ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ScheduleRule sets the number of units of an app while its schedule is
+// active. Schedule is a cron-style expression, with the minute, hour, day of
+// month, month and day of week fields, and the rule is active in every minute
+// matching it. For example, "* 8-19 * * 1-5" is active on weekdays from 08:00
+// to 20:00. Timezone is the name of the location used to evaluate the
+// schedule, defaulting to UTC.
+type ScheduleRule struct {
+	ID       string `json:"id"`
+	Schedule string `json:"schedule"`
+	Units    uint   `json:"units"`
+	Timezone string `json:"timezone,omitempty" bson:",omitempty"`
+}
+
+func (rule *ScheduleRule) validate() error {
+	if rule.Units == 0 {
+		return invalidSchedule("schedule units must be greater than zero")
+	}
+	_, err := parseCronSchedule(rule.Schedule)
+	if err != nil {
+		return err
+	}
+	_, err = time.LoadLocation(rule.Timezone)
+	if err != nil {
+		return invalidSchedule("invalid timezone %q", rule.Timezone)
+	}
+	return nil
+}
+
+func (rule *ScheduleRule) active(t time.Time) bool {
+	schedule, err := parseCronSchedule(rule.Schedule)
+	if err != nil {
+		return false
+	}
+	location, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		return false
+	}
+	return schedule.matches(t.In(location))
+}
+
+// activeSchedule returns the first rule of the config active at the given
+// time, or nil if none of them is active.
+func (config *AutoScaleConfig) activeSchedule(t time.Time) *ScheduleRule {
+	for i := range config.Schedules {
+		if config.Schedules[i].active(t) {
+			return &config.Schedules[i]
+		}
+	}
+	return nil
+}
+
+// cronSchedule holds the values matched by each field of a cron expression.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	anyDay, anyWeekday                     bool
+}
+
+var cronFieldBounds = [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFieldBounds) {
+		return nil, ErrInvalidSchedule
+	}
+	values := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		var err error
+		values[i], err = parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if values[4][7] {
+		values[4][0] = true
+	}
+	return &cronSchedule{
+		minutes:    values[0],
+		hours:      values[1],
+		days:       values[2],
+		months:     values[3],
+		weekdays:   values[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges ("1-5"),
+// wildcards ("*") and steps ("*/15", "8-18/2").
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		idx := strings.Index(part, "/")
+		if idx >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[idx+1:])
+			if err != nil || step <= 0 {
+				return nil, invalidSchedule("invalid step in schedule field %q", field)
+			}
+			part = part[:idx]
+		}
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, invalidSchedule("invalid schedule field %q", field)
+			}
+			end = start
+			if idx >= 0 {
+				end = max
+			}
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, invalidSchedule("invalid schedule field %q", field)
+				}
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, invalidSchedule("schedule field %q out of range %d-%d", field, min, max)
+		}
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// matches returns whether the schedule is active in the minute of t. As in
+// cron, when both the day of month and the day of week are restricted, the
+// schedule matches days matching any of them.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+	dayMatches := s.days[t.Day()]
+	weekdayMatches := s.weekdays[int(t.Weekday())]
+	if s.anyDay || s.anyWeekday {
+		return dayMatches && weekdayMatches
+	}
+	return dayMatches || weekdayMatches
+}
+
+// scheduledUnits returns the number of units set by the rule, limited by the
+// minimum and maximum units of the config.
+func (config *AutoScaleConfig) scheduledUnits(rule *ScheduleRule) uint {
+	units := rule.Units
+	if config.MinUnits > 0 && units < config.MinUnits {
+		units = config.MinUnits
+	}
+	if config.MaxUnits > 0 && units > config.MaxUnits {
+		units = config.MaxUnits
+	}
+	return units
+}
+
+func scaleApplicationToSchedule(app *App, rule *ScheduleRule) error {
+	currentUnits, err := app.defaultProcessUnits()
+	if err != nil {
+		return err
+	}
+	units := app.AutoScaleConfig.scheduledUnits(rule)
+	if currentUnits == units {
+		return nil
+	}
+	lastEvent, err := lastScaleEvent(app.Name)
+	if err == nil && lastEvent.EndTime.IsZero() {
+		return nil
+	}
+	locked, err := AcquireApplicationLock(app.Name, InternalAppName, "auto-scale")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		log.Debugf("[auto scale] Skipping schedule of app %q, it's locked by another operation.", app.Name)
+		return nil
+	}
+	defer ReleaseApplicationLock(app.Name)
+	evt, err := NewAutoScaleEvent(app, "schedule")
+	if err != nil {
+		return fmt.Errorf("Error trying to insert auto scale event, auto scale aborted: %s", err.Error())
+	}
+	var scaleErr error
+	if units > currentUnits {
+		scaleErr = app.AddUnits(units-currentUnits, "", nil)
+	} else {
+		scaleErr = app.RemoveUnits(currentUnits-units, "")
+	}
+	err = evt.update(scaleErr)
+	if err != nil {
+		log.Errorf("Error trying to update auto scale event: %s", err.Error())
+	}
+	return scaleErr
+}
+
+// AddAutoScaleSchedule validates the rule and appends it to the schedules of
+// the app, returning it with its generated ID.
+func AddAutoScaleSchedule(app *App, rule ScheduleRule) (*ScheduleRule, error) {
+	err := rule.validate()
+	if err != nil {
+		return nil, err
+	}
+	rule.ID = bson.NewObjectId().Hex()
+	if app.AutoScaleConfig == nil {
+		app.AutoScaleConfig = &AutoScaleConfig{}
+	}
+	app.AutoScaleConfig.Schedules = append(app.AutoScaleConfig.Schedules, rule)
+	err = saveAutoScaleConfig(app)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// RemoveAutoScaleSchedule removes the rule with the given ID from the
+// schedules of the app.
+func RemoveAutoScaleSchedule(app *App, id string) error {
+	if app.AutoScaleConfig == nil {
+		return ErrScheduleNotFound
+	}
+	schedules := app.AutoScaleConfig.Schedules
+	for i := range schedules {
+		if schedules[i].ID == id {
+			app.AutoScaleConfig.Schedules = append(schedules[:i], schedules[i+1:]...)
+			return saveAutoScaleConfig(app)
+		}
+	}
+	return ErrScheduleNotFound
+}
+
+func saveAutoScaleConfig(app *App) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"autoscaleconfig": app.AutoScaleConfig}},
+	)
+}
@@ -0,0 +1,232 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestParseCronSchedule(c *check.C) {
+	schedule, err := parseCronSchedule("*/15 8-19 * * 1-5")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedule.minutes, check.DeepEquals, map[int]bool{0: true, 15: true, 30: true, 45: true})
+	c.Assert(schedule.hours, check.HasLen, 12)
+	c.Assert(schedule.days, check.HasLen, 31)
+	c.Assert(schedule.months, check.HasLen, 12)
+	c.Assert(schedule.weekdays, check.DeepEquals, map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true})
+	schedule, err = parseCronSchedule("5/20 0,12 1 1 7")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedule.minutes, check.DeepEquals, map[int]bool{5: true, 25: true, 45: true})
+	c.Assert(schedule.hours, check.DeepEquals, map[int]bool{0: true, 12: true})
+	c.Assert(schedule.weekdays, check.DeepEquals, map[int]bool{0: true, 7: true})
+}
+
+func (s *S) TestParseCronScheduleInvalid(c *check.C) {
+	var tests = []struct {
+		expression string
+		message    string
+	}{
+		{"* * * *", ErrInvalidSchedule.Message},
+		{"60 * * * *", `schedule field "60" out of range 0-59`},
+		{"* 20-8 * * *", `schedule field "20-8" out of range 0-23`},
+		{"* * * * mon", `invalid schedule field "mon"`},
+		{"*/0 * * * *", `invalid step in schedule field "*/0"`},
+	}
+	for _, t := range tests {
+		_, err := parseCronSchedule(t.expression)
+		c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+		c.Check(err.Error(), check.Equals, t.message)
+	}
+}
+
+func (s *S) TestScheduleRuleActive(c *check.C) {
+	rule := ScheduleRule{Schedule: "* 8-19 * * 1-5", Units: 10}
+	monday := time.Date(2015, time.June, 1, 8, 0, 0, 0, time.UTC)
+	c.Assert(rule.active(monday), check.Equals, true)
+	c.Assert(rule.active(monday.Add(-time.Minute)), check.Equals, false)
+	c.Assert(rule.active(monday.Add(12*time.Hour)), check.Equals, false)
+	c.Assert(rule.active(monday.Add(-24*time.Hour)), check.Equals, false)
+	rule.Timezone = "America/Sao_Paulo"
+	c.Assert(rule.active(monday), check.Equals, false)
+	c.Assert(rule.active(monday.Add(3*time.Hour)), check.Equals, true)
+}
+
+func (s *S) TestScheduleRuleActiveDayOfMonthOrWeek(c *check.C) {
+	rule := ScheduleRule{Schedule: "* * 1 * 0", Units: 10}
+	c.Assert(rule.active(time.Date(2015, time.June, 1, 0, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Assert(rule.active(time.Date(2015, time.June, 7, 0, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Assert(rule.active(time.Date(2015, time.June, 2, 0, 0, 0, 0, time.UTC)), check.Equals, false)
+}
+
+func (s *S) TestActiveSchedule(c *check.C) {
+	config := AutoScaleConfig{
+		Schedules: []ScheduleRule{
+			{ID: "weekdays", Schedule: "* 8-19 * * 1-5", Units: 10},
+			{ID: "otherwise", Schedule: "* * * * *", Units: 2},
+		},
+	}
+	monday := time.Date(2015, time.June, 1, 10, 0, 0, 0, time.UTC)
+	c.Assert(config.activeSchedule(monday).ID, check.Equals, "weekdays")
+	c.Assert(config.activeSchedule(monday.Add(12*time.Hour)).ID, check.Equals, "otherwise")
+	config.Schedules = config.Schedules[:1]
+	c.Assert(config.activeSchedule(monday.Add(12*time.Hour)), check.IsNil)
+}
+
+func (s *S) TestScheduledUnits(c *check.C) {
+	config := AutoScaleConfig{MinUnits: 2, MaxUnits: 8}
+	c.Assert(config.scheduledUnits(&ScheduleRule{Units: 1}), check.Equals, uint(2))
+	c.Assert(config.scheduledUnits(&ScheduleRule{Units: 5}), check.Equals, uint(5))
+	c.Assert(config.scheduledUnits(&ScheduleRule{Units: 10}), check.Equals, uint(8))
+}
+
+func (s *S) TestAutoScaleSchedule(c *check.C) {
+	newApp := App{
+		Name:     "myApp",
+		Platform: "Django",
+		Quota:    quota.Unlimited,
+		AutoScaleConfig: &AutoScaleConfig{
+			Increase: Action{Units: 1, Expression: "{cpu_max} > 80"},
+			Enabled:  true,
+			MaxUnits: 3,
+			Schedules: []ScheduleRule{
+				{ID: "always", Schedule: "* * * * *", Units: 5},
+			},
+		},
+	}
+	err := s.conn.Apps().Insert(newApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
+	s.provisioner.Provision(&newApp)
+	defer s.provisioner.Destroy(&newApp)
+	s.provisioner.AddUnits(&newApp, 1, "", nil)
+	err = scaleApplicationIfNeeded(&newApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Units(), check.HasLen, 3)
+	var events []AutoScaleEvent
+	err = s.conn.AutoScale().Find(nil).All(&events)
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Type, check.Equals, "schedule")
+	c.Assert(events[0].AppName, check.Equals, newApp.Name)
+	c.Assert(events[0].Successful, check.Equals, true)
+	c.Assert(events[0].AutoScaleConfig, check.DeepEquals, newApp.AutoScaleConfig)
+	err = scaleApplicationIfNeeded(&newApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Units(), check.HasLen, 3)
+	err = s.conn.AutoScale().Find(nil).All(&events)
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 1)
+}
+
+func (s *S) TestAutoScaleScheduleDecrease(c *check.C) {
+	newApp := App{
+		Name:     "myApp",
+		Platform: "Django",
+		Quota:    quota.Unlimited,
+		AutoScaleConfig: &AutoScaleConfig{
+			Enabled: true,
+			Schedules: []ScheduleRule{
+				{ID: "always", Schedule: "* * * * *", Units: 1},
+			},
+		},
+	}
+	err := s.conn.Apps().Insert(newApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
+	s.provisioner.Provision(&newApp)
+	defer s.provisioner.Destroy(&newApp)
+	s.provisioner.AddUnits(&newApp, 3, "", nil)
+	err = scaleApplicationIfNeeded(&newApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Units(), check.HasLen, 1)
+	var events []AutoScaleEvent
+	err = s.conn.AutoScale().Find(nil).All(&events)
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Type, check.Equals, "schedule")
+}
+
+func (s *S) TestAutoScaleScheduleAppLocked(c *check.C) {
+	newApp := App{
+		Name:     "myApp",
+		Platform: "Django",
+		Quota:    quota.Unlimited,
+		AutoScaleConfig: &AutoScaleConfig{
+			Enabled: true,
+			Schedules: []ScheduleRule{
+				{ID: "always", Schedule: "* * * * *", Units: 3},
+			},
+		},
+	}
+	err := s.conn.Apps().Insert(newApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
+	s.provisioner.Provision(&newApp)
+	defer s.provisioner.Destroy(&newApp)
+	s.provisioner.AddUnits(&newApp, 1, "", nil)
+	locked, err := AcquireApplicationLock(newApp.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = scaleApplicationIfNeeded(&newApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Units(), check.HasLen, 1)
+	count, err := s.conn.AutoScale().Find(nil).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 0)
+	dbApp, err := GetByName(newApp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, true)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "someone")
+}
+
+func (s *S) TestAddAutoScaleSchedule(c *check.C) {
+	a := App{Name: "myApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	rule, err := AddAutoScaleSchedule(&a, ScheduleRule{Schedule: "* 8-19 * * 1-5", Units: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.ID, check.Not(check.Equals), "")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScaleConfig.Schedules, check.DeepEquals, []ScheduleRule{*rule})
+	c.Assert(dbApp.AutoScaleConfig.Enabled, check.Equals, false)
+}
+
+func (s *S) TestAddAutoScaleScheduleInvalid(c *check.C) {
+	a := App{Name: "myApp"}
+	_, err := AddAutoScaleSchedule(&a, ScheduleRule{Schedule: "* * * * *"})
+	c.Assert(err, check.ErrorMatches, "schedule units must be greater than zero")
+	_, err = AddAutoScaleSchedule(&a, ScheduleRule{Schedule: "* * * * *", Units: 1, Timezone: "Nowhere/Land"})
+	c.Assert(err, check.ErrorMatches, `invalid timezone "Nowhere/Land"`)
+	_, err = AddAutoScaleSchedule(&a, ScheduleRule{Schedule: "weekdays", Units: 1})
+	c.Assert(err, check.Equals, ErrInvalidSchedule)
+	c.Assert(a.AutoScaleConfig, check.IsNil)
+}
+
+func (s *S) TestRemoveAutoScaleSchedule(c *check.C) {
+	a := App{Name: "myApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = RemoveAutoScaleSchedule(&a, "unknown")
+	c.Assert(err, check.Equals, ErrScheduleNotFound)
+	first, err := AddAutoScaleSchedule(&a, ScheduleRule{Schedule: "* 8-19 * * 1-5", Units: 10})
+	c.Assert(err, check.IsNil)
+	second, err := AddAutoScaleSchedule(&a, ScheduleRule{Schedule: "* * * * *", Units: 2})
+	c.Assert(err, check.IsNil)
+	err = RemoveAutoScaleSchedule(&a, first.ID)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScaleConfig.Schedules, check.DeepEquals, []ScheduleRule{*second})
+	err = RemoveAutoScaleSchedule(&a, first.ID)
+	c.Assert(err, check.Equals, ErrScheduleNotFound)
+}
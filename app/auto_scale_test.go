@@ -79,6 +79,42 @@ func (s *S) TestAutoScaleUp(c *check.C) {
 	c.Assert(events[0].AutoScaleConfig, check.DeepEquals, newApp.AutoScaleConfig)
 }
 
+func (s *S) TestAutoScaleUpAppLocked(c *check.C) {
+	h := metricHandler{cpuMax: "90.2"}
+	ts := httptest.NewServer(&h)
+	config.Set("metrics:db", "graphite")
+	config.Set("graphite:host", ts.URL)
+	defer ts.Close()
+	newApp := App{
+		Name:     "myApp",
+		Platform: "Django",
+		Quota:    quota.Unlimited,
+		AutoScaleConfig: &AutoScaleConfig{
+			Increase: Action{Units: 1, Expression: "{cpu_max} > 80"},
+			Enabled:  true,
+			MaxUnits: uint(10),
+		},
+	}
+	err := s.conn.Apps().Insert(newApp)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
+	s.provisioner.Provision(&newApp)
+	defer s.provisioner.Destroy(&newApp)
+	locked, err := AcquireApplicationLock(newApp.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = scaleApplicationIfNeeded(&newApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Units(), check.HasLen, 0)
+	count, err := s.conn.AutoScale().Find(nil).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 0)
+	dbApp, err := GetByName(newApp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, true)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "someone")
+}
+
 func (s *S) TestAutoScaleDown(c *check.C) {
 	h := metricHandler{cpuMax: "10.2"}
 	ts := httptest.NewServer(&h)
@@ -100,7 +136,7 @@ func (s *S) TestAutoScaleDown(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
 	s.provisioner.Provision(&newApp)
 	defer s.provisioner.Destroy(&newApp)
-	s.provisioner.AddUnits(&newApp, 2, nil)
+	s.provisioner.AddUnits(&newApp, 2, "", nil)
 	err = scaleApplicationIfNeeded(&newApp)
 	c.Assert(err, check.IsNil)
 	c.Assert(newApp.Units(), check.HasLen, 1)
@@ -176,7 +212,7 @@ func (s *S) TestRunAutoScaleOnce(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": down.Name})
 	s.provisioner.Provision(&down)
 	defer s.provisioner.Destroy(&down)
-	s.provisioner.AddUnits(&down, 3, nil)
+	s.provisioner.AddUnits(&down, 3, "", nil)
 	runAutoScaleOnce()
 	c.Assert(up.Units(), check.HasLen, 1)
 	c.Assert(down.Units(), check.HasLen, 2)
@@ -554,7 +590,7 @@ func (s *S) TestAutoScaleMinUnits(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
 	s.provisioner.Provision(&newApp)
 	defer s.provisioner.Destroy(&newApp)
-	s.provisioner.AddUnits(&newApp, 5, nil)
+	s.provisioner.AddUnits(&newApp, 5, "", nil)
 	err = scaleApplicationIfNeeded(&newApp)
 	c.Assert(err, check.IsNil)
 	c.Assert(newApp.Units(), check.HasLen, 3)
@@ -624,7 +660,7 @@ func (s *S) TestAutoScaleDownMin(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
 	s.provisioner.Provision(&newApp)
 	defer s.provisioner.Destroy(&newApp)
-	s.provisioner.AddUnits(&newApp, 1, nil)
+	s.provisioner.AddUnits(&newApp, 1, "", nil)
 	err = scaleApplicationIfNeeded(&newApp)
 	c.Assert(err, check.IsNil)
 	c.Assert(newApp.Units(), check.HasLen, 1)
@@ -655,7 +691,7 @@ func (s *S) TestAutoScaleUpMax(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": newApp.Name})
 	s.provisioner.Provision(&newApp)
 	defer s.provisioner.Destroy(&newApp)
-	s.provisioner.AddUnits(&newApp, 2, nil)
+	s.provisioner.AddUnits(&newApp, 2, "", nil)
 	err = scaleApplicationIfNeeded(&newApp)
 	c.Assert(err, check.IsNil)
 	c.Assert(newApp.Units(), check.HasLen, 2)
@@ -0,0 +1,104 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"io"
+
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var (
+	ErrCanaryNotSupported  = errors.New("the provisioner does not support canary deploys")
+	ErrInvalidCanaryWeight = errors.New("canary weight must be between 1 and 99")
+)
+
+func canaryDeployer() (provision.CanaryDeployer, error) {
+	deployer, ok := Provisioner.(provision.CanaryDeployer)
+	if !ok {
+		return nil, ErrCanaryNotSupported
+	}
+	return deployer, nil
+}
+
+func validateCanaryWeight(weight int) error {
+	if weight < 1 || weight > 99 {
+		return ErrInvalidCanaryWeight
+	}
+	return nil
+}
+
+// canaryDeploy deploys the app as a canary, aborting the canary when the
+// deploy fails.
+func canaryDeploy(opts *DeployOptions, writer io.Writer) (string, error) {
+	deployer, err := canaryDeployer()
+	if err != nil {
+		return "", err
+	}
+	err = validateCanaryWeight(opts.CanaryWeight)
+	if err != nil {
+		return "", err
+	}
+	err = deployer.StartCanary(opts.App, opts.CanaryWeight)
+	if err != nil {
+		return "", err
+	}
+	plainOpts := *opts
+	plainOpts.CanaryWeight = 0
+	imageId, err := deployToProvisioner(&plainOpts, writer)
+	if err != nil {
+		abortErr := deployer.AbortCanary(opts.App, writer)
+		if abortErr != nil {
+			log.Errorf("[deploy] error aborting canary of the app %s - %s", opts.App.Name, abortErr)
+		}
+		return "", err
+	}
+	return imageId, nil
+}
+
+// SetCanaryWeight changes the percentage of the traffic sent to the units of
+// the ongoing canary deploy of the app.
+func (app *App) SetCanaryWeight(weight int) error {
+	deployer, err := canaryDeployer()
+	if err != nil {
+		return err
+	}
+	err = validateCanaryWeight(weight)
+	if err != nil {
+		return err
+	}
+	return deployer.SetCanaryWeight(app, weight)
+}
+
+// PromoteCanary replaces all units of the app with units running the version
+// of the ongoing canary deploy.
+func (app *App) PromoteCanary(w io.Writer) error {
+	deployer, err := canaryDeployer()
+	if err != nil {
+		return err
+	}
+	err = deployer.PromoteCanary(app, w)
+	if err != nil {
+		log.Errorf("[canary] error on promote canary of the app %s - %s", app.Name, err)
+		return err
+	}
+	return nil
+}
+
+// AbortCanary removes the units of the ongoing canary deploy of the app.
+func (app *App) AbortCanary(w io.Writer) error {
+	deployer, err := canaryDeployer()
+	if err != nil {
+		return err
+	}
+	err = deployer.AbortCanary(app, w)
+	if err != nil {
+		log.Errorf("[canary] error on abort canary of the app %s - %s", app.Name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestDeployAppCanary(c *check.C) {
+	a := App{
+		Name:     "someApp",
+		Platform: "django",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: writer,
+		CanaryWeight: 10,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(writer.String(), check.Equals, "Git deploy called")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 10)
+}
+
+func (s *S) TestDeployAppCanaryInvalidWeight(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: &bytes.Buffer{},
+		CanaryWeight: 100,
+	})
+	c.Assert(err, check.Equals, ErrInvalidCanaryWeight)
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
+
+func (s *S) TestDeployAppCanaryAbortsOnFailure(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareFailure("GitDeploy", errors.New("deploy failed"))
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: writer,
+		CanaryWeight: 10,
+	})
+	c.Assert(err, check.ErrorMatches, "deploy failed")
+	c.Assert(writer.String(), check.Equals, "Canary aborted")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
+
+func (s *S) TestSetCanaryWeight(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err := s.provisioner.StartCanary(&a, 10)
+	c.Assert(err, check.IsNil)
+	err = a.SetCanaryWeight(50)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 50)
+	err = a.SetCanaryWeight(0)
+	c.Assert(err, check.Equals, ErrInvalidCanaryWeight)
+}
+
+func (s *S) TestPromoteCanary(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err := s.provisioner.StartCanary(&a, 10)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.PromoteCanary(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Canary promoted")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
+
+func (s *S) TestAbortCanary(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err := s.provisioner.StartCanary(&a, 10)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.AbortCanary(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Canary aborted")
+	c.Assert(s.provisioner.CanaryWeight(&a), check.Equals, 0)
+}
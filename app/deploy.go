@@ -12,15 +12,24 @@ import (
 	"time"
 
 	"github.com/tsuru/go-gandalfclient"
+	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/service"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+var (
+	ErrRollingDeployNotSupported    = errors.New("the provisioner does not support rolling deploys")
+	ErrDockerfileDeployNotSupported = errors.New("the provisioner does not support Dockerfile deploys")
+	ErrDeployNotRunning             = errors.New("there is no deploy running for the app")
+	ErrDeployCanceled               = errors.New("deploy canceled")
+)
+
 type DeployData struct {
 	ID          bson.ObjectId `bson:"_id,omitempty"`
 	App         string
@@ -32,6 +41,7 @@ type DeployData struct {
 	Log         string
 	User        string
 	Origin      string
+	Canceled    bool
 	CanRollback bool
 	RemoveDate  time.Time `bson:",omitempty"`
 }
@@ -42,9 +52,15 @@ type DeployOptions struct {
 	Commit       string
 	ArchiveURL   string
 	File         io.ReadCloser
+	Dockerfile   bool
 	OutputStream io.Writer
 	User         string
 	Image        string
+	CanaryWeight int
+	Rolling      provision.TsuruYamlDeploy
+	// Origin overrides the origin recorded in the deploy data, which is
+	// otherwise inferred from the other options.
+	Origin string
 }
 
 func (app *App) ListDeploys(u *auth.User) ([]DeployData, error) {
@@ -208,7 +224,15 @@ func Deploy(opts DeployOptions) error {
 	start := time.Now()
 	logWriter := LogWriter{App: opts.App, Writer: opts.OutputStream}
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	err := registerRunningDeploy(opts.App.Name)
+	if err != nil {
+		return err
+	}
+	defer unregisterRunningDeploy(opts.App.Name)
 	imageId, err := deployToProvisioner(&opts, writer)
+	if err == action.ErrCanceled {
+		err = ErrDeployCanceled
+	}
 	elapsed := time.Since(start)
 	saveErr := saveDeployData(&opts, imageId, outBuffer.String(), elapsed, err)
 	if saveErr != nil {
@@ -228,22 +252,64 @@ func Deploy(opts DeployOptions) error {
 }
 
 func deployToProvisioner(opts *DeployOptions, writer io.Writer) (string, error) {
+	if opts.CanaryWeight > 0 {
+		return canaryDeploy(opts, writer)
+	}
+	app, err := deployApp(opts)
+	if err != nil {
+		return "", err
+	}
 	if opts.Image != "" {
 		if deployer, ok := Provisioner.(provision.ImageDeployer); ok {
-			return deployer.ImageDeploy(opts.App, opts.Image, writer)
+			return deployer.ImageDeploy(app, opts.Image, writer)
+		}
+	}
+	if opts.File != nil && opts.Dockerfile {
+		deployer, ok := Provisioner.(provision.DockerfileDeployer)
+		if !ok {
+			return "", ErrDockerfileDeployNotSupported
 		}
+		return deployer.DockerfileDeploy(app, opts.File, writer)
 	}
 	if opts.File != nil {
 		if deployer, ok := Provisioner.(provision.UploadDeployer); ok {
-			return deployer.UploadDeploy(opts.App, opts.File, writer)
+			return deployer.UploadDeploy(app, opts.File, writer)
 		}
 	}
 	if opts.ArchiveURL != "" {
 		if deployer, ok := Provisioner.(provision.ArchiveDeployer); ok {
-			return deployer.ArchiveDeploy(opts.App, opts.ArchiveURL, writer)
+			return deployer.ArchiveDeploy(app, opts.ArchiveURL, writer)
 		}
 	}
-	return Provisioner.(provision.GitDeployer).GitDeploy(opts.App, opts.Version, writer)
+	return Provisioner.(provision.GitDeployer).GitDeploy(app, opts.Version, writer)
+}
+
+// rollingDeployApp is the app given to the provisioner in a rolling deploy,
+// carrying the settings of the deploy.
+type rollingDeployApp struct {
+	*App
+	settings provision.TsuruYamlDeploy
+}
+
+func (a *rollingDeployApp) RollingDeploy() provision.TsuruYamlDeploy {
+	return a.settings
+}
+
+// deployApp returns the app given to the provisioner in the deploy, which
+// carries the rolling deploy settings of the deploy, if any.
+func deployApp(opts *DeployOptions) (provision.App, error) {
+	if !opts.Rolling.Rolling() {
+		return opts.App, nil
+	}
+	deployer, ok := Provisioner.(provision.RollingDeployer)
+	if !ok {
+		return nil, ErrRollingDeployNotSupported
+	}
+	err := deployer.ValidateRollingDeploy(opts.Rolling)
+	if err != nil {
+		return nil, err
+	}
+	return &rollingDeployApp{App: opts.App, settings: opts.Rolling}, nil
 }
 
 func saveDeployData(opts *DeployOptions, imageId, log string, duration time.Duration, deployError error) error {
@@ -261,19 +327,86 @@ func saveDeployData(opts *DeployOptions, imageId, log string, duration time.Dura
 		Log:       log,
 		User:      opts.User,
 	}
-	if opts.Commit != "" {
+	if opts.Origin != "" {
+		deploy.Origin = opts.Origin
+	} else if opts.Commit != "" {
 		deploy.Origin = "git"
 	} else if opts.Image != "" {
 		deploy.Origin = "rollback"
+	} else if opts.Dockerfile {
+		deploy.Origin = "dockerfile"
 	} else {
 		deploy.Origin = "app-deploy"
 	}
 	if deployError != nil {
 		deploy.Error = deployError.Error()
+		deploy.Canceled = deployError == ErrDeployCanceled
 	}
 	return conn.Deploys().Insert(deploy)
 }
 
+// registerRunningDeploy records that a deploy of the app is in progress, so it
+// can be canceled.
+func registerRunningDeploy(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.RunningDeploys().UpsertId(appName, bson.M{"_id": appName, "canceled": false})
+	return err
+}
+
+func unregisterRunningDeploy(appName string) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[deploy] error getting DB, couldn't unregister the deploy of %s: %s", appName, err)
+		return
+	}
+	defer conn.Close()
+	err = conn.RunningDeploys().RemoveId(appName)
+	if err != nil {
+		log.Errorf("[deploy] couldn't unregister the deploy of %s: %s", appName, err)
+	}
+}
+
+// CancelDeploy signals the deploy in progress of the app to stop. The
+// provisioner stops the deploy at the next action boundary, rolling back what
+// has already been done, and the deploy is recorded as canceled.
+func CancelDeploy(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.RunningDeploys().UpdateId(appName, bson.M{"$set": bson.M{"canceled": true}})
+	if err == mgo.ErrNotFound {
+		return ErrDeployNotRunning
+	}
+	return err
+}
+
+// IsDeployCanceled returns whether the deploy in progress of the app has been
+// canceled.
+func IsDeployCanceled(appName string) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var running struct {
+		Canceled bool
+	}
+	err = conn.RunningDeploys().FindId(appName).One(&running)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return running.Canceled, nil
+}
+
 func incrementDeploy(app *App) error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -0,0 +1,182 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrQueuedDeployNotFound = errors.New("queued deploy not found")
+	ErrQueuedDeployAborted  = errors.New("queued deploy aborted")
+)
+
+var (
+	// queuePollInterval is the interval between each check of queued
+	// deploys for their turn to acquire the lock of the app.
+	queuePollInterval = time.Second
+
+	// queueHeartbeatTimeout is for how long a queued deploy remains in the
+	// queue without a heartbeat, which happens when the API process
+	// waiting for it dies.
+	queueHeartbeatTimeout = time.Minute
+)
+
+// QueuedDeploy is a deploy waiting for the lock of its app. Deploys of an
+// app acquire the lock in the order they were queued.
+type QueuedDeploy struct {
+	ID        bson.ObjectId `bson:"_id"`
+	App       string
+	Owner     string
+	Reason    string
+	Timestamp time.Time
+	Heartbeat time.Time `json:"-"`
+	Position  int       `bson:"-"`
+}
+
+// EnqueueDeploy adds a deploy of the app to the end of its queue.
+func EnqueueDeploy(appName, owner, reason string) (*QueuedDeploy, error) {
+	if _, err := GetByName(appName); err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	now := time.Now().In(time.UTC)
+	queued := QueuedDeploy{
+		ID:        bson.NewObjectId(),
+		App:       appName,
+		Owner:     owner,
+		Reason:    reason,
+		Timestamp: now,
+		Heartbeat: now,
+	}
+	err = conn.DeployQueue().Insert(queued)
+	if err != nil {
+		return nil, err
+	}
+	return &queued, nil
+}
+
+// ListDeployQueue returns the deploys waiting for the lock of the app, with
+// their positions in the queue.
+func ListDeployQueue(appName string) ([]QueuedDeploy, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{
+		"app":       appName,
+		"heartbeat": bson.M{"$gte": time.Now().In(time.UTC).Add(-queueHeartbeatTimeout)},
+	}
+	var queue []QueuedDeploy
+	err = conn.DeployQueue().Find(query).Sort("timestamp", "_id").All(&queue)
+	if err != nil {
+		return nil, err
+	}
+	for i := range queue {
+		queue[i].Position = i + 1
+	}
+	return queue, nil
+}
+
+// RemoveQueuedDeploy removes a deploy from the queue of the app. The request
+// waiting for it fails with ErrDeployCanceled.
+func RemoveQueuedDeploy(appName, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrQueuedDeployNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.DeployQueue().Remove(bson.M{"_id": bson.ObjectIdHex(id), "app": appName})
+	if err == mgo.ErrNotFound {
+		return ErrQueuedDeployNotFound
+	}
+	return err
+}
+
+// Wait blocks until the deploy is the first in the queue of its app and
+// acquires the lock of the app, leaving the queue. While waiting, progress
+// is called with the position of the deploy in the queue whenever it
+// changes. It returns ErrDeployCanceled if the deploy is removed from the
+// queue while waiting, and ErrQueuedDeployAborted, leaving the queue, if
+// abort is closed or receives a value. Both progress and abort may be nil.
+func (q *QueuedDeploy) Wait(progress func(position int), abort <-chan bool) error {
+	var lastPosition int
+	for {
+		err := q.heartbeat()
+		if err != nil {
+			return err
+		}
+		queue, err := ListDeployQueue(q.App)
+		if err != nil {
+			return err
+		}
+		var position int
+		for _, queued := range queue {
+			if queued.ID == q.ID {
+				position = queued.Position
+				break
+			}
+		}
+		if position == 1 {
+			locked, err := AcquireApplicationLock(q.App, q.Owner, q.Reason)
+			if err != nil {
+				return err
+			}
+			if locked {
+				return q.leave()
+			}
+		}
+		if position != lastPosition && position > 0 && progress != nil {
+			progress(position)
+		}
+		lastPosition = position
+		select {
+		case <-abort:
+			q.leave()
+			return ErrQueuedDeployAborted
+		case <-time.After(queuePollInterval):
+		}
+	}
+}
+
+func (q *QueuedDeploy) heartbeat() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	q.Heartbeat = time.Now().In(time.UTC)
+	err = conn.DeployQueue().UpdateId(q.ID, bson.M{"$set": bson.M{"heartbeat": q.Heartbeat}})
+	if err == mgo.ErrNotFound {
+		return ErrDeployCanceled
+	}
+	return err
+}
+
+func (q *QueuedDeploy) leave() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.DeployQueue().RemoveId(q.ID)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
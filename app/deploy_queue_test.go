@@ -0,0 +1,186 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestEnqueueDeploy(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	first, err := EnqueueDeploy(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(first.App, check.Equals, a.Name)
+	c.Assert(first.Owner, check.Equals, "someone")
+	second, err := EnqueueDeploy(a.Name, "other", "POST /apps/someApp/deploy/rollback")
+	c.Assert(err, check.IsNil)
+	queue, err := ListDeployQueue(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 2)
+	c.Assert(queue[0].ID, check.Equals, first.ID)
+	c.Assert(queue[0].Reason, check.Equals, "POST /apps/someApp/deploy")
+	c.Assert(queue[0].Position, check.Equals, 1)
+	c.Assert(queue[1].ID, check.Equals, second.ID)
+	c.Assert(queue[1].Owner, check.Equals, "other")
+	c.Assert(queue[1].Position, check.Equals, 2)
+}
+
+func (s *S) TestEnqueueDeployAppNotFound(c *check.C) {
+	_, err := EnqueueDeploy("someApp", "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestListDeployQueueIgnoresStaleDeploys(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	stale := QueuedDeploy{
+		ID:        bson.NewObjectId(),
+		App:       a.Name,
+		Timestamp: time.Now().Add(-time.Hour),
+		Heartbeat: time.Now().Add(-2 * queueHeartbeatTimeout),
+	}
+	err = s.conn.DeployQueue().Insert(stale)
+	c.Assert(err, check.IsNil)
+	queued, err := EnqueueDeploy(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	queue, err := ListDeployQueue(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 1)
+	c.Assert(queue[0].ID, check.Equals, queued.ID)
+	c.Assert(queue[0].Position, check.Equals, 1)
+}
+
+func (s *S) TestRemoveQueuedDeploy(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	queued, err := EnqueueDeploy(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	err = RemoveQueuedDeploy("otherApp", queued.ID.Hex())
+	c.Assert(err, check.Equals, ErrQueuedDeployNotFound)
+	err = RemoveQueuedDeploy(a.Name, queued.ID.Hex())
+	c.Assert(err, check.IsNil)
+	queue, err := ListDeployQueue(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 0)
+	err = RemoveQueuedDeploy(a.Name, queued.ID.Hex())
+	c.Assert(err, check.Equals, ErrQueuedDeployNotFound)
+	err = RemoveQueuedDeploy(a.Name, "invalid")
+	c.Assert(err, check.Equals, ErrQueuedDeployNotFound)
+}
+
+func (s *S) TestQueuedDeployWait(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	locked, err := AcquireApplicationLock(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	first, err := EnqueueDeploy(a.Name, "first", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	second, err := EnqueueDeploy(a.Name, "second", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	order := make(chan string, 2)
+	go func() {
+		c.Check(second.Wait(nil, nil), check.IsNil)
+		order <- second.Owner
+	}()
+	go func() {
+		c.Check(first.Wait(nil, nil), check.IsNil)
+		order <- first.Owner
+	}()
+	ReleaseApplicationLock(a.Name)
+	c.Assert(<-order, check.Equals, "first")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "first")
+	ReleaseApplicationLock(a.Name)
+	c.Assert(<-order, check.Equals, "second")
+	queue, err := ListDeployQueue(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 0)
+}
+
+func (s *S) TestQueuedDeployWaitCanceled(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	queued, err := EnqueueDeploy(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	err = RemoveQueuedDeploy(a.Name, queued.ID.Hex())
+	c.Assert(err, check.IsNil)
+	err = queued.Wait(nil, nil)
+	c.Assert(err, check.Equals, ErrDeployCanceled)
+}
+
+func (s *S) TestQueuedDeployWaitProgress(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	locked, err := AcquireApplicationLock(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	first, err := EnqueueDeploy(a.Name, "first", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	second, err := EnqueueDeploy(a.Name, "second", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	positions := make(chan int, 10)
+	done := make(chan error)
+	go func() {
+		done <- second.Wait(func(position int) {
+			positions <- position
+		}, nil)
+	}()
+	c.Assert(<-positions, check.Equals, 2)
+	err = RemoveQueuedDeploy(a.Name, first.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(<-positions, check.Equals, 1)
+	ReleaseApplicationLock(a.Name)
+	c.Assert(<-done, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "second")
+}
+
+func (s *S) TestQueuedDeployWaitAborted(c *check.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.DeployQueue().RemoveAll(bson.M{"app": a.Name})
+	locked, err := AcquireApplicationLock(a.Name, "someone", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	queued, err := EnqueueDeploy(a.Name, "first", "POST /apps/someApp/deploy")
+	c.Assert(err, check.IsNil)
+	abort := make(chan bool)
+	close(abort)
+	err = queued.Wait(nil, abort)
+	c.Assert(err, check.Equals, ErrQueuedDeployAborted)
+	queue, err := ListDeployQueue(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(queue, check.HasLen, 0)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "someone")
+}
@@ -7,12 +7,15 @@ package app
 import (
 	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
 	"time"
 
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/auth/native"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/repository/repositorytest"
 	"github.com/tsuru/tsuru/service"
@@ -447,6 +450,69 @@ func (s *S) TestDeployApp(c *check.C) {
 	c.Assert(logs, check.Equals, "Git deploy called")
 }
 
+func (s *S) TestDeployAppRolling(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	writer := &bytes.Buffer{}
+	settings := provision.TsuruYamlDeploy{MaxSurge: 2, MaxUnavailable: 1}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: writer,
+		Rolling:      settings,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(writer.String(), check.Equals, "Git deploy called")
+	c.Assert(s.provisioner.RollingDeploy(&a), check.DeepEquals, settings)
+}
+
+func (s *S) TestDeployAppRollingSettingsOnlyForTheDeploy(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareFailure("GitDeploy", errors.New("deploy failed"))
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: &bytes.Buffer{},
+		Rolling:      provision.TsuruYamlDeploy{MaxSurge: 1},
+	})
+	c.Assert(err, check.ErrorMatches, "deploy failed")
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: &bytes.Buffer{},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.RollingDeploy(&a), check.DeepEquals, provision.TsuruYamlDeploy{})
+}
+
+func (s *S) TestDeployAppRollingInvalidSettings(c *check.C) {
+	a := App{Name: "someApp", Platform: "django", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareFailure("ValidateRollingDeploy", errors.New("invalid settings"))
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: writer,
+		Rolling:      provision.TsuruYamlDeploy{MaxSurge: 1},
+	})
+	c.Assert(err, check.ErrorMatches, "invalid settings")
+	c.Assert(writer.String(), check.Equals, "")
+}
+
 func (s *S) TestDeployAppWithUpdatePlatform(c *check.C) {
 	a := App{
 		Name:           "someApp",
@@ -566,6 +632,32 @@ func (s *S) TestDeployAppSaveDeployDataOriginRollback(c *check.C) {
 	c.Assert(result["origin"], check.Equals, "rollback")
 }
 
+func (s *S) TestDeployAppSaveDeployDataOriginOverride(c *check.C) {
+	a := App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: writer,
+		Image:        "registry.example.com/team/app:1.0",
+		Origin:       "image",
+	})
+	c.Assert(err, check.IsNil)
+	var result map[string]interface{}
+	s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&result)
+	c.Assert(result["image"], check.Equals, "registry.example.com/team/app:1.0")
+	c.Assert(result["log"], check.Equals, "Image deploy called")
+	c.Assert(result["origin"], check.Equals, "image")
+}
+
 func (s *S) TestDeployAppSaveDeployDataOriginAppDeploy(c *check.C) {
 	a := App{
 		Name:     "otherapp",
@@ -598,6 +690,32 @@ func (s *S) TestDeployAppSaveDeployDataOriginAppDeploy(c *check.C) {
 	c.Assert(result["origin"], check.Equals, "app-deploy")
 }
 
+func (s *S) TestDeployAppSaveDeployDataOriginDockerfile(c *check.C) {
+	a := App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: writer,
+		File:         ioutil.NopCloser(bytes.NewBuffer([]byte("my context"))),
+		Dockerfile:   true,
+	})
+	c.Assert(err, check.IsNil)
+	var result map[string]interface{}
+	s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&result)
+	c.Assert(result["image"], check.Equals, "app-image")
+	c.Assert(result["log"], check.Equals, "Dockerfile deploy called")
+	c.Assert(result["origin"], check.Equals, "dockerfile")
+}
+
 func (s *S) TestDeployAppSaveDeployErrorData(c *check.C) {
 	provisioner := provisiontest.NewFakeProvisioner()
 	provisioner.PrepareFailure("GitDeploy", errors.New("deploy error"))
@@ -629,6 +747,141 @@ func (s *S) TestDeployAppSaveDeployErrorData(c *check.C) {
 	c.Assert(result["error"], check.NotNil)
 }
 
+// cancelingProvisioner is a provisioner whose deploys are canceled while
+// running.
+type cancelingProvisioner struct {
+	*provisiontest.FakeProvisioner
+}
+
+func (p cancelingProvisioner) GitDeploy(app provision.App, version string, w io.Writer) (string, error) {
+	err := CancelDeploy(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	return "", action.ErrCanceled
+}
+
+func (s *S) TestDeployCanceled(c *check.C) {
+	Provisioner = cancelingProvisioner{provisiontest.NewFakeProvisioner()}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		Commit:       "1ee1f1084927b3a5db59c9033bc5c4abefb7b93c",
+		OutputStream: writer,
+	})
+	c.Assert(err, check.Equals, ErrDeployCanceled)
+	var result map[string]interface{}
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["error"], check.Equals, "deploy canceled")
+	c.Assert(result["canceled"], check.Equals, true)
+	n, err := s.conn.RunningDeploys().FindId(a.Name).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
+
+// failingCanceledProvisioner is a provisioner whose deploys are canceled
+// while running, but fail for another reason before noticing it.
+type failingCanceledProvisioner struct {
+	*provisiontest.FakeProvisioner
+}
+
+func (p failingCanceledProvisioner) GitDeploy(app provision.App, version string, w io.Writer) (string, error) {
+	err := CancelDeploy(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	return "", errors.New("failed to build the image")
+}
+
+func (s *S) TestDeployCanceledFailsWithOtherError(c *check.C) {
+	Provisioner = failingCanceledProvisioner{provisiontest.NewFakeProvisioner()}
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{
+		Name:     "otherapp",
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Version:      "version",
+		OutputStream: ioutil.Discard,
+	})
+	c.Assert(err, check.ErrorMatches, "failed to build the image")
+	var result map[string]interface{}
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["error"], check.Equals, "failed to build the image")
+	c.Assert(result["canceled"], check.Equals, false)
+}
+
+func (s *S) TestDeployRegistersRunningDeploy(c *check.C) {
+	provisioner := provisiontest.NewFakeProvisioner()
+	provisioner.PrepareFailure("GitDeploy", errors.New("deploy error"))
+	Provisioner = provisioner
+	defer func() {
+		Provisioner = s.provisioner
+	}()
+	a := App{Name: "otherapp", Platform: "zend"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	provisioner.Provision(&a)
+	defer provisioner.Destroy(&a)
+	err = Deploy(DeployOptions{App: &a, Version: "version", OutputStream: ioutil.Discard})
+	c.Assert(err, check.ErrorMatches, "deploy error")
+	var result map[string]interface{}
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["canceled"], check.Equals, false)
+	err = CancelDeploy(a.Name)
+	c.Assert(err, check.Equals, ErrDeployNotRunning)
+}
+
+func (s *S) TestCancelDeploy(c *check.C) {
+	err := registerRunningDeploy("myapp")
+	c.Assert(err, check.IsNil)
+	defer unregisterRunningDeploy("myapp")
+	canceled, err := IsDeployCanceled("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(canceled, check.Equals, false)
+	err = CancelDeploy("myapp")
+	c.Assert(err, check.IsNil)
+	canceled, err = IsDeployCanceled("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(canceled, check.Equals, true)
+	err = registerRunningDeploy("myapp")
+	c.Assert(err, check.IsNil)
+	canceled, err = IsDeployCanceled("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(canceled, check.Equals, false)
+}
+
+func (s *S) TestCancelDeployNotRunning(c *check.C) {
+	err := CancelDeploy("myapp")
+	c.Assert(err, check.Equals, ErrDeployNotRunning)
+	canceled, err := IsDeployCanceled("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(canceled, check.Equals, false)
+}
+
 func (s *S) TestUserHasPermission(c *check.C) {
 	user := &auth.User{Email: "user@user.com", Password: "123456"}
 	nativeScheme := auth.ManagedScheme(native.NativeScheme{})
@@ -745,6 +998,25 @@ func (s *S) TestDeployToProvisionerUpload(c *check.C) {
 	c.Assert(logs, check.Equals, "Upload deploy called")
 }
 
+func (s *S) TestDeployToProvisionerDockerfile(c *check.C) {
+	a := App{
+		Name:     "someApp",
+		Platform: "django",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	writer := &bytes.Buffer{}
+	opts := DeployOptions{App: &a, File: ioutil.NopCloser(bytes.NewBuffer([]byte("my context"))), Dockerfile: true}
+	_, err = deployToProvisioner(&opts, writer)
+	c.Assert(err, check.IsNil)
+	logs := writer.String()
+	c.Assert(logs, check.Equals, "Dockerfile deploy called")
+}
+
 func (s *S) TestDeployToProvisionerImage(c *check.C) {
 	a := App{
 		Name:     "someApp",
@@ -30,3 +30,14 @@ type ManyTeamsError struct{}
 func (err ManyTeamsError) Error() string {
 	return "You belong to more than one team, choose one to be owner for this app."
 }
+
+// VolumeNotAllowedError is the error returned when the team owner of an app
+// is not allowed to use the pool of the volume being bound to the app.
+type VolumeNotAllowedError struct {
+	Volume string
+	Err    error
+}
+
+func (e *VolumeNotAllowedError) Error() string {
+	return fmt.Sprintf("volume %q cannot be bound to the app: %s", e.Volume, e.Err)
+}
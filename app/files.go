@@ -0,0 +1,68 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var ErrUnitFilesNotSupported = errors.New("the provisioner does not support copying files of units")
+
+func unitFileCopier() (provision.UnitFileCopier, error) {
+	copier, ok := Provisioner.(provision.UnitFileCopier)
+	if !ok {
+		return nil, ErrUnitFilesNotSupported
+	}
+	return copier, nil
+}
+
+// unitForFiles returns the unit of the app whose name starts with unitName,
+// checking that path is an absolute path.
+func (app *App) unitForFiles(unitName, path string) (provision.Unit, error) {
+	if !strings.HasPrefix(path, "/") {
+		return provision.Unit{}, &tsuruErrors.ValidationError{Message: "path must be absolute"}
+	}
+	if unitName != "" {
+		for _, unit := range app.Units() {
+			if strings.HasPrefix(unit.Name, unitName) {
+				return unit, nil
+			}
+		}
+	}
+	return provision.Unit{}, ErrUnitNotFound
+}
+
+// DownloadUnitFiles writes to w a tar archive with the file or directory at
+// path in the given unit of the app.
+func (app *App) DownloadUnitFiles(unitName, path string, w io.Writer) error {
+	copier, err := unitFileCopier()
+	if err != nil {
+		return err
+	}
+	unit, err := app.unitForFiles(unitName, path)
+	if err != nil {
+		return err
+	}
+	return copier.DownloadUnitFiles(app, unit, path, w)
+}
+
+// UploadUnitFiles extracts the tar archive read from r into the directory at
+// path in the given unit of the app.
+func (app *App) UploadUnitFiles(unitName, path string, r io.Reader) error {
+	copier, err := unitFileCopier()
+	if err != nil {
+		return err
+	}
+	unit, err := app.unitForFiles(unitName, path)
+	if err != nil {
+		return err
+	}
+	return copier.UploadUnitFiles(app, unit, path, r)
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"strings"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUploadAndDownloadUnitFiles(c *check.C) {
+	a := App{Name: "someapp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.UploadUnitFiles(units[0].Name, "/tmp", strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(s.provisioner.UnitFiles(&a, units[0].Name, "/tmp")), check.Equals, "tar data")
+	var buf bytes.Buffer
+	err = a.DownloadUnitFiles(units[0].Name, "/tmp", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "tar data")
+}
+
+func (s *S) TestUploadUnitFilesByUnitPrefix(c *check.C) {
+	a := App{Name: "someapp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.UploadUnitFiles("someapp-", "/tmp", strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(s.provisioner.UnitFiles(&a, units[0].Name, "/tmp")), check.Equals, "tar data")
+}
+
+func (s *S) TestUnitFilesUnitNotFound(c *check.C) {
+	a := App{Name: "someapp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	_, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.DownloadUnitFiles("otherapp-0", "/tmp", &buf)
+	c.Assert(err, check.Equals, ErrUnitNotFound)
+	err = a.UploadUnitFiles("", "/tmp", &buf)
+	c.Assert(err, check.Equals, ErrUnitNotFound)
+}
+
+func (s *S) TestUnitFilesRelativePath(c *check.C) {
+	a := App{Name: "someapp", Platform: "django", Teams: []string{s.team.Name}}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.DownloadUnitFiles(units[0].Name, "tmp", &buf)
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, "path must be absolute")
+}
+
+func (s *S) TestUnitFilesNotSupported(c *check.C) {
+	Provisioner = struct{ provision.Provisioner }{s.provisioner}
+	defer func() { Provisioner = s.provisioner }()
+	a := App{Name: "someapp", Platform: "django"}
+	var buf bytes.Buffer
+	err := a.DownloadUnitFiles("someapp-0", "/tmp", &buf)
+	c.Assert(err, check.Equals, ErrUnitFilesNotSupported)
+	err = a.UploadUnitFiles("someapp-0", "/tmp", &buf)
+	c.Assert(err, check.Equals, ErrUnitFilesNotSupported)
+}
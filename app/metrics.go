@@ -10,6 +10,7 @@ import (
 
 	"github.com/tsuru/tsuru/metrics"
 	_ "github.com/tsuru/tsuru/metrics/graphite"
+	_ "github.com/tsuru/tsuru/metrics/mongodb"
 )
 
 func (app *App) Metric(kind string) (float64, error) {
@@ -0,0 +1,47 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/volume"
+)
+
+// BindVolume attaches the volume to the app at the mount point. The volume
+// must be in the pool where the units of the app run, and the team owner of
+// the app must be allowed to use the pool.
+func (app *App) BindVolume(name, mountPoint string, readOnly bool) error {
+	if !path.IsAbs(mountPoint) {
+		return volume.ErrInvalidMountPoint
+	}
+	v, err := volume.Get(name)
+	if err != nil {
+		return err
+	}
+	pool := app.Pool
+	poolProvisioner, isPoolProvisioner := Provisioner.(provision.PoolProvisioner)
+	if pool == "" && isPoolProvisioner {
+		pool, err = poolProvisioner.AppPool(app)
+		if err != nil {
+			return err
+		}
+	}
+	if v.Pool != pool {
+		return &errors.ValidationError{
+			Message: fmt.Sprintf("volume %q is in pool %q, the app must be moved to this pool before binding it", v.Name, v.Pool),
+		}
+	}
+	if isPoolProvisioner {
+		_, err = poolProvisioner.ValidateAppPool(app.TeamOwner, v.Pool)
+		if err != nil {
+			return &VolumeNotAllowedError{Volume: v.Name, Err: err}
+		}
+	}
+	return volume.BindApp(v.Name, app.Name, mountPoint, readOnly)
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/volume"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestBindVolume(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	a := App{Name: "myapp", TeamOwner: s.team.Name, Pool: "pool1"}
+	err = a.BindVolume("data", "/data", true)
+	c.Assert(err, check.IsNil)
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 1)
+	c.Assert(binds[0].MountPoint, check.Equals, "/data")
+	c.Assert(binds[0].ReadOnly, check.Equals, true)
+}
+
+func (s *S) TestBindVolumeInAnotherPool(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.BindVolume("data", "/data", false)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `volume "data" is in pool "pool1", the app must be moved to this pool before binding it`)
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+}
+
+func (s *S) TestBindVolumeAppWithoutPool(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = s.provisioner.MoveUnitsToPool(&a, "pool1", nil)
+	c.Assert(err, check.IsNil)
+	err = a.BindVolume("data", "/data", false)
+	c.Assert(err, check.IsNil)
+	binds, err := volume.ListAppBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 1)
+}
+
+func (s *S) TestBindVolumePoolNotAllowed(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Volumes().RemoveAll(nil)
+	s.provisioner.PrepareFailure("ValidateAppPool", fmt.Errorf(`team "other" is not allowed to use pool "pool1"`))
+	a := App{Name: "myapp", TeamOwner: "other", Pool: "pool1"}
+	err = a.BindVolume("data", "/data", false)
+	c.Assert(err, check.FitsTypeOf, &VolumeNotAllowedError{})
+	c.Assert(err, check.ErrorMatches, `volume "data" cannot be bound to the app: team "other" is not allowed to use pool "pool1"`)
+}
+
+func (s *S) TestBindVolumeInvalidMountPoint(c *check.C) {
+	a := App{Name: "myapp", Pool: "pool1"}
+	err := a.BindVolume("data", "data", false)
+	c.Assert(err, check.Equals, volume.ErrInvalidMountPoint)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/provision"
 	_ "github.com/tsuru/tsuru/provision/docker"
+	_ "github.com/tsuru/tsuru/provision/local"
 )
 
 const defaultConfigPath = "/etc/tsuru/tsuru.conf"
@@ -83,6 +83,22 @@ func (s *Storage) Deploys() *storage.Collection {
 	return s.Collection("deploys")
 }
 
+// RunningDeploys returns the collection of deploys in progress from MongoDB.
+func (s *Storage) RunningDeploys() *storage.Collection {
+	return s.Collection("running_deploys")
+}
+
+// DeployQueue returns the collection of deploys waiting for the lock of
+// their apps from MongoDB.
+func (s *Storage) DeployQueue() *storage.Collection {
+	return s.Collection("deploy_queue")
+}
+
+// Volumes returns the volumes collection from MongoDB.
+func (s *Storage) Volumes() *storage.Collection {
+	return s.Collection("volumes")
+}
+
 // Platforms returns the platforms collection from MongoDB.
 func (s *Storage) Platforms() *storage.Collection {
 	return s.Collection("platforms")
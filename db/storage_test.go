@@ -162,6 +162,30 @@ func (s *S) TestDeploys(c *check.C) {
 	c.Assert(deploys, check.DeepEquals, deploysc)
 }
 
+func (s *S) TestRunningDeploys(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	running := strg.RunningDeploys()
+	runningc := strg.Collection("running_deploys")
+	c.Assert(running, check.DeepEquals, runningc)
+}
+
+func (s *S) TestDeployQueue(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	queue := strg.DeployQueue()
+	queuec := strg.Collection("deploy_queue")
+	c.Assert(queue, check.DeepEquals, queuec)
+}
+
+func (s *S) TestVolumes(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	volumes := strg.Volumes()
+	volumesc := strg.Collection("volumes")
+	c.Assert(volumes, check.DeepEquals, volumesc)
+}
+
 func (s *S) TestPlatforms(c *check.C) {
 	strg, err := Conn()
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,257 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mongodb provides a time series database backed by the resource
+// usage samples of units, stored in a rolling MongoDB collection.
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultRetention = 24 * time.Hour
+
+var errNoSamples = errors.New("no samples in the given interval")
+
+var (
+	indexesMutex   sync.Mutex
+	indexesEnsured bool
+)
+
+func init() {
+	metrics.Register("mongodb", mongodb{})
+}
+
+// Sample is the resource usage of a unit at a given time. CPU is the usage
+// percentage, Memory and MemoryLimit are in bytes, and NetRx and NetTx are
+// the bytes received and transmitted since the unit started.
+type Sample struct {
+	App         string    `json:"app"`
+	Unit        string    `json:"unit"`
+	Process     string    `json:"process"`
+	Timestamp   time.Time `json:"timestamp"`
+	CPU         float64   `json:"cpu"`
+	Memory      uint64    `json:"memory"`
+	MemoryLimit uint64    `json:"memory_limit" bson:"memorylimit"`
+	NetRx       uint64    `json:"net_rx" bson:"netrx"`
+	NetTx       uint64    `json:"net_tx" bson:"nettx"`
+}
+
+// MemoryPercent returns the memory usage of the unit as a percentage of its
+// limit.
+func (s *Sample) MemoryPercent() float64 {
+	if s.MemoryLimit == 0 {
+		return 0
+	}
+	return float64(s.Memory) * 100 / float64(s.MemoryLimit)
+}
+
+func (s *Sample) value(kind string) (float64, error) {
+	switch kind {
+	case "cpu":
+		return s.CPU, nil
+	case "mem":
+		return float64(s.Memory), nil
+	case "mem_pct":
+		return s.MemoryPercent(), nil
+	case "netrx":
+		return float64(s.NetRx), nil
+	case "nettx":
+		return float64(s.NetTx), nil
+	}
+	return 0, fmt.Errorf("unknown metric: %q", kind)
+}
+
+func retention() time.Duration {
+	seconds, _ := config.GetDuration("metrics:mongodb:retention")
+	if seconds <= 0 {
+		return defaultRetention
+	}
+	return seconds * time.Second
+}
+
+// collection returns the collection that stores the samples. Samples are
+// removed by MongoDB once they're older than the retention, configured in
+// seconds with metrics:mongodb:retention.
+func collection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	c := conn.Collection("units_metrics")
+	err = ensureIndexes(c)
+	if err != nil {
+		log.Errorf("[metrics] Unable to create the indexes of the units metrics: %s", err)
+	}
+	return c, nil
+}
+
+// ensureIndexes creates the indexes of the collection of samples once, trying
+// again in the next call when it fails.
+func ensureIndexes(c *storage.Collection) error {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+	if indexesEnsured {
+		return nil
+	}
+	err := c.EnsureIndex(mgo.Index{Key: []string{"timestamp"}, ExpireAfter: retention()})
+	if err != nil {
+		return err
+	}
+	err = c.EnsureIndex(mgo.Index{Key: []string{"app", "timestamp"}})
+	if err != nil {
+		return err
+	}
+	indexesEnsured = true
+	return nil
+}
+
+// Add stores the given samples.
+func Add(samples ...Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	docs := make([]interface{}, len(samples))
+	for i := range samples {
+		docs[i] = samples[i]
+	}
+	return coll.Insert(docs...)
+}
+
+// List returns the samples of the units of the app collected between from
+// and to, ordered by time.
+func List(appName string, from, to time.Time) ([]Sample, error) {
+	coll, err := collection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{
+		"app":       appName,
+		"timestamp": bson.M{"$gte": from, "$lte": to},
+	}
+	var samples []Sample
+	err = coll.Find(query).Sort("timestamp").All(&samples)
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// mongodb is the time series database that summarizes the stored samples.
+type mongodb struct{}
+
+// parseKey extracts the app name and the metric from keys in the format
+// used by tsuru for Graphite, like "myapp.*.*.cpu_max". The suffix of the
+// metric, when present, overrides the summarize function.
+func parseKey(key, function string) (string, string, string, error) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 4 || parts[0] == "" {
+		return "", "", "", fmt.Errorf("invalid key: %q", key)
+	}
+	kind := parts[3]
+	for _, f := range []string{"max", "min", "avg", "sum"} {
+		if strings.HasSuffix(kind, "_"+f) {
+			return parts[0], strings.TrimSuffix(kind, "_"+f), f, nil
+		}
+	}
+	return parts[0], kind, function, nil
+}
+
+func summarize(values []float64, function string) (float64, error) {
+	result := values[0]
+	switch function {
+	case "max":
+		for _, v := range values[1:] {
+			if v > result {
+				result = v
+			}
+		}
+	case "min":
+		for _, v := range values[1:] {
+			if v < result {
+				result = v
+			}
+		}
+	case "sum", "avg":
+		for _, v := range values[1:] {
+			result += v
+		}
+		if function == "avg" {
+			result /= float64(len(values))
+		}
+	default:
+		return 0, fmt.Errorf("unknown function: %q", function)
+	}
+	return result, nil
+}
+
+// Summarize summarizes the samples of the units of the app collected in the
+// given interval, like "-10h", using the function across the units sampled
+// at the same time.
+func (mongodb) Summarize(key, interval, function string) (metrics.Series, error) {
+	appName, kind, function, err := parseKey(key, function)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := time.ParseDuration(strings.TrimPrefix(interval, "-"))
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now()
+	samples, err := List(appName, to.Add(-duration), to)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, errNoSamples
+	}
+	values := make(map[int64][]float64)
+	for _, s := range samples {
+		v, err := s.value(kind)
+		if err != nil {
+			return nil, err
+		}
+		ts := s.Timestamp.Unix()
+		values[ts] = append(values[ts], v)
+	}
+	timestamps := make([]int64, 0, len(values))
+	for ts := range values {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Sort(int64Slice(timestamps))
+	series := make(metrics.Series, len(timestamps))
+	for i, ts := range timestamps {
+		v, err := summarize(values[ts], function)
+		if err != nil {
+			return nil, err
+		}
+		series[i] = metrics.Data{Timestamp: float64(ts), Value: v}
+	}
+	return series, nil
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
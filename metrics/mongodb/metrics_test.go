@@ -0,0 +1,128 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/metrics"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_metrics_mongodb_test")
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Apps().Database)
+}
+
+func (s *S) TestAddAndList(c *check.C) {
+	now := time.Now().Truncate(time.Second)
+	err := Add(
+		Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-2 * time.Hour), CPU: 10},
+		Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-time.Minute), CPU: 20},
+		Sample{App: "otherapp", Unit: "u2", Timestamp: now.Add(-time.Minute), CPU: 30},
+	)
+	c.Assert(err, check.IsNil)
+	samples, err := List("myapp", now.Add(-time.Hour), now)
+	c.Assert(err, check.IsNil)
+	c.Assert(samples, check.HasLen, 1)
+	c.Assert(samples[0].Unit, check.Equals, "u1")
+	c.Assert(samples[0].CPU, check.Equals, 20.0)
+}
+
+func (s *S) TestCollectionEnsuresIndexesOnce(c *check.C) {
+	indexesEnsured = false
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	indexes, err := coll.Indexes()
+	c.Assert(err, check.IsNil)
+	var keys [][]string
+	for _, index := range indexes {
+		keys = append(keys, index.Key)
+	}
+	c.Assert(keys, check.DeepEquals, [][]string{{"_id"}, {"app", "timestamp"}, {"timestamp"}})
+	c.Assert(indexesEnsured, check.Equals, true)
+	err = coll.DropIndex("app", "timestamp")
+	c.Assert(err, check.IsNil)
+	otherColl, err := collection()
+	c.Assert(err, check.IsNil)
+	defer otherColl.Close()
+	indexes, err = otherColl.Indexes()
+	c.Assert(err, check.IsNil)
+	c.Assert(indexes, check.HasLen, 2)
+	indexesEnsured = false
+}
+
+func (s *S) TestMemoryPercent(c *check.C) {
+	sample := Sample{Memory: 256, MemoryLimit: 1024}
+	c.Assert(sample.MemoryPercent(), check.Equals, 25.0)
+	sample = Sample{Memory: 256}
+	c.Assert(sample.MemoryPercent(), check.Equals, 0.0)
+}
+
+func (s *S) TestParseKey(c *check.C) {
+	appName, kind, function, err := parseKey("myapp.*.*.cpu_max", "avg")
+	c.Assert(err, check.IsNil)
+	c.Assert(appName, check.Equals, "myapp")
+	c.Assert(kind, check.Equals, "cpu")
+	c.Assert(function, check.Equals, "max")
+	_, kind, function, err = parseKey("myapp.*.*.mem_pct", "avg")
+	c.Assert(err, check.IsNil)
+	c.Assert(kind, check.Equals, "mem_pct")
+	c.Assert(function, check.Equals, "avg")
+	_, _, _, err = parseKey("cpu", "max")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestSummarize(c *check.C) {
+	now := time.Now().Truncate(time.Second)
+	err := Add(
+		Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-2 * time.Minute), CPU: 10, Memory: 100},
+		Sample{App: "myapp", Unit: "u2", Timestamp: now.Add(-2 * time.Minute), CPU: 30, Memory: 300},
+		Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-time.Minute), CPU: 50, Memory: 200},
+	)
+	c.Assert(err, check.IsNil)
+	series, err := mongodb{}.Summarize("myapp.*.*.cpu_max", "-1h", "max")
+	c.Assert(err, check.IsNil)
+	c.Assert(series, check.DeepEquals, metrics.Series{
+		{Timestamp: float64(now.Add(-2 * time.Minute).Unix()), Value: 30},
+		{Timestamp: float64(now.Add(-time.Minute).Unix()), Value: 50},
+	})
+	series, err = mongodb{}.Summarize("myapp.*.*.mem", "-1h", "avg")
+	c.Assert(err, check.IsNil)
+	c.Assert(series, check.DeepEquals, metrics.Series{
+		{Timestamp: float64(now.Add(-2 * time.Minute).Unix()), Value: 200},
+		{Timestamp: float64(now.Add(-time.Minute).Unix()), Value: 200},
+	})
+}
+
+func (s *S) TestSummarizeNoSamples(c *check.C) {
+	_, err := mongodb{}.Summarize("myapp.*.*.cpu_max", "-1h", "max")
+	c.Assert(err, check.Equals, errNoSamples)
+}
+
+func (s *S) TestSummarizeUnknownMetric(c *check.C) {
+	err := Add(Sample{App: "myapp", Unit: "u1", Timestamp: time.Now(), CPU: 10})
+	c.Assert(err, check.IsNil)
+	_, err = mongodb{}.Summarize("myapp.*.*.connections", "-1h", "max")
+	c.Assert(err, check.ErrorMatches, `unknown metric: "connections"`)
+}
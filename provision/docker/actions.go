@@ -23,21 +23,25 @@ type runContainerActionsArgs struct {
 	app              provision.App
 	imageID          string
 	commands         []string
+	imageCommand     bool
 	destinationHosts []string
 	writer           io.Writer
 	isDeploy         bool
 	buildingImage    string
+	processName      string
 	provisioner      *dockerProvisioner
 }
 
 type changeUnitsPipelineArgs struct {
-	app         provision.App
-	writer      io.Writer
-	toRemove    []container
-	unitsToAdd  int
-	toHost      string
-	imageId     string
-	provisioner *dockerProvisioner
+	app          provision.App
+	writer       io.Writer
+	toRemove     []container
+	toKeep       []container
+	toAdd        map[string]int
+	toHost       string
+	imageId      string
+	canaryWeight int
+	provisioner  *dockerProvisioner
 }
 
 var insertEmptyContainerInDB = action.Action{
@@ -47,6 +51,7 @@ var insertEmptyContainerInDB = action.Action{
 		contName := randomString()
 		cont := container{
 			AppName:       args.app.GetName(),
+			ProcessName:   args.processName,
 			Type:          args.app.GetPlatform(),
 			Name:          contName,
 			Status:        provision.StatusCreated.String(),
@@ -104,7 +109,7 @@ var createContainer = action.Action{
 	Backward: func(ctx action.BWContext) {
 		c := ctx.FWResult.(container)
 		args := ctx.Params[0].(runContainerActionsArgs)
-		err := args.provisioner.getCluster().RemoveContainer(docker.RemoveContainerOptions{ID: c.ID})
+		err := c.getCluster(args.provisioner).RemoveContainer(docker.RemoveContainerOptions{ID: c.ID})
 		if err != nil {
 			log.Errorf("Failed to remove the container %q: %s", c.ID, err)
 		}
@@ -122,6 +127,7 @@ var setNetworkInfo = action.Action{
 		}
 		c.IP = info.IP
 		c.HostPort = info.HTTPHostPort
+		c.ExtraPorts = info.ExtraPorts
 		return c, nil
 	},
 }
@@ -142,7 +148,7 @@ var startContainer = action.Action{
 	Backward: func(ctx action.BWContext) {
 		c := ctx.FWResult.(container)
 		args := ctx.Params[0].(runContainerActionsArgs)
-		err := args.provisioner.getCluster().StopContainer(c.ID, 10)
+		err := c.getCluster(args.provisioner).StopContainer(c.ID, 10)
 		if err != nil {
 			log.Errorf("Failed to stop the container %q: %s", c.ID, err)
 		}
@@ -185,13 +191,22 @@ var addNewRoutes = action.Action{
 		if writer == nil {
 			writer = ioutil.Discard
 		}
-		fmt.Fprintf(writer, "\n---- Adding routes to %d new units ----\n", len(newContainers))
-		addedContainers := make([]container, 0, len(newContainers))
-		for _, cont := range newContainers {
+		routable := routableContainers(newContainers)
+		fmt.Fprintf(writer, "\n---- Adding routes to %d new units ----\n", len(routable))
+		addedContainers := make([]container, 0, len(routable))
+		for _, cont := range routable {
 			err = r.AddRoute(cont.AppName, cont.getAddress())
+			if err == nil {
+				err = cont.addTCPRoutes(r)
+				if err != nil {
+					r.RemoveRoute(cont.AppName, cont.getAddress())
+					cont.removeTCPRoutes(r)
+				}
+			}
 			if err != nil {
 				for _, toRemoveCont := range addedContainers {
 					r.RemoveRoute(toRemoveCont.AppName, toRemoveCont.getAddress())
+					toRemoveCont.removeTCPRoutes(r)
 				}
 				return nil, err
 			}
@@ -207,13 +222,18 @@ var addNewRoutes = action.Action{
 		if err != nil {
 			log.Errorf("[add-new-routes:Backward] Error geting router: %s", err.Error())
 		}
-		for _, cont := range newContainers {
+		for _, cont := range routableContainers(newContainers) {
 			err = r.RemoveRoute(cont.AppName, cont.getAddress())
 			if err != nil {
 				log.Errorf("[add-new-routes:Backward] Error removing route for %s: %s", cont.ID, err.Error())
 			}
+			err = cont.removeTCPRoutes(r)
+			if err != nil {
+				log.Errorf("[add-new-routes:Backward] Error removing tcp routes for %s: %s", cont.ID, err.Error())
+			}
 		}
 	},
+	PointOfNoReturn: true,
 }
 
 var removeOldRoutes = action.Action{
@@ -228,13 +248,18 @@ var removeOldRoutes = action.Action{
 		if writer == nil {
 			writer = ioutil.Discard
 		}
-		fmt.Fprintf(writer, "\n---- Removing routes from %d old units ----\n", len(args.toRemove))
-		removedConts := make([]container, 0, len(args.toRemove))
-		for _, cont := range args.toRemove {
+		routable := routableContainers(args.toRemove)
+		fmt.Fprintf(writer, "\n---- Removing routes from %d old units ----\n", len(routable))
+		removedConts := make([]container, 0, len(routable))
+		for _, cont := range routable {
 			err = r.RemoveRoute(cont.AppName, cont.getAddress())
-			if err != router.ErrRouteNotFound && err != nil {
+			if err == nil || err == router.ErrRouteNotFound {
+				err = cont.removeTCPRoutes(r)
+			}
+			if err != nil {
 				for _, toAddCont := range removedConts {
 					r.AddRoute(toAddCont.AppName, toAddCont.getAddress())
+					toAddCont.addTCPRoutes(r)
 				}
 				return nil, err
 			}
@@ -249,11 +274,15 @@ var removeOldRoutes = action.Action{
 		if err != nil {
 			log.Errorf("[add-new-routes:Backward] Error geting router: %s", err.Error())
 		}
-		for _, cont := range args.toRemove {
+		for _, cont := range routableContainers(args.toRemove) {
 			err = r.AddRoute(cont.AppName, cont.getAddress())
 			if err != nil {
 				log.Errorf("[remove-old-routes:Backward] Error adding back route for %s: %s", cont.ID, err.Error())
 			}
+			err = cont.addTCPRoutes(r)
+			if err != nil {
+				log.Errorf("[remove-old-routes:Backward] Error adding back tcp routes for %s: %s", cont.ID, err.Error())
+			}
 		}
 	},
 	MinParams: 1,
@@ -320,7 +349,7 @@ var followLogsAndCommit = action.Action{
 			log.Errorf("error on get logs for container %s - %s", c.ID, err)
 			return nil, err
 		}
-		status, err := args.provisioner.getCluster().WaitContainer(c.ID)
+		status, err := c.getCluster(args.provisioner).WaitContainer(c.ID)
 		if err != nil {
 			log.Errorf("Process failed for container %q: %s", c.ID, err)
 			return nil, err
@@ -360,9 +389,14 @@ var updateAppImage = action.Action{
 			log.Errorf("Couldn't list images for cleaning: %s", err.Error())
 			return ctx.Previous, nil
 		}
+		dcluster, _, err := args.provisioner.clusterForApp(args.app.GetName())
+		if err != nil {
+			log.Errorf("Couldn't get the cluster of app %s for cleaning images: %s", args.app.GetName(), err.Error())
+			return ctx.Previous, nil
+		}
 		for i, imgName := range allImages {
 			if i > len(allImages)-imgHistorySize-1 {
-				err := args.provisioner.getCluster().RemoveImageIgnoreLast(imgName)
+				err := dcluster.RemoveImageIgnoreLast(imgName)
 				if err != nil {
 					log.Debugf("Ignored error removing old image %q: %s", imgName, err.Error())
 				}
@@ -373,3 +407,85 @@ var updateAppImage = action.Action{
 		return ctx.Previous, nil
 	},
 }
+
+var addCanaryRoutes = action.Action{
+	Name: "add-canary-routes",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(changeUnitsPipelineArgs)
+		newContainers := ctx.Previous.([]container)
+		r, err := weightedRouterForApp(args.app)
+		if err != nil {
+			return nil, err
+		}
+		writer := args.writer
+		if writer == nil {
+			writer = ioutil.Discard
+		}
+		currentWeight, canaryWeight := canaryRouteWeights(args.canaryWeight, len(args.toKeep), len(newContainers))
+		fmt.Fprintf(writer, "\n---- Adding routes to %d canary units (%d%% of the traffic) ----\n", len(newContainers), args.canaryWeight)
+		err = setRoutesWeight(r, args.toKeep, currentWeight)
+		if err != nil {
+			setRoutesWeight(r, args.toKeep, 1)
+			return nil, err
+		}
+		addedContainers := make([]container, 0, len(newContainers))
+		for _, cont := range newContainers {
+			err = r.AddWeightedRoute(cont.AppName, cont.getAddress(), canaryWeight)
+			if err != nil {
+				for _, toRemoveCont := range addedContainers {
+					r.RemoveRoute(toRemoveCont.AppName, toRemoveCont.getAddress())
+				}
+				setRoutesWeight(r, args.toKeep, 1)
+				return nil, err
+			}
+			addedContainers = append(addedContainers, cont)
+			fmt.Fprintf(writer, " ---> Added route to canary unit %s\n", cont.shortID())
+		}
+		return newContainers, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(changeUnitsPipelineArgs)
+		newContainers := ctx.FWResult.([]container)
+		r, err := weightedRouterForApp(args.app)
+		if err != nil {
+			log.Errorf("[add-canary-routes:Backward] Error geting router: %s", err.Error())
+			return
+		}
+		for _, cont := range newContainers {
+			err = r.RemoveRoute(cont.AppName, cont.getAddress())
+			if err != nil {
+				log.Errorf("[add-canary-routes:Backward] Error removing route for %s: %s", cont.ID, err.Error())
+			}
+		}
+		err = setRoutesWeight(r, args.toKeep, 1)
+		if err != nil {
+			log.Errorf("[add-canary-routes:Backward] Error resetting route weights: %s", err.Error())
+		}
+	},
+	MinParams: 1,
+}
+
+var saveCanaryUnits = action.Action{
+	Name: "save-canary-units",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(changeUnitsPipelineArgs)
+		newContainers := ctx.Previous.([]container)
+		ids := make([]string, len(newContainers))
+		for i, cont := range newContainers {
+			ids[i] = cont.ID
+		}
+		coll, err := canaryColl()
+		if err != nil {
+			return nil, err
+		}
+		defer coll.Close()
+		err = coll.UpdateId(args.app.GetName(), bson.M{"$set": bson.M{"image": args.imageId, "units": ids}})
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Previous, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	MinParams: 1,
+}
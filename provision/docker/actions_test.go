@@ -386,7 +386,7 @@ func (s *S) TestProvisionAddUnitsToHostForward(c *check.C) {
 	args := changeUnitsPipelineArgs{
 		app:         app,
 		toHost:      "localhost",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		imageId:     imageId,
 		provisioner: p,
 	}
@@ -417,7 +417,7 @@ func (s *S) TestProvisionAddUnitsToHostForwardWithoutHost(c *check.C) {
 	c.Assert(err, check.IsNil)
 	args := changeUnitsPipelineArgs{
 		app:         app,
-		unitsToAdd:  3,
+		toAdd:       map[string]int{"": 3},
 		imageId:     imageId,
 		provisioner: p,
 	}
@@ -7,9 +7,12 @@ package docker
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/tsuru/tsuru/cmd"
 	tsuruIo "github.com/tsuru/tsuru/io"
@@ -69,6 +72,49 @@ func (c *moveContainersCmd) Run(context *cmd.Context, client *cmd.Client) error
 	return nil
 }
 
+type drainNodeCmd struct {
+	cmd.ConfirmationCommand
+}
+
+func (c *drainNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-node-drain",
+		Usage: "docker-node-drain <address> [-y/--assume-yes]",
+		Desc: `Marks a node as unschedulable and moves all its containers to other nodes
+in the same pool. Use docker-node-uncordon to make the node schedulable again.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *drainNodeCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	address := context.Args[0]
+	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to drain the node %q?", address)) {
+		return nil
+	}
+	url, err := cmd.GetURL("/docker/node/drain")
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{"address": address})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	w := tsuruIo.NewStreamWriter(context.Stdout, progressFormatter{})
+	for n := int64(1); n > 0 && err == nil; n, err = io.Copy(w, response.Body) {
+	}
+	return nil
+}
+
 type fixContainersCmd struct{}
 
 func (fixContainersCmd) Info() *cmd.Info {
@@ -186,3 +232,232 @@ func (c *rebalanceContainersCmd) Flags() *gnuflag.FlagSet {
 	}
 	return c.fs
 }
+
+type imageGCCmd struct {
+	cmd.ConfirmationCommand
+	fs  *gnuflag.FlagSet
+	dry bool
+}
+
+func (c *imageGCCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-image-gc",
+		Usage: "docker-image-gc [--dry] [-y/--assume-yes]",
+		Desc: `Remove old app images from the docker nodes and from the registry.
+
+Images outside the image history of each app are removed, unless they're used
+by a unit.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *imageGCCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	if !c.dry && !c.Confirm(context, "Are you sure you want to remove old images?") {
+		return nil
+	}
+	url, err := cmd.GetURL("/docker/images/gc")
+	if err != nil {
+		return err
+	}
+	params := map[string]string{
+		"dry": fmt.Sprintf("%t", c.dry),
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	w := tsuruIo.NewStreamWriter(context.Stdout, progressFormatter{})
+	for n := int64(1); n > 0 && err == nil; n, err = io.Copy(w, response.Body) {
+	}
+	return nil
+}
+
+func (c *imageGCCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.ConfirmationCommand.Flags()
+		c.fs.BoolVar(&c.dry, "dry", false, "Dry run, only shows which images would be removed")
+	}
+	return c.fs
+}
+
+type setCanaryWeightCmd struct{}
+
+func (setCanaryWeightCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "canary-weight",
+		Usage:   "canary-weight <app name> <weight>",
+		Desc:    "Change the percentage of the traffic sent to the units of the canary deploy of an app.",
+		MinArgs: 2,
+	}
+}
+
+func (setCanaryWeightCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	weight, err := strconv.Atoi(context.Args[1])
+	if err != nil || weight < 1 || weight > 99 {
+		return errors.New("the weight must be a number between 1 and 99")
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/canary", context.Args[0]))
+	if err != nil {
+		return err
+	}
+	body := strings.NewReader(fmt.Sprintf("weight=%d", weight))
+	request, err := http.NewRequest("PUT", url, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Canary units of %s are now receiving %d%% of the traffic.\n", context.Args[0], weight)
+	return nil
+}
+
+type promoteCanaryCmd struct {
+	cmd.ConfirmationCommand
+}
+
+func (c *promoteCanaryCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "canary-promote",
+		Usage:   "canary-promote <app name> [-y/--assume-yes]",
+		Desc:    "Replace all units of an app with units running the version of its canary deploy.",
+		MinArgs: 1,
+	}
+}
+
+func (c *promoteCanaryCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	appName := context.Args[0]
+	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to promote the canary deploy of %q?", appName)) {
+		return nil
+	}
+	return streamCanaryAction(context, client, appName, "promote")
+}
+
+type abortCanaryCmd struct {
+	cmd.ConfirmationCommand
+}
+
+func (c *abortCanaryCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "canary-abort",
+		Usage:   "canary-abort <app name> [-y/--assume-yes]",
+		Desc:    "Remove the units of the canary deploy of an app, sending all the traffic back to the current version.",
+		MinArgs: 1,
+	}
+}
+
+func (c *abortCanaryCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	appName := context.Args[0]
+	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to abort the canary deploy of %q?", appName)) {
+		return nil
+	}
+	return streamCanaryAction(context, client, appName, "abort")
+}
+
+type cancelDeployCmd struct {
+	cmd.ConfirmationCommand
+}
+
+func (c *cancelDeployCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-deploy-cancel",
+		Usage: "app-deploy-cancel <app name> [-y/--assume-yes]",
+		Desc: `Cancel the deploy in progress of an app.
+
+The deploy stops before its next step, removing the units it has already
+created and restoring the routes of the app.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *cancelDeployCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	appName := context.Args[0]
+	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to cancel the deploy of %q?", appName)) {
+		return nil
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/deploy/current", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Deploy of %s is being canceled.\n", appName)
+	return nil
+}
+
+func streamCanaryAction(context *cmd.Context, client *cmd.Client, appName, action string) error {
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/canary/%s", appName, action))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	w := tsuruIo.NewStreamWriter(context.Stdout, nil)
+	for n := int64(1); n > 0 && err == nil; n, err = io.Copy(w, response.Body) {
+	}
+	return err
+}
+
+type changeAppPoolCmd struct{}
+
+func (changeAppPoolCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-app-pool-set",
+		Usage: "docker-app-pool-set <app name> [pool]",
+		Desc: `Move an app to another pool, replacing its units with new units in the
+nodes of the pool. Omit the pool to move the app to the default pool of its
+team.`,
+		MinArgs: 1,
+	}
+}
+
+func (changeAppPoolCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	var pool string
+	if len(context.Args) > 1 {
+		pool = context.Args[1]
+	}
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/pool", context.Args[0]))
+	if err != nil {
+		return err
+	}
+	body := strings.NewReader("pool=" + pool)
+	request, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	w := tsuruIo.NewStreamWriter(context.Stdout, nil)
+	for n := int64(1); n > 0 && err == nil; n, err = io.Copy(w, response.Body) {
+	}
+	return err
+}
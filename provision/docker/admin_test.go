@@ -59,6 +59,32 @@ func (s *S) TestMoveContainersRun(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestDrainNodeRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"http://localhost:2375"},
+	}
+	msg, _ := json.Marshal(progressLog{Message: "progress msg"})
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			var result map[string]string
+			json.NewDecoder(req.Body).Decode(&result)
+			return req.URL.Path == "/docker/node/drain" && req.Method == "POST" &&
+				result["address"] == "http://localhost:2375"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := drainNodeCmd{}
+	command.Flags().Parse(true, []string{"-y"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "progress msg\n")
+}
+
 func (s *S) TestMoveContainerInfo(c *check.C) {
 	expected := &cmd.Info{
 		Name:    "container-move",
@@ -199,6 +225,46 @@ func (s *S) TestRebalanceContainersRunGivingUp(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, "Are you sure you want to rebalance containers? (y/n) Abort.\n")
 }
 
+func (s *S) TestImageGCCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	msg, _ := json.Marshal(progressLog{Message: "progress msg"})
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			defer req.Body.Close()
+			var params map[string]string
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, check.IsNil)
+			c.Assert(params, check.DeepEquals, map[string]string{"dry": "true"})
+			return req.URL.Path == "/docker/images/gc" && req.Method == "POST"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := imageGCCmd{}
+	err := command.Flags().Parse(true, []string{"--dry"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "progress msg\n")
+}
+
+func (s *S) TestImageGCCmdRunGivingUp(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stdin:  bytes.NewBufferString("n\n"),
+	}
+	command := imageGCCmd{}
+	err := command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Are you sure you want to remove old images? (y/n) Abort.\n")
+}
+
 func (s *S) TestFixContainersCmdRun(c *check.C) {
 	var buf bytes.Buffer
 	context := cmd.Context{Stdout: &buf, Stderr: &buf}
@@ -226,3 +292,149 @@ func (s *S) TestFixContainersCmdInfo(c *check.C) {
 	info := command.Info()
 	c.Assert(*info, check.DeepEquals, expected)
 }
+
+func (s *S) TestSetCanaryWeightCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"myapp", "30"},
+	}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/myapp/canary" && req.Method == "PUT" &&
+				req.FormValue("weight") == "30"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := setCanaryWeightCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Canary units of myapp are now receiving 30% of the traffic.\n")
+}
+
+func (s *S) TestSetCanaryWeightCmdRunInvalidWeight(c *check.C) {
+	context := cmd.Context{Args: []string{"myapp", "100"}}
+	err := setCanaryWeightCmd{}.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "the weight must be a number between 1 and 99")
+}
+
+func (s *S) TestChangeAppPoolCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"myapp", "staging"},
+	}
+	msg, _ := json.Marshal(progressLog{Message: "moved\n"})
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/myapp/pool" && req.Method == "POST" &&
+				req.FormValue("pool") == "staging"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := changeAppPoolCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "moved\n")
+}
+
+func (s *S) TestPromoteCanaryCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"myapp"},
+	}
+	msg, _ := json.Marshal(progressLog{Message: "promoted\n"})
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/myapp/canary/promote" && req.Method == "POST"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := promoteCanaryCmd{}
+	err := command.Flags().Parse(true, []string{"-y"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "promoted\n")
+}
+
+func (s *S) TestPromoteCanaryCmdRunGivingUp(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stdin:  bytes.NewBufferString("n\n"),
+		Args:   []string{"myapp"},
+	}
+	command := promoteCanaryCmd{}
+	err := command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Are you sure you want to promote the canary deploy of \"myapp\"? (y/n) Abort.\n")
+}
+
+func (s *S) TestAbortCanaryCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"myapp"},
+	}
+	msg, _ := json.Marshal(progressLog{Message: "aborted\n"})
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/myapp/canary/abort" && req.Method == "POST"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := abortCanaryCmd{}
+	err := command.Flags().Parse(true, []string{"-y"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "aborted\n")
+}
+
+func (s *S) TestCancelDeployCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"myapp"},
+	}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/apps/myapp/deploy/current" && req.Method == "DELETE"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := cancelDeployCmd{}
+	err := command.Flags().Parse(true, []string{"-y"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Deploy of myapp is being canceled.\n")
+}
+
+func (s *S) TestCancelDeployCmdRunGivingUp(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stdin:  bytes.NewBufferString("n\n"),
+		Args:   []string{"myapp"},
+	}
+	command := cancelDeployCmd{}
+	err := command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Are you sure you want to cancel the deploy of \"myapp\"? (y/n) Abort.\n")
+}
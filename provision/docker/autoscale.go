@@ -0,0 +1,480 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	errAutoScaleRequiresSegregate = errors.New("node auto scaling requires the segregated scheduler (docker:segregate)")
+	errAutoScalePoolLocked        = errors.New("pool is being scaled by another tsuru process")
+	errAutoScaleNoMemoryMetadata  = errors.New("node auto scaling requires docker:scheduler:total-memory-metadata and docker:scheduler:max-used-memory")
+)
+
+// PoolAutoScale holds the settings used to add nodes to the pool, created
+// from an IaaS template, when the memory reserved by the units in the pool
+// goes above ScaleUpRatio, and to remove nodes when it goes below
+// ScaleDownRatio. Both ratios are relative to the memory available to units
+// in the nodes of the pool, as limited by docker:scheduler:max-used-memory.
+type PoolAutoScale struct {
+	Enabled        bool
+	Template       string
+	MinNodes       int
+	MaxNodes       int
+	ScaleUpRatio   float64
+	ScaleDownRatio float64
+}
+
+func (a *PoolAutoScale) validate() error {
+	if a.Template == "" {
+		return errors.New("template is required for node auto scaling")
+	}
+	if a.MinNodes < 0 || a.MaxNodes < 0 {
+		return errors.New("the limits of nodes cannot be negative")
+	}
+	if a.MaxNodes > 0 && a.MaxNodes < a.MinNodes {
+		return errors.New("the maximum number of nodes cannot be lower than the minimum")
+	}
+	if a.ScaleUpRatio <= 0 || a.ScaleUpRatio > 1 {
+		return errors.New("scale up ratio must be greater than 0 and at most 1")
+	}
+	if a.ScaleDownRatio < 0 || a.ScaleDownRatio >= a.ScaleUpRatio {
+		return errors.New("scale down ratio must be lower than the scale up ratio")
+	}
+	return nil
+}
+
+// setPoolAutoScale changes the auto scaling settings of the pool. A nil
+// autoScale disables the auto scaling, keeping the previous settings.
+func setPoolAutoScale(poolName string, autoScale *PoolAutoScale) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection(schedulerCollection)
+	if autoScale == nil {
+		var pool Pool
+		err = coll.FindId(poolName).One(&pool)
+		if err != nil || pool.AutoScale == nil {
+			return err
+		}
+		return coll.UpdateId(poolName, bson.M{"$set": bson.M{"autoscale.enabled": false}})
+	}
+	err = autoScale.validate()
+	if err != nil {
+		return err
+	}
+	_, err = iaas.FindTemplate(autoScale.Template)
+	if err != nil {
+		return fmt.Errorf("template %q not found", autoScale.Template)
+	}
+	return coll.UpdateId(poolName, bson.M{"$set": bson.M{"autoscale": autoScale}})
+}
+
+type autoScaleEvent struct {
+	ID         bson.ObjectId `bson:"_id"`
+	StartTime  time.Time
+	EndTime    time.Time `bson:",omitempty"`
+	Pool       string
+	Action     string
+	Reason     string
+	Node       cluster.Node `bson:",omitempty"`
+	NodeCount  int
+	MinNodes   int
+	MaxNodes   int
+	Successful bool
+	Error      string `bson:",omitempty"`
+}
+
+func autoScaleCollection() (*storage.Collection, error) {
+	name, _ := config.GetString("docker:auto-scale:events_collection")
+	if name == "" {
+		name = "autoscale_events"
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("Failed to connect to the database: %s", err.Error())
+		return nil, err
+	}
+	return conn.Collection(name), nil
+}
+
+func newAutoScaleEvent(pool *Pool, action, reason string, nodeCount int) (*autoScaleEvent, error) {
+	evt := autoScaleEvent{
+		ID:        bson.NewObjectId(),
+		StartTime: time.Now().UTC(),
+		Pool:      pool.Name,
+		Action:    action,
+		Reason:    reason,
+		NodeCount: nodeCount,
+		MinNodes:  pool.AutoScale.MinNodes,
+		MaxNodes:  pool.AutoScale.MaxNodes,
+	}
+	coll, err := autoScaleCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	return &evt, coll.Insert(evt)
+}
+
+func (evt *autoScaleEvent) update(node cluster.Node, err error) error {
+	if err != nil {
+		evt.Error = err.Error()
+	}
+	evt.EndTime = time.Now().UTC()
+	evt.Node = node
+	evt.Successful = err == nil
+	coll, err := autoScaleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.UpdateId(evt.ID, evt)
+}
+
+func listAutoScaleHistory(poolName string) ([]autoScaleEvent, error) {
+	coll, err := autoScaleCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{}
+	if poolName != "" {
+		query["pool"] = poolName
+	}
+	var history []autoScaleEvent
+	err = coll.Find(query).Sort("-_id").Limit(200).All(&history)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// nodeMemory holds the memory reserved by units in a node and the memory
+// available to them, in bytes.
+type nodeMemory struct {
+	node     cluster.Node
+	reserved int64
+	capacity float64
+}
+
+func memoryUsage(nodes []nodeMemory) float64 {
+	var reserved, capacity float64
+	for _, n := range nodes {
+		reserved += float64(n.reserved)
+		capacity += n.capacity
+	}
+	if capacity == 0 {
+		return 0
+	}
+	return reserved / capacity
+}
+
+func (s segregatedScheduler) nodesMemory(nodes []cluster.Node) ([]nodeMemory, error) {
+	if s.maxMemoryRatio == 0 || s.totalMemoryMetadata == "" {
+		return nil, errAutoScaleNoMemoryMetadata
+	}
+	hostReserved, err := s.reservedMemoryByHost(nodes)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]nodeMemory, len(nodes))
+	for i, node := range nodes {
+		totalMemory, _ := strconv.ParseFloat(node.Metadata[s.totalMemoryMetadata], 64)
+		result[i] = nodeMemory{
+			node:     node,
+			reserved: hostReserved[urlToHost(node.Address)],
+			capacity: totalMemory * float64(s.maxMemoryRatio),
+		}
+	}
+	return result, nil
+}
+
+// scaleDownCandidate returns the index of the node with less reserved memory
+// among the nodes created by an IaaS, along with the memory usage of the pool
+// once its units are moved to the other nodes. It returns -1 when there's no
+// such node.
+func scaleDownCandidate(nodes []nodeMemory) (int, float64) {
+	candidate := -1
+	for i, n := range nodes {
+		if n.node.Metadata["iaas"] == "" {
+			continue
+		}
+		if candidate == -1 || n.reserved < nodes[candidate].reserved {
+			candidate = i
+		}
+	}
+	if candidate == -1 {
+		return -1, 0
+	}
+	var reserved, capacity float64
+	for _, n := range nodes {
+		reserved += float64(n.reserved)
+		capacity += n.capacity
+	}
+	capacity -= nodes[candidate].capacity
+	if capacity <= 0 {
+		return candidate, math.Inf(1)
+	}
+	return candidate, reserved / capacity
+}
+
+func autoScaleWaitTime() time.Duration {
+	waitSeconds, _ := config.GetDuration("docker:auto-scale:wait-new-time")
+	if waitSeconds <= 0 {
+		waitSeconds = 5 * 60
+	}
+	return waitSeconds * time.Second
+}
+
+// autoScaleLockTTL returns for how long a pool stays locked by an auto
+// scaling run, so locks held by processes that died while scaling a pool
+// don't block it forever. It must be greater than the time spent adding or
+// removing a node.
+func autoScaleLockTTL() time.Duration {
+	return 3 * autoScaleWaitTime()
+}
+
+// acquirePoolAutoScaleLock locks the pool in the database, preventing other
+// tsuru processes from scaling it at the same time. It returns false when
+// the pool is already locked.
+func acquirePoolAutoScaleLock(poolName string) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	query := bson.M{"_id": poolName, "$or": []bson.M{
+		{"autoscalelockeduntil": bson.M{"$exists": false}},
+		{"autoscalelockeduntil": bson.M{"$lt": now}},
+	}}
+	update := bson.M{"$set": bson.M{"autoscalelockeduntil": now.Add(autoScaleLockTTL())}}
+	err = conn.Collection(schedulerCollection).Update(query, update)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func releasePoolAutoScaleLock(poolName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$unset": bson.M{"autoscalelockeduntil": ""}})
+}
+
+func (p *dockerProvisioner) runAutoScale(interval time.Duration) {
+	for {
+		err := p.autoScaleOnce()
+		if err != nil {
+			log.Errorf("[node autoscale] %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// autoScaleOnce adds or removes nodes of each pool with auto scaling
+// enabled, according to the memory reserved by the units in the pool.
+func (p *dockerProvisioner) autoScaleOnce() error {
+	if p.scheduler == nil {
+		return errAutoScaleRequiresSegregate
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var pools []Pool
+	err = conn.Collection(schedulerCollection).Find(bson.M{"autoscale.enabled": true}).All(&pools)
+	if err != nil {
+		return err
+	}
+	for i := range pools {
+		err = p.lockAndAutoScalePool(&pools[i])
+		if err != nil {
+			log.Errorf("[node autoscale] Unable to scale pool %q: %s", pools[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// lockAndAutoScalePool scales the pool while holding its auto scaling lock.
+// When another process holds the lock, the run is skipped and recorded in
+// the auto scaling history.
+func (p *dockerProvisioner) lockAndAutoScalePool(pool *Pool) error {
+	locked, err := acquirePoolAutoScaleLock(pool.Name)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		log.Debugf("[node autoscale] Skipping pool %q: %s.", pool.Name, errAutoScalePoolLocked)
+		evt, err := newAutoScaleEvent(pool, "skip", "another auto scaling run is in progress", 0)
+		if err != nil {
+			return err
+		}
+		return evt.update(cluster.Node{}, errAutoScalePoolLocked)
+	}
+	defer func() {
+		if err := releasePoolAutoScaleLock(pool.Name); err != nil {
+			log.Errorf("[node autoscale] Unable to release lock of pool %q: %s", pool.Name, err)
+		}
+	}()
+	return p.autoScalePool(pool)
+}
+
+func (p *dockerProvisioner) poolNodes(dcluster *cluster.Cluster, poolName string) ([]cluster.Node, error) {
+	nodes, err := dcluster.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err = filterCordonedNodes(nodes)
+	if err != nil {
+		return nil, err
+	}
+	var poolNodes []cluster.Node
+	for _, node := range nodes {
+		if node.Metadata["pool"] == poolName {
+			poolNodes = append(poolNodes, node)
+		}
+	}
+	return poolNodes, nil
+}
+
+func (p *dockerProvisioner) autoScalePool(pool *Pool) error {
+	limits := pool.AutoScale
+	dcluster, err := p.getClusterByName(pool.Cluster)
+	if err != nil {
+		return err
+	}
+	nodes, err := p.poolNodes(dcluster, pool.Name)
+	if err != nil {
+		return err
+	}
+	if len(nodes) < limits.MinNodes {
+		reason := fmt.Sprintf("number of nodes %d is lower than the minimum of %d", len(nodes), limits.MinNodes)
+		return p.scaleUpPool(dcluster, pool, len(nodes), reason)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	memory, err := p.scheduler.nodesMemory(nodes)
+	if err != nil {
+		return err
+	}
+	usage := memoryUsage(memory)
+	if usage > limits.ScaleUpRatio {
+		if limits.MaxNodes > 0 && len(nodes) >= limits.MaxNodes {
+			log.Debugf("[node autoscale] Pool %q has reached the maximum of %d nodes, memory usage %0.2f.", pool.Name, limits.MaxNodes, usage)
+			return nil
+		}
+		reason := fmt.Sprintf("memory usage %0.2f is greater than the scale up ratio of %0.2f", usage, limits.ScaleUpRatio)
+		return p.scaleUpPool(dcluster, pool, len(nodes), reason)
+	}
+	minNodes := limits.MinNodes
+	if minNodes < 1 {
+		minNodes = 1
+	}
+	if usage >= limits.ScaleDownRatio || len(nodes) <= minNodes {
+		return nil
+	}
+	candidate, usageAfter := scaleDownCandidate(memory)
+	if candidate == -1 || usageAfter > limits.ScaleUpRatio {
+		return nil
+	}
+	reason := fmt.Sprintf("memory usage %0.2f is lower than the scale down ratio of %0.2f, %0.2f after removing the node", usage, limits.ScaleDownRatio, usageAfter)
+	return p.scaleDownPool(dcluster, pool, nodes[candidate], len(nodes), reason)
+}
+
+// scaleUpPool creates a machine from the auto scaling template of the pool
+// and registers it as a new node of the pool.
+func (p *dockerProvisioner) scaleUpPool(dcluster *cluster.Cluster, pool *Pool, nodeCount int, reason string) error {
+	log.Debugf("[node autoscale] Adding node to pool %q: %s.", pool.Name, reason)
+	evt, err := newAutoScaleEvent(pool, "add", reason, nodeCount)
+	if err != nil {
+		return err
+	}
+	node, err := p.addPoolNode(dcluster, pool)
+	updateErr := evt.update(node, err)
+	if updateErr != nil {
+		log.Errorf("[node autoscale] Error trying to update auto scale event: %s", updateErr)
+	}
+	return err
+}
+
+func (p *dockerProvisioner) addPoolNode(dcluster *cluster.Cluster, pool *Pool) (cluster.Node, error) {
+	params := map[string]string{"template": pool.AutoScale.Template, "pool": pool.Name}
+	m, err := iaas.CreateMachine(params)
+	if err != nil {
+		return cluster.Node{}, fmt.Errorf("error creating new machine: %s", err)
+	}
+	params["iaas"] = m.Iaas
+	node, err := dcluster.WaitAndRegister(m.FormatNodeAddress(), params, autoScaleWaitTime())
+	if err != nil {
+		m.Destroy()
+		return cluster.Node{}, fmt.Errorf("error registering new node %s: %s", m.Address, err)
+	}
+	return node, nil
+}
+
+// scaleDownPool moves the units of the node to the other nodes of the pool,
+// removes the node from the cluster and destroys its machine.
+func (p *dockerProvisioner) scaleDownPool(dcluster *cluster.Cluster, pool *Pool, node cluster.Node, nodeCount int, reason string) error {
+	log.Debugf("[node autoscale] Removing node %q from pool %q: %s.", node.Address, pool.Name, reason)
+	evt, err := newAutoScaleEvent(pool, "remove", reason, nodeCount)
+	if err != nil {
+		return err
+	}
+	err = p.removePoolNode(dcluster, node)
+	updateErr := evt.update(node, err)
+	if updateErr != nil {
+		log.Errorf("[node autoscale] Error trying to update auto scale event: %s", updateErr)
+	}
+	return err
+}
+
+func (p *dockerProvisioner) removePoolNode(dcluster *cluster.Cluster, node cluster.Node) error {
+	var buf bytes.Buffer
+	err := p.drainNode(node.Address, json.NewEncoder(&buf))
+	if err != nil {
+		p.uncordonNode(node.Address)
+		return fmt.Errorf("unable to move units away from node %s: %s: %s", node.Address, err, buf.String())
+	}
+	err = dcluster.Unregister(node.Address)
+	p.uncordonNode(node.Address)
+	if err != nil {
+		return fmt.Errorf("error unregistering node %s: %s", node.Address, err)
+	}
+	host := urlToHost(node.Address)
+	m, err := iaas.FindMachineByAddress(host)
+	if err != nil {
+		return fmt.Errorf("unable to find machine %s in IaaS: %s", host, err)
+	}
+	err = m.Destroy()
+	if err != nil {
+		return fmt.Errorf("unable to destroy machine %s from IaaS: %s", host, err)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsouza/go-dockerclient/testing"
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/iaas"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestPoolAutoScaleValidate(c *check.C) {
+	var tests = []struct {
+		autoScale PoolAutoScale
+		err       string
+	}{
+		{PoolAutoScale{Template: "tpl1", ScaleUpRatio: 0.8, ScaleDownRatio: 0.4}, ""},
+		{PoolAutoScale{Template: "tpl1", MinNodes: 1, MaxNodes: 3, ScaleUpRatio: 1}, ""},
+		{PoolAutoScale{ScaleUpRatio: 0.8}, "template is required for node auto scaling"},
+		{PoolAutoScale{Template: "tpl1", MinNodes: -1, ScaleUpRatio: 0.8}, "the limits of nodes cannot be negative"},
+		{PoolAutoScale{Template: "tpl1", MinNodes: 3, MaxNodes: 2, ScaleUpRatio: 0.8}, "the maximum number of nodes cannot be lower than the minimum"},
+		{PoolAutoScale{Template: "tpl1", ScaleUpRatio: 1.2}, "scale up ratio must be greater than 0 and at most 1"},
+		{PoolAutoScale{Template: "tpl1", ScaleUpRatio: 0.5, ScaleDownRatio: 0.5}, "scale down ratio must be lower than the scale up ratio"},
+	}
+	for _, t := range tests {
+		err := t.autoScale.validate()
+		if t.err == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, t.err)
+		}
+	}
+}
+
+func (s *S) TestSetPoolAutoScale(c *check.C) {
+	iaas.RegisterIaasProvider("my-scale-iaas", &TestHealerIaaS{})
+	tpl := iaas.Template{Name: "tpl1", IaaSName: "my-scale-iaas"}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate(tpl.Name)
+	coll := s.storage.Collection(schedulerCollection)
+	err = coll.Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("pool1")
+	autoScale := PoolAutoScale{Enabled: true, Template: "tpl1", MaxNodes: 3, ScaleUpRatio: 0.8, ScaleDownRatio: 0.4}
+	err = setPoolAutoScale("pool1", &autoScale)
+	c.Assert(err, check.IsNil)
+	var pool Pool
+	err = coll.FindId("pool1").One(&pool)
+	c.Assert(err, check.IsNil)
+	c.Assert(pool.AutoScale, check.DeepEquals, &autoScale)
+	err = setPoolAutoScale("pool1", nil)
+	c.Assert(err, check.IsNil)
+	err = coll.FindId("pool1").One(&pool)
+	c.Assert(err, check.IsNil)
+	autoScale.Enabled = false
+	c.Assert(pool.AutoScale, check.DeepEquals, &autoScale)
+}
+
+func (s *S) TestSetPoolAutoScaleTemplateNotFound(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("pool1")
+	autoScale := PoolAutoScale{Enabled: true, Template: "tpl1", ScaleUpRatio: 0.8}
+	err = setPoolAutoScale("pool1", &autoScale)
+	c.Assert(err, check.ErrorMatches, `template "tpl1" not found`)
+}
+
+func (s *S) TestScaleDownCandidate(c *check.C) {
+	nodes := []nodeMemory{
+		{node: cluster.Node{Address: "http://n1:2375"}, reserved: 100, capacity: 1000},
+		{node: cluster.Node{Address: "http://n2:2375", Metadata: map[string]string{"iaas": "ec2"}}, reserved: 300, capacity: 1000},
+		{node: cluster.Node{Address: "http://n3:2375", Metadata: map[string]string{"iaas": "ec2"}}, reserved: 200, capacity: 1000},
+	}
+	c.Assert(memoryUsage(nodes), check.Equals, 0.2)
+	candidate, usage := scaleDownCandidate(nodes)
+	c.Assert(candidate, check.Equals, 2)
+	c.Assert(usage, check.Equals, 0.3)
+	candidate, _ = scaleDownCandidate(nodes[:1])
+	c.Assert(candidate, check.Equals, -1)
+}
+
+func (s *S) TestAutoScaleOnceRequiresSegregatedScheduler(c *check.C) {
+	p := &dockerProvisioner{}
+	err := p.autoScaleOnce()
+	c.Assert(err, check.Equals, errAutoScaleRequiresSegregate)
+}
+
+func newAutoScaleProvisioner(c *check.C, nodes ...cluster.Node) *dockerProvisioner {
+	p := &dockerProvisioner{storage: &cluster.MapStorage{}}
+	p.scheduler = &segregatedScheduler{
+		maxMemoryRatio:      0.8,
+		totalMemoryMetadata: "totalMemory",
+		provisioner:         p,
+	}
+	var err error
+	p.cluster, err = cluster.New(p.scheduler, p.storage, nodes...)
+	c.Assert(err, check.IsNil)
+	return p
+}
+
+func (s *S) TestAutoScaleOnceAddsNode(c *check.C) {
+	defer func() {
+		machines, _ := iaas.ListMachines()
+		for _, m := range machines {
+			m.Destroy()
+		}
+	}()
+	iaas.RegisterIaasProvider("my-scale-iaas", &TestHealerIaaS{addr: "localhost"})
+	tpl := iaas.Template{Name: "tpl1", IaaSName: "my-scale-iaas"}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate(tpl.Name)
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer node1.Stop()
+	node2, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer node2.Stop()
+	config.Set("iaas:node-protocol", "http")
+	config.Set("iaas:node-port", urlPort(node2.URL()))
+	defer config.Unset("iaas:node-protocol")
+	defer config.Unset("iaas:node-port")
+	p := newAutoScaleProvisioner(c, cluster.Node{
+		Address:  node1.URL(),
+		Metadata: map[string]string{"pool": "pool1", "totalMemory": "1000"},
+	})
+	a := app.App{Name: "myapp", Plan: app.Plan{Memory: 600}}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a.Name})
+	coll := p.collection()
+	defer coll.Close()
+	err = coll.Insert(container{ID: "c1", AppName: a.Name, HostAddr: "127.0.0.1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("c1")
+	pool := Pool{Name: "pool1", AutoScale: &PoolAutoScale{
+		Enabled:        true,
+		Template:       "tpl1",
+		MaxNodes:       2,
+		ScaleUpRatio:   0.5,
+		ScaleDownRatio: 0.1,
+	}}
+	err = s.storage.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Collection(schedulerCollection).RemoveId(pool.Name)
+	err = p.autoScaleOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := p.getCluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	var created cluster.Node
+	for _, node := range nodes {
+		if urlToHost(node.Address) == "localhost" {
+			created = node
+		}
+	}
+	c.Assert(created.Metadata["pool"], check.Equals, "pool1")
+	c.Assert(created.Metadata["iaas"], check.Equals, "my-scale-iaas")
+	history, err := listAutoScaleHistory("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+	c.Assert(history[0].Action, check.Equals, "add")
+	c.Assert(history[0].Successful, check.Equals, true)
+	c.Assert(history[0].Node.Address, check.Equals, created.Address)
+	c.Assert(history[0].NodeCount, check.Equals, 1)
+	c.Assert(history[0].MaxNodes, check.Equals, 2)
+	c.Assert(history[0].Reason, check.Equals, "memory usage 0.75 is greater than the scale up ratio of 0.50")
+	err = p.autoScaleOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = p.getCluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	history, err = listAutoScaleHistory("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+}
+
+func (s *S) TestAutoScaleOnceRemovesNode(c *check.C) {
+	defer func() {
+		machines, _ := iaas.ListMachines()
+		for _, m := range machines {
+			m.Destroy()
+		}
+	}()
+	iaas.RegisterIaasProvider("my-scale-iaas", &TestHealerIaaS{addr: "localhost"})
+	_, err := iaas.CreateMachineForIaaS("my-scale-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer node1.Stop()
+	node2, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer node2.Stop()
+	node2Addr := fmt.Sprintf("http://localhost:%d", urlPort(node2.URL()))
+	p := newAutoScaleProvisioner(c,
+		cluster.Node{Address: node1.URL(), Metadata: map[string]string{"pool": "pool1", "totalMemory": "1000"}},
+		cluster.Node{Address: node2Addr, Metadata: map[string]string{"pool": "pool1", "totalMemory": "1000", "iaas": "my-scale-iaas"}},
+	)
+	pool := Pool{Name: "pool1", AutoScale: &PoolAutoScale{
+		Enabled:        true,
+		Template:       "tpl1",
+		MinNodes:       1,
+		ScaleUpRatio:   0.8,
+		ScaleDownRatio: 0.3,
+	}}
+	err = s.storage.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Collection(schedulerCollection).RemoveId(pool.Name)
+	err = p.autoScaleOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := p.getCluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(nodes[0].Address, check.Equals, node1.URL())
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+	history, err := listAutoScaleHistory("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+	c.Assert(history[0].Action, check.Equals, "remove")
+	c.Assert(history[0].Successful, check.Equals, true)
+	c.Assert(history[0].Node.Address, check.Equals, node2Addr)
+	c.Assert(history[0].MinNodes, check.Equals, 1)
+	err = p.autoScaleOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = p.getCluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
+
+func (s *S) TestPoolAutoScaleLock(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("pool1")
+	locked, err := acquirePoolAutoScaleLock("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	locked, err = acquirePoolAutoScaleLock("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, false)
+	err = releasePoolAutoScaleLock("pool1")
+	c.Assert(err, check.IsNil)
+	locked, err = acquirePoolAutoScaleLock("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = coll.UpdateId("pool1", bson.M{"$set": bson.M{"autoscalelockeduntil": time.Now().UTC().Add(-time.Second)}})
+	c.Assert(err, check.IsNil)
+	locked, err = acquirePoolAutoScaleLock("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+}
+
+func (s *S) TestAutoScaleOnceSkipsLockedPool(c *check.C) {
+	p := newAutoScaleProvisioner(c)
+	pool := Pool{Name: "pool1", AutoScale: &PoolAutoScale{
+		Enabled:      true,
+		Template:     "tpl1",
+		MinNodes:     1,
+		ScaleUpRatio: 0.5,
+	}}
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(pool.Name)
+	locked, err := acquirePoolAutoScaleLock(pool.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = p.autoScaleOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := p.getCluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 0)
+	history, err := listAutoScaleHistory("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+	c.Assert(history[0].Action, check.Equals, "skip")
+	c.Assert(history[0].Successful, check.Equals, false)
+	c.Assert(history[0].Error, check.Equals, errAutoScalePoolLocked.Error())
+	locked, err = acquirePoolAutoScaleLock(pool.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, false)
+}
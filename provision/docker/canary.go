@@ -0,0 +1,408 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	errCanaryInProgress  = errors.New("there is a canary deploy in progress for this app, promote or abort it first")
+	errNoCanary          = errors.New("there is no canary deploy in progress for this app")
+	errRouterNotWeighted = errors.New("the router of this app does not support weighted routes")
+	errNoWebUnits        = errors.New("the app has no units running the web process")
+)
+
+// canaryDeploy holds the state of the canary deploy of an app. An empty Image
+// means that the canary was started, but the deploy didn't finish yet.
+type canaryDeploy struct {
+	AppName string `bson:"_id"`
+	Weight  int
+	Image   string
+	Units   []string
+}
+
+func (c *canaryDeploy) active() bool {
+	return c.Image != ""
+}
+
+func canaryColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_canary", name)), nil
+}
+
+func getCanaryDeploy(appName string) (*canaryDeploy, error) {
+	coll, err := canaryColl()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var canary canaryDeploy
+	err = coll.FindId(appName).One(&canary)
+	if err == mgo.ErrNotFound {
+		return nil, errNoCanary
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &canary, nil
+}
+
+func getActiveCanaryDeploy(appName string) (*canaryDeploy, error) {
+	canary, err := getCanaryDeploy(appName)
+	if err != nil {
+		return nil, err
+	}
+	if !canary.active() {
+		return nil, errNoCanary
+	}
+	return canary, nil
+}
+
+func removeCanaryDeploy(appName string) error {
+	coll, err := canaryColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(appName)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// checkNoActiveCanary returns errCanaryInProgress when there's an active
+// canary deploy for the app.
+func checkNoActiveCanary(appName string) error {
+	canary, err := getCanaryDeploy(appName)
+	if err == errNoCanary {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if canary.active() {
+		return errCanaryInProgress
+	}
+	return nil
+}
+
+func weightedRouterForApp(app provision.App) (router.WeightedRouter, error) {
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return nil, err
+	}
+	wr, ok := r.(router.WeightedRouter)
+	if !ok {
+		return nil, errRouterNotWeighted
+	}
+	return wr, nil
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// maxRouteWeight is the highest weight set in a route. Routers like hipache
+// repeat the route once per unit of weight, so the weights are scaled down
+// when they're higher than this, trading some precision in the split of the
+// traffic for a bounded number of entries.
+const maxRouteWeight = 100
+
+// canaryRouteWeights returns the weight of the route of each current unit and
+// of each canary unit, so that the canary units receive percent of the
+// traffic in total. Weights are always between 1 and maxRouteWeight.
+func canaryRouteWeights(percent, currentUnits, canaryUnits int) (int, int) {
+	if currentUnits == 0 || canaryUnits == 0 {
+		return 1, 1
+	}
+	currentWeight := (100 - percent) * canaryUnits
+	canaryWeight := percent * currentUnits
+	d := gcd(currentWeight, canaryWeight)
+	currentWeight, canaryWeight = currentWeight/d, canaryWeight/d
+	highest := currentWeight
+	if canaryWeight > highest {
+		highest = canaryWeight
+	}
+	if highest > maxRouteWeight {
+		currentWeight = scaleWeight(currentWeight, highest)
+		canaryWeight = scaleWeight(canaryWeight, highest)
+	}
+	return currentWeight, canaryWeight
+}
+
+// scaleWeight scales weight down to the [1, maxRouteWeight] range, where
+// highest is mapped to maxRouteWeight.
+func scaleWeight(weight, highest int) int {
+	weight = (weight*maxRouteWeight + highest/2) / highest
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
+
+// canaryUnitsCount returns the number of canary units to start, keeping
+// roughly the same proportion as the traffic they'll receive.
+func canaryUnitsCount(percent, currentUnits int) int {
+	count := (currentUnits*percent + 99) / 100
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+func setRoutesWeight(r router.WeightedRouter, containers []container, weight int) error {
+	for _, cont := range containers {
+		err := r.SetRouteWeight(cont.AppName, cont.getAddress(), weight)
+		if err != nil && err != router.ErrRouteNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// canaryRouteWeight returns the weight of the route of the container while
+// its app has an active canary deploy, or 0 when there's no active canary.
+func (p *dockerProvisioner) canaryRouteWeight(cont *container) (int, error) {
+	canary, err := getActiveCanaryDeploy(cont.AppName)
+	if err == errNoCanary {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	canaryConts, currentConts, err := p.splitCanaryContainers(canary)
+	if err != nil {
+		return 0, err
+	}
+	currentWeight, canaryWeight := canaryRouteWeights(canary.Weight, len(routableContainers(currentConts)), len(canaryConts))
+	for _, c := range canaryConts {
+		if c.ID == cont.ID {
+			return canaryWeight, nil
+		}
+	}
+	return currentWeight, nil
+}
+
+// splitCanaryContainers separates the containers of the app in the ones
+// created by the canary deploy and the ones running the current version,
+// including the ones that don't receive traffic.
+func (p *dockerProvisioner) splitCanaryContainers(canary *canaryDeploy) ([]container, []container, error) {
+	containers, err := p.listContainersByApp(canary.AppName)
+	if err != nil {
+		return nil, nil, err
+	}
+	canaryIDs := make(map[string]bool, len(canary.Units))
+	for _, id := range canary.Units {
+		canaryIDs[id] = true
+	}
+	var canaryConts, currentConts []container
+	for _, c := range containers {
+		if canaryIDs[c.ID] {
+			canaryConts = append(canaryConts, c)
+		} else {
+			currentConts = append(currentConts, c)
+		}
+	}
+	return canaryConts, currentConts, nil
+}
+
+func (p *dockerProvisioner) StartCanary(app provision.App, weight int) error {
+	_, err := weightedRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	coll, err := canaryColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(canaryDeploy{AppName: app.GetName(), Weight: weight})
+	if mgo.IsDup(err) {
+		return errCanaryInProgress
+	}
+	return err
+}
+
+func (p *dockerProvisioner) SetCanaryWeight(app provision.App, weight int) error {
+	canary, err := getActiveCanaryDeploy(app.GetName())
+	if err != nil {
+		return err
+	}
+	canaryConts, currentConts, err := p.splitCanaryContainers(canary)
+	if err != nil {
+		return err
+	}
+	r, err := weightedRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	currentConts = routableContainers(currentConts)
+	currentWeight, canaryWeight := canaryRouteWeights(weight, len(currentConts), len(canaryConts))
+	err = setRoutesWeight(r, canaryConts, canaryWeight)
+	if err != nil {
+		return err
+	}
+	err = setRoutesWeight(r, currentConts, currentWeight)
+	if err != nil {
+		return err
+	}
+	coll, err := canaryColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.UpdateId(canary.AppName, bson.M{"$set": bson.M{"weight": weight}})
+}
+
+func (p *dockerProvisioner) PromoteCanary(app provision.App, w io.Writer) error {
+	canary, err := getActiveCanaryDeploy(app.GetName())
+	if err != nil {
+		return err
+	}
+	canaryConts, currentConts, err := p.splitCanaryContainers(canary)
+	if err != nil {
+		return err
+	}
+	r, err := weightedRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	toAdd := processUnitsCount(currentConts)
+	for process, n := range processUnitsCount(canaryConts) {
+		toAdd[process] -= n
+	}
+	for process, n := range toAdd {
+		if n <= 0 {
+			delete(toAdd, process)
+		}
+	}
+	args := changeUnitsPipelineArgs{
+		app:         app,
+		toRemove:    currentConts,
+		toAdd:       toAdd,
+		writer:      w,
+		imageId:     canary.Image,
+		provisioner: p,
+	}
+	var actions []*action.Action
+	if len(toAdd) > 0 {
+		actions = append(actions, &provisionAddUnitsToHost, &addNewRoutes)
+	}
+	actions = append(actions, &removeOldRoutes, &provisionRemoveOldUnits, &updateAppImage)
+	err = action.NewPipeline(actions...).Execute(args)
+	if err != nil {
+		return err
+	}
+	err = setRoutesWeight(r, canaryConts, 1)
+	if err != nil {
+		log.Errorf("Ignored error resetting route weights of canary units of %s: %s", app.GetName(), err)
+	}
+	return removeCanaryDeploy(app.GetName())
+}
+
+func (p *dockerProvisioner) AbortCanary(app provision.App, w io.Writer) error {
+	canary, err := getCanaryDeploy(app.GetName())
+	if err != nil {
+		return err
+	}
+	if !canary.active() {
+		return removeCanaryDeploy(app.GetName())
+	}
+	canaryConts, currentConts, err := p.splitCanaryContainers(canary)
+	if err != nil {
+		return err
+	}
+	r, err := weightedRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	fmt.Fprintf(w, "\n---- Removing %d canary units ----\n", len(canaryConts))
+	for _, cont := range canaryConts {
+		err = r.RemoveRoute(cont.AppName, cont.getAddress())
+		if err != nil && err != router.ErrRouteNotFound {
+			return err
+		}
+		err = p.removeContainer(&cont)
+		if err != nil {
+			log.Errorf("Ignored error trying to remove canary container %q: %s", cont.ID, err)
+		}
+		unit := cont.asUnit(app)
+		err = app.UnbindUnit(&unit)
+		if err != nil {
+			log.Errorf("Ignored error trying to unbind canary container %q: %s", cont.ID, err)
+		}
+		fmt.Fprintf(w, " ---> Removed canary unit %s\n", cont.shortID())
+	}
+	err = setRoutesWeight(r, routableContainers(currentConts), 1)
+	if err != nil {
+		return err
+	}
+	p.cleanImage(app.GetName(), canary.Image)
+	return removeCanaryDeploy(app.GetName())
+}
+
+// runCanaryPipeline starts the canary units of the app, running the same
+// process as the current units that receive traffic.
+func (p *dockerProvisioner) runCanaryPipeline(w io.Writer, a provision.App, currentContainers []container, imageId string, weight int) ([]container, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	currentContainers = routableContainers(currentContainers)
+	if len(currentContainers) == 0 {
+		return nil, errNoWebUnits
+	}
+	process := currentContainers[0].ProcessName
+	args := changeUnitsPipelineArgs{
+		app:          a,
+		toKeep:       currentContainers,
+		toAdd:        map[string]int{process: canaryUnitsCount(weight, len(currentContainers))},
+		writer:       w,
+		imageId:      imageId,
+		canaryWeight: weight,
+		provisioner:  p,
+	}
+	pipeline := action.NewPipeline(
+		&provisionAddUnitsToHost,
+		&addCanaryRoutes,
+		&saveCanaryUnits,
+	)
+	pipeline.SetCanceled(deployCanceled(a.GetName()))
+	err := pipeline.Execute(args)
+	if err != nil {
+		return nil, err
+	}
+	return pipeline.Result().([]container), nil
+}
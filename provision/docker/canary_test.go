@@ -0,0 +1,210 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestCanaryRouteWeights(c *check.C) {
+	var tests = []struct {
+		percent, current, canary    int
+		currentWeight, canaryWeight int
+	}{
+		{10, 1, 1, 9, 1},
+		{50, 4, 2, 1, 2},
+		{10, 3, 1, 3, 1},
+		{25, 4, 1, 3, 4},
+		{99, 1, 1, 1, 99},
+		{10, 0, 1, 1, 1},
+		{10, 2, 0, 1, 1},
+		{10, 0, 0, 1, 1},
+		{99, 10, 1, 1, 100},
+		{1, 1, 50, 100, 1},
+		{37, 50, 3, 10, 100},
+	}
+	for _, t := range tests {
+		currentWeight, canaryWeight := canaryRouteWeights(t.percent, t.current, t.canary)
+		c.Check(currentWeight, check.Equals, t.currentWeight)
+		c.Check(canaryWeight, check.Equals, t.canaryWeight)
+	}
+}
+
+func (s *S) TestCanaryUnitsCount(c *check.C) {
+	c.Assert(canaryUnitsCount(10, 1), check.Equals, 1)
+	c.Assert(canaryUnitsCount(10, 20), check.Equals, 2)
+	c.Assert(canaryUnitsCount(50, 3), check.Equals, 2)
+	c.Assert(canaryUnitsCount(99, 4), check.Equals, 4)
+}
+
+func (s *S) TestStartCanary(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	err := s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	canary, err := getCanaryDeploy(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(canary.Weight, check.Equals, 10)
+	c.Assert(canary.active(), check.Equals, false)
+	err = s.p.StartCanary(app, 20)
+	c.Assert(err, check.Equals, errCanaryInProgress)
+}
+
+func (s *S) TestDeployCanary(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = s.p.deploy(app, "tsuru/python", &buf)
+	c.Assert(err, check.IsNil)
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	canary, err := getActiveCanaryDeploy(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(canary.Image, check.Equals, "tsuru/python")
+	c.Assert(canary.Units, check.HasLen, 1)
+	canaryConts, currentConts, err := s.p.splitCanaryContainers(canary)
+	c.Assert(err, check.IsNil)
+	c.Assert(canaryConts, check.HasLen, 1)
+	c.Assert(currentConts, check.HasLen, 1)
+	c.Assert(currentConts[0].ID, check.Equals, cont.ID)
+	weights, err := routertest.FakeRouter.RouteWeights(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{
+		cont.getAddress():           9,
+		canaryConts[0].getAddress(): 1,
+	})
+	err = s.p.deploy(app, "tsuru/python", &buf)
+	c.Assert(err, check.Equals, errCanaryInProgress)
+	err = s.p.Restart(app, nil)
+	c.Assert(err, check.Equals, errCanaryInProgress)
+}
+
+func (s *S) TestSetCanaryWeight(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	err = s.p.deploy(app, "tsuru/python", nil)
+	c.Assert(err, check.IsNil)
+	err = s.p.SetCanaryWeight(app, 50)
+	c.Assert(err, check.IsNil)
+	canary, err := getActiveCanaryDeploy(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(canary.Weight, check.Equals, 50)
+	canaryConts, _, err := s.p.splitCanaryContainers(canary)
+	c.Assert(err, check.IsNil)
+	weights, err := routertest.FakeRouter.RouteWeights(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{
+		cont.getAddress():           1,
+		canaryConts[0].getAddress(): 1,
+	})
+}
+
+func (s *S) TestSetCanaryWeightNoCanary(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	err := s.p.SetCanaryWeight(app, 50)
+	c.Assert(err, check.Equals, errNoCanary)
+}
+
+func (s *S) TestPromoteCanary(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	err = s.p.deploy(app, "tsuru/python", nil)
+	c.Assert(err, check.IsNil)
+	canary, err := getActiveCanaryDeploy(app.GetName())
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = s.p.PromoteCanary(app, &buf)
+	c.Assert(err, check.IsNil)
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 1)
+	c.Assert(containers[0].ID, check.Equals, canary.Units[0])
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), check.Equals, false)
+	weights, err := routertest.FakeRouter.RouteWeights(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{containers[0].getAddress(): 1})
+	imageId, err := appCurrentImageName(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(imageId, check.Equals, "tsuru/python")
+	_, err = getCanaryDeploy(app.GetName())
+	c.Assert(err, check.Equals, errNoCanary)
+}
+
+func (s *S) TestAbortCanary(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	err = s.p.deploy(app, "tsuru/python", nil)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = s.p.AbortCanary(app, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, "(?s).*Removing 1 canary units.*")
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 1)
+	c.Assert(containers[0].ID, check.Equals, cont.ID)
+	weights, err := routertest.FakeRouter.RouteWeights(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{cont.getAddress(): 1})
+	_, err = getCanaryDeploy(app.GetName())
+	c.Assert(err, check.Equals, errNoCanary)
+}
+
+func (s *S) TestAbortCanaryNotStarted(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	err := s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	err = s.p.AbortCanary(app, nil)
+	c.Assert(err, check.IsNil)
+	_, err = getCanaryDeploy(app.GetName())
+	c.Assert(err, check.Equals, errNoCanary)
+}
+
+func (s *S) TestRunCanaryPipelineDeployCanceled(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.StartCanary(app, 10)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.RunningDeploys().Insert(bson.M{"_id": app.GetName(), "canceled": true})
+	c.Assert(err, check.IsNil)
+	defer conn.RunningDeploys().RemoveId(app.GetName())
+	var buf bytes.Buffer
+	err = s.p.deploy(app, "tsuru/python", &buf)
+	c.Assert(err, check.Equals, action.ErrCanceled)
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 1)
+	c.Assert(containers[0].ID, check.Equals, cont.ID)
+	_, err = getActiveCanaryDeploy(app.GetName())
+	c.Assert(err, check.Equals, errNoCanary)
+}
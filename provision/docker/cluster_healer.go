@@ -24,6 +24,7 @@ import (
 
 type Healer struct {
 	provisioner           *dockerProvisioner
+	cluster               *cluster.Cluster
 	disabledTime          time.Duration
 	waitTimeNewMachine    time.Duration
 	failuresBeforeHealing int
@@ -40,6 +41,7 @@ type healingEvent struct {
 	CreatedContainer container    `bson:",omitempty"`
 	Successful       bool
 	Error            string `bson:",omitempty"`
+	Reason           string `bson:",omitempty"`
 }
 
 var (
@@ -102,6 +104,14 @@ func (evt *healingEvent) update(created interface{}, err error) error {
 	return coll.UpdateId(evt.ID, evt)
 }
 
+// getCluster returns the cluster of the nodes healed by the healer.
+func (h *Healer) getCluster() *cluster.Cluster {
+	if h.cluster != nil {
+		return h.cluster
+	}
+	return h.provisioner.getCluster()
+}
+
 func (h *Healer) healNode(node *cluster.Node) (cluster.Node, error) {
 	emptyNode := cluster.Node{}
 	failingAddr := node.Address
@@ -113,17 +123,17 @@ func (h *Healer) healNode(node *cluster.Node) (cluster.Node, error) {
 		node.ResetFailures()
 		return emptyNode, fmt.Errorf("Can't auto-heal after %d failures for node %s: error creating new machine: %s", failures, failingHost, err.Error())
 	}
-	err = h.provisioner.getCluster().Unregister(failingAddr)
+	err = h.getCluster().Unregister(failingAddr)
 	if err != nil {
 		machine.Destroy()
 		return emptyNode, fmt.Errorf("Can't auto-heal after %d failures for node %s: error unregistering old node: %s", failures, failingHost, err.Error())
 	}
 	newAddr := machine.FormatNodeAddress()
 	log.Debugf("New machine created during healing process: %s - Waiting for docker to start...", newAddr)
-	createdNode, err := h.provisioner.getCluster().WaitAndRegister(newAddr, nodeMetadata, h.waitTimeNewMachine)
+	createdNode, err := h.getCluster().WaitAndRegister(newAddr, nodeMetadata, h.waitTimeNewMachine)
 	if err != nil {
 		node.ResetFailures()
-		h.provisioner.getCluster().Register(failingAddr, nodeMetadata)
+		h.getCluster().Register(failingAddr, nodeMetadata)
 		machine.Destroy()
 		return emptyNode, fmt.Errorf("Can't auto-heal after %d failures for node %s: error registering new node: %s", failures, failingHost, err.Error())
 	}
@@ -204,7 +214,7 @@ func (p *dockerProvisioner) healContainer(cont container, locker *appLocker) (co
 }
 
 func (p *dockerProvisioner) hasProcfileWatcher(cont container) (bool, error) {
-	topResult, err := p.getCluster().TopContainer(cont.ID, "")
+	topResult, err := cont.getCluster(p).TopContainer(cont.ID, "")
 	if err != nil {
 		return false, err
 	}
@@ -236,6 +246,13 @@ func (p *dockerProvisioner) healContainerIfNeeded(cont container) error {
 		cont.setStatus(p, provision.StatusStarted.String())
 		return nil
 	}
+	return p.healContainerWithReason(cont, fmt.Sprintf("unresponsive since %s", cont.LastSuccessStatusUpdate))
+}
+
+// healContainerWithReason replaces the container by a new one, recording a
+// healing event with the reason of the healing. Containers healed too many
+// times in a short period aren't healed again.
+func (p *dockerProvisioner) healContainerWithReason(cont container, reason string) error {
 	healingCounter, err := healingCountFor("container", cont.ID, consecutiveHealingsTimeframe)
 	if err != nil {
 		return fmt.Errorf("Containers healing: couldn't verify number of previous healings for %s: %s", cont.ID, err.Error())
@@ -258,11 +275,12 @@ func (p *dockerProvisioner) healContainerIfNeeded(cont container) error {
 		}
 		return fmt.Errorf("Containers healing: unable to heal %s couldn't verify it still exists.", cont.ID)
 	}
-	log.Errorf("Initiating healing process for container %s, unresponsive since %s.", cont.ID, cont.LastSuccessStatusUpdate)
+	log.Errorf("Initiating healing process for container %s, %s.", cont.ID, reason)
 	evt, err := newHealingEvent(cont)
 	if err != nil {
 		return fmt.Errorf("Error trying to insert container healing event, healing aborted: %s", err.Error())
 	}
+	evt.Reason = reason
 	newCont, healErr := p.healContainer(cont, locker)
 	if healErr != nil {
 		healErr = fmt.Errorf("Error healing container %s: %s", cont.ID, healErr.Error())
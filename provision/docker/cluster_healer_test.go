@@ -97,7 +97,7 @@ func (s *S) TestHealerHealNode(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -342,7 +342,7 @@ func (s *S) TestHealerHealNodeDestroyError(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -438,7 +438,7 @@ func (s *S) TestHealContainer(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -497,7 +497,7 @@ func (s *S) TestRunContainerHealer(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -574,7 +574,7 @@ func (s *S) TestRunContainerHealerConcurrency(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -656,7 +656,7 @@ func (s *S) TestRunContainerHealerAlreadyHealed(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -729,7 +729,7 @@ func (s *S) TestRunContainerHealerDoesntHealWithProcfileInTop(c *check.C) {
 	c.Assert(err, check.IsNil)
 	cont, err := addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -778,7 +778,7 @@ func (s *S) TestRunContainerHealerWithError(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -895,7 +895,7 @@ func (s *S) TestHealerHandleError(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "127.0.0.1",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: &p,
@@ -0,0 +1,317 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	errNamedClustersRequireSegregate = errors.New("docker:clusters requires the segregated scheduler (docker:segregate)")
+	errMoveAcrossClusters            = errors.New("the units of the app can't be moved to a pool in another docker cluster")
+)
+
+// clusterKey returns the config key of a docker setting for the given
+// cluster. Named clusters take the same settings of the docker section under
+// docker:clusters:<name>, falling back to the docker section for unset
+// settings. The default cluster has an empty name.
+func clusterKey(clusterName, key string) string {
+	if clusterName != "" {
+		namedKey := fmt.Sprintf("docker:clusters:%s:%s", clusterName, key)
+		if _, err := config.Get(namedKey); err == nil {
+			return namedKey
+		}
+	}
+	return "docker:" + key
+}
+
+// namedClusters returns the names of the clusters declared in
+// docker:clusters, sorted.
+func namedClusters() []string {
+	value, err := config.Get("docker:clusters")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	switch clusters := value.(type) {
+	case map[interface{}]interface{}:
+		for name := range clusters {
+			names = append(names, fmt.Sprint(name))
+		}
+	case map[string]interface{}:
+		for name := range clusters {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isClusterDeclared(clusterName string) bool {
+	for _, name := range namedClusters() {
+		if name == clusterName {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterRegistry returns the registry where images built in the cluster are
+// pushed.
+func clusterRegistry(clusterName string) string {
+	registry, _ := config.GetString(clusterKey(clusterName, "registry"))
+	return registry
+}
+
+func initNamedClusters(p *dockerProvisioner) {
+	names := namedClusters()
+	if len(names) == 0 {
+		return
+	}
+	if !isSegregateScheduler() {
+		panic(errNamedClustersRequireSegregate)
+	}
+	p.clusters = make(map[string]*cluster.Cluster, len(names))
+	p.clusterStorages = make(map[string]cluster.Storage, len(names))
+	for _, name := range names {
+		storage, err := buildClusterStorage(name)
+		if err != nil {
+			panic(err)
+		}
+		c, err := cluster.New(p.scheduler, storage)
+		if err != nil {
+			panic(err)
+		}
+		p.clusters[name] = c
+		p.clusterStorages[name] = storage
+		p.setClusterHealing(name, c)
+	}
+}
+
+// setClusterHealing enables the healing of the nodes and the active
+// monitoring of the cluster, according to its healing settings.
+func (p *dockerProvisioner) setClusterHealing(clusterName string, c *cluster.Cluster) {
+	autoHealingNodes, _ := config.GetBool(clusterKey(clusterName, "healing:heal-nodes"))
+	if autoHealingNodes {
+		disabledSeconds, _ := config.GetDuration(clusterKey(clusterName, "healing:disabled-time"))
+		if disabledSeconds <= 0 {
+			disabledSeconds = 30
+		}
+		maxFailures, _ := config.GetInt(clusterKey(clusterName, "healing:max-failures"))
+		if maxFailures <= 0 {
+			maxFailures = 5
+		}
+		waitSecondsNewMachine, _ := config.GetDuration(clusterKey(clusterName, "healing:wait-new-time"))
+		if waitSecondsNewMachine <= 0 {
+			waitSecondsNewMachine = 5 * 60
+		}
+		healer := Healer{
+			provisioner:           p,
+			cluster:               c,
+			disabledTime:          disabledSeconds * time.Second,
+			waitTimeNewMachine:    waitSecondsNewMachine * time.Second,
+			failuresBeforeHealing: maxFailures,
+		}
+		c.SetHealer(&healer)
+	}
+	activeMonitoring, _ := config.GetDuration(clusterKey(clusterName, "healing:active-monitoring-interval"))
+	if activeMonitoring > 0 {
+		c.StartActiveMonitoring(activeMonitoring * time.Second)
+	}
+}
+
+// clusterNames returns the names of all the clusters of the provisioner,
+// starting with the default cluster.
+func (p *dockerProvisioner) clusterNames() []string {
+	p.getCluster()
+	p.cmutex.Lock()
+	defer p.cmutex.Unlock()
+	names := make([]string, 0, len(p.clusters)+1)
+	names = append(names, "")
+	for name := range p.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+func (p *dockerProvisioner) getClusterByName(clusterName string) (*cluster.Cluster, error) {
+	defaultCluster := p.getCluster()
+	if clusterName == "" {
+		return defaultCluster, nil
+	}
+	p.cmutex.Lock()
+	defer p.cmutex.Unlock()
+	c, ok := p.clusters[clusterName]
+	if !ok {
+		return nil, fmt.Errorf("docker cluster %q not found", clusterName)
+	}
+	return c, nil
+}
+
+// getCluster returns the cluster where the container runs.
+func (c *container) getCluster(p *dockerProvisioner) *cluster.Cluster {
+	dcluster, err := p.getClusterByName(c.Cluster)
+	if err != nil {
+		log.Errorf("Failed to get the cluster of container %s: %s", c.shortID(), err)
+		return p.getCluster()
+	}
+	return dcluster
+}
+
+// appClusterName returns the name of the cluster where the units of the app
+// run, which is the cluster of the first pool of the app.
+func appClusterName(appName string) (string, error) {
+	a, _ := app.GetByName(appName)
+	pools, err := poolsForApp(a)
+	if err == errNoFallback {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return pools[0].Cluster, nil
+}
+
+func (p *dockerProvisioner) clusterForApp(appName string) (*cluster.Cluster, string, error) {
+	clusterName, err := appClusterName(appName)
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := p.getClusterByName(clusterName)
+	return c, clusterName, err
+}
+
+// nodesByCluster returns the nodes of all the clusters, keyed by the name of
+// the cluster.
+func (p *dockerProvisioner) nodesByCluster(unfiltered bool) (map[string][]cluster.Node, error) {
+	result := make(map[string][]cluster.Node)
+	for _, name := range p.clusterNames() {
+		c, err := p.getClusterByName(name)
+		if err != nil {
+			return nil, err
+		}
+		var nodes []cluster.Node
+		if unfiltered {
+			nodes, err = c.UnfilteredNodes()
+		} else {
+			nodes, err = c.Nodes()
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[name] = nodes
+	}
+	return result, nil
+}
+
+// unfilteredNodes returns the nodes of all the clusters, including the
+// disabled ones.
+func (p *dockerProvisioner) unfilteredNodes() ([]cluster.Node, error) {
+	return p.allNodes(true)
+}
+
+// nodes returns the enabled nodes of all the clusters.
+func (p *dockerProvisioner) nodes() ([]cluster.Node, error) {
+	return p.allNodes(false)
+}
+
+func (p *dockerProvisioner) allNodes(unfiltered bool) ([]cluster.Node, error) {
+	byCluster, err := p.nodesByCluster(unfiltered)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []cluster.Node
+	for _, name := range p.clusterNames() {
+		nodes = append(nodes, byCluster[name]...)
+	}
+	return nodes, nil
+}
+
+// clusterForNode returns the cluster where the node with the given address
+// is registered, or the default cluster when no cluster has the node.
+func (p *dockerProvisioner) clusterForNode(address string) (*cluster.Cluster, string, error) {
+	byCluster, err := p.nodesByCluster(true)
+	if err != nil {
+		return nil, "", err
+	}
+	for name, nodes := range byCluster {
+		for _, node := range nodes {
+			if node.Address == address || urlToHost(node.Address) == address {
+				c, err := p.getClusterByName(name)
+				return c, name, err
+			}
+		}
+	}
+	return p.getCluster(), "", nil
+}
+
+func poolClusterName(poolName string) (string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	var pool Pool
+	err = conn.Collection(schedulerCollection).FindId(poolName).One(&pool)
+	if err != nil {
+		return "", err
+	}
+	return pool.Cluster, nil
+}
+
+// clusterForPool returns the cluster where the nodes of the pool are
+// registered.
+func (p *dockerProvisioner) clusterForPool(poolName string) (*cluster.Cluster, error) {
+	clusterName, err := poolClusterName(poolName)
+	if err != nil {
+		return nil, err
+	}
+	return p.getClusterByName(clusterName)
+}
+
+// setPoolCluster assigns the pool to the named cluster, or to the default
+// cluster when clusterName is empty. Only pools without nodes can be
+// assigned to another cluster.
+func (p *dockerProvisioner) setPoolCluster(poolName, clusterName string) error {
+	if clusterName != "" && !isClusterDeclared(clusterName) {
+		return fmt.Errorf("docker cluster %q not found", clusterName)
+	}
+	current, err := poolClusterName(poolName)
+	if err != nil {
+		return err
+	}
+	if current == clusterName {
+		return nil
+	}
+	nodes, err := p.unfilteredNodes()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node.Metadata["pool"] == poolName {
+			return fmt.Errorf("pool %q has nodes, remove them before assigning the pool to another cluster", poolName)
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if clusterName == "" {
+		return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$unset": bson.M{"cluster": ""}})
+	}
+	return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$set": bson.M{"cluster": clusterName}})
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestClusterKey(c *check.C) {
+	config.Set("docker:clusters:cluster1:registry", "registry.cluster1:5000")
+	defer config.Unset("docker:clusters")
+	c.Assert(clusterKey("", "registry"), check.Equals, "docker:registry")
+	c.Assert(clusterKey("cluster1", "registry"), check.Equals, "docker:clusters:cluster1:registry")
+	c.Assert(clusterKey("cluster1", "healing:heal-nodes"), check.Equals, "docker:healing:heal-nodes")
+}
+
+func (s *S) TestNamedClusters(c *check.C) {
+	c.Assert(namedClusters(), check.HasLen, 0)
+	config.Set("docker:clusters:west:registry", "registry.west:5000")
+	config.Set("docker:clusters:east:registry", "registry.east:5000")
+	defer config.Unset("docker:clusters")
+	c.Assert(namedClusters(), check.DeepEquals, []string{"east", "west"})
+	c.Assert(isClusterDeclared("east"), check.Equals, true)
+	c.Assert(isClusterDeclared("north"), check.Equals, false)
+}
+
+func (s *S) TestImageNamesUseClusterRegistry(c *check.C) {
+	config.Set("docker:registry", "localhost:3030")
+	defer config.Unset("docker:registry")
+	config.Set("docker:clusters:cluster1:registry", "registry.cluster1:5000")
+	defer config.Unset("docker:clusters")
+	c.Assert(platformImageName("", "python"), check.Equals, "localhost:3030/tsuru/python")
+	c.Assert(platformImageName("cluster1", "python"), check.Equals, "registry.cluster1:5000/tsuru/python")
+	c.Assert(basicImageName("cluster1"), check.Equals, "registry.cluster1:5000/tsuru")
+}
+
+func (s *S) TestGetClusterByName(c *check.C) {
+	named, err := cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	s.p.clusters = map[string]*cluster.Cluster{"cluster1": named}
+	dcluster, err := s.p.getClusterByName("")
+	c.Assert(err, check.IsNil)
+	c.Assert(dcluster, check.Equals, s.p.cluster)
+	dcluster, err = s.p.getClusterByName("cluster1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dcluster, check.Equals, named)
+	_, err = s.p.getClusterByName("cluster2")
+	c.Assert(err, check.ErrorMatches, `docker cluster "cluster2" not found`)
+	cont := container{ID: "abc123", Cluster: "cluster1"}
+	c.Assert(cont.getCluster(s.p), check.Equals, named)
+	cont.Cluster = "cluster2"
+	c.Assert(cont.getCluster(s.p), check.Equals, s.p.cluster)
+	c.Assert(s.p.clusterNames(), check.DeepEquals, []string{"", "cluster1"})
+}
+
+func (s *S) TestClusterForNode(c *check.C) {
+	named, err := cluster.New(nil, &cluster.MapStorage{}, cluster.Node{Address: "http://10.10.10.1:2375"})
+	c.Assert(err, check.IsNil)
+	s.p.clusters = map[string]*cluster.Cluster{"cluster1": named}
+	dcluster, clusterName, err := s.p.clusterForNode("http://10.10.10.1:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(dcluster, check.Equals, named)
+	c.Assert(clusterName, check.Equals, "cluster1")
+	dcluster, clusterName, err = s.p.clusterForNode(s.server.URL())
+	c.Assert(err, check.IsNil)
+	c.Assert(dcluster, check.Equals, s.p.cluster)
+	c.Assert(clusterName, check.Equals, "")
+	nodes, err := s.p.unfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+}
+
+func (s *S) TestAppClusterName(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(Pool{Name: "pool1", Teams: []string{"tsuruteam"}, Cluster: "cluster1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("pool1")
+	a := app.App{Name: "myapp", TeamOwner: "tsuruteam"}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(map[string]string{"name": a.Name})
+	clusterName, err := appClusterName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(clusterName, check.Equals, "cluster1")
+}
+
+func (s *S) TestAppClusterNameWithoutPools(c *check.C) {
+	clusterName, err := appClusterName("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(clusterName, check.Equals, "")
+}
+
+func (s *S) TestSetPoolCluster(c *check.C) {
+	config.Set("docker:clusters:cluster1:registry", "registry.cluster1:5000")
+	defer config.Unset("docker:clusters")
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("pool1")
+	err = s.p.setPoolCluster("pool1", "cluster1")
+	c.Assert(err, check.IsNil)
+	var pool Pool
+	err = coll.FindId("pool1").One(&pool)
+	c.Assert(err, check.IsNil)
+	c.Assert(pool.Cluster, check.Equals, "cluster1")
+	err = s.p.setPoolCluster("pool1", "")
+	c.Assert(err, check.IsNil)
+	var defaultPool Pool
+	err = coll.FindId("pool1").One(&defaultPool)
+	c.Assert(err, check.IsNil)
+	c.Assert(defaultPool.Cluster, check.Equals, "")
+}
+
+func (s *S) TestSetPoolClusterUndeclaredCluster(c *check.C) {
+	err := s.p.setPoolCluster("pool1", "cluster1")
+	c.Assert(err, check.ErrorMatches, `docker cluster "cluster1" not found`)
+}
+
+func (s *S) TestSetPoolClusterPoolWithNodes(c *check.C) {
+	config.Set("docker:clusters:cluster1:registry", "registry.cluster1:5000")
+	defer config.Unset("docker:clusters")
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("pool1")
+	_, err = s.p.cluster.Register("http://10.10.10.1:2375", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	err = s.p.setPoolCluster("pool1", "cluster1")
+	c.Assert(err, check.ErrorMatches, `pool "pool1" has nodes, remove them before assigning the pool to another cluster`)
+}
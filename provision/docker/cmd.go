@@ -3,9 +3,11 @@ package docker
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -141,6 +143,65 @@ func (c *removeNodeFromSchedulerCmd) Flags() *gnuflag.FlagSet {
 	return c.fs
 }
 
+type cordonNodeCmd struct{}
+
+func (cordonNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-node-cordon",
+		Usage: "docker-node-cordon <address>",
+		Desc: `Marks a node as unschedulable. No new containers will be created in the
+node, but the containers already running in it are kept.`,
+		MinArgs: 1,
+	}
+}
+
+func (cordonNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	err := postNodeAction(client, ctx.Args[0], "cordon")
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Node successfully cordoned.\n"))
+	return nil
+}
+
+type uncordonNodeCmd struct{}
+
+func (uncordonNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-node-uncordon",
+		Usage:   "docker-node-uncordon <address>",
+		Desc:    "Marks a cordoned node as schedulable again.",
+		MinArgs: 1,
+	}
+}
+
+func (uncordonNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	err := postNodeAction(client, ctx.Args[0], "uncordon")
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Node successfully uncordoned.\n"))
+	return nil
+}
+
+func postNodeAction(client *cmd.Client, address, action string) error {
+	b, err := json.Marshal(map[string]string{"address": address})
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/node/" + action)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(req)
+	return err
+}
+
 type listNodesInTheSchedulerCmd struct {
 	fs     *gnuflag.FlagSet
 	filter filterList
@@ -205,6 +266,12 @@ func (c *listNodesInTheSchedulerCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 			machineMap[machine["Address"].(string)] = m.(map[string]interface{})
 		}
 	}
+	cordoned := map[string]bool{}
+	if result["cordoned"] != nil {
+		for _, addr := range result["cordoned"].([]interface{}) {
+			cordoned[addr.(string)] = true
+		}
+	}
 	t := cmd.Table{Headers: cmd.Row([]string{"Address", "IaaS ID", "Status", "Metadata"}), LineSeparator: true}
 	var nodes []interface{}
 	if result["nodes"] != nil {
@@ -214,6 +281,9 @@ func (c *listNodesInTheSchedulerCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 		node := n.(map[string]interface{})
 		addr := node["Address"].(string)
 		status := node["Status"].(string)
+		if cordoned[addr] {
+			status += " (cordoned)"
+		}
 		result := []string{}
 		metadataField, _ := node["Metadata"]
 		if c.filter != nil && metadataField == nil {
@@ -249,6 +319,102 @@ func (c *listNodesInTheSchedulerCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 	return nil
 }
 
+type nodeUsageCmd struct {
+	fs   *gnuflag.FlagSet
+	pool string
+}
+
+func (c *nodeUsageCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-node-usage",
+		Usage: "docker-node-usage [-p/--pool pool]",
+		Desc: `Show the memory, swap and CPU share reserved by the plans of the units in
+each node and pool, against the capacity declared in the node metadata, along
+with the number of units in each status and the apps using most of each node.`,
+	}
+}
+
+func (c *nodeUsageCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		pool := "Show only the nodes of the pool"
+		c.fs.StringVar(&c.pool, "pool", "", pool)
+		c.fs.StringVar(&c.pool, "p", "", pool)
+	}
+	return c.fs
+}
+
+func formatReserved(reserved, total int64, unit string, divisor int64) string {
+	result := fmt.Sprintf("%d%s", reserved/divisor, unit)
+	if total > 0 {
+		result += fmt.Sprintf(" / %d%s (%d%%)", total/divisor, unit, reserved*100/total)
+	}
+	return result
+}
+
+func formatContainerCounts(counts map[string]int) string {
+	result := make([]string, 0, len(counts))
+	for status, count := range counts {
+		result = append(result, fmt.Sprintf("%s: %d", status, count))
+	}
+	sort.Strings(result)
+	return strings.Join(result, "\n")
+}
+
+func (c *nodeUsageCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	url, err := cmd.GetURL(fmt.Sprintf("/docker/node/usage?pool=%s", c.pool))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var report usageReport
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	if err != nil {
+		return err
+	}
+	const megabyte = 1024 * 1024
+	fmt.Fprintln(ctx.Stdout, "Nodes:")
+	t := cmd.Table{Headers: cmd.Row([]string{"Address", "Pool", "Memory", "Swap", "CPU Share", "Units", "Top Apps"}), LineSeparator: true}
+	for _, node := range report.Nodes {
+		apps := make([]string, len(node.TopApps))
+		for i, a := range node.TopApps {
+			apps[i] = fmt.Sprintf("%s (%d units, %dMB)", a.App, a.Units, a.Memory/megabyte)
+		}
+		t.AddRow(cmd.Row([]string{
+			node.Address,
+			node.Pool,
+			formatReserved(node.Usage.Memory, node.Usage.TotalMemory, "MB", megabyte),
+			formatReserved(node.Usage.Swap, 0, "MB", megabyte),
+			formatReserved(int64(node.Usage.CpuShare), int64(node.Usage.TotalCpuShare), "", 1),
+			formatContainerCounts(node.Usage.Containers),
+			strings.Join(apps, "\n"),
+		}))
+	}
+	ctx.Stdout.Write(t.Bytes())
+	fmt.Fprintln(ctx.Stdout, "Pools:")
+	t = cmd.Table{Headers: cmd.Row([]string{"Pool", "Nodes", "Memory", "Swap", "CPU Share", "Units"}), LineSeparator: true}
+	for _, pool := range report.Pools {
+		t.AddRow(cmd.Row([]string{
+			pool.Pool,
+			strconv.Itoa(pool.Nodes),
+			formatReserved(pool.Usage.Memory, pool.Usage.TotalMemory, "MB", megabyte),
+			formatReserved(pool.Usage.Swap, 0, "MB", megabyte),
+			formatReserved(int64(pool.Usage.CpuShare), int64(pool.Usage.TotalCpuShare), "", 1),
+			formatContainerCounts(pool.Usage.Containers),
+		}))
+	}
+	ctx.Stdout.Write(t.Bytes())
+	return nil
+}
+
 type listHealingHistoryCmd struct {
 	fs            *gnuflag.FlagSet
 	nodeOnly      bool
@@ -342,3 +508,216 @@ func (c *listHealingHistoryCmd) Flags() *gnuflag.FlagSet {
 	}
 	return c.fs
 }
+
+type listAutoScaleHistoryCmd struct {
+	fs   *gnuflag.FlagSet
+	pool string
+}
+
+func (c *listAutoScaleHistoryCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-autoscale-list",
+		Usage: "docker-autoscale-list [-p/--pool pool]",
+		Desc:  "List the nodes added and removed by the auto scaling of pools.",
+	}
+}
+
+func (c *listAutoScaleHistoryCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	url, err := cmd.GetURL(fmt.Sprintf("/docker/autoscale?pool=%s", c.pool))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var history []autoScaleEvent
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	if err != nil {
+		return err
+	}
+	headers := cmd.Row([]string{"Start", "Finish", "Pool", "Action", "Node", "Nodes", "Success", "Reason", "Error"})
+	t := cmd.Table{Headers: headers}
+	for i := len(history) - 1; i >= 0; i-- {
+		event := history[i]
+		t.AddRow(cmd.Row([]string{
+			event.StartTime.Local().Format(time.Stamp),
+			event.EndTime.Local().Format(time.Stamp),
+			event.Pool,
+			event.Action,
+			event.Node.Address,
+			fmt.Sprintf("%d (min %d, max %d)", event.NodeCount, event.MinNodes, event.MaxNodes),
+			fmt.Sprintf("%t", event.Successful),
+			event.Reason,
+			event.Error,
+		}))
+	}
+	t.LineSeparator = true
+	ctx.Stdout.Write(t.Bytes())
+	return nil
+}
+
+func (c *listAutoScaleHistoryCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		pool := "List only the events of the pool"
+		c.fs.StringVar(&c.pool, "pool", "", pool)
+		c.fs.StringVar(&c.pool, "p", "", pool)
+	}
+	return c.fs
+}
+
+// registryCredentialsOwner holds the flags used to choose the owner of
+// registry credentials.
+type registryCredentialsOwner struct {
+	fs       *gnuflag.FlagSet
+	appName  string
+	teamName string
+}
+
+func (o *registryCredentialsOwner) Flags() *gnuflag.FlagSet {
+	if o.fs == nil {
+		o.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		o.fs.StringVar(&o.appName, "app", "", "The app using the credentials")
+		o.fs.StringVar(&o.appName, "a", "", "The app using the credentials")
+		o.fs.StringVar(&o.teamName, "team", "", "The team whose apps use the credentials")
+		o.fs.StringVar(&o.teamName, "t", "", "The team whose apps use the credentials")
+	}
+	return o.fs
+}
+
+func (o *registryCredentialsOwner) params(registry string) (map[string]string, error) {
+	if (o.appName == "") == (o.teamName == "") {
+		return nil, errors.New("you must specify either the app or the team")
+	}
+	return map[string]string{
+		"app":      o.appName,
+		"team":     o.teamName,
+		"registry": registry,
+	}, nil
+}
+
+type setRegistryCredentialsCmd struct {
+	registryCredentialsOwner
+}
+
+func (setRegistryCredentialsCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-registry-credentials-set",
+		Usage: "docker-registry-credentials-set <registry> <username> <password> <-a/--app appname | -t/--team teamname>",
+		Desc: `Set the credentials used to pull images from a private registry when
+deploying images of an app, or of all apps of a team. Credentials of an app
+take precedence over the ones of its teams.`,
+		MinArgs: 3,
+	}
+}
+
+func (c *setRegistryCredentialsCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	params, err := c.params(ctx.Args[0])
+	if err != nil {
+		return err
+	}
+	params["username"] = ctx.Args[1]
+	params["password"] = ctx.Args[2]
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/registry/credentials")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Registry credentials successfully set.\n"))
+	return nil
+}
+
+type removeRegistryCredentialsCmd struct {
+	registryCredentialsOwner
+}
+
+func (removeRegistryCredentialsCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-registry-credentials-remove",
+		Usage:   "docker-registry-credentials-remove <registry> <-a/--app appname | -t/--team teamname>",
+		Desc:    "Remove the credentials of an app or team for a private registry.",
+		MinArgs: 1,
+	}
+}
+
+func (c *removeRegistryCredentialsCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	params, err := c.params(ctx.Args[0])
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/registry/credentials")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Registry credentials successfully removed.\n"))
+	return nil
+}
+
+type listRegistryCredentialsCmd struct{}
+
+func (listRegistryCredentialsCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-registry-credentials-list",
+		Usage: "docker-registry-credentials-list",
+		Desc:  "List the credentials used to pull images from private registries.",
+	}
+}
+
+func (listRegistryCredentialsCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	url, err := cmd.GetURL("/docker/registry/credentials")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var creds []registryCredentials
+	if resp.StatusCode == http.StatusOK {
+		err = json.NewDecoder(resp.Body).Decode(&creds)
+		if err != nil {
+			return err
+		}
+	}
+	t := cmd.Table{Headers: cmd.Row([]string{"Registry", "App", "Team", "Username"})}
+	for _, c := range creds {
+		t.AddRow(cmd.Row([]string{c.Registry, c.App, c.Team, c.Username}))
+	}
+	t.Sort()
+	ctx.Stdout.Write(t.Bytes())
+	return nil
+}
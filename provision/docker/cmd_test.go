@@ -252,6 +252,50 @@ func (s *S) TestListNodesInTheSchedulerCmdRunEmptyAll(c *check.C) {
 	c.Assert(buf.String(), check.Equals, expected)
 }
 
+func (s *S) TestNodeUsageCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	data := `{
+	"Nodes": [{
+		"Address": "http://server1:1234",
+		"Pool": "pool1",
+		"Usage": {"Memory": 536870912, "CpuShare": 20, "TotalMemory": 2147483648, "TotalCpuShare": 100, "Containers": {"started": 2}},
+		"TopApps": [{"App": "myapp", "Units": 2, "Memory": 536870912, "CpuShare": 20}]
+	}],
+	"Pools": [{
+		"Pool": "pool1",
+		"Nodes": 1,
+		"Usage": {"Memory": 536870912, "CpuShare": 20, "TotalMemory": 2147483648, "TotalCpuShare": 100, "Containers": {"started": 2}}
+	}]
+}`
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: data, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/docker/node/usage" && req.URL.Query().Get("pool") == "pool1"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := &nodeUsageCmd{}
+	command.Flags().Parse(true, []string{"-p", "pool1"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `Nodes:
++---------------------+-------+----------------------+------+----------------+------------+------------------------+
+| Address             | Pool  | Memory               | Swap | CPU Share      | Units      | Top Apps               |
++---------------------+-------+----------------------+------+----------------+------------+------------------------+
+| http://server1:1234 | pool1 | 512MB / 2048MB (25%) | 0MB  | 20 / 100 (20%) | started: 2 | myapp (2 units, 512MB) |
++---------------------+-------+----------------------+------+----------------+------------+------------------------+
+Pools:
++-------+-------+----------------------+------+----------------+------------+
+| Pool  | Nodes | Memory               | Swap | CPU Share      | Units      |
++-------+-------+----------------------+------+----------------+------------+
+| pool1 | 1     | 512MB / 2048MB (25%) | 0MB  | 20 / 100 (20%) | started: 2 |
++-------+-------+----------------------+------+----------------+------------+
+`
+	c.Assert(buf.String(), check.Equals, expected)
+}
+
 func (s *S) TestListHealingHistoryCmdInfo(c *check.C) {
 	expected := cmd.Info{
 		Name:  "docker-healing-list",
@@ -410,3 +454,171 @@ func (s *S) TestListHealingHistoryCmdRunFilterContainer(c *check.C) {
 `, startTStr, endTStr, startTStr, endTStr)
 	c.Assert(buf.String(), check.Equals, expected)
 }
+
+func (s *S) TestListAutoScaleHistoryCmdInfo(c *check.C) {
+	expected := cmd.Info{
+		Name:  "docker-autoscale-list",
+		Usage: "docker-autoscale-list [-p/--pool pool]",
+		Desc:  "List the nodes added and removed by the auto scaling of pools.",
+	}
+	cmd := listAutoScaleHistoryCmd{}
+	c.Assert(cmd.Info(), check.DeepEquals, &expected)
+}
+
+func (s *S) TestListAutoScaleHistoryCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	data := `[{
+	"StartTime": "2014-10-23T08:00:00.000Z",
+	"EndTime": "2014-10-23T08:30:00.000Z",
+	"Pool": "pool1",
+	"Action": "add",
+	"Reason": "memory usage 0.90",
+	"Node": {"Address": "http://n1:2375"},
+	"NodeCount": 2,
+	"MinNodes": 0,
+	"MaxNodes": 3,
+	"Successful": true
+}]`
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: data, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/docker/autoscale" && req.URL.Query().Get("pool") == "pool1"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := &listAutoScaleHistoryCmd{}
+	command.Flags().Parse(true, []string{"--pool", "pool1"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	startT, _ := time.Parse(time.RFC3339, "2014-10-23T08:00:00.000Z")
+	endT, _ := time.Parse(time.RFC3339, "2014-10-23T08:30:00.000Z")
+	expected := fmt.Sprintf(`+-----------------+-----------------+-------+--------+----------------+------------------+---------+-------------------+-------+
+| Start           | Finish          | Pool  | Action | Node           | Nodes            | Success | Reason            | Error |
++-----------------+-----------------+-------+--------+----------------+------------------+---------+-------------------+-------+
+| %s | %s | pool1 | add    | http://n1:2375 | 2 (min 0, max 3) | true    | memory usage 0.90 |       |
++-----------------+-----------------+-------+--------+----------------+------------------+---------+-------------------+-------+
+`, startT.Local().Format(time.Stamp), endT.Local().Format(time.Stamp))
+	c.Assert(buf.String(), check.Equals, expected)
+}
+
+func (s *S) TestCordonNodeCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var result map[string]string
+			json.NewDecoder(req.Body).Decode(&result)
+			return req.URL.Path == "/docker/node/cordon" && req.Method == "POST" &&
+				result["address"] == "http://localhost:8080"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := cordonNodeCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node successfully cordoned.\n")
+}
+
+func (s *S) TestUncordonNodeCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var result map[string]string
+			json.NewDecoder(req.Body).Decode(&result)
+			return req.URL.Path == "/docker/node/uncordon" && req.Method == "POST" &&
+				result["address"] == "http://localhost:8080"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := uncordonNodeCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node successfully uncordoned.\n")
+}
+
+func (s *S) TestSetRegistryCredentialsCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"registry.example.com", "user", "123456"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var result map[string]string
+			json.NewDecoder(req.Body).Decode(&result)
+			return req.URL.Path == "/docker/registry/credentials" && req.Method == "POST" &&
+				result["app"] == "myapp" && result["team"] == "" &&
+				result["registry"] == "registry.example.com" &&
+				result["username"] == "user" && result["password"] == "123456"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := setRegistryCredentialsCmd{}
+	command.Flags().Parse(true, []string{"-a", "myapp"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Registry credentials successfully set.\n")
+}
+
+func (s *S) TestSetRegistryCredentialsCmdRunWithoutOwner(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"registry.example.com", "user", "123456"}, Stdout: &buf}
+	command := setRegistryCredentialsCmd{}
+	command.Flags().Parse(true, []string{})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "you must specify either the app or the team")
+}
+
+func (s *S) TestRemoveRegistryCredentialsCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"registry.example.com"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var result map[string]string
+			json.NewDecoder(req.Body).Decode(&result)
+			return req.URL.Path == "/docker/registry/credentials" && req.Method == "DELETE" &&
+				result["team"] == "myteam" && result["registry"] == "registry.example.com"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := removeRegistryCredentialsCmd{}
+	command.Flags().Parse(true, []string{"--team", "myteam"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Registry credentials successfully removed.\n")
+}
+
+func (s *S) TestListRegistryCredentialsCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	creds := []registryCredentials{
+		{Team: "myteam", Registry: "registry.example.com", Username: "teamuser"},
+		{App: "myapp", Registry: "other.example.com", Username: "appuser"},
+	}
+	data, err := json.Marshal(creds)
+	c.Assert(err, check.IsNil)
+	context := cmd.Context{Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(data), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/docker/registry/credentials" && req.Method == "GET"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err = listRegistryCredentialsCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `+----------------------+-------+--------+----------+
+| Registry             | App   | Team   | Username |
++----------------------+-------+--------+----------+
+| other.example.com    | myapp |        | appuser  |
+| registry.example.com |       | myteam | teamuser |
++----------------------+-------+--------+----------+
+`
+	c.Assert(buf.String(), check.Equals, expected)
+}
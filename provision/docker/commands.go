@@ -40,12 +40,16 @@ func deployCmds(app provision.App, params ...string) ([]string, error) {
 }
 
 // runWithAgentCmds returns the list of commands that should be passed when the
-// provisioner will run a unit using tsuru_unit_agent to start.
-func runWithAgentCmds(app provision.App) ([]string, error) {
+// provisioner will run a unit using tsuru_unit_agent to start. When process is
+// not empty, the unit runs only the given process from the Procfile.
+func runWithAgentCmds(app provision.App, process string) ([]string, error) {
 	runCmd, err := config.GetString("docker:run-cmd:bin")
 	if err != nil {
 		return nil, err
 	}
+	if process != "" {
+		runCmd = `"` + runCmd + " " + process + `"`
+	}
 	host := app.Envs()["TSURU_HOST"].Value
 	token := app.Envs()["TSURU_APP_TOKEN"].Value
 	unitAgentCmds := []string{"tsuru_unit_agent", host, token, app.GetName(), runCmd}
@@ -85,7 +85,20 @@ func (s *S) TestRunWithAgentCmds(c *check.C) {
 	unitAgentCmd := fmt.Sprintf("tsuru_unit_agent tsuru_host app_token app-name %s", runCmd)
 	cmd := fmt.Sprintf("%s && tail -f /dev/null", unitAgentCmd)
 	expected := []string{"/bin/bash", "-lc", cmd}
-	cmds, err := runWithAgentCmds(app)
+	cmds, err := runWithAgentCmds(app, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(cmds, check.DeepEquals, expected)
 }
+
+func (s *S) TestRunWithAgentCmdsWithProcess(c *check.C) {
+	app := provisiontest.NewFakeApp("app-name", "python", 1)
+	app.SetEnv(bind.EnvVar{Name: "TSURU_HOST", Value: "tsuru_host", Public: true})
+	app.SetEnv(bind.EnvVar{Name: "TSURU_APP_TOKEN", Value: "app_token", Public: true})
+	runCmd, err := config.GetString("docker:run-cmd:bin")
+	c.Assert(err, check.IsNil)
+	unitAgentCmd := fmt.Sprintf(`tsuru_unit_agent tsuru_host app_token app-name "%s worker"`, runCmd)
+	cmd := fmt.Sprintf("%s && tail -f /dev/null", unitAgentCmd)
+	cmds, err := runWithAgentCmds(app, "worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(cmds, check.DeepEquals, []string{"/bin/bash", "-lc", cmd})
+}
@@ -87,18 +87,41 @@ func handleMoveErrors(moveErrors chan error, encoder *json.Encoder) error {
 	return nil
 }
 
+// deployCanceled returns the function used by pipelines to check whether the
+// deploy in progress of the app has been canceled.
+func deployCanceled(appName string) action.Canceled {
+	return func() bool {
+		canceled, err := app.IsDeployCanceled(appName)
+		if err != nil {
+			log.Errorf("[deploy] error checking if the deploy of %s was canceled: %s", appName, err)
+			return false
+		}
+		return canceled
+	}
+}
+
 func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App, toRemoveContainers []container, imageId string, toHosts ...string) ([]container, error) {
 	var toHost string
 	if len(toHosts) > 0 {
 		toHost = toHosts[0]
 	}
+	return p.replaceUnits(nil, w, a, toRemoveContainers, imageId, toHost)
+}
+
+// runDeployReplaceUnitsPipeline replaces the units of the app in a deploy,
+// which can be canceled until the new units are added to the router.
+func (p *dockerProvisioner) runDeployReplaceUnitsPipeline(w io.Writer, a provision.App, toRemoveContainers []container, imageId string) ([]container, error) {
+	return p.replaceUnits(deployCanceled(a.GetName()), w, a, toRemoveContainers, imageId, "")
+}
+
+func (p *dockerProvisioner) replaceUnits(canceled action.Canceled, w io.Writer, a provision.App, toRemoveContainers []container, imageId, toHost string) ([]container, error) {
 	if w == nil {
 		w = ioutil.Discard
 	}
 	args := changeUnitsPipelineArgs{
 		app:         a,
 		toRemove:    toRemoveContainers,
-		unitsToAdd:  len(toRemoveContainers),
+		toAdd:       processUnitsCount(toRemoveContainers),
 		toHost:      toHost,
 		writer:      w,
 		imageId:     imageId,
@@ -111,6 +134,7 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 		&provisionRemoveOldUnits,
 		&updateAppImage,
 	)
+	pipeline.SetCanceled(canceled)
 	err := pipeline.Execute(args)
 	if err != nil {
 		return nil, err
@@ -118,13 +142,23 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 	return pipeline.Result().([]container), nil
 }
 
-func (p *dockerProvisioner) runCreateUnitsPipeline(w io.Writer, a provision.App, toAddCount int, imageId string) ([]container, error) {
+func (p *dockerProvisioner) runCreateUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]int, imageId string) ([]container, error) {
+	return p.createUnits(nil, w, a, toAdd, imageId)
+}
+
+// runDeployCreateUnitsPipeline creates the first units of the app in a
+// deploy, which can be canceled until the new units are added to the router.
+func (p *dockerProvisioner) runDeployCreateUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]int, imageId string) ([]container, error) {
+	return p.createUnits(deployCanceled(a.GetName()), w, a, toAdd, imageId)
+}
+
+func (p *dockerProvisioner) createUnits(canceled action.Canceled, w io.Writer, a provision.App, toAdd map[string]int, imageId string) ([]container, error) {
 	if w == nil {
 		w = ioutil.Discard
 	}
 	args := changeUnitsPipelineArgs{
 		app:         a,
-		unitsToAdd:  toAddCount,
+		toAdd:       toAdd,
 		writer:      w,
 		imageId:     imageId,
 		provisioner: p,
@@ -134,6 +168,7 @@ func (p *dockerProvisioner) runCreateUnitsPipeline(w io.Writer, a provision.App,
 		&addNewRoutes,
 		&updateAppImage,
 	)
+	pipeline.SetCanceled(canceled)
 	err := pipeline.Execute(args)
 	if err != nil {
 		return nil, err
@@ -280,5 +315,8 @@ func (p *dockerProvisioner) rebalanceContainers(encoder *json.Encoder, dryRun bo
 		}
 		logProgress(encoder, "%s %s for %q: %s -> %s...", prefix, cont.ID, contApp.GetName(), cont.HostAddr, newConts[0].HostAddr)
 	}
+	if p.scheduler != nil && p.scheduler.zoneMetadata != "" {
+		return p.logZoneDistribution(encoder, p.scheduler.zoneMetadata)
+	}
 	return nil
 }
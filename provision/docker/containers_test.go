@@ -33,7 +33,7 @@ func (s *S) TestMoveContainers(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -83,7 +83,7 @@ func (s *S) TestMoveContainersUnknownDest(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -129,7 +129,7 @@ func (s *S) TestMoveContainer(c *check.C) {
 	c.Assert(err, check.IsNil)
 	addedConts, err := addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  2,
+		toAdd:       map[string]int{"": 2},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -167,7 +167,7 @@ func (s *S) TestRebalanceContainers(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  5,
+		toAdd:       map[string]int{"": 5},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -265,7 +265,7 @@ func (s *S) TestRebalanceContainersManyApps(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -275,7 +275,7 @@ func (s *S) TestRebalanceContainersManyApps(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         appInstance2,
 		imageId:     imageId2,
 		provisioner: p,
@@ -321,7 +321,7 @@ func (s *S) TestRebalanceContainersDry(c *check.C) {
 	c.Assert(err, check.IsNil)
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  5,
+		toAdd:       map[string]int{"": 5},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -0,0 +1,203 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var errNodeNotCordoned = errors.New("node is not cordoned")
+
+// cordonedNode is a node marked as unschedulable, which the scheduler skips
+// when choosing where to create new containers.
+type cordonedNode struct {
+	Address string `bson:"_id"`
+}
+
+func cordonedNodesColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_cordoned_nodes", name)), nil
+}
+
+func (p *dockerProvisioner) getNode(address string) (cluster.Node, error) {
+	nodes, err := p.unfilteredNodes()
+	if err != nil {
+		return cluster.Node{}, err
+	}
+	for _, node := range nodes {
+		if node.Address == address {
+			return node, nil
+		}
+	}
+	return cluster.Node{}, fmt.Errorf("node %q not found", address)
+}
+
+// cordonNode marks the node as unschedulable. Cordoning a node that is
+// already cordoned is not an error.
+func (p *dockerProvisioner) cordonNode(address string) error {
+	_, err := p.getNode(address)
+	if err != nil {
+		return err
+	}
+	coll, err := cordonedNodesColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(address, cordonedNode{Address: address})
+	return err
+}
+
+// uncordonNode marks the node as schedulable again.
+func (p *dockerProvisioner) uncordonNode(address string) error {
+	coll, err := cordonedNodesColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(address)
+	if err == mgo.ErrNotFound {
+		return errNodeNotCordoned
+	}
+	return err
+}
+
+func cordonedNodeAddresses() (map[string]bool, error) {
+	coll, err := cordonedNodesColl()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var nodes []cordonedNode
+	err = coll.Find(nil).All(&nodes)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		addresses[node.Address] = true
+	}
+	return addresses, nil
+}
+
+// filterCordonedNodes returns the nodes that are not cordoned.
+func filterCordonedNodes(nodes []cluster.Node) ([]cluster.Node, error) {
+	cordoned, err := cordonedNodeAddresses()
+	if err != nil {
+		return nil, err
+	}
+	if len(cordoned) == 0 {
+		return nodes, nil
+	}
+	result := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !cordoned[node.Address] {
+			result = append(result, node)
+		}
+	}
+	return result, nil
+}
+
+// drainDestinations returns the hosts of the schedulable nodes in the same
+// pool as the given node, with the number of containers in each one.
+func (p *dockerProvisioner) drainDestinations(node cluster.Node) (map[string]int, error) {
+	nodes, err := p.unfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err = filterCordonedNodes(nodes)
+	if err != nil {
+		return nil, err
+	}
+	pool := node.Metadata["pool"]
+	var hosts []string
+	for _, n := range nodes {
+		if n.Address != node.Address && n.Metadata["pool"] == pool {
+			hosts = append(hosts, urlToHost(n.Address))
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no nodes available in pool %q to receive the units of %s", pool, node.Address)
+	}
+	containers, err := p.listContainersBy(bson.M{"hostaddr": bson.M{"$in": hosts}})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(hosts))
+	for _, host := range hosts {
+		counts[host] = 0
+	}
+	for _, c := range containers {
+		counts[c.HostAddr]++
+	}
+	return counts, nil
+}
+
+// drainNode cordons the node and moves all its containers to other nodes in
+// the same pool, choosing the node with less containers for each one.
+func (p *dockerProvisioner) drainNode(address string, encoder *json.Encoder) error {
+	node, err := p.getNode(address)
+	if err != nil {
+		return err
+	}
+	err = p.cordonNode(address)
+	if err != nil {
+		return err
+	}
+	logProgress(encoder, "Node %s cordoned.", address)
+	fromHost := urlToHost(address)
+	containers, err := p.listContainersByHost(fromHost)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		logProgress(encoder, "No units to move in %s.", fromHost)
+		return nil
+	}
+	destinations, err := p.drainDestinations(node)
+	if err != nil {
+		return err
+	}
+	logProgress(encoder, "Moving %d units...", len(containers))
+	locker := &appLocker{}
+	moveErrors := make(chan error, len(containers))
+	wg := sync.WaitGroup{}
+	wg.Add(len(containers))
+	for _, c := range containers {
+		var toHost string
+		minCount := math.MaxInt32
+		for host, count := range destinations {
+			if count < minCount || (count == minCount && host < toHost) {
+				minCount = count
+				toHost = host
+			}
+		}
+		destinations[toHost]++
+		go p.moveOneContainer(c, toHost, moveErrors, &wg, encoder, locker)
+	}
+	go func() {
+		wg.Wait()
+		close(moveErrors)
+	}()
+	return handleMoveErrors(moveErrors, encoder)
+}
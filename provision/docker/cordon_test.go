@@ -0,0 +1,147 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestCordonAndUncordonNode(c *check.C) {
+	err := s.p.cordonNode(s.server.URL())
+	c.Assert(err, check.IsNil)
+	err = s.p.cordonNode(s.server.URL())
+	c.Assert(err, check.IsNil)
+	cordoned, err := cordonedNodeAddresses()
+	c.Assert(err, check.IsNil)
+	c.Assert(cordoned, check.DeepEquals, map[string]bool{s.server.URL(): true})
+	err = s.p.uncordonNode(s.server.URL())
+	c.Assert(err, check.IsNil)
+	cordoned, err = cordonedNodeAddresses()
+	c.Assert(err, check.IsNil)
+	c.Assert(cordoned, check.HasLen, 0)
+	err = s.p.uncordonNode(s.server.URL())
+	c.Assert(err, check.Equals, errNodeNotCordoned)
+}
+
+func (s *S) TestCordonNodeNotFound(c *check.C) {
+	err := s.p.cordonNode("http://unknown:2375")
+	c.Assert(err, check.ErrorMatches, `node "http://unknown:2375" not found`)
+}
+
+func (s *S) TestFilterCordonedNodes(c *check.C) {
+	coll, err := cordonedNodesColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(cordonedNode{Address: "http://url1:1234"})
+	c.Assert(err, check.IsNil)
+	nodes := []cluster.Node{{Address: "http://url0:1234"}, {Address: "http://url1:1234"}}
+	filtered, err := filterCordonedNodes(nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(filtered, check.DeepEquals, []cluster.Node{{Address: "http://url0:1234"}})
+}
+
+func (s *S) TestSchedulerScheduleSkipsCordonedNodes(c *check.C) {
+	a := app.App{Name: "impius", Teams: []string{"tsuruteam"}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	coll := s.storage.Collection(schedulerCollection)
+	p := Pool{Name: "pool1", Teams: []string{"tsuruteam"}}
+	err = coll.Insert(p)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": p.Name})
+	cordonedColl, err := cordonedNodesColl()
+	c.Assert(err, check.IsNil)
+	defer cordonedColl.Close()
+	err = cordonedColl.Insert(cordonedNode{Address: "http://url0:1234"})
+	c.Assert(err, check.IsNil)
+	scheduler := segregatedScheduler{provisioner: s.p}
+	clusterInstance, err := cluster.New(&scheduler, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url0:1234", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url1:1234", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	node, err := scheduler.Schedule(clusterInstance, docker.CreateContainerOptions{}, a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, "http://url1:1234")
+	err = cordonedColl.Insert(cordonedNode{Address: "http://url1:1234"})
+	c.Assert(err, check.IsNil)
+	_, err = scheduler.Schedule(clusterInstance, docker.CreateContainerOptions{}, a.Name)
+	c.Assert(err, check.ErrorMatches, `All nodes available for "impius" are cordoned.`)
+}
+
+func (s *S) TestDrainNode(c *check.C) {
+	p, err := s.startMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer s.stopMultipleServersCluster(p)
+	err = s.newFakeImage(p, "tsuru/app-myapp")
+	c.Assert(err, check.IsNil)
+	appInstance := provisiontest.NewFakeApp("myapp", "python", 0)
+	defer p.Destroy(appInstance)
+	p.Provision(appInstance)
+	coll := p.collection()
+	defer coll.Close()
+	coll.Insert(container{ID: "container-id", AppName: appInstance.GetName(), Version: "container-version", Image: "tsuru/python"})
+	defer coll.RemoveAll(bson.M{"appname": appInstance.GetName()})
+	imageId, err := appCurrentImageName(appInstance.GetName())
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toHost:      "localhost",
+		toAdd:       map[string]int{"": 2},
+		app:         appInstance,
+		imageId:     imageId,
+		provisioner: p,
+	})
+	c.Assert(err, check.IsNil)
+	appStruct := &app.App{Name: appInstance.GetName()}
+	err = s.storage.Apps().Insert(appStruct)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": appStruct.Name})
+	nodes, err := p.getCluster().Nodes()
+	c.Assert(err, check.IsNil)
+	var address string
+	for _, node := range nodes {
+		if urlToHost(node.Address) == "localhost" {
+			address = node.Address
+		}
+	}
+	var buf bytes.Buffer
+	err = p.drainNode(address, json.NewEncoder(&buf))
+	c.Assert(err, check.IsNil)
+	containers, err := p.listContainersByHost("localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+	containers, err = p.listContainersByHost("127.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	cordoned, err := cordonedNodeAddresses()
+	c.Assert(err, check.IsNil)
+	c.Assert(cordoned, check.DeepEquals, map[string]bool{address: true})
+	parts := strings.Split(buf.String(), "\n")
+	var logEntry progressLog
+	json.Unmarshal([]byte(parts[0]), &logEntry)
+	c.Assert(logEntry.Message, check.Equals, "Node "+address+" cordoned.")
+	json.Unmarshal([]byte(parts[1]), &logEntry)
+	c.Assert(logEntry.Message, check.Equals, "Moving 2 units...")
+}
+
+func (s *S) TestDrainNodeWithoutDestination(c *check.C) {
+	cont, err := s.newContainer(nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	var buf bytes.Buffer
+	err = s.p.drainNode(s.server.URL(), json.NewEncoder(&buf))
+	c.Assert(err, check.ErrorMatches, `no nodes available in pool "" to receive the units of .*`)
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"net"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/safe"
+	"github.com/tsuru/tsuru/volume"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -43,16 +45,22 @@ func isSegregateScheduler() bool {
 	return segregate
 }
 
-func buildClusterStorage() (cluster.Storage, error) {
-	mongoUrl, _ := config.GetString("docker:cluster:mongo-url")
-	mongoDatabase, _ := config.GetString("docker:cluster:mongo-database")
+// buildClusterStorage connects to the storage of the cluster. Named clusters
+// must have their own storage, set in docker:clusters:<name>:cluster.
+func buildClusterStorage(clusterName string) (cluster.Storage, error) {
+	prefix := "docker:cluster"
+	if clusterName != "" {
+		prefix = fmt.Sprintf("docker:clusters:%s:cluster", clusterName)
+	}
+	mongoUrl, _ := config.GetString(prefix + ":mongo-url")
+	mongoDatabase, _ := config.GetString(prefix + ":mongo-database")
 	if mongoUrl == "" || mongoDatabase == "" {
-		return nil, fmt.Errorf("Cluster Storage: docker:cluster:{mongo-url,mongo-database} must be set.")
+		return nil, fmt.Errorf("Cluster Storage: %s:{mongo-url,mongo-database} must be set.", prefix)
 	}
 	storage, err := mongodb.Mongodb(mongoUrl, mongoDatabase)
 	if err != nil {
-		return nil, fmt.Errorf("Cluster Storage: Unable to connect to mongodb: %s (docker:cluster:mongo-url = %q; docker:cluster:mongo-database = %q)",
-			err.Error(), mongoUrl, mongoDatabase)
+		return nil, fmt.Errorf("Cluster Storage: Unable to connect to mongodb: %s (%s:mongo-url = %q; %s:mongo-database = %q)",
+			err.Error(), prefix, mongoUrl, prefix, mongoDatabase)
 	}
 	return storage, nil
 }
@@ -71,26 +79,37 @@ func urlToHost(urlStr string) string {
 	return host
 }
 
-func (p *dockerProvisioner) hostToNodeAddress(host string) (string, error) {
-	nodes, err := p.getCluster().Nodes()
+// hostToNodeAddress returns the address of the node in the host, along with
+// the name of the cluster of the node.
+func (p *dockerProvisioner) hostToNodeAddress(host string) (string, string, error) {
+	byCluster, err := p.nodesByCluster(false)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	for _, node := range nodes {
-		if urlToHost(node.Address) == host {
-			return node.Address, nil
+	for _, clusterName := range p.clusterNames() {
+		for _, node := range byCluster[clusterName] {
+			if urlToHost(node.Address) == host {
+				return node.Address, clusterName, nil
+			}
 		}
 	}
-	return "", fmt.Errorf("Host `%s` not found", host)
+	return "", "", fmt.Errorf("Host `%s` not found", host)
 }
 
+// webProcessName is the name of the Procfile process that receives the
+// traffic of the app.
+const webProcessName = "web"
+
 type container struct {
 	ID                      string
 	AppName                 string
+	ProcessName             string
 	Type                    string
 	IP                      string
 	HostAddr                string
 	HostPort                string
+	ExtraPorts              map[string]string `bson:",omitempty" json:",omitempty"`
+	Cluster                 string            `bson:",omitempty" json:",omitempty"`
 	PrivateKey              string
 	Status                  string
 	Version                 string
@@ -101,7 +120,10 @@ type container struct {
 	LastStatusUpdate        time.Time
 	LastSuccessStatusUpdate time.Time
 	LockedUntil             time.Time
-	appCache                provision.App
+	// Unrouted is set while the container is out of the router for failing
+	// its liveness check.
+	Unrouted bool `bson:",omitempty" json:",omitempty"`
+	appCache provision.App
 }
 
 func (c *container) shortID() string {
@@ -121,6 +143,44 @@ func (c *container) getAddress() string {
 	return fmt.Sprintf("http://%s:%s", c.HostAddr, c.HostPort)
 }
 
+// routable returns true if the container runs the web process, receiving
+// traffic from the router. Containers without a process name run all the
+// processes in the Procfile, including the web one.
+func (c *container) routable() bool {
+	return c.ProcessName == "" || c.ProcessName == webProcessName
+}
+
+// routableContainers filters the given containers, returning only the ones
+// that receive traffic from the router.
+func routableContainers(containers []container) []container {
+	result := make([]container, 0, len(containers))
+	for _, c := range containers {
+		if c.routable() {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// processUnitsCount returns the number of containers running each process.
+func processUnitsCount(containers []container) map[string]int {
+	count := make(map[string]int)
+	for _, c := range containers {
+		count[c.ProcessName]++
+	}
+	return count
+}
+
+// containersProcesses returns the processes run by the given containers.
+func containersProcesses(containers []container) []string {
+	var processes []string
+	for process := range processUnitsCount(containers) {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	return processes
+}
+
 func randomString() string {
 	h := crypto.MD5.New()
 	h.Write([]byte(time.Now().Format(time.RFC3339Nano)))
@@ -143,6 +203,13 @@ func (c *container) create(args runContainerActionsArgs) error {
 		exposedPorts = map[docker.Port]struct{}{
 			docker.Port(port + "/tcp"): {},
 		}
+		extraPorts, err := imagePorts(args.imageID, args.app.GetName())
+		if err != nil {
+			return err
+		}
+		for _, extraPort := range extraPorts {
+			exposedPorts[dockerPort(extraPort.Port)] = struct{}{}
+		}
 	}
 	config := docker.Config{
 		Image:        args.imageID,
@@ -156,45 +223,73 @@ func (c *container) create(args runContainerActionsArgs) error {
 		MemorySwap:   args.app.GetMemory() + args.app.GetSwap(),
 		CPUShares:    int64(args.app.GetCpuShare()),
 	}
+	if args.imageCommand {
+		// Images built from a Dockerfile or deployed from external
+		// registries run as the user defined in the image and don't have
+		// the unit agent to load the app environment.
+		config.User = ""
+		config.Env = imageUnitEnvs(args.app, port)
+	}
 	if sharedMount != "" && sharedBasedir != "" {
 		config.Volumes = map[string]struct{}{
 			sharedMount: {},
 		}
 		config.Env = append(config.Env, fmt.Sprintf("TSURU_SHAREDFS_MOUNTPOINT=%s", sharedMount))
 	}
+	if !args.isDeploy {
+		binds, err := volume.ListAppBinds(args.app.GetName())
+		if err != nil {
+			return err
+		}
+		for _, bind := range binds {
+			if config.Volumes == nil {
+				config.Volumes = make(map[string]struct{})
+			}
+			config.Volumes[bind.MountPoint] = struct{}{}
+		}
+	}
 	opts := docker.CreateContainerOptions{Name: c.Name, Config: &config}
 	var nodeList []string
 	if len(args.destinationHosts) > 0 {
-		nodeName, err := args.provisioner.hostToNodeAddress(args.destinationHosts[0])
+		nodeName, clusterName, err := args.provisioner.hostToNodeAddress(args.destinationHosts[0])
 		if err != nil {
 			return err
 		}
 		nodeList = []string{nodeName}
+		c.Cluster = clusterName
+	} else {
+		clusterName, err := appClusterName(args.app.GetName())
+		if err != nil {
+			return err
+		}
+		c.Cluster = clusterName
 	}
-	addr, cont, err := args.provisioner.getCluster().CreateContainerSchedulerOpts(opts, args.app.GetName(), nodeList...)
+	addr, cont, err := c.getCluster(args.provisioner).CreateContainerSchedulerOpts(opts, args.app.GetName(), nodeList...)
 	if err != nil {
 		log.Errorf("error on creating container in docker %s - %s", c.AppName, err)
 		return err
 	}
 	c.ID = cont.ID
 	c.HostAddr = urlToHost(addr)
-	c.User = user
+	c.User = config.User
 	return nil
 }
 
 type containerNetworkInfo struct {
 	HTTPHostPort string
 	IP           string
+	ExtraPorts   map[string]string
 }
 
-// networkInfo returns the IP and the host port for the container.
+// networkInfo returns the IP and the host ports for the container. The host
+// ports of the extra ports are keyed by the port in the container.
 func (c *container) networkInfo(p *dockerProvisioner) (containerNetworkInfo, error) {
 	var netInfo containerNetworkInfo
 	port, err := getPort()
 	if err != nil {
 		return netInfo, err
 	}
-	dockerContainer, err := p.getCluster().InspectContainer(c.ID)
+	dockerContainer, err := c.getCluster(p).InspectContainer(c.ID)
 	if err != nil {
 		return netInfo, err
 	}
@@ -207,6 +302,20 @@ func (c *container) networkInfo(p *dockerProvisioner) (containerNetworkInfo, err
 				break
 			}
 		}
+		for exposed, bindings := range dockerContainer.NetworkSettings.Ports {
+			if exposed == httpPort {
+				continue
+			}
+			for _, binding := range bindings {
+				if binding.HostPort != "" && binding.HostIP != "" {
+					if netInfo.ExtraPorts == nil {
+						netInfo.ExtraPorts = make(map[string]string)
+					}
+					netInfo.ExtraPorts[exposed.Port()] = binding.HostPort
+					break
+				}
+			}
+		}
 	}
 	return netInfo, err
 }
@@ -263,6 +372,7 @@ func (p *dockerProvisioner) deployPipeline(app provision.App, imageId string, co
 		&followLogsAndCommit,
 	}
 	pipeline := action.NewPipeline(actions...)
+	pipeline.SetCanceled(deployCanceled(app.GetName()))
 	buildingImage, err := appNewImageName(app.GetName())
 	if err != nil {
 		return "", log.WrapError(fmt.Errorf("error getting new image name for app %s", app.GetName()))
@@ -284,11 +394,18 @@ func (p *dockerProvisioner) deployPipeline(app provision.App, imageId string, co
 	return buildingImage, nil
 }
 
-func (p *dockerProvisioner) start(app provision.App, imageId string, w io.Writer, destinationHosts ...string) (*container, error) {
-	commands, err := runWithAgentCmds(app)
+func (p *dockerProvisioner) start(app provision.App, imageId, process string, w io.Writer, destinationHosts ...string) (*container, error) {
+	imageCommand, err := usesImageCommand(imageId)
 	if err != nil {
 		return nil, err
 	}
+	var commands []string
+	if !imageCommand {
+		commands, err = runWithAgentCmds(app, process)
+		if err != nil {
+			return nil, err
+		}
+	}
 	actions := []*action.Action{
 		&insertEmptyContainerInDB,
 		&createContainer,
@@ -301,7 +418,9 @@ func (p *dockerProvisioner) start(app provision.App, imageId string, w io.Writer
 		app:              app,
 		imageID:          imageId,
 		commands:         commands,
+		imageCommand:     imageCommand,
 		destinationHosts: destinationHosts,
+		processName:      process,
 		provisioner:      p,
 	}
 	err = pipeline.Execute(args)
@@ -329,7 +448,7 @@ func (c *container) getApp() (provision.App, error) {
 func (c *container) remove(p *dockerProvisioner) error {
 	address := c.getAddress()
 	log.Debugf("Removing container %s from docker", c.ID)
-	err := p.getCluster().RemoveContainer(docker.RemoveContainerOptions{ID: c.ID})
+	err := c.getCluster(p).RemoveContainer(docker.RemoveContainerOptions{ID: c.ID})
 	if err != nil {
 		log.Errorf("Failed to remove container from docker: %s", err)
 	}
@@ -339,6 +458,9 @@ func (c *container) remove(p *dockerProvisioner) error {
 	if err := coll.Remove(bson.M{"id": c.ID}); err != nil {
 		log.Errorf("Failed to remove container from database: %s", err)
 	}
+	if !c.routable() {
+		return nil
+	}
 	a, err := c.getApp()
 	if err != nil {
 		log.Errorf("Failed to obtain app: %s", err)
@@ -352,6 +474,9 @@ func (c *container) remove(p *dockerProvisioner) error {
 	if err := r.RemoveRoute(c.AppName, address); err != nil {
 		log.Errorf("Failed to remove route: %s", err)
 	}
+	if err := c.removeTCPRoutes(r); err != nil {
+		log.Errorf("Failed to remove tcp routes: %s", err)
+	}
 	return nil
 }
 
@@ -370,7 +495,7 @@ func (c *container) shell(p *dockerProvisioner, stdin io.Reader, stdout, stderr
 		Container:    c.ID,
 		Tty:          true,
 	}
-	exec, err := p.getCluster().CreateExec(execCreateOpts)
+	exec, err := c.getCluster(p).CreateExec(execCreateOpts)
 	if err != nil {
 		return err
 	}
@@ -381,12 +506,26 @@ func (c *container) shell(p *dockerProvisioner, stdin io.Reader, stdout, stderr
 		Tty:          true,
 		RawTerminal:  true,
 	}
-	err = p.getCluster().StartExec(exec.ID, c.ID, startExecOptions)
+	err = c.getCluster(p).StartExec(exec.ID, c.ID, startExecOptions)
 	if err != nil {
 		return err
 	}
-	return p.getCluster().ResizeExecTTY(exec.ID, c.ID, pty.height, pty.width)
+	return c.getCluster(p).ResizeExecTTY(exec.ID, c.ID, pty.height, pty.width)
+
+}
 
+// nodeClient returns a docker client for the node where the container runs.
+func (c *container) nodeClient(p *dockerProvisioner) (*docker.Client, error) {
+	nodes, err := c.getCluster(p).UnfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if urlToHost(node.Address) == c.HostAddr {
+			return node.Client()
+		}
+	}
+	return nil, fmt.Errorf("node of unit %s not found", c.shortID())
 }
 
 type execErr struct {
@@ -408,7 +547,7 @@ func (c *container) exec(p *dockerProvisioner, stdout, stderr io.Writer, cmd str
 		Cmd:          cmds,
 		Container:    c.ID,
 	}
-	exec, err := p.getCluster().CreateExec(execCreateOpts)
+	exec, err := c.getCluster(p).CreateExec(execCreateOpts)
 	if err != nil {
 		return err
 	}
@@ -416,11 +555,11 @@ func (c *container) exec(p *dockerProvisioner, stdout, stderr io.Writer, cmd str
 		OutputStream: stdout,
 		ErrorStream:  stderr,
 	}
-	err = p.getCluster().StartExec(exec.ID, c.ID, startExecOptions)
+	err = c.getCluster(p).StartExec(exec.ID, c.ID, startExecOptions)
 	if err != nil {
 		return err
 	}
-	execData, err := p.getCluster().InspectExec(exec.ID, c.ID)
+	execData, err := c.getCluster(p).InspectExec(exec.ID, c.ID)
 	if err != nil {
 		return err
 	}
@@ -442,18 +581,18 @@ func (c *container) commit(p *dockerProvisioner, writer io.Writer) (string, erro
 	repository := strings.Join(parts[:len(parts)-1], ":")
 	tag := parts[len(parts)-1]
 	opts := docker.CommitContainerOptions{Container: c.ID, Repository: repository, Tag: tag}
-	image, err := p.getCluster().CommitContainer(opts)
+	image, err := c.getCluster(p).CommitContainer(opts)
 	if err != nil {
 		return "", log.WrapError(fmt.Errorf("error in commit container %s: %s", c.ID, err.Error()))
 	}
-	imgData, err := p.getCluster().InspectImage(c.BuildingImage)
+	imgData, err := c.getCluster(p).InspectImage(c.BuildingImage)
 	imgSize := ""
 	if err == nil {
 		imgSize = fmt.Sprintf("(%.02fMB)", float64(imgData.Size)/1024/1024)
 	}
 	fmt.Fprintf(writer, " ---> Sending image to repository %s\n", imgSize)
 	log.Debugf("image %s generated from container %s", image.ID, c.ID)
-	err = p.pushImage(repository, tag)
+	err = p.pushImage(c.Cluster, repository, tag)
 	if err != nil {
 		return "", log.WrapError(fmt.Errorf("error in push image %s: %s", c.BuildingImage, err.Error()))
 	}
@@ -465,7 +604,7 @@ func (c *container) stop(p *dockerProvisioner) error {
 	if c.Status == provision.StatusStopped.String() {
 		return nil
 	}
-	err := p.cluster.StopContainer(c.ID, 10)
+	err := c.getCluster(p).StopContainer(c.ID, 10)
 	if err != nil {
 		log.Errorf("error on stop container %s: %s", c.ID, err)
 	}
@@ -488,6 +627,13 @@ func (c *container) start(p *dockerProvisioner, isDeploy bool) error {
 		config.PortBindings = map[docker.Port][]docker.PortBinding{
 			docker.Port(port + "/tcp"): {{HostIP: "", HostPort: ""}},
 		}
+		extraPorts, err := imagePorts(c.Image, c.AppName)
+		if err != nil {
+			return err
+		}
+		for _, extraPort := range extraPorts {
+			config.PortBindings[dockerPort(extraPort.Port)] = []docker.PortBinding{{HostIP: "", HostPort: ""}}
+		}
 	}
 	if sharedBasedir != "" && sharedMount != "" {
 		if sharedIsolation {
@@ -504,7 +650,14 @@ func (c *container) start(p *dockerProvisioner, isDeploy bool) error {
 			config.Binds = append(config.Binds, fmt.Sprintf("%s:%s:rw", sharedBasedir, sharedMount))
 		}
 	}
-	err = p.getCluster().StartContainer(c.ID, &config)
+	if !isDeploy {
+		binds, err := appVolumeBinds(c.AppName)
+		if err != nil {
+			return err
+		}
+		config.Binds = append(config.Binds, binds...)
+	}
+	err = c.getCluster(p).StartContainer(c.ID, &config)
 	if err != nil {
 		return err
 	}
@@ -517,7 +670,7 @@ func (c *container) start(p *dockerProvisioner, isDeploy bool) error {
 
 // logs returns logs for the container.
 func (c *container) logs(p *dockerProvisioner, w io.Writer) error {
-	container, err := p.getCluster().InspectContainer(c.ID)
+	container, err := c.getCluster(p).InspectContainer(c.ID)
 	if err != nil {
 		return err
 	}
@@ -531,26 +684,31 @@ func (c *container) logs(p *dockerProvisioner, w io.Writer) error {
 		RawTerminal:  container.Config.Tty,
 		Stream:       true,
 	}
-	return p.getCluster().AttachToContainer(opts)
+	return c.getCluster(p).AttachToContainer(opts)
 }
 
 func (c *container) asUnit(a provision.App) provision.Unit {
 	return provision.Unit{
-		Name:    c.ID,
-		AppName: a.GetName(),
-		Type:    a.GetPlatform(),
-		Ip:      c.HostAddr,
-		Status:  provision.StatusBuilding,
+		Name:        c.ID,
+		AppName:     a.GetName(),
+		ProcessName: c.ProcessName,
+		Type:        a.GetPlatform(),
+		Ip:          c.HostAddr,
+		Status:      provision.StatusBuilding,
 	}
 }
 
-// pushImage sends the given image to the registry server defined in the
-// configuration file.
-func (p *dockerProvisioner) pushImage(name, tag string) error {
-	if _, err := config.GetString("docker:registry"); err == nil {
+// pushImage sends the given image, built in the cluster, to the registry
+// server of the cluster defined in the configuration file.
+func (p *dockerProvisioner) pushImage(clusterName, name, tag string) error {
+	if _, err := config.GetString(clusterKey(clusterName, "registry")); err == nil {
+		dcluster, err := p.getClusterByName(clusterName)
+		if err != nil {
+			return err
+		}
 		var buf safe.Buffer
 		pushOpts := docker.PushImageOptions{Name: name, Tag: tag, OutputStream: &buf}
-		err = p.getCluster().PushImage(pushOpts, docker.AuthConfiguration{})
+		err = dcluster.PushImage(pushOpts, docker.AuthConfiguration{})
 		if err != nil {
 			log.Errorf("[docker] Failed to push image %q (%s): %s", name, err, buf.String())
 			return err
@@ -562,10 +720,11 @@ func (p *dockerProvisioner) pushImage(name, tag string) error {
 // unitFromContainer returns a unit that represents a container.
 func unitFromContainer(c container) provision.Unit {
 	return provision.Unit{
-		Name:    c.ID,
-		AppName: c.AppName,
-		Type:    c.Type,
-		Status:  provision.Status(c.Status),
-		Ip:      c.HostAddr,
+		Name:        c.ID,
+		AppName:     c.AppName,
+		ProcessName: c.ProcessName,
+		Type:        c.Type,
+		Status:      provision.Status(c.Status),
+		Ip:          c.HostAddr,
 	}
 }
@@ -34,6 +34,7 @@ import (
 
 type newContainerOpts struct {
 	AppName     string
+	ProcessName string
 	Status      string
 	Provisioner *dockerProvisioner
 }
@@ -49,6 +50,7 @@ func (s *S) newContainer(opts *newContainerOpts) (*container, error) {
 	if opts != nil {
 		container.Status = opts.Status
 		container.AppName = opts.AppName
+		container.ProcessName = opts.ProcessName
 		if opts.Provisioner != nil {
 			p = opts.Provisioner
 		}
@@ -61,7 +63,9 @@ func (s *S) newContainer(opts *newContainerOpts) (*container, error) {
 		container.AppName = "container"
 	}
 	routertest.FakeRouter.AddBackend(container.AppName)
-	routertest.FakeRouter.AddRoute(container.AppName, container.getAddress())
+	if container.routable() {
+		routertest.FakeRouter.AddRoute(container.AppName, container.getAddress())
+	}
 	port, err := getPort()
 	if err != nil {
 		return nil, err
@@ -626,7 +630,7 @@ func (s *S) TestStart(c *check.C) {
 	routertest.FakeRouter.AddBackend(app.GetName())
 	defer routertest.FakeRouter.RemoveBackend(app.GetName())
 	var buf bytes.Buffer
-	cont, err := s.p.start(app, imageId, &buf)
+	cont, err := s.p.start(app, imageId, "", &buf)
 	c.Assert(err, check.IsNil)
 	defer cont.remove(s.p)
 	c.Assert(cont.ID, check.Not(check.Equals), "")
@@ -749,7 +753,7 @@ func (s *S) TestPushImage(c *check.C) {
 	c.Assert(err, check.IsNil)
 	err = s.newFakeImage(&p, "localhost:3030/base/img")
 	c.Assert(err, check.IsNil)
-	err = p.pushImage("localhost:3030/base/img", "")
+	err = p.pushImage("", "localhost:3030/base/img", "")
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 3)
 	c.Assert(requests[0].URL.Path, check.Equals, "/images/create")
@@ -758,7 +762,7 @@ func (s *S) TestPushImage(c *check.C) {
 	c.Assert(requests[2].URL.RawQuery, check.Equals, "")
 	err = s.newFakeImage(&p, "localhost:3030/base/img:v2")
 	c.Assert(err, check.IsNil)
-	err = p.pushImage("localhost:3030/base/img", "v2")
+	err = p.pushImage("", "localhost:3030/base/img", "v2")
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 6)
 	c.Assert(requests[3].URL.Path, check.Equals, "/images/create")
@@ -774,7 +778,7 @@ func (s *S) TestPushImageNoRegistry(c *check.C) {
 	})
 	c.Assert(err, check.IsNil)
 	defer server.Stop()
-	err = s.p.pushImage("localhost:3030/base", "")
+	err = s.p.pushImage("", "localhost:3030/base", "")
 	c.Assert(err, check.IsNil)
 	c.Assert(request, check.IsNil)
 }
@@ -887,11 +891,11 @@ func (s *S) TestBuildClusterStorage(c *check.C) {
 	defer config.Set("docker:cluster:mongo-url", "127.0.0.1:27017")
 	defer config.Set("docker:cluster:mongo-database", "docker_provision_tests_cluster_stor")
 	config.Unset("docker:cluster:mongo-url")
-	_, err := buildClusterStorage()
+	_, err := buildClusterStorage("")
 	c.Assert(err, check.ErrorMatches, ".*docker:cluster:{mongo-url,mongo-database} must be set.")
 	config.Set("docker:cluster:mongo-url", "127.0.0.1:27017")
 	config.Unset("docker:cluster:mongo-database")
-	_, err = buildClusterStorage()
+	_, err = buildClusterStorage("")
 	c.Assert(err, check.ErrorMatches, ".*docker:cluster:{mongo-url,mongo-database} must be set.")
 	config.Set("docker:cluster:storage", "xxxx")
 }
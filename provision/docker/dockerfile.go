@@ -0,0 +1,101 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+)
+
+// DockerfileDeploy builds the image of the app from the given build context,
+// a tar archive containing a Dockerfile, and deploys it. Units of images
+// built from a Dockerfile run the command defined in the image instead of
+// the unit agent.
+func (p *dockerProvisioner) DockerfileDeploy(app provision.App, buildContext io.ReadCloser, w io.Writer) (string, error) {
+	defer buildContext.Close()
+	imageId, err := p.dockerfileBuild(app, buildContext, w)
+	if err != nil {
+		return "", err
+	}
+	return imageId, p.deployAndClean(app, imageId, w)
+}
+
+func (p *dockerProvisioner) dockerfileBuild(app provision.App, buildContext io.Reader, w io.Writer) (string, error) {
+	imageId, err := appNewImageName(app.GetName())
+	if err != nil {
+		return "", log.WrapError(fmt.Errorf("error getting new image name for app %s", app.GetName()))
+	}
+	fmt.Fprintf(w, "---- Building image %s from Dockerfile ----\n", imageId)
+	buildOptions := docker.BuildImageOptions{
+		Name:           imageId,
+		RmTmpContainer: true,
+		InputStream:    buildContext,
+		OutputStream:   w,
+	}
+	dcluster, clusterName, err := p.clusterForApp(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	err = dcluster.BuildImage(buildOptions)
+	if err != nil {
+		return "", err
+	}
+	err = saveImageCustomData(imageId, map[string]interface{}{"dockerfile": true})
+	if err != nil {
+		return "", err
+	}
+	sep := strings.LastIndex(imageId, ":")
+	fmt.Fprintln(w, " ---> Sending image to repository")
+	err = p.pushImage(clusterName, imageId[:sep], imageId[sep+1:])
+	if err != nil {
+		return "", log.WrapError(fmt.Errorf("error in push image %s: %s", imageId, err.Error()))
+	}
+	return imageId, nil
+}
+
+// usesImageCommand returns whether units of the image run the command
+// defined in the image instead of the unit agent, which is the case for
+// images built from a Dockerfile and images deployed from external
+// registries.
+func usesImageCommand(imageName string) (bool, error) {
+	var customData struct {
+		Customdata struct {
+			Dockerfile    bool
+			ExternalImage string
+		}
+	}
+	coll, err := imageCustomDataColl()
+	if err != nil {
+		return false, err
+	}
+	defer coll.Close()
+	err = coll.FindId(imageName).One(&customData)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return customData.Customdata.Dockerfile || customData.Customdata.ExternalImage != "", nil
+}
+
+// imageUnitEnvs returns the environment of units running the command defined
+// in the image, with the app environment variables and the port the unit
+// must listen on.
+func imageUnitEnvs(app provision.App, port string) []string {
+	envs := make([]string, 0, len(app.Envs())+1)
+	for name, env := range app.Envs() {
+		envs = append(envs, fmt.Sprintf("%s=%s", name, env.Value))
+	}
+	sort.Strings(envs)
+	return append(envs, "PORT="+port)
+}
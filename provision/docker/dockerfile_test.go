@@ -0,0 +1,121 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func buildContext(c *check.C, dockerfile string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(dockerfile))})
+	c.Assert(err, check.IsNil)
+	_, err = tw.Write([]byte(dockerfile))
+	c.Assert(err, check.IsNil)
+	err = tw.Close()
+	c.Assert(err, check.IsNil)
+	return &buf
+}
+
+func (s *S) TestDockerfileDeploy(c *check.C) {
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "python",
+	}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer conn.Apps().Remove(bson.M{"name": a.Name})
+	s.p.Provision(&a)
+	defer s.p.Destroy(&a)
+	w := safe.NewBuffer(make([]byte, 2048))
+	err = app.Deploy(app.DeployOptions{
+		App:          &a,
+		OutputStream: w,
+		File:         ioutil.NopCloser(buildContext(c, "FROM busybox\nCMD [\"./server\"]\n")),
+		Dockerfile:   true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(w.String(), check.Matches, `(?s).*---- Building image tsuru/app-otherapp:v1 from Dockerfile ----.*`)
+	units := a.Units()
+	c.Assert(units, check.HasLen, 1)
+	images, err := listValidAppImages(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(images, check.DeepEquals, []string{"tsuru/app-otherapp:v1"})
+	imageCommand, err := usesImageCommand("tsuru/app-otherapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(imageCommand, check.Equals, true)
+	cont, err := s.p.getContainer(units[0].Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(cont.User, check.Equals, "")
+	dockerContainer, err := s.p.getCluster().InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.Config.Cmd, check.HasLen, 0)
+	env := dockerContainer.Config.Env
+	c.Assert(env[len(env)-1], check.Equals, "PORT=8888")
+}
+
+func (s *S) TestUsesImageCommand(c *check.C) {
+	imageCommand, err := usesImageCommand("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(imageCommand, check.Equals, false)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{"procfile": "web: ./server"})
+	c.Assert(err, check.IsNil)
+	imageCommand, err = usesImageCommand("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(imageCommand, check.Equals, false)
+	err = saveImageCustomData("tsuru/app-myapp:v2", map[string]interface{}{"dockerfile": true})
+	c.Assert(err, check.IsNil)
+	imageCommand, err = usesImageCommand("tsuru/app-myapp:v2")
+	c.Assert(err, check.IsNil)
+	c.Assert(imageCommand, check.Equals, true)
+	err = saveImageCustomData("tsuru/app-myapp:v3", map[string]interface{}{"externalimage": "registry.example.com/team/app:1.0"})
+	c.Assert(err, check.IsNil)
+	imageCommand, err = usesImageCommand("tsuru/app-myapp:v3")
+	c.Assert(err, check.IsNil)
+	c.Assert(imageCommand, check.Equals, true)
+}
+
+func (s *S) TestImageUnitEnvs(c *check.C) {
+	fakeApp := provisiontest.NewFakeApp("myapp", "python", 0)
+	fakeApp.SetEnv(bind.EnvVar{Name: "DATABASE_HOST", Value: "localhost"})
+	fakeApp.SetEnv(bind.EnvVar{Name: "A_VAR", Value: "a value"})
+	envs := imageUnitEnvs(fakeApp, "8888")
+	c.Assert(envs, check.DeepEquals, []string{"A_VAR=a value", "DATABASE_HOST=localhost", "PORT=8888"})
+}
+
+func (s *S) TestStartDockerfileImageUsesImageCommand(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{"dockerfile": true})
+	c.Assert(err, check.IsNil)
+	fakeApp := provisiontest.NewFakeApp("myapp", "python", 0)
+	fakeApp.SetEnv(bind.EnvVar{Name: "A_VAR", Value: "a value"})
+	var buf bytes.Buffer
+	cont, err := s.p.start(fakeApp, "tsuru/app-myapp:v1", "", &buf)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.Config.Cmd, check.HasLen, 0)
+	c.Assert(dockerContainer.Config.User, check.Equals, "")
+	c.Assert(dockerContainer.Config.Env, check.DeepEquals, []string{"A_VAR=a value", "PORT=8888"})
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/safe"
+)
+
+// importExternalImage pulls an image from an external registry, using the
+// registry credentials of the app, and tags it as a new image of the app,
+// sending it to the tsuru registry so nodes pull it from there when creating
+// units and rollbacks keep working. Units of the imported image run the
+// command defined in the image.
+func (p *dockerProvisioner) importExternalImage(app provision.App, imageName string, w io.Writer) (string, error) {
+	authConfig, err := registryAuthForApp(app.GetName(), imageRegistry(imageName))
+	if err != nil {
+		return "", err
+	}
+	dcluster, clusterName, err := p.clusterForApp(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "---- Pulling image %s ----\n", imageName)
+	var buf safe.Buffer
+	pullOpts := docker.PullImageOptions{Repository: imageName, OutputStream: &buf}
+	err = dcluster.PullImage(pullOpts, authConfig)
+	if err != nil {
+		log.Errorf("[docker] Failed to pull image %q (%s): %s", imageName, err, buf.String())
+		return "", fmt.Errorf("error pulling image %s: %s", imageName, err)
+	}
+	newImage, err := appNewImageName(app.GetName())
+	if err != nil {
+		return "", log.WrapError(fmt.Errorf("error getting new image name for app %s", app.GetName()))
+	}
+	fmt.Fprintf(w, " ---> Tagging image as %s\n", newImage)
+	sep := strings.LastIndex(newImage, ":")
+	repo, tag := newImage[:sep], newImage[sep+1:]
+	tagOpts := docker.TagImageOptions{Repo: repo, Tag: tag, Force: true}
+	err = dcluster.TagImage(imageName, tagOpts)
+	if err != nil {
+		return "", err
+	}
+	err = saveImageCustomData(newImage, map[string]interface{}{"externalimage": imageName})
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(w, " ---> Sending image to repository")
+	err = p.pushImage(clusterName, repo, tag)
+	if err != nil {
+		return "", log.WrapError(fmt.Errorf("error in push image %s: %s", newImage, err.Error()))
+	}
+	return newImage, nil
+}
@@ -40,7 +40,7 @@ func (p *dockerProvisioner) checkContainer(container container, wg *sync.WaitGro
 		if err != nil {
 			return err
 		}
-		if info.HTTPHostPort != container.HostPort || info.IP != container.IP {
+		if info.HTTPHostPort != container.HostPort || info.IP != container.IP || extraPortsChanged(container.ExtraPorts, info.ExtraPorts) {
 			err = p.fixContainer(&container, info)
 			if err != nil {
 				log.Errorf("error on fix container hostport for [container %s]", container.ID)
@@ -63,10 +63,17 @@ func (p *dockerProvisioner) fixContainer(container *container, info containerNet
 	if err != nil {
 		return err
 	}
-	router.RemoveRoute(container.AppName, container.getAddress())
+	if container.routable() {
+		router.RemoveRoute(container.AppName, container.getAddress())
+		container.removeTCPRoutes(router)
+	}
 	container.IP = info.IP
 	container.HostPort = info.HTTPHostPort
-	router.AddRoute(container.AppName, container.getAddress())
+	container.ExtraPorts = info.ExtraPorts
+	if container.routable() {
+		router.AddRoute(container.AppName, container.getAddress())
+		container.addTCPRoutes(router)
+	}
 	coll := p.collection()
 	defer coll.Close()
 	return coll.Update(bson.M{"id": container.ID}, container)
@@ -14,6 +14,8 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -130,3 +132,52 @@ func (s *S) TestFixContainersEmptyPortDoesNothing(c *check.C) {
 	c.Assert(cont.IP, check.Equals, "")
 	c.Assert(cont.HostPort, check.Equals, "")
 }
+
+func (s *S) TestFixContainerUpdatesTCPRoutes(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	a := app.App{Name: "makea"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	routertest.FakeRouter.AddBackend(a.Name)
+	defer routertest.FakeRouter.RemoveBackend(a.Name)
+	_, err = router.AllocatePort(a.Name, 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	defer router.ReleaseAppPorts(a.Name)
+	cont := container{
+		ID:         "9930c24f1c4x",
+		AppName:    a.Name,
+		Status:     provision.StatusStarted.String(),
+		IP:         "127.0.0.4",
+		HostPort:   "9025",
+		HostAddr:   "127.0.0.1",
+		ExtraPorts: map[string]string{"5432": "49153"},
+	}
+	coll := s.p.collection()
+	defer coll.Close()
+	err = coll.Insert(cont)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"appname": a.Name})
+	err = cont.addTCPRoutes(&routertest.FakeRouter)
+	c.Assert(err, check.IsNil)
+	info := containerNetworkInfo{
+		IP:           "127.0.0.9",
+		HTTPHostPort: "9999",
+		ExtraPorts:   map[string]string{"5432": "49200"},
+	}
+	err = s.p.fixContainer(&cont, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasTCPRoute(a.Name, 30000, "127.0.0.1:49153"), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasTCPRoute(a.Name, 30000, "127.0.0.1:49200"), check.Equals, true)
+	dbCont, err := s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.ExtraPorts, check.DeepEquals, map[string]string{"5432": "49200"})
+}
+
+func (s *S) TestExtraPortsChanged(c *check.C) {
+	c.Assert(extraPortsChanged(nil, nil), check.Equals, false)
+	c.Assert(extraPortsChanged(map[string]string{"5432": "49153"}, map[string]string{"5432": "49153"}), check.Equals, false)
+	c.Assert(extraPortsChanged(map[string]string{"5432": "49153"}, map[string]string{"5432": "49200"}), check.Equals, true)
+	c.Assert(extraPortsChanged(map[string]string{"5432": "49153"}, nil), check.Equals, true)
+	c.Assert(extraPortsChanged(nil, map[string]string{"5432": "49153"}), check.Equals, true)
+}
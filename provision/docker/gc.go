@@ -0,0 +1,320 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/storage"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	imageGCLockID  = "gc"
+	imageGCLockTTL = 30 * time.Minute
+)
+
+var errImageGCLocked = errors.New("images are being collected by another tsuru process")
+
+// gcRemovedImage is the record of an image removed by the image garbage
+// collector. Node is empty when the image was removed using the image list
+// of the app, which also removes it from the registry.
+type gcRemovedImage struct {
+	Image     string
+	AppName   string
+	Node      string `bson:",omitempty" json:",omitempty"`
+	Registry  bool
+	RemovedAt time.Time
+}
+
+func imageGCColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_image_gc", name)), nil
+}
+
+func listRemovedImages() ([]gcRemovedImage, error) {
+	coll, err := imageGCColl()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var images []gcRemovedImage
+	err = coll.Find(nil).Sort("-removedat").All(&images)
+	return images, err
+}
+
+// normalizeImageName adds the latest tag to images without a tag, so images
+// listed by the docker nodes can be compared with the names stored by tsuru.
+func normalizeImageName(name string) string {
+	if strings.LastIndex(name, ":") <= strings.LastIndex(name, "/") {
+		return name + ":latest"
+	}
+	return name
+}
+
+// appNameFromImage returns the app of an image created by tsuru, or an empty
+// string when the image isn't an app image.
+func appNameFromImage(name string) string {
+	for _, clusterName := range append([]string{""}, namedClusters()...) {
+		prefix := basicImageName(clusterName) + "/app-"
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		appName := strings.TrimPrefix(name, prefix)
+		if i := strings.Index(appName, ":"); i != -1 {
+			appName = appName[:i]
+		}
+		return appName
+	}
+	return ""
+}
+
+// collectImages removes the images of apps that are outside the valid image
+// history, both from the docker nodes and from the registry. Images still
+// used by a container are never removed. In dry mode the images are only
+// listed.
+func (p *dockerProvisioner) collectImages(encoder *json.Encoder, dryRun bool) error {
+	containers, err := p.listAllContainers()
+	if err != nil {
+		return err
+	}
+	inUse := make(map[string]bool)
+	for _, c := range containers {
+		for _, img := range []string{c.Image, c.BuildingImage} {
+			if img != "" {
+				inUse[normalizeImageName(img)] = true
+			}
+		}
+	}
+	// keep holds the images that the node collection must not touch: the
+	// ones in use and, in dry mode, the ones already listed.
+	keep := make(map[string]bool, len(inUse))
+	for img := range inUse {
+		keep[img] = true
+	}
+	coll, err := appImagesColl()
+	if err != nil {
+		return err
+	}
+	var allImages []appImages
+	err = coll.Find(nil).All(&allImages)
+	coll.Close()
+	if err != nil {
+		return err
+	}
+	historySize := imageHistorySize()
+	valid := make(map[string]map[string]bool, len(allImages))
+	var removed []gcRemovedImage
+	for _, imgs := range allImages {
+		valid[imgs.AppName] = make(map[string]bool)
+		for i, img := range imgs.Images {
+			if i >= len(imgs.Images)-historySize {
+				valid[imgs.AppName][normalizeImageName(img)] = true
+				continue
+			}
+			if inUse[normalizeImageName(img)] {
+				logProgress(encoder, "Keeping image %s, it's used by a unit of %q.", img, imgs.AppName)
+				continue
+			}
+			if dryRun {
+				logProgress(encoder, "Would remove image %s of %q.", img, imgs.AppName)
+				keep[normalizeImageName(img)] = true
+				continue
+			}
+			if p.removeImageFromHistory(imgs.AppName, img) {
+				logProgress(encoder, "Removed image %s of %q.", img, imgs.AppName)
+				removed = append(removed, gcRemovedImage{Image: img, AppName: imgs.AppName, Registry: true})
+			}
+		}
+	}
+	nodeRemoved, err := p.collectNodeImages(encoder, dryRun, valid, keep)
+	if err != nil {
+		return err
+	}
+	removed = append(removed, nodeRemoved...)
+	return recordRemovedImages(removed)
+}
+
+// removeImageFromHistory removes the image from the nodes and from the
+// registry, pulling it from the image list of the app if both succeed.
+func (p *dockerProvisioner) removeImageFromHistory(appName, img string) bool {
+	dcluster, _, err := p.clusterForApp(appName)
+	if err != nil {
+		log.Errorf("[image gc] Unable to get the cluster of app %q: %s. Image %q kept on list to retry later.", appName, err, img)
+		return false
+	}
+	err = dcluster.RemoveImage(img)
+	if err != nil && err != storage.ErrNoSuchImage && err != docker.ErrNoSuchImage {
+		log.Errorf("[image gc] Unable to remove image %q: %s. Image kept on list to retry later.", img, err)
+		return false
+	}
+	err = dcluster.RemoveFromRegistry(img)
+	if err != nil {
+		log.Errorf("[image gc] Unable to remove image %q from registry: %s. Image kept on list to retry later.", img, err)
+		return false
+	}
+	err = pullAppImageNames(appName, []string{img})
+	if err != nil {
+		log.Errorf("[image gc] Unable to pull image %q from database: %s", img, err)
+		return false
+	}
+	return true
+}
+
+// collectNodeImages removes from each node the app images that are neither in
+// the valid history of the app nor in keep. Images of apps without an image
+// list are kept.
+func (p *dockerProvisioner) collectNodeImages(encoder *json.Encoder, dryRun bool, valid map[string]map[string]bool, keep map[string]bool) ([]gcRemovedImage, error) {
+	nodes, err := p.unfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	var removed []gcRemovedImage
+	for _, node := range nodes {
+		client, err := node.Client()
+		if err != nil {
+			log.Errorf("[image gc] Unable to get client for node %s: %s", node.Address, err)
+			continue
+		}
+		images, err := client.ListImages(docker.ListImagesOptions{})
+		if err != nil {
+			log.Errorf("[image gc] Unable to list images in node %s: %s", node.Address, err)
+			continue
+		}
+		for _, image := range images {
+			for _, tag := range image.RepoTags {
+				appName := appNameFromImage(tag)
+				appValid, ok := valid[appName]
+				if !ok || appValid[normalizeImageName(tag)] || keep[normalizeImageName(tag)] {
+					continue
+				}
+				if dryRun {
+					logProgress(encoder, "Would remove image %s of %q from node %s.", tag, appName, node.Address)
+					continue
+				}
+				err = client.RemoveImage(tag)
+				if err != nil {
+					log.Errorf("[image gc] Unable to remove image %q from node %s: %s", tag, node.Address, err)
+					continue
+				}
+				logProgress(encoder, "Removed image %s of %q from node %s.", tag, appName, node.Address)
+				removed = append(removed, gcRemovedImage{Image: tag, AppName: appName, Node: node.Address})
+			}
+		}
+	}
+	return removed, nil
+}
+
+func recordRemovedImages(images []gcRemovedImage) error {
+	if len(images) == 0 {
+		return nil
+	}
+	coll, err := imageGCColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	docs := make([]interface{}, len(images))
+	for i := range images {
+		images[i].RemovedAt = now
+		docs[i] = images[i]
+	}
+	return coll.Insert(docs...)
+}
+
+func imageGCLockColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_image_gc_lock", name)), nil
+}
+
+// acquireImageGCLock locks the image garbage collector in the database,
+// preventing other tsuru processes from collecting images at the same time.
+// It returns false when the collector is already locked. Locks expire after
+// imageGCLockTTL, so locks held by processes that died while collecting
+// images don't block the collector forever.
+func acquireImageGCLock() (bool, error) {
+	coll, err := imageGCLockColl()
+	if err != nil {
+		return false, err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	query := bson.M{"_id": imageGCLockID, "lockeduntil": bson.M{"$lt": now}}
+	_, err = coll.Upsert(query, bson.M{"$set": bson.M{"lockeduntil": now.Add(imageGCLockTTL)}})
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func releaseImageGCLock() error {
+	coll, err := imageGCLockColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(imageGCLockID)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// lockAndCollectImages runs collectImages holding the image garbage collector
+// lock, returning errImageGCLocked when another process holds it.
+func (p *dockerProvisioner) lockAndCollectImages(encoder *json.Encoder, dryRun bool) error {
+	locked, err := acquireImageGCLock()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errImageGCLocked
+	}
+	defer func() {
+		if err := releaseImageGCLock(); err != nil {
+			log.Errorf("[image gc] Unable to release the image gc lock: %s", err)
+		}
+	}()
+	return p.collectImages(encoder, dryRun)
+}
+
+func (p *dockerProvisioner) runImageGC(interval time.Duration) {
+	encoder := json.NewEncoder(ioutil.Discard)
+	for {
+		err := p.lockAndCollectImages(encoder, false)
+		if err == errImageGCLocked {
+			log.Debugf("[image gc] Skipping run: %s.", err)
+		} else if err != nil {
+			log.Errorf("[image gc] Unable to collect images: %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) nodeImageTags(c *check.C) []string {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	images, err := client.ListImages(docker.ListImagesOptions{All: true})
+	c.Assert(err, check.IsNil)
+	var tags []string
+	for _, image := range images {
+		tags = append(tags, image.RepoTags...)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (s *S) prepareImagesForGC(c *check.C) {
+	for _, img := range []string{"tsuru/app-myapp:v0", "tsuru/app-myapp:v1", "tsuru/app-myapp:v2", "tsuru/app-myapp:v3", "tsuru/python"} {
+		err := s.newFakeImage(s.p, img)
+		c.Assert(err, check.IsNil)
+	}
+	for _, img := range []string{"tsuru/app-myapp:v1", "tsuru/app-myapp:v2", "tsuru/app-myapp:v3"} {
+		err := appendAppImageName("myapp", img)
+		c.Assert(err, check.IsNil)
+	}
+	coll := s.p.collection()
+	defer coll.Close()
+	err := coll.Insert(container{ID: "c1", AppName: "myapp", Image: "tsuru/app-myapp:v1", HostAddr: "127.0.0.1"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestNormalizeImageName(c *check.C) {
+	c.Assert(normalizeImageName("tsuru/app-myapp"), check.Equals, "tsuru/app-myapp:latest")
+	c.Assert(normalizeImageName("tsuru/app-myapp:v1"), check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(normalizeImageName("localhost:5000/tsuru/app-myapp"), check.Equals, "localhost:5000/tsuru/app-myapp:latest")
+}
+
+func (s *S) TestAppNameFromImage(c *check.C) {
+	c.Assert(appNameFromImage("tsuru/app-myapp:v1"), check.Equals, "myapp")
+	c.Assert(appNameFromImage("tsuru/app-myapp"), check.Equals, "myapp")
+	c.Assert(appNameFromImage("tsuru/python"), check.Equals, "")
+	c.Assert(appNameFromImage("other/app-myapp:v1"), check.Equals, "")
+}
+
+func (s *S) TestCollectImages(c *check.C) {
+	config.Set("docker:image-history-size", 1)
+	defer config.Unset("docker:image-history-size")
+	s.prepareImagesForGC(c)
+	var buf bytes.Buffer
+	err := s.p.collectImages(json.NewEncoder(&buf), false)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.nodeImageTags(c), check.DeepEquals, []string{"tsuru/app-myapp:v1", "tsuru/app-myapp:v3", "tsuru/python"})
+	removed, err := listRemovedImages()
+	c.Assert(err, check.IsNil)
+	var removedNames []string
+	for _, img := range removed {
+		c.Assert(img.AppName, check.Equals, "myapp")
+		c.Assert(img.RemovedAt.IsZero(), check.Equals, false)
+		removedNames = append(removedNames, img.Image)
+	}
+	sort.Strings(removedNames)
+	c.Assert(removedNames, check.DeepEquals, []string{"tsuru/app-myapp:v0", "tsuru/app-myapp:v2"})
+}
+
+func (s *S) TestCollectImagesDryRun(c *check.C) {
+	config.Set("docker:image-history-size", 1)
+	defer config.Unset("docker:image-history-size")
+	s.prepareImagesForGC(c)
+	var buf bytes.Buffer
+	err := s.p.collectImages(json.NewEncoder(&buf), true)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.nodeImageTags(c), check.DeepEquals, []string{
+		"tsuru/app-myapp:v0", "tsuru/app-myapp:v1", "tsuru/app-myapp:v2", "tsuru/app-myapp:v3", "tsuru/python",
+	})
+	images, err := listAppImages("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(images, check.HasLen, 3)
+	removed, err := listRemovedImages()
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.HasLen, 0)
+	var messages []string
+	decoder := json.NewDecoder(&buf)
+	for {
+		var entry progressLog
+		if decoder.Decode(&entry) != nil {
+			break
+		}
+		messages = append(messages, entry.Message)
+	}
+	c.Assert(messages, check.DeepEquals, []string{
+		`Keeping image tsuru/app-myapp:v1, it's used by a unit of "myapp".`,
+		`Would remove image tsuru/app-myapp:v2 of "myapp".`,
+		`Would remove image tsuru/app-myapp:v0 of "myapp" from node ` + s.server.URL() + ".",
+	})
+}
+
+func (s *S) TestImageGCLock(c *check.C) {
+	locked, err := acquireImageGCLock()
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	locked, err = acquireImageGCLock()
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, false)
+	err = releaseImageGCLock()
+	c.Assert(err, check.IsNil)
+	locked, err = acquireImageGCLock()
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = releaseImageGCLock()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestImageGCLockExpired(c *check.C) {
+	coll, err := imageGCLockColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(bson.M{"_id": imageGCLockID, "lockeduntil": time.Now().UTC().Add(-time.Minute)})
+	c.Assert(err, check.IsNil)
+	locked, err := acquireImageGCLock()
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = releaseImageGCLock()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestLockAndCollectImagesLocked(c *check.C) {
+	config.Set("docker:image-history-size", 1)
+	defer config.Unset("docker:image-history-size")
+	s.prepareImagesForGC(c)
+	locked, err := acquireImageGCLock()
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	var buf bytes.Buffer
+	err = s.p.lockAndCollectImages(json.NewEncoder(&buf), false)
+	c.Assert(err, check.Equals, errImageGCLocked)
+	c.Assert(s.nodeImageTags(c), check.HasLen, 5)
+	err = releaseImageGCLock()
+	c.Assert(err, check.IsNil)
+	err = s.p.lockAndCollectImages(json.NewEncoder(&buf), false)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.nodeImageTags(c), check.DeepEquals, []string{"tsuru/app-myapp:v1", "tsuru/app-myapp:v3", "tsuru/python"})
+	locked, err = acquireImageGCLock()
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = releaseImageGCLock()
+	c.Assert(err, check.IsNil)
+}
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/tsuru/tsuru/iaas"
 	_ "github.com/tsuru/tsuru/iaas/cloudstack"
 	_ "github.com/tsuru/tsuru/iaas/ec2"
+	"github.com/tsuru/tsuru/volume"
 	"gopkg.in/mgo.v2"
 )
 
@@ -30,16 +32,33 @@ func init() {
 	api.RegisterHandler("/docker/node/{address}/containers", "GET", api.AdminRequiredHandler(listContainersHandler))
 	api.RegisterHandler("/docker/node", "POST", api.AdminRequiredHandler(addNodeHandler))
 	api.RegisterHandler("/docker/node", "DELETE", api.AdminRequiredHandler(removeNodeHandler))
+	api.RegisterHandler("/docker/node/cordon", "POST", api.AdminRequiredHandler(cordonNodeHandler))
+	api.RegisterHandler("/docker/node/uncordon", "POST", api.AdminRequiredHandler(uncordonNodeHandler))
+	api.RegisterHandler("/docker/node/drain", "POST", api.AdminRequiredHandler(drainNodeHandler))
+	api.RegisterHandler("/docker/node/usage", "GET", api.AdminRequiredHandler(nodeUsageHandler))
 	api.RegisterHandler("/docker/container/{id}/move", "POST", api.AdminRequiredHandler(moveContainerHandler))
 	api.RegisterHandler("/docker/containers/move", "POST", api.AdminRequiredHandler(moveContainersHandler))
 	api.RegisterHandler("/docker/containers/rebalance", "POST", api.AdminRequiredHandler(rebalanceContainersHandler))
+	api.RegisterHandler("/docker/images/gc", "POST", api.AdminRequiredHandler(collectImagesHandler))
+	api.RegisterHandler("/docker/images/gc", "GET", api.AdminRequiredHandler(listRemovedImagesHandler))
+	api.RegisterHandler("/docker/registry/credentials", "POST", api.AdminRequiredHandler(setRegistryCredentialsHandler))
+	api.RegisterHandler("/docker/registry/credentials", "DELETE", api.AdminRequiredHandler(removeRegistryCredentialsHandler))
+	api.RegisterHandler("/docker/registry/credentials", "GET", api.AdminRequiredHandler(listRegistryCredentialsHandler))
 	api.RegisterHandler("/docker/pool", "GET", api.AdminRequiredHandler(listPoolHandler))
 	api.RegisterHandler("/docker/pool", "POST", api.AdminRequiredHandler(addPoolHandler))
 	api.RegisterHandler("/docker/pool", "DELETE", api.AdminRequiredHandler(removePoolHandler))
+	api.RegisterHandler("/docker/pool/strategy", "POST", api.AdminRequiredHandler(setPoolStrategyHandler))
+	api.RegisterHandler("/docker/pool/cluster", "POST", api.AdminRequiredHandler(setPoolClusterHandler))
+	api.RegisterHandler("/docker/pool/default", "POST", api.AdminRequiredHandler(setTeamDefaultPoolHandler))
+	api.RegisterHandler("/docker/pool/autoscale", "POST", api.AdminRequiredHandler(setPoolAutoScaleHandler))
 	api.RegisterHandler("/docker/pool/team", "POST", api.AdminRequiredHandler(addTeamToPoolHandler))
 	api.RegisterHandler("/docker/pool/team", "DELETE", api.AdminRequiredHandler(removeTeamToPoolHandler))
+	api.RegisterHandler("/docker/volume", "GET", api.AdminRequiredHandler(listVolumesHandler))
+	api.RegisterHandler("/docker/volume", "POST", api.AdminRequiredHandler(addVolumeHandler))
+	api.RegisterHandler("/docker/volume", "DELETE", api.AdminRequiredHandler(removeVolumeHandler))
 	api.RegisterHandler("/docker/fix-containers", "POST", api.AdminRequiredHandler(fixContainersHandler))
 	api.RegisterHandler("/docker/healing", "GET", api.AdminRequiredHandler(healingHistoryHandler))
+	api.RegisterHandler("/docker/autoscale", "GET", api.AdminRequiredHandler(autoScaleHistoryHandler))
 }
 
 func validateNodeAddress(address string) error {
@@ -79,7 +98,17 @@ func (p *dockerProvisioner) addNodeForParams(params map[string]string, isRegiste
 	if err != nil {
 		return response, err
 	}
-	_, err = p.getCluster().Register(address, params)
+	dcluster := p.getCluster()
+	if params["pool"] != "" {
+		dcluster, err = p.clusterForPool(params["pool"])
+		if err == mgo.ErrNotFound {
+			dcluster, err = p.getCluster(), nil
+		}
+		if err != nil {
+			return response, err
+		}
+	}
+	_, err = dcluster.Register(address, params)
 	if err != nil {
 		return response, err
 	}
@@ -113,7 +142,11 @@ func removeNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) err
 	if address == "" {
 		return fmt.Errorf("Node address is required.")
 	}
-	err = mainDockerProvisioner.getCluster().Unregister(address)
+	dcluster, _, err := mainDockerProvisioner.clusterForNode(address)
+	if err != nil {
+		return err
+	}
+	err = dcluster.Unregister(address)
 	if err != nil {
 		return err
 	}
@@ -128,9 +161,70 @@ func removeNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) err
 	return nil
 }
 
+func nodeAddressParam(r *http.Request) (string, error) {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return "", err
+	}
+	address, _ := params["address"]
+	if address == "" {
+		return "", &errors.HTTP{Code: http.StatusBadRequest, Message: "Node address is required."}
+	}
+	return address, nil
+}
+
+// cordonNodeHandler marks a node as unschedulable, so the scheduler doesn't
+// create new containers in it.
+func cordonNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	address, err := nodeAddressParam(r)
+	if err != nil {
+		return err
+	}
+	err = mainDockerProvisioner.cordonNode(address)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// uncordonNodeHandler marks a cordoned node as schedulable again.
+func uncordonNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	address, err := nodeAddressParam(r)
+	if err != nil {
+		return err
+	}
+	err = mainDockerProvisioner.uncordonNode(address)
+	if err == errNodeNotCordoned {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// drainNodeHandler cordons a node and moves its containers to other nodes in
+// the same pool, streaming the progress of the operation.
+func drainNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	address, err := nodeAddressParam(r)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	err = mainDockerProvisioner.drainNode(address, encoder)
+	if err != nil {
+		logProgress(encoder, "Error draining node: %s", err.Error())
+	} else {
+		logProgress(encoder, "Node drained successfully!")
+	}
+	return nil
+}
+
 //listNodeHandler call scheduler.Nodes to list all nodes into it.
 func listNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
-	nodeList, err := mainDockerProvisioner.getCluster().UnfilteredNodes()
+	nodeList, err := mainDockerProvisioner.unfilteredNodes()
 	if err != nil {
 		return err
 	}
@@ -138,13 +232,53 @@ func listNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	if err != nil {
 		return err
 	}
+	cordoned, err := cordonedNodeAddresses()
+	if err != nil {
+		return err
+	}
+	cordonedList := make([]string, 0, len(cordoned))
+	for address := range cordoned {
+		cordonedList = append(cordonedList, address)
+	}
+	sort.Strings(cordonedList)
 	result := map[string]interface{}{
 		"nodes":    nodeList,
 		"machines": machines,
+		"cordoned": cordonedList,
+	}
+	if len(namedClusters()) > 0 {
+		byCluster, err := mainDockerProvisioner.nodesByCluster(true)
+		if err != nil {
+			return err
+		}
+		nodeClusters := make(map[string]string, len(nodeList))
+		for clusterName, nodes := range byCluster {
+			for _, node := range nodes {
+				nodeClusters[node.Address] = clusterName
+			}
+		}
+		result["clusters"] = nodeClusters
+	}
+	if zoneKey := zoneMetadata(); zoneKey != "" {
+		zones, err := mainDockerProvisioner.zoneDistribution(zoneKey, "")
+		if err != nil {
+			return err
+		}
+		result["zones"] = zones
 	}
 	return json.NewEncoder(w).Encode(result)
 }
 
+// nodeUsageHandler reports the resources reserved by units in each node and
+// pool against their capacity.
+func nodeUsageHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	report, err := mainDockerProvisioner.nodesUsage(r.URL.Query().Get("pool"))
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(report)
+}
+
 func fixContainersHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	err := mainDockerProvisioner.fixContainers()
 	if err != nil {
@@ -210,22 +344,127 @@ func rebalanceContainersHandler(w http.ResponseWriter, r *http.Request, t auth.T
 	return nil
 }
 
+func collectImagesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	dry := false
+	params, err := unmarshal(r.Body)
+	if err == nil {
+		dry = params["dry"] == "true"
+	}
+	encoder := json.NewEncoder(w)
+	err = mainDockerProvisioner.lockAndCollectImages(encoder, dry)
+	if err != nil {
+		logProgress(encoder, "Error trying to collect images: %s", err.Error())
+	} else {
+		logProgress(encoder, "Images collected successfully!")
+	}
+	return nil
+}
+
+func listRemovedImagesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	images, err := listRemovedImages()
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(images)
+}
+
+// setRegistryCredentialsHandler stores the credentials an app, or the apps of
+// a team, use to pull images from a private registry.
+func setRegistryCredentialsHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = setRegistryCredentials(registryCredentials{
+		App:      params["app"],
+		Team:     params["team"],
+		Registry: params["registry"],
+		Username: params["username"],
+		Password: params["password"],
+	})
+	switch err {
+	case nil:
+	case errRegistryCredentialsOwner, errRegistryCredentialsRegistry, errRegistryAuthSecretNotSet:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	default:
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func removeRegistryCredentialsHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = removeRegistryCredentials(params["app"], params["team"], params["registry"])
+	switch err {
+	case nil:
+	case errRegistryCredentialsOwner:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case errRegistryCredentialsNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	default:
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listRegistryCredentialsHandler lists the stored registry credentials,
+// without their passwords.
+func listRegistryCredentialsHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	creds, err := listRegistryCredentials()
+	if err != nil {
+		return err
+	}
+	if len(creds) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(creds)
+}
+
+type containerWithZone struct {
+	container
+	Zone string `json:",omitempty"`
+}
+
 //listContainersHandler call scheduler.Containers to list all containers into it.
 func listContainersHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	var containerList []container
+	var err error
 	address := r.URL.Query().Get(":address")
 	if address != "" {
-		containerList, err := mainDockerProvisioner.listContainersByHost(address)
-		if err != nil {
-			return err
-		}
+		containerList, err = mainDockerProvisioner.listContainersByHost(address)
+	} else {
+		app := r.URL.Query().Get(":appname")
+		containerList, err = mainDockerProvisioner.listContainersByApp(app)
+	}
+	if err != nil {
+		return err
+	}
+	zoneKey := zoneMetadata()
+	if zoneKey == "" {
 		return json.NewEncoder(w).Encode(containerList)
 	}
-	app := r.URL.Query().Get(":appname")
-	containerList, err := mainDockerProvisioner.listContainersByApp(app)
+	nodes, err := mainDockerProvisioner.unfilteredNodes()
 	if err != nil {
 		return err
 	}
-	return json.NewEncoder(w).Encode(containerList)
+	zones := hostZones(nodes, zoneKey)
+	result := make([]containerWithZone, len(containerList))
+	for i, c := range containerList {
+		result[i] = containerWithZone{container: c, Zone: zones[c.HostAddr]}
+	}
+	return json.NewEncoder(w).Encode(result)
 }
 
 func addPoolHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
@@ -265,6 +504,107 @@ type teamsToPoolParams struct {
 	Teams []string `json:"teams"`
 }
 
+func setPoolStrategyHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return err
+	}
+	var segScheduler segregatedScheduler
+	err = segScheduler.setPoolStrategy(params["pool"], params["strategy"])
+	if err == mgo.ErrNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "Pool not found."}
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// autoScaleFromParams builds the auto scaling settings of a pool from the
+// request params, returning nil when the auto scaling is being disabled.
+func autoScaleFromParams(params map[string]string) (*PoolAutoScale, error) {
+	if enabled, _ := strconv.ParseBool(params["enabled"]); !enabled {
+		return nil, nil
+	}
+	autoScale := PoolAutoScale{Enabled: true, Template: params["template"]}
+	var err error
+	if params["min"] != "" {
+		autoScale.MinNodes, err = strconv.Atoi(params["min"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid minimum number of nodes: %s", params["min"])
+		}
+	}
+	if params["max"] != "" {
+		autoScale.MaxNodes, err = strconv.Atoi(params["max"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid maximum number of nodes: %s", params["max"])
+		}
+	}
+	autoScale.ScaleUpRatio, err = strconv.ParseFloat(params["scale-up"], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scale up ratio: %s", params["scale-up"])
+	}
+	autoScale.ScaleDownRatio, err = strconv.ParseFloat(params["scale-down"], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scale down ratio: %s", params["scale-down"])
+	}
+	return &autoScale, nil
+}
+
+func setPoolAutoScaleHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return err
+	}
+	autoScale, err := autoScaleFromParams(params)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = setPoolAutoScale(params["pool"], autoScale)
+	if err == mgo.ErrNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "Pool not found."}
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func setPoolClusterHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return err
+	}
+	err = mainDockerProvisioner.setPoolCluster(params["pool"], params["cluster"])
+	if err == mgo.ErrNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "Pool not found."}
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func setTeamDefaultPoolHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return err
+	}
+	var segScheduler segregatedScheduler
+	err = segScheduler.setTeamDefaultPool(params["pool"], params["team"])
+	if err == mgo.ErrNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "Pool not found."}
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func addTeamToPoolHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -293,6 +633,80 @@ func removeTeamToPoolHandler(w http.ResponseWriter, r *http.Request, t auth.Toke
 	return segScheduler.removeTeamsFromPool(params.Pool, params.Teams)
 }
 
+func listVolumesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	volumes, err := volume.List()
+	if err != nil {
+		return err
+	}
+	if len(volumes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(volumes)
+}
+
+// addVolumeHandler creates a volume in an existing pool. Volumes can then be
+// bound to apps by their teams.
+func addVolumeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	v := volume.Volume{
+		Name:   params["name"],
+		Type:   params["type"],
+		Source: params["source"],
+		Pool:   params["pool"],
+		Node:   params["node"],
+	}
+	if v.Pool != "" {
+		conn, err := db.Conn()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		n, err := conn.Collection(schedulerCollection).FindId(v.Pool).Count()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: "Pool not found."}
+		}
+	}
+	err = volume.Create(&v)
+	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+		}
+		if err == volume.ErrVolumeAlreadyExists {
+			return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+		}
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func removeVolumeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	params, err := unmarshal(r.Body)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = volume.Remove(params["name"])
+	switch err {
+	case nil:
+	case volume.ErrVolumeNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case volume.ErrVolumeBound:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func unmarshal(body io.ReadCloser) (map[string]string, error) {
 	b, err := ioutil.ReadAll(body)
 	if err != nil {
@@ -320,3 +734,11 @@ func healingHistoryHandler(w http.ResponseWriter, r *http.Request, t auth.Token)
 	}
 	return json.NewEncoder(w).Encode(history)
 }
+
+func autoScaleHistoryHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	history, err := listAutoScaleHistory(r.URL.Query().Get("pool"))
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(history)
+}
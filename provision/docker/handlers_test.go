@@ -23,10 +23,12 @@ import (
 	"github.com/tsuru/tsuru/auth/native"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/iaas"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/volume"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -99,6 +101,10 @@ func (s *HandlersSuite) SetUpTest(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer healingColl.Close()
 	healingColl.RemoveAll(nil)
+	autoScaleColl, err := autoScaleCollection()
+	c.Assert(err, check.IsNil)
+	defer autoScaleColl.Close()
+	autoScaleColl.RemoveAll(nil)
 }
 
 func (s *HandlersSuite) TearDownSuite(c *check.C) {
@@ -345,6 +351,126 @@ func (s *HandlersSuite) TestListNodeHandler(c *check.C) {
 	c.Assert(result.Nodes[1].Metadata, check.DeepEquals, map[string]string{"pool": "pool2", "foo": "bar"})
 }
 
+func (s *HandlersSuite) TestNodeUsageHandler(c *check.C) {
+	var err error
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host1.com:2375", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host2.com:2375", map[string]string{"pool": "pool2"})
+	c.Assert(err, check.IsNil)
+	coll := mainDockerProvisioner.collection()
+	defer coll.Close()
+	err = coll.Insert(container{ID: "1", AppName: "myapp", HostAddr: "host1.com", Status: "started"})
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/node/usage?pool=pool1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var report usageReport
+	err = json.Unmarshal(recorder.Body.Bytes(), &report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Nodes, check.HasLen, 1)
+	c.Assert(report.Nodes[0].Address, check.Equals, "http://host1.com:2375")
+	c.Assert(report.Nodes[0].Usage.Containers, check.DeepEquals, map[string]int{"started": 1})
+	c.Assert(report.Nodes[0].TopApps, check.DeepEquals, []appUsage{{App: "myapp", Units: 1}})
+	c.Assert(report.Pools, check.DeepEquals, []poolUsage{{
+		Pool:  "pool1",
+		Nodes: 1,
+		Usage: resourceUsage{Containers: map[string]int{"started": 1}},
+	}})
+}
+
+func (s *HandlersSuite) TestCordonNodeHandler(c *check.C) {
+	var err error
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host1.com:2375", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	b := bytes.NewBufferString(`{"address": "http://host1.com:2375"}`)
+	req, err := http.NewRequest("POST", "/docker/node/cordon", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = cordonNodeHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	cordoned, err := cordonedNodeAddresses()
+	c.Assert(err, check.IsNil)
+	c.Assert(cordoned, check.DeepEquals, map[string]bool{"http://host1.com:2375": true})
+	b = bytes.NewBufferString(`{"address": "http://host1.com:2375"}`)
+	req, err = http.NewRequest("POST", "/docker/node/uncordon", b)
+	c.Assert(err, check.IsNil)
+	rec = httptest.NewRecorder()
+	err = uncordonNodeHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	cordoned, err = cordonedNodeAddresses()
+	c.Assert(err, check.IsNil)
+	c.Assert(cordoned, check.HasLen, 0)
+}
+
+func (s *HandlersSuite) TestCordonNodeHandlerNodeNotFound(c *check.C) {
+	var err error
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	b := bytes.NewBufferString(`{"address": "http://host1.com:2375"}`)
+	req, err := http.NewRequest("POST", "/docker/node/cordon", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = cordonNodeHandler(rec, req, nil)
+	c.Assert(err, check.ErrorMatches, `node "http://host1.com:2375" not found`)
+}
+
+func (s *HandlersSuite) TestUncordonNodeHandlerNotCordoned(c *check.C) {
+	b := bytes.NewBufferString(`{"address": "http://host1.com:2375"}`)
+	req, err := http.NewRequest("POST", "/docker/node/uncordon", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = uncordonNodeHandler(rec, req, nil)
+	c.Assert(err, check.ErrorMatches, "node is not cordoned")
+}
+
+func (s *HandlersSuite) TestDrainNodeHandlerWithoutAddress(c *check.C) {
+	b := bytes.NewBufferString(`{}`)
+	req, err := http.NewRequest("POST", "/docker/node/drain", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = drainNodeHandler(rec, req, nil)
+	c.Assert(err, check.ErrorMatches, "Node address is required.")
+}
+
+func (s *HandlersSuite) TestDrainNodeHandler(c *check.C) {
+	var err error
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host1.com:2375", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	b := bytes.NewBufferString(`{"address": "http://host1.com:2375"}`)
+	req, err := http.NewRequest("POST", "/docker/node/drain", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = drainNodeHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(rec.Body)
+	c.Assert(err, check.IsNil)
+	validJson := fmt.Sprintf("[%s]", strings.Replace(strings.Trim(string(body), "\n "), "\n", ",", -1))
+	var result []progressLog
+	err = json.Unmarshal([]byte(validJson), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []progressLog{
+		{Message: "Node http://host1.com:2375 cordoned."},
+		{Message: "No units to move in host1.com."},
+		{Message: "Node drained successfully!"},
+	})
+}
+
 func (s *HandlersSuite) TestFixContainerHandler(c *check.C) {
 	cleanup, server, p := startDocker("9999")
 	defer cleanup()
@@ -513,7 +639,7 @@ func (s *S) TestRebalanceContainersEmptyBodyHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	units, err := addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  5,
+		toAdd:       map[string]int{"": 5},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -574,7 +700,7 @@ func (s *S) TestRebalanceContainersDryBodyHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	units, err := addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  5,
+		toAdd:       map[string]int{"": 5},
 		app:         appInstance,
 		imageId:     imageId,
 		provisioner: p,
@@ -787,3 +913,487 @@ func (s *HandlersSuite) TestHealingHistoryHandlerFilterNode(c *check.C) {
 	c.Assert(healings[1].Action, check.Equals, "node-healing")
 	c.Assert(healings[1].ID, check.Equals, evt1.ID)
 }
+
+func (s *HandlersSuite) TestSetPoolStrategyHandler(c *check.C) {
+	pool := Pool{Name: "pool1"}
+	err := s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	b := bytes.NewBufferString(`{"pool": "pool1", "strategy": "binpack"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/strategy", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolStrategyHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	var p Pool
+	err = s.conn.Collection(schedulerCollection).FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Strategy, check.Equals, "binpack")
+}
+
+func (s *HandlersSuite) TestSetPoolStrategyHandlerPoolNotFound(c *check.C) {
+	b := bytes.NewBufferString(`{"pool": "unknown", "strategy": "binpack"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/strategy", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolStrategyHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestSetPoolStrategyHandlerUnknownStrategy(c *check.C) {
+	pool := Pool{Name: "pool1"}
+	err := s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	b := bytes.NewBufferString(`{"pool": "pool1", "strategy": "random"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/strategy", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolStrategyHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, `unknown scheduling strategy: "random"`)
+}
+
+func (s *HandlersSuite) TestSetTeamDefaultPoolHandler(c *check.C) {
+	pool := Pool{Name: "pool1", Teams: []string{"ateam"}}
+	err := s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	b := bytes.NewBufferString(`{"pool": "pool1", "team": "ateam"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/default", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setTeamDefaultPoolHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	var p Pool
+	err = s.conn.Collection(schedulerCollection).FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.DefaultTeams, check.DeepEquals, []string{"ateam"})
+}
+
+func (s *HandlersSuite) TestSetTeamDefaultPoolHandlerPoolNotFound(c *check.C) {
+	b := bytes.NewBufferString(`{"pool": "unknown", "team": "ateam"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/default", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setTeamDefaultPoolHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestSetPoolClusterHandler(c *check.C) {
+	config.Set("docker:clusters:cluster1:registry", "registry.cluster1:5000")
+	defer config.Unset("docker:clusters")
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, _ = cluster.New(segregatedScheduler{}, &cluster.MapStorage{})
+	pool := Pool{Name: "pool1"}
+	err := s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	b := bytes.NewBufferString(`{"pool": "pool1", "cluster": "cluster1"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/cluster", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolClusterHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	var p Pool
+	err = s.conn.Collection(schedulerCollection).FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Cluster, check.Equals, "cluster1")
+}
+
+func (s *HandlersSuite) TestSetPoolClusterHandlerUnknownCluster(c *check.C) {
+	pool := Pool{Name: "pool1"}
+	err := s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	b := bytes.NewBufferString(`{"pool": "pool1", "cluster": "cluster1"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/cluster", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolClusterHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, `docker cluster "cluster1" not found`)
+}
+
+func (s *HandlersSuite) TestSetPoolAutoScaleHandler(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", TestIaaS{})
+	tpl := iaas.Template{Name: "tpl1", IaaSName: "test-iaas"}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate(tpl.Name)
+	pool := Pool{Name: "pool1"}
+	err = s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	b := bytes.NewBufferString(`{"pool": "pool1", "enabled": "true", "template": "tpl1", "min": "1", "max": "5", "scale-up": "0.8", "scale-down": "0.4"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/autoscale", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolAutoScaleHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	var p Pool
+	err = s.conn.Collection(schedulerCollection).FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.AutoScale, check.DeepEquals, &PoolAutoScale{
+		Enabled:        true,
+		Template:       "tpl1",
+		MinNodes:       1,
+		MaxNodes:       5,
+		ScaleUpRatio:   0.8,
+		ScaleDownRatio: 0.4,
+	})
+	b = bytes.NewBufferString(`{"pool": "pool1", "enabled": "false"}`)
+	req, err = http.NewRequest("POST", "/docker/pool/autoscale", b)
+	c.Assert(err, check.IsNil)
+	rec = httptest.NewRecorder()
+	err = setPoolAutoScaleHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	err = s.conn.Collection(schedulerCollection).FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.AutoScale.Enabled, check.Equals, false)
+	c.Assert(p.AutoScale.Template, check.Equals, "tpl1")
+}
+
+func (s *HandlersSuite) TestSetPoolAutoScaleHandlerInvalidParams(c *check.C) {
+	pool := Pool{Name: "pool1"}
+	err := s.conn.Collection(schedulerCollection).Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId(pool.Name)
+	var tests = []struct {
+		body    string
+		message string
+	}{
+		{`{"pool": "pool1", "enabled": "true", "template": "tpl1", "min": "x", "scale-up": "0.8", "scale-down": "0.4"}`, "invalid minimum number of nodes: x"},
+		{`{"pool": "pool1", "enabled": "true", "template": "tpl1", "scale-up": "", "scale-down": "0.4"}`, "invalid scale up ratio: "},
+		{`{"pool": "pool1", "enabled": "true", "template": "tpl1", "scale-up": "0.4", "scale-down": "0.8"}`, "scale down ratio must be lower than the scale up ratio"},
+	}
+	for _, t := range tests {
+		req, err := http.NewRequest("POST", "/docker/pool/autoscale", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+		rec := httptest.NewRecorder()
+		err = setPoolAutoScaleHandler(rec, req, nil)
+		c.Assert(err, check.NotNil)
+		e, ok := err.(*tsuruErrors.HTTP)
+		c.Assert(ok, check.Equals, true)
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(e.Message, check.Equals, t.message)
+	}
+}
+
+func (s *HandlersSuite) TestSetPoolAutoScaleHandlerPoolNotFound(c *check.C) {
+	b := bytes.NewBufferString(`{"pool": "unknown", "enabled": "false"}`)
+	req, err := http.NewRequest("POST", "/docker/pool/autoscale", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setPoolAutoScaleHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestAutoScaleHistoryHandler(c *check.C) {
+	pool1 := Pool{Name: "pool1", AutoScale: &PoolAutoScale{MaxNodes: 3}}
+	pool2 := Pool{Name: "pool2", AutoScale: &PoolAutoScale{}}
+	evt1, err := newAutoScaleEvent(&pool1, "add", "memory usage 0.90 is greater than the scale up ratio of 0.80", 2)
+	c.Assert(err, check.IsNil)
+	evt1.update(cluster.Node{Address: "http://n1:2375"}, nil)
+	evt2, err := newAutoScaleEvent(&pool2, "remove", "memory usage 0.10 is lower than the scale down ratio of 0.40", 3)
+	c.Assert(err, check.IsNil)
+	evt2.update(cluster.Node{Address: "http://n2:2375"}, errors.New("some error"))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/autoscale?pool=pool1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var history []autoScaleEvent
+	err = json.Unmarshal(recorder.Body.Bytes(), &history)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 1)
+	c.Assert(history[0].Pool, check.Equals, "pool1")
+	c.Assert(history[0].Action, check.Equals, "add")
+	c.Assert(history[0].Node.Address, check.Equals, "http://n1:2375")
+	c.Assert(history[0].NodeCount, check.Equals, 2)
+	c.Assert(history[0].MaxNodes, check.Equals, 3)
+	c.Assert(history[0].Successful, check.Equals, true)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("GET", "/docker/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	history = nil
+	err = json.Unmarshal(recorder.Body.Bytes(), &history)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 2)
+	c.Assert(history[0].Pool, check.Equals, "pool2")
+	c.Assert(history[0].Successful, check.Equals, false)
+	c.Assert(history[0].Error, check.Equals, "some error")
+}
+
+func (s *HandlersSuite) TestListNodeHandlerWithZones(c *check.C) {
+	config.Set("docker:scheduler:zone-metadata", "zone")
+	defer config.Unset("docker:scheduler:zone-metadata")
+	var result struct {
+		Zones map[string]map[string]int `json:"zones"`
+	}
+	var err error
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host1.com:2375", map[string]string{"zone": "a"})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host2.com:2375", map[string]string{"zone": "b"})
+	c.Assert(err, check.IsNil)
+	coll := mainDockerProvisioner.collection()
+	defer coll.Close()
+	err = coll.Insert(
+		container{ID: "c1", AppName: "appbla", HostAddr: "host1.com"},
+		container{ID: "c2", AppName: "appbla", HostAddr: "host2.com"},
+		container{ID: "c3", AppName: "appbla", HostAddr: "host2.com"},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"appname": "appbla"})
+	req, err := http.NewRequest("GET", "/node/", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = listNodeHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	err = json.NewDecoder(rec.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Zones, check.DeepEquals, map[string]map[string]int{"appbla": {"a": 1, "b": 2}})
+}
+
+func (s *HandlersSuite) TestListContainersByAppHandlerWithZones(c *check.C) {
+	config.Set("docker:scheduler:zone-metadata", "zone")
+	defer config.Unset("docker:scheduler:zone-metadata")
+	var result []containerWithZone
+	var err error
+	mainDockerProvisioner = &dockerProvisioner{}
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = mainDockerProvisioner.getCluster().Register("http://host1.com:2375", map[string]string{"zone": "a"})
+	c.Assert(err, check.IsNil)
+	coll := mainDockerProvisioner.collection()
+	defer coll.Close()
+	err = coll.Insert(container{ID: "c1", AppName: "appbla", HostAddr: "host1.com"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"appname": "appbla"})
+	req, err := http.NewRequest("GET", "/node/appbla/containers?:appname=appbla", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = listContainersHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	err = json.NewDecoder(rec.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].ID, check.Equals, "c1")
+	c.Assert(result[0].Zone, check.Equals, "a")
+}
+
+func (s *HandlersSuite) TestListRemovedImagesHandler(c *check.C) {
+	err := recordRemovedImages([]gcRemovedImage{{Image: "tsuru/app-myapp:v1", AppName: "myapp", Registry: true}})
+	c.Assert(err, check.IsNil)
+	coll, err := imageGCColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	defer coll.RemoveAll(nil)
+	req, err := http.NewRequest("GET", "/docker/images/gc", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = listRemovedImagesHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var images []gcRemovedImage
+	err = json.NewDecoder(rec.Body).Decode(&images)
+	c.Assert(err, check.IsNil)
+	c.Assert(images, check.HasLen, 1)
+	c.Assert(images[0].Image, check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(images[0].AppName, check.Equals, "myapp")
+	c.Assert(images[0].Registry, check.Equals, true)
+}
+
+func (s *HandlersSuite) TestListRemovedImagesHandlerNoContent(c *check.C) {
+	req, err := http.NewRequest("GET", "/docker/images/gc", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = listRemovedImagesHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *HandlersSuite) TestSetRegistryCredentialsHandler(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	coll, err := registryCredentialsColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	defer coll.RemoveAll(nil)
+	b := bytes.NewBufferString(`{"team": "myteam", "registry": "registry.example.com", "username": "user", "password": "123456"}`)
+	req, err := http.NewRequest("POST", "/docker/registry/credentials", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setRegistryCredentialsHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	creds, err := listRegistryCredentials()
+	c.Assert(err, check.IsNil)
+	c.Assert(creds, check.HasLen, 1)
+	c.Assert(creds[0].Team, check.Equals, "myteam")
+	c.Assert(creds[0].Username, check.Equals, "user")
+	password, err := decryptRegistryPassword(creds[0].Password)
+	c.Assert(err, check.IsNil)
+	c.Assert(password, check.Equals, "123456")
+}
+
+func (s *HandlersSuite) TestSetRegistryCredentialsHandlerWithoutOwner(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	b := bytes.NewBufferString(`{"registry": "registry.example.com", "username": "user", "password": "123456"}`)
+	req, err := http.NewRequest("POST", "/docker/registry/credentials", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = setRegistryCredentialsHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, errRegistryCredentialsOwner.Error())
+}
+
+func (s *HandlersSuite) TestRemoveRegistryCredentialsHandlerNotFound(c *check.C) {
+	b := bytes.NewBufferString(`{"app": "myapp", "registry": "registry.example.com"}`)
+	req, err := http.NewRequest("DELETE", "/docker/registry/credentials", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = removeRegistryCredentialsHandler(rec, req, nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestListRegistryCredentialsHandler(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	coll, err := registryCredentialsColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	defer coll.RemoveAll(nil)
+	err = setRegistryCredentials(registryCredentials{App: "myapp", Registry: "registry.example.com", Username: "user", Password: "123456"})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("GET", "/docker/registry/credentials", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = listRegistryCredentialsHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(rec.Body.String(), check.Not(check.Matches), `(?s).*[pP]assword.*`)
+	var creds []registryCredentials
+	err = json.NewDecoder(rec.Body).Decode(&creds)
+	c.Assert(err, check.IsNil)
+	c.Assert(creds, check.DeepEquals, []registryCredentials{{App: "myapp", Registry: "registry.example.com", Username: "user"}})
+}
+
+func (s *HandlersSuite) TestAddVolumeHandler(c *check.C) {
+	err := s.conn.Collection(schedulerCollection).Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId("pool1")
+	defer s.conn.Volumes().RemoveAll(nil)
+	b := bytes.NewBufferString(`{"name": "data", "type": "host", "source": "/mnt/data", "pool": "pool1", "node": "10.0.0.1"}`)
+	req, err := http.NewRequest("POST", "/docker/volume", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = addVolumeHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusCreated)
+	v, err := volume.Get("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(*v, check.DeepEquals, volume.Volume{Name: "data", Type: "host", Source: "/mnt/data", Pool: "pool1", Node: "10.0.0.1"})
+}
+
+func (s *HandlersSuite) TestAddVolumeHandlerPoolNotFound(c *check.C) {
+	b := bytes.NewBufferString(`{"name": "data", "type": "host", "source": "/mnt/data", "pool": "pool1"}`)
+	req, err := http.NewRequest("POST", "/docker/volume", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = addVolumeHandler(rec, req, nil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestAddVolumeHandlerInvalid(c *check.C) {
+	err := s.conn.Collection(schedulerCollection).Insert(Pool{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer s.conn.Collection(schedulerCollection).RemoveId("pool1")
+	b := bytes.NewBufferString(`{"name": "data", "type": "host", "source": "mnt/data", "pool": "pool1"}`)
+	req, err := http.NewRequest("POST", "/docker/volume", b)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = addVolumeHandler(rec, req, nil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, "source of host volumes must be an absolute path")
+}
+
+func (s *HandlersSuite) TestRemoveVolumeHandler(c *check.C) {
+	defer s.conn.Volumes().RemoveAll(nil)
+	err := volume.Create(&volume.Volume{Name: "data", Type: "host", Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = volume.BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("DELETE", "/docker/volume", bytes.NewBufferString(`{"name": "data"}`))
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = removeVolumeHandler(rec, req, nil)
+	e, ok := err.(*tsuruErrors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusConflict)
+	err = volume.UnbindApp("data", "myapp", "/data")
+	c.Assert(err, check.IsNil)
+	req, err = http.NewRequest("DELETE", "/docker/volume", bytes.NewBufferString(`{"name": "data"}`))
+	c.Assert(err, check.IsNil)
+	rec = httptest.NewRecorder()
+	err = removeVolumeHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Code, check.Equals, http.StatusNoContent)
+	_, err = volume.Get("data")
+	c.Assert(err, check.Equals, volume.ErrVolumeNotFound)
+}
+
+func (s *HandlersSuite) TestListVolumesHandler(c *check.C) {
+	defer s.conn.Volumes().RemoveAll(nil)
+	err := volume.Create(&volume.Volume{Name: "data", Type: "host", Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("GET", "/docker/volume", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = listVolumesHandler(rec, req, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var volumes []volume.Volume
+	err = json.NewDecoder(rec.Body).Decode(&volumes)
+	c.Assert(err, check.IsNil)
+	c.Assert(volumes, check.DeepEquals, []volume.Volume{{Name: "data", Type: "host", Source: "/mnt/data", Pool: "pool1"}})
+}
@@ -48,24 +48,43 @@ func healthCheckDockerRegistry() error {
 	return nil
 }
 
+// healthCheckDocker pings the node of every docker cluster with a single
+// node. Clusters with more than one node are not checked, and the component is
+// disabled when no cluster is checked.
 func healthCheckDocker() error {
-	nodes, err := mainDockerProvisioner.getCluster().Nodes()
-	if err != nil {
-		return err
+	var total int
+	checked := false
+	for _, name := range mainDockerProvisioner.clusterNames() {
+		c, err := mainDockerProvisioner.getClusterByName(name)
+		if err != nil {
+			return err
+		}
+		nodes, err := c.Nodes()
+		if err != nil {
+			return err
+		}
+		total += len(nodes)
+		if len(nodes) != 1 {
+			continue
+		}
+		client, err := nodes[0].Client()
+		if err != nil {
+			return err
+		}
+		err = client.Ping()
+		if err != nil {
+			if name != "" {
+				return fmt.Errorf("ping failed in cluster %q - %s", name, err.Error())
+			}
+			return fmt.Errorf("ping failed - %s", err.Error())
+		}
+		checked = true
 	}
-	if len(nodes) < 1 {
+	if total < 1 {
 		return errors.New("error - no nodes available for running containers")
 	}
-	if len(nodes) > 1 {
+	if !checked {
 		return hc.ErrDisabledComponent
 	}
-	client, err := nodes[0].Client()
-	if err != nil {
-		return err
-	}
-	err = client.Ping()
-	if err != nil {
-		return fmt.Errorf("ping failed - %s", err.Error())
-	}
 	return nil
 }
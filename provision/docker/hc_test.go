@@ -139,3 +139,56 @@ func (s *S) TestHealthCheckDockerFailure(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "ping failed - API error (500): something went wrong")
 }
+
+func (s *S) TestHealthCheckDockerNamedClusters(c *check.C) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{}, cluster.Node{Address: server.URL})
+	c.Assert(err, check.IsNil)
+	named, err := cluster.New(nil, &cluster.MapStorage{}, cluster.Node{Address: server.URL})
+	c.Assert(err, check.IsNil)
+	mainDockerProvisioner.clusters = map[string]*cluster.Cluster{"cluster1": named}
+	err = healthCheckDocker()
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.DeepEquals, []string{"/_ping", "/_ping"})
+}
+
+func (s *S) TestHealthCheckDockerNamedClusterFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("something went wrong"))
+	}))
+	defer server.Close()
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	named, err := cluster.New(nil, &cluster.MapStorage{}, cluster.Node{Address: server.URL})
+	c.Assert(err, check.IsNil)
+	mainDockerProvisioner.clusters = map[string]*cluster.Cluster{"cluster1": named}
+	err = healthCheckDocker()
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `ping failed in cluster "cluster1" - API error (500): something went wrong`)
+}
+
+func (s *S) TestHealthCheckDockerNodesOnlyInNamedCluster(c *check.C) {
+	var request *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	named, err := cluster.New(nil, &cluster.MapStorage{}, cluster.Node{Address: server.URL})
+	c.Assert(err, check.IsNil)
+	mainDockerProvisioner.clusters = map[string]*cluster.Cluster{"cluster1": named}
+	err = healthCheckDocker()
+	c.Assert(err, check.IsNil)
+	c.Assert(request.URL.Path, check.Equals, "/_ping")
+}
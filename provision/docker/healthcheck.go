@@ -5,6 +5,7 @@
 package docker
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/provision"
 )
 
 func clientWithTimeout(timeout time.Duration) *http.Client {
@@ -31,81 +33,172 @@ func clientWithTimeout(timeout time.Duration) *http.Client {
 
 var timeoutHttpClient = clientWithTimeout(5 * time.Second)
 
-func runHealthcheck(cont *container, w io.Writer) error {
+const (
+	healthcheckHTTP    = "http"
+	healthcheckTCP     = "tcp"
+	healthcheckCommand = "command"
+)
+
+// healthcheckProbe checks a unit once. The returned bool indicates whether
+// the unit responded, in which case the error counts as one of the allowed
+// failures of the healthcheck instead of being retried until the max time.
+type healthcheckProbe func() (bool, error)
+
+func (p *dockerProvisioner) runHealthcheck(cont *container, w io.Writer) error {
+	if !cont.routable() {
+		return nil
+	}
 	yamlData, err := getImageTsuruYamlDataWithFallback(cont.Image, cont.AppName)
 	if err != nil {
 		return err
 	}
-	path := yamlData.Healthcheck.Path
-	method := yamlData.Healthcheck.Method
-	match := yamlData.Healthcheck.Match
-	status := yamlData.Healthcheck.Status
-	allowedFailures := yamlData.Healthcheck.AllowedFailures
-	if path == "" {
-		return nil
+	hc := yamlData.Healthcheck
+	var probe healthcheckProbe
+	switch strings.ToLower(hc.Type) {
+	case "", healthcheckHTTP:
+		if hc.Path == "" {
+			return nil
+		}
+		probe, err = httpHealthcheckProbe(cont, hc)
+	case healthcheckTCP:
+		probe = tcpHealthcheckProbe(cont, hc)
+	case healthcheckCommand:
+		if hc.Command == "" {
+			return nil
+		}
+		probe = p.commandHealthcheckProbe(cont, hc)
+	default:
+		return fmt.Errorf("invalid healthcheck type %q", hc.Type)
+	}
+	if err != nil {
+		return err
+	}
+	allowedFailures := hc.AllowedFailures
+	maxWaitTime := time.Duration(hc.MaxTime)
+	if maxWaitTime == 0 {
+		maxWaitTime, _ = config.GetDuration("docker:healthcheck:max-time")
+	}
+	if maxWaitTime == 0 {
+		maxWaitTime = 120
+	}
+	maxWaitTime = maxWaitTime * time.Second
+	sleepTime := time.Duration(hc.Interval) * time.Second
+	if sleepTime == 0 {
+		sleepTime = 3 * time.Second
 	}
-	path = strings.TrimSpace(strings.TrimLeft(path, "/"))
+	startedTime := time.Now()
+	for {
+		responded, lastError := probe()
+		if lastError != nil && responded {
+			if allowedFailures == 0 {
+				return lastError
+			}
+			allowedFailures--
+		}
+		if lastError == nil {
+			fmt.Fprintf(w, " ---> healthcheck successful(%s)\n", cont.shortID())
+			return nil
+		}
+		if time.Now().Sub(startedTime) > maxWaitTime {
+			return lastError
+		}
+		fmt.Fprintf(w, " ---> %s. Trying again in %ds\n", lastError.Error(), sleepTime/time.Second)
+		time.Sleep(sleepTime)
+	}
+}
+
+func healthcheckTimeout(hc provision.TsuruYamlHealthcheck) time.Duration {
+	if hc.Timeout > 0 {
+		return time.Duration(hc.Timeout) * time.Second
+	}
+	return 5 * time.Second
+}
+
+func httpHealthcheckProbe(cont *container, hc provision.TsuruYamlHealthcheck) (healthcheckProbe, error) {
+	path := strings.TrimSpace(strings.TrimLeft(hc.Path, "/"))
+	method := hc.Method
 	if method == "" {
 		method = "get"
 	}
 	method = strings.ToUpper(method)
+	match := hc.Match
+	status := hc.Status
 	if status == 0 && match == "" {
 		status = 200
 	}
 	var matchRE *regexp.Regexp
 	if match != "" {
 		match = "(?s)" + match
+		var err error
 		matchRE, err = regexp.Compile(match)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	maxWaitTime, _ := config.GetDuration("docker:healthcheck:max-time")
-	if maxWaitTime == 0 {
-		maxWaitTime = 120
+	client := timeoutHttpClient
+	if hc.Timeout > 0 {
+		client = &http.Client{Timeout: healthcheckTimeout(hc)}
 	}
-	maxWaitTime = maxWaitTime * time.Second
-	sleepTime := 3 * time.Second
-	startedTime := time.Now()
 	url := fmt.Sprintf("http://%s:%s/%s", cont.HostAddr, cont.HostPort, path)
-	for {
-		var lastError error = nil
+	return func() (bool, error) {
 		req, err := http.NewRequest(method, url, nil)
 		if err != nil {
-			return err
+			return false, err
 		}
-		rsp, err := timeoutHttpClient.Do(req)
+		for name, value := range hc.Headers {
+			if strings.EqualFold(name, "Host") {
+				req.Host = value
+			} else {
+				req.Header.Set(name, value)
+			}
+		}
+		rsp, err := client.Do(req)
 		if err != nil {
-			lastError = fmt.Errorf("healthcheck fail(%s): %s", cont.shortID(), err.Error())
-		} else {
-			defer rsp.Body.Close()
-			if status != 0 && rsp.StatusCode != status {
-				lastError = fmt.Errorf("healthcheck fail(%s): wrong status code, expected %d, got: %d", cont.shortID(), status, rsp.StatusCode)
-			} else if matchRE != nil {
-				result, err := ioutil.ReadAll(rsp.Body)
-
-				if err != nil {
-					lastError = err
-				}
-				if !matchRE.Match(result) {
-					lastError = fmt.Errorf("healthcheck fail(%s): unexpected result, expected %q, got: %s", cont.shortID(), match, string(result))
-				}
+			return false, fmt.Errorf("healthcheck fail(%s): %s", cont.shortID(), err.Error())
+		}
+		defer rsp.Body.Close()
+		if status != 0 && rsp.StatusCode != status {
+			return true, fmt.Errorf("healthcheck fail(%s): wrong status code, expected %d, got: %d", cont.shortID(), status, rsp.StatusCode)
+		}
+		if matchRE != nil {
+			result, err := ioutil.ReadAll(rsp.Body)
+			if err != nil {
+				return true, err
 			}
-			if lastError != nil {
-				if allowedFailures == 0 {
-					return lastError
-				}
-				allowedFailures--
+			if !matchRE.Match(result) {
+				return true, fmt.Errorf("healthcheck fail(%s): unexpected result, expected %q, got: %s", cont.shortID(), match, string(result))
 			}
 		}
-		if lastError == nil {
-			fmt.Fprintf(w, " ---> healthcheck successful(%s)\n", cont.shortID())
-			return nil
+		return true, nil
+	}, nil
+}
+
+// tcpHealthcheckProbe checks whether the unit accepts connections in its
+// port, for apps that don't speak HTTP.
+func tcpHealthcheckProbe(cont *container, hc provision.TsuruYamlHealthcheck) healthcheckProbe {
+	addr := net.JoinHostPort(cont.HostAddr, cont.HostPort)
+	return func() (bool, error) {
+		conn, err := net.DialTimeout("tcp", addr, healthcheckTimeout(hc))
+		if err != nil {
+			return false, fmt.Errorf("healthcheck fail(%s): %s", cont.shortID(), err.Error())
 		}
-		if time.Now().Sub(startedTime) > maxWaitTime {
-			return lastError
+		conn.Close()
+		return true, nil
+	}
+}
+
+// commandHealthcheckProbe runs the healthcheck command inside the unit,
+// which is healthy when the command exits with status 0. The unit responded
+// when the command ran, whatever its exit status, and didn't respond only
+// when the command couldn't be run.
+func (p *dockerProvisioner) commandHealthcheckProbe(cont *container, hc provision.TsuruYamlHealthcheck) healthcheckProbe {
+	return func() (bool, error) {
+		var output bytes.Buffer
+		err := cont.exec(p, &output, &output, hc.Command)
+		if err != nil {
+			_, exited := err.(*execErr)
+			return exited, fmt.Errorf("healthcheck fail(%s): command %q failed: %s - %s", cont.shortID(), hc.Command, err.Error(), strings.TrimSpace(output.String()))
 		}
-		fmt.Fprintf(w, " ---> %s. Trying again in %ds\n", lastError.Error(), sleepTime/time.Second)
-		time.Sleep(sleepTime)
+		return true, nil
 	}
 }
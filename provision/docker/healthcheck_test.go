@@ -15,6 +15,7 @@ import (
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -40,7 +41,7 @@ func (s *S) TestHealthcheck(c *check.C) {
 	host, port, _ := net.SplitHostPort(url.Host)
 	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
 	buf := bytes.Buffer{}
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 1)
 	c.Assert(requests[0].URL.Path, check.Equals, "/x/y")
@@ -74,11 +75,11 @@ func (s *S) TestHealthcheckWithMatch(c *check.C) {
 	host, port, _ := net.SplitHostPort(url.Host)
 	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
 	buf := bytes.Buffer{}
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.ErrorMatches, ".*unexpected result, expected \"(?s).*some.*\", got: invalid")
 	c.Assert(requests, check.HasLen, 1)
 	c.Assert(requests[0].Method, check.Equals, "GET")
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 2)
 	c.Assert(requests[1].URL.Path, check.Equals, "/x/y")
@@ -104,7 +105,7 @@ func (s *S) TestHealthcheckDefaultCheck(c *check.C) {
 	host, port, _ := net.SplitHostPort(url.Host)
 	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
 	buf := bytes.Buffer{}
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 1)
 	c.Assert(requests[0].Method, check.Equals, "GET")
@@ -126,7 +127,7 @@ func (s *S) TestHealthcheckNoHealthcheck(c *check.C) {
 	host, port, _ := net.SplitHostPort(url.Host)
 	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
 	buf := bytes.Buffer{}
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 0)
 }
@@ -151,7 +152,7 @@ func (s *S) TestHealthcheckNoPath(c *check.C) {
 	host, port, _ := net.SplitHostPort(url.Host)
 	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
 	buf := bytes.Buffer{}
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(requests, check.HasLen, 0)
 }
@@ -190,7 +191,7 @@ func (s *S) TestHealthcheckKeepsTryingWithServerDown(c *check.C) {
 		defer lock.Unlock()
 		shouldRun = true
 	}()
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Matches, `(?s).*---> healthcheck fail.*?Trying again in 3s.*---> healthcheck successful.*`)
 	c.Assert(requests, check.HasLen, 2)
@@ -217,7 +218,7 @@ func (s *S) TestHealthcheckErrorsAfterMaxTime(c *check.C) {
 	defer config.Unset("docker:healthcheck:max-time")
 	done := make(chan struct{})
 	go func() {
-		err = runHealthcheck(&cont, &buf)
+		err = s.p.runHealthcheck(&cont, &buf)
 		close(done)
 	}()
 	select {
@@ -269,7 +270,7 @@ func (s *S) TestSuccessfulHealthcheckWithAllowedFailures(c *check.C) {
 		defer lock.Unlock()
 		step = 2
 	}()
-	err = runHealthcheck(&cont, &buf)
+	err = s.p.runHealthcheck(&cont, &buf)
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Matches, `(?s).*---> healthcheck fail.*?Trying again in 3s.*---> healthcheck fail.*?Trying again in 3s.*---> healthcheck successful.*`)
 	c.Assert(requests, check.HasLen, 3)
@@ -280,3 +281,180 @@ func (s *S) TestSuccessfulHealthcheckWithAllowedFailures(c *check.C) {
 	c.Assert(requests[2].Method, check.Equals, "GET")
 	c.Assert(requests[2].URL.Path, check.Equals, "/x/y")
 }
+
+func (s *S) TestHealthcheckWithHeaders(c *check.C) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	a := app.App{Name: "myapp1", CustomData: map[string]interface{}{
+		"healthcheck": map[string]interface{}{
+			"path": "/x/y",
+			"headers": map[string]interface{}{
+				"Host":          "myapp.example.com",
+				"Authorization": "Basic dXNlcjpwYXNz",
+			},
+		},
+	}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	url, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(url.Host)
+	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
+	buf := bytes.Buffer{}
+	err = s.p.runHealthcheck(&cont, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].Host, check.Equals, "myapp.example.com")
+	c.Assert(requests[0].Header.Get("Authorization"), check.Equals, "Basic dXNlcjpwYXNz")
+}
+
+func (s *S) TestHealthcheckTCP(c *check.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	a := app.App{Name: "myapp1", CustomData: map[string]interface{}{
+		"healthcheck": map[string]interface{}{
+			"type": "tcp",
+		},
+	}}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
+	buf := bytes.Buffer{}
+	err = s.p.runHealthcheck(&cont, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, " ---> healthcheck successful()\n")
+}
+
+func (s *S) TestHealthcheckTCPErrorsAfterAppMaxTime(c *check.C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	addr := listener.Addr().String()
+	listener.Close()
+	a := app.App{Name: "myapp1", CustomData: map[string]interface{}{
+		"healthcheck": map[string]interface{}{
+			"type":     "tcp",
+			"interval": 1,
+			"max_time": 1,
+		},
+	}}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	config.Set("docker:healthcheck:max-time", 60)
+	defer config.Unset("docker:healthcheck:max-time")
+	host, port, _ := net.SplitHostPort(addr)
+	cont := container{AppName: a.Name, HostAddr: host, HostPort: port}
+	buf := bytes.Buffer{}
+	done := make(chan struct{})
+	go func() {
+		err = s.p.runHealthcheck(&cont, &buf)
+		close(done)
+	}()
+	select {
+	case <-time.After(5 * time.Second):
+		c.Fatal("Timed out waiting for healthcheck to fail")
+	case <-done:
+	}
+	c.Assert(err, check.ErrorMatches, "healthcheck fail.*connection refused")
+	c.Assert(buf.String(), check.Matches, `(?s).*Trying again in 1s.*`)
+}
+
+func (s *S) TestHealthcheckCommand(c *check.C) {
+	a := app.App{Name: "myapp1", CustomData: map[string]interface{}{
+		"healthcheck": map[string]interface{}{
+			"type":    "command",
+			"command": "pg_isready",
+		},
+	}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	buf := bytes.Buffer{}
+	err = s.p.runHealthcheck(cont, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, " ---> healthcheck successful.*\n")
+}
+
+func (s *S) TestHealthcheckCommandFailure(c *check.C) {
+	s.server.CustomHandler("/exec/id-exec-created-by-test/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ID": "id-exec-created-by-test", "ExitCode": 1}`))
+	}))
+	a := app.App{Name: "myapp1", CustomData: map[string]interface{}{
+		"healthcheck": map[string]interface{}{
+			"type":     "command",
+			"command":  "pg_isready",
+			"interval": 1,
+			"max_time": 1,
+		},
+	}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	buf := bytes.Buffer{}
+	err = s.p.runHealthcheck(cont, &buf)
+	c.Assert(err, check.ErrorMatches, `healthcheck fail.*command "pg_isready" failed.*`)
+}
+
+func (s *S) TestCommandHealthcheckProbeNonZeroExit(c *check.C) {
+	s.server.CustomHandler("/exec/id-exec-created-by-test/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ID": "id-exec-created-by-test", "ExitCode": 1}`))
+	}))
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp1"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	probe := s.p.commandHealthcheckProbe(cont, provision.TsuruYamlHealthcheck{Command: "pg_isready"})
+	responded, err := probe()
+	c.Assert(err, check.ErrorMatches, `healthcheck fail.*command "pg_isready" failed: unexpected exit code: 1.*`)
+	c.Assert(responded, check.Equals, true)
+}
+
+func (s *S) TestCommandHealthcheckProbeExecFailure(c *check.C) {
+	s.server.PrepareFailure("exec-failure", "/containers/.*/exec")
+	defer s.server.ResetFailure("exec-failure")
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp1"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	probe := s.p.commandHealthcheckProbe(cont, provision.TsuruYamlHealthcheck{Command: "pg_isready"})
+	responded, err := probe()
+	c.Assert(err, check.ErrorMatches, `healthcheck fail.*command "pg_isready" failed.*`)
+	c.Assert(responded, check.Equals, false)
+}
+
+func (s *S) TestHealthcheckInvalidType(c *check.C) {
+	a := app.App{Name: "myapp1", CustomData: map[string]interface{}{
+		"healthcheck": map[string]interface{}{
+			"type": "udp",
+		},
+	}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont := container{AppName: a.Name, HostAddr: "127.0.0.1", HostPort: "3333"}
+	buf := bytes.Buffer{}
+	err = s.p.runHealthcheck(&cont, &buf)
+	c.Assert(err, check.ErrorMatches, `invalid healthcheck type "udp"`)
+}
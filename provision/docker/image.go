@@ -78,12 +78,16 @@ func (p *dockerProvisioner) migrateImages() error {
 // * the deploy number is multiple of 10.
 // in all other cases the app image name will be returne.
 func (p *dockerProvisioner) getBuildImage(app provision.App) string {
+	clusterName, err := appClusterName(app.GetName())
+	if err != nil {
+		log.Errorf("Couldn't get the cluster of app %q, using the default cluster: %s", app.GetName(), err)
+	}
 	if p.usePlatformImage(app) {
-		return platformImageName(app.GetPlatform())
+		return platformImageName(clusterName, app.GetPlatform())
 	}
 	appImageName, err := appCurrentImageName(app.GetName())
 	if err != nil {
-		return platformImageName(app.GetPlatform())
+		return platformImageName(clusterName, app.GetPlatform())
 	}
 	return appImageName
 }
@@ -134,6 +138,51 @@ func getImageTsuruYamlData(imageName string) (provision.TsuruYamlData, error) {
 	return customData.Customdata, err
 }
 
+// getImageProcesses returns the names of the processes declared in the
+// Procfile of the image, in the same order. The Procfile is sent by the unit
+// agent when the image is built, older platforms don't send it, in which case
+// the returned list is empty.
+func getImageProcesses(imageName string) ([]string, error) {
+	var customData struct {
+		Customdata struct {
+			Procfile string
+		}
+	}
+	coll, err := imageCustomDataColl()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	err = coll.FindId(imageName).One(&customData)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var processes []string
+	for _, line := range strings.Split(customData.Customdata.Procfile, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) != "" {
+			processes = append(processes, strings.TrimSpace(parts[0]))
+		}
+	}
+	return processes, nil
+}
+
+func processDeclared(processes []string, process string) bool {
+	for _, p := range processes {
+		if p == process {
+			return true
+		}
+	}
+	return false
+}
+
 // TODO(cezarsa): This method only exist to keep tsuru compatible with older
 // platforms. It should be deprecated in the next major after 0.10.0.
 func getImageTsuruYamlDataWithFallback(imageName, appName string) (provision.TsuruYamlData, error) {
@@ -161,11 +210,15 @@ func appNewImageName(appName string) (string, error) {
 		ReturnNew: true,
 		Upsert:    true,
 	}
+	clusterName, err := appClusterName(appName)
+	if err != nil {
+		return "", err
+	}
 	_, err = coll.FindId(appName).Apply(dbChange, &imgs)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s/app-%s:v%d", basicImageName(), appName, imgs.Count), nil
+	return fmt.Sprintf("%s/app-%s:v%d", basicImageName(clusterName), appName, imgs.Count), nil
 }
 
 func appCurrentImageName(appName string) (string, error) {
@@ -178,7 +231,7 @@ func appCurrentImageName(appName string) (string, error) {
 	err = coll.FindId(appName).One(&imgs)
 	if err != nil {
 		log.Errorf("Couldn't find images for app %q, fallback to old image names. Error: %s", appName, err.Error())
-		return fmt.Sprintf("%s/app-%s", basicImageName(), appName), nil
+		return fmt.Sprintf("%s/app-%s", basicImageName(""), appName), nil
 	}
 	if len(imgs.Images) == 0 {
 		return "", fmt.Errorf("no images available for app %q", appName)
@@ -296,13 +349,17 @@ func pullAppImageNames(appName string, images []string) error {
 	return coll.UpdateId(appName, bson.M{"$pullAll": bson.M{"images": images}})
 }
 
-func platformImageName(platformName string) string {
-	return fmt.Sprintf("%s/%s", basicImageName(), platformName)
+// platformImageName returns the name of the image of the platform in the
+// cluster.
+func platformImageName(clusterName, platformName string) string {
+	return fmt.Sprintf("%s/%s", basicImageName(clusterName), platformName)
 }
 
-func basicImageName() string {
+// basicImageName returns the prefix of the names of images built in the
+// cluster, which includes the registry of the cluster.
+func basicImageName(clusterName string) string {
 	parts := make([]string, 0, 2)
-	registry, _ := config.GetString("docker:registry")
+	registry := clusterRegistry(clusterName)
 	if registry != "" {
 		parts = append(parts, registry)
 	}
@@ -324,14 +381,19 @@ func (p *dockerProvisioner) usePlatformImage(app provision.App) bool {
 }
 
 func (p *dockerProvisioner) cleanImage(appName, imgName string) {
+	dcluster, _, err := p.clusterForApp(appName)
+	if err != nil {
+		log.Errorf("Ignored error getting the cluster of app %q to remove image %q: %s", appName, imgName, err.Error())
+		return
+	}
 	shouldRemove := true
-	err := p.getCluster().RemoveImage(imgName)
+	err = dcluster.RemoveImage(imgName)
 	if err != nil {
 		shouldRemove = false
 		log.Errorf("Ignored error removing old image %q: %s. Image kept on list to retry later.",
 			imgName, err.Error())
 	}
-	err = p.getCluster().RemoveFromRegistry(imgName)
+	err = dcluster.RemoveFromRegistry(imgName)
 	if err != nil {
 		shouldRemove = false
 		log.Errorf("Ignored error removing old image from registry %q: %s. Image kept on list to retry later.",
@@ -251,11 +251,11 @@ func (s *S) TestValidListAppImages(c *check.C) {
 }
 
 func (s *S) TestPlatformImageName(c *check.C) {
-	platName := platformImageName("python")
+	platName := platformImageName("", "python")
 	c.Assert(platName, check.Equals, "tsuru/python")
 	config.Set("docker:registry", "localhost:3030")
 	defer config.Unset("docker:registry")
-	platName = platformImageName("ruby")
+	platName = platformImageName("", "ruby")
 	c.Assert(platName, check.Equals, "localhost:3030/tsuru/ruby")
 }
 
@@ -286,6 +286,29 @@ func (s *S) TestDeleteAllAppImageNamesRemovesCustomData(c *check.C) {
 	c.Assert(yamlData, check.DeepEquals, provision.TsuruYamlData{})
 }
 
+func (s *S) TestGetImageProcesses(c *check.C) {
+	imgName := "tsuru/app-myapp:v1"
+	data := map[string]interface{}{
+		"procfile": "web: python app.py\n# comment\n\nworker: python worker.py --queue=jobs\n",
+	}
+	err := saveImageCustomData(imgName, data)
+	c.Assert(err, check.IsNil)
+	processes, err := getImageProcesses(imgName)
+	c.Assert(err, check.IsNil)
+	c.Assert(processes, check.DeepEquals, []string{"web", "worker"})
+}
+
+func (s *S) TestGetImageProcessesWithoutProcfile(c *check.C) {
+	processes, err := getImageProcesses("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(processes, check.HasLen, 0)
+	err = saveImageCustomData("tsuru/app-myapp:v2", map[string]interface{}{"hooks": nil})
+	c.Assert(err, check.IsNil)
+	processes, err = getImageProcesses("tsuru/app-myapp:v2")
+	c.Assert(err, check.IsNil)
+	c.Assert(processes, check.HasLen, 0)
+}
+
 func (s *S) TestGetImageTsuruYamlDataWithFallback(c *check.C) {
 	data1 := map[string]interface{}{
 		"hooks": map[string]interface{}{
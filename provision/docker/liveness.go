@@ -0,0 +1,229 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultLivenessInterval         = 10
+	defaultLivenessTimeout          = 5
+	defaultLivenessFailureThreshold = 3
+)
+
+// livenessChecker probes the started units of apps declaring a liveness
+// check in tsuru.yaml. Units failing the check are removed from the router,
+// unless they're the last routable unit of the app, and healed after failing
+// it as many times in a row as the failure threshold of the app. Removed
+// routes are flagged in the container document, so they're restored even by
+// other tsuru processes.
+type livenessChecker struct {
+	provisioner *dockerProvisioner
+	lastCheck   map[string]time.Time
+	failures    map[string]int
+}
+
+type livenessResult struct {
+	cont     container
+	liveness provision.TsuruYamlLiveness
+	err      error
+}
+
+func newLivenessChecker(p *dockerProvisioner) *livenessChecker {
+	return &livenessChecker{
+		provisioner: p,
+		lastCheck:   make(map[string]time.Time),
+		failures:    make(map[string]int),
+	}
+}
+
+func (p *dockerProvisioner) runLivenessChecker(interval time.Duration) {
+	checker := newLivenessChecker(p)
+	for {
+		checker.checkOnce()
+		time.Sleep(interval)
+	}
+}
+
+// checkOnce probes the units whose liveness interval has elapsed since their
+// last check, handling the ones that failed.
+func (l *livenessChecker) checkOnce() {
+	containers, err := l.provisioner.listContainersBy(bson.M{"status": provision.StatusStarted.String()})
+	if err != nil {
+		log.Errorf("Liveness check: couldn't list started containers: %s", err)
+		return
+	}
+	now := time.Now()
+	seen := make(map[string]bool, len(containers))
+	results := make(chan livenessResult, len(containers))
+	var wg sync.WaitGroup
+	for _, cont := range containers {
+		if !cont.routable() {
+			continue
+		}
+		seen[cont.ID] = true
+		yamlData, err := getImageTsuruYamlDataWithFallback(cont.Image, cont.AppName)
+		if err != nil {
+			log.Errorf("Liveness check: couldn't get tsuru.yaml of container %s: %s", cont.ID, err)
+			continue
+		}
+		liveness := yamlData.Liveness
+		if liveness.Path == "" {
+			continue
+		}
+		interval := liveness.Interval
+		if interval <= 0 {
+			interval = defaultLivenessInterval
+		}
+		if now.Sub(l.lastCheck[cont.ID]) < time.Duration(interval)*time.Second {
+			continue
+		}
+		l.lastCheck[cont.ID] = now
+		wg.Add(1)
+		go func(cont container) {
+			defer wg.Done()
+			results <- livenessResult{cont: cont, liveness: liveness, err: probeLiveness(&cont, liveness)}
+		}(cont)
+	}
+	wg.Wait()
+	close(results)
+	for result := range results {
+		l.handleResult(result)
+	}
+	for id := range l.lastCheck {
+		if !seen[id] {
+			l.forget(id)
+		}
+	}
+}
+
+func (l *livenessChecker) handleResult(result livenessResult) {
+	cont := result.cont
+	if result.err == nil {
+		delete(l.failures, cont.ID)
+		if cont.Unrouted {
+			err := l.setRouted(cont, true)
+			if err != nil {
+				log.Errorf("Liveness check: couldn't add route of container %s back: %s", cont.ID, err)
+			}
+		}
+		return
+	}
+	l.failures[cont.ID]++
+	failures := l.failures[cont.ID]
+	threshold := result.liveness.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultLivenessFailureThreshold
+	}
+	log.Errorf("Liveness check: container %s of app %s failed (%d/%d): %s", cont.ID, cont.AppName, failures, threshold, result.err)
+	if !cont.Unrouted {
+		err := l.unroute(cont)
+		if err != nil {
+			log.Errorf("Liveness check: couldn't remove route of container %s: %s", cont.ID, err)
+		}
+	}
+	if failures < threshold {
+		return
+	}
+	reason := fmt.Sprintf("failed %d liveness checks in a row: %s", failures, result.err)
+	err := l.provisioner.healContainerWithReason(cont, reason)
+	if err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+	l.forget(cont.ID)
+}
+
+// unroute removes the route of the container, unless no other started unit
+// of the app receives traffic.
+func (l *livenessChecker) unroute(cont container) error {
+	containers, err := l.provisioner.listContainersBy(bson.M{
+		"appname":  cont.AppName,
+		"status":   provision.StatusStarted.String(),
+		"unrouted": bson.M{"$ne": true},
+		"id":       bson.M{"$ne": cont.ID},
+	})
+	if err != nil {
+		return err
+	}
+	if len(routableContainers(containers)) == 0 {
+		log.Errorf("Liveness check: keeping route of container %s, it's the last routable unit of app %s", cont.ID, cont.AppName)
+		return nil
+	}
+	return l.setRouted(cont, false)
+}
+
+// setRouted adds or removes the route of the container, recording it in the
+// container document. Routes added back while the app has an active canary
+// deploy get the weight of the other units of the same version.
+func (l *livenessChecker) setRouted(cont container, routed bool) error {
+	a, err := cont.getApp()
+	if err != nil {
+		return err
+	}
+	r, err := getRouterForApp(a)
+	if err != nil {
+		return err
+	}
+	if routed {
+		weight, err := l.provisioner.canaryRouteWeight(&cont)
+		if err != nil {
+			return err
+		}
+		if wr, ok := r.(router.WeightedRouter); ok && weight > 0 {
+			err = wr.AddWeightedRoute(cont.AppName, cont.getAddress(), weight)
+		} else {
+			err = r.AddRoute(cont.AppName, cont.getAddress())
+		}
+	} else {
+		err = r.RemoveRoute(cont.AppName, cont.getAddress())
+	}
+	if err != nil {
+		return err
+	}
+	coll := l.provisioner.collection()
+	defer coll.Close()
+	if routed {
+		return coll.Update(bson.M{"id": cont.ID}, bson.M{"$unset": bson.M{"unrouted": ""}})
+	}
+	return coll.Update(bson.M{"id": cont.ID}, bson.M{"$set": bson.M{"unrouted": true}})
+}
+
+func (l *livenessChecker) forget(id string) {
+	delete(l.lastCheck, id)
+	delete(l.failures, id)
+}
+
+// probeLiveness sends a GET request to the liveness path of the container,
+// which is alive when it responds with a 2xx or 3xx status within the
+// timeout.
+func probeLiveness(cont *container, liveness provision.TsuruYamlLiveness) error {
+	timeout := liveness.Timeout
+	if timeout <= 0 {
+		timeout = defaultLivenessTimeout
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	path := strings.TrimSpace(strings.TrimLeft(liveness.Path, "/"))
+	url := fmt.Sprintf("http://%s:%s/%s", cont.HostAddr, cont.HostPort, path)
+	rsp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+	}
+	return nil
+}
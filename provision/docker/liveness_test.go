@@ -0,0 +1,201 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestProbeLiveness(c *check.C) {
+	var paths []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	url, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(url.Host)
+	cont := container{AppName: "myapp", HostAddr: host, HostPort: port}
+	liveness := provision.TsuruYamlLiveness{Path: "/alive"}
+	err := probeLiveness(&cont, liveness)
+	c.Assert(err, check.IsNil)
+	status = http.StatusInternalServerError
+	err = probeLiveness(&cont, liveness)
+	c.Assert(err, check.ErrorMatches, "unexpected status code 500")
+	c.Assert(paths, check.DeepEquals, []string{"/alive", "/alive"})
+}
+
+func (s *S) TestProbeLivenessTimeout(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer server.Close()
+	url, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(url.Host)
+	cont := container{AppName: "myapp", HostAddr: host, HostPort: port}
+	err := probeLiveness(&cont, provision.TsuruYamlLiveness{Path: "/alive", Timeout: 1})
+	c.Assert(err, check.NotNil)
+}
+
+// newLivenessContainer creates a started container of the app whose address
+// is the one of the given test server.
+func (s *S) newLivenessContainer(c *check.C, appName, serverURL string) *container {
+	cont, err := s.newContainer(&newContainerOpts{AppName: appName, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.RemoveRoute(cont.AppName, cont.getAddress())
+	url, _ := url.Parse(serverURL)
+	cont.HostAddr, cont.HostPort, _ = net.SplitHostPort(url.Host)
+	routertest.FakeRouter.AddRoute(cont.AppName, cont.getAddress())
+	coll := s.p.collection()
+	defer coll.Close()
+	err = coll.Update(bson.M{"id": cont.ID}, cont)
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData(cont.Image, map[string]interface{}{
+		"liveness": map[string]interface{}{
+			"path":              "/alive",
+			"failure_threshold": 2,
+		},
+	})
+	c.Assert(err, check.IsNil)
+	return cont
+}
+
+func (s *S) TestLivenessCheckerRemovesRouteAndHeals(c *check.C) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer okServer.Close()
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont := s.newLivenessContainer(c, a.Name, server.URL)
+	defer s.removeTestContainer(cont)
+	okCont := s.newLivenessContainer(c, a.Name, okServer.URL)
+	defer s.removeTestContainer(okCont)
+	checker := newLivenessChecker(s.p)
+	checker.checkOnce()
+	c.Assert(checker.failures[cont.ID], check.Equals, 1)
+	c.Assert(routertest.FakeRouter.HasRoute(cont.AppName, cont.getAddress()), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasRoute(okCont.AppName, okCont.getAddress()), check.Equals, true)
+	dbCont, err := s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Unrouted, check.Equals, true)
+	checker.checkOnce()
+	c.Assert(checker.failures[cont.ID], check.Equals, 1)
+	status = http.StatusOK
+	checker = newLivenessChecker(s.p)
+	checker.checkOnce()
+	c.Assert(checker.failures[cont.ID], check.Equals, 0)
+	c.Assert(routertest.FakeRouter.HasRoute(cont.AppName, cont.getAddress()), check.Equals, true)
+	dbCont, err = s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Unrouted, check.Equals, false)
+	status = http.StatusInternalServerError
+	checker.lastCheck[cont.ID] = time.Time{}
+	checker.checkOnce()
+	checker.lastCheck[cont.ID] = time.Time{}
+	checker.checkOnce()
+	healingColl, err := healingCollection()
+	c.Assert(err, check.IsNil)
+	defer healingColl.Close()
+	var events []healingEvent
+	err = healingColl.Find(nil).All(&events)
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 1)
+	c.Assert(events[0].Action, check.Equals, "container-healing")
+	c.Assert(events[0].FailingContainer.ID, check.Equals, cont.ID)
+	c.Assert(events[0].Reason, check.Equals, "failed 2 liveness checks in a row: unexpected status code 500")
+}
+
+func (s *S) TestLivenessCheckerKeepsRouteOfLastRoutableUnit(c *check.C) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+	server2 := httptest.NewServer(handler)
+	defer server2.Close()
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont1 := s.newLivenessContainer(c, a.Name, server1.URL)
+	defer s.removeTestContainer(cont1)
+	cont2 := s.newLivenessContainer(c, a.Name, server2.URL)
+	defer s.removeTestContainer(cont2)
+	checker := newLivenessChecker(s.p)
+	checker.checkOnce()
+	c.Assert(checker.failures[cont1.ID], check.Equals, 1)
+	c.Assert(checker.failures[cont2.ID], check.Equals, 1)
+	routes, err := routertest.FakeRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 1)
+	unrouted, err := s.p.listContainersBy(bson.M{"appname": a.Name, "unrouted": true})
+	c.Assert(err, check.IsNil)
+	c.Assert(unrouted, check.HasLen, 1)
+}
+
+func (s *S) TestLivenessCheckerSetRoutedKeepsCanaryWeight(c *check.C) {
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont1 := s.newLivenessContainer(c, a.Name, "http://127.0.0.1:4001")
+	defer s.removeTestContainer(cont1)
+	cont2 := s.newLivenessContainer(c, a.Name, "http://127.0.0.1:4002")
+	defer s.removeTestContainer(cont2)
+	canaryCont := s.newLivenessContainer(c, a.Name, "http://127.0.0.1:4003")
+	defer s.removeTestContainer(canaryCont)
+	coll, err := canaryColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(canaryDeploy{AppName: a.Name, Weight: 20, Image: "tsuru/python", Units: []string{canaryCont.ID}})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(a.Name)
+	checker := newLivenessChecker(s.p)
+	err = checker.setRouted(*canaryCont, false)
+	c.Assert(err, check.IsNil)
+	err = checker.setRouted(*canaryCont, true)
+	c.Assert(err, check.IsNil)
+	err = checker.setRouted(*cont1, false)
+	c.Assert(err, check.IsNil)
+	err = checker.setRouted(*cont1, true)
+	c.Assert(err, check.IsNil)
+	weights, err := routertest.FakeRouter.RouteWeights(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(weights[canaryCont.getAddress()], check.Equals, 1)
+	c.Assert(weights[cont1.getAddress()], check.Equals, 2)
+}
+
+func (s *S) TestLivenessCheckerIgnoresAppsWithoutLiveness(c *check.C) {
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	checker := newLivenessChecker(s.p)
+	checker.checkOnce()
+	c.Assert(checker.lastCheck, check.HasLen, 0)
+	c.Assert(routertest.FakeRouter.HasRoute(cont.AppName, cont.getAddress()), check.Equals, true)
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+	mongoMetrics "github.com/tsuru/tsuru/metrics/mongodb"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultMetricsWorkers = 10
+
+// cpuPercent returns the CPU usage percentage of a container between two
+// samples of its stats, considering all the CPUs of the host.
+func cpuPercent(previous, current *docker.Stats) float64 {
+	cpuDelta := float64(current.CPUStats.CPUUsage.TotalUsage) - float64(previous.CPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(current.CPUStats.SystemCPUUsage) - float64(previous.CPUStats.SystemCPUUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cpus := len(current.CPUStats.CPUUsage.PercpuUsage)
+	if cpus == 0 {
+		cpus = 1
+	}
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// containerStats reads two samples from the stats stream of the container,
+// so the CPU usage can be calculated.
+func containerStats(client *docker.Client, id string) (*docker.Stats, *docker.Stats, error) {
+	statsCh := make(chan *docker.Stats)
+	done := make(chan bool)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Stats(docker.StatsOptions{ID: id, Stats: statsCh, Done: done})
+	}()
+	var samples []*docker.Stats
+	for stats := range statsCh {
+		samples = append(samples, stats)
+		if len(samples) == 2 {
+			close(done)
+			break
+		}
+	}
+	for range statsCh {
+	}
+	err := <-errCh
+	if len(samples) < 2 {
+		if err == nil {
+			err = fmt.Errorf("not enough stats samples for container %s", id)
+		}
+		return nil, nil, err
+	}
+	return samples[0], samples[1], nil
+}
+
+func containerSample(client *docker.Client, c container, timestamp time.Time) (mongoMetrics.Sample, error) {
+	previous, current, err := containerStats(client, c.ID)
+	if err != nil {
+		return mongoMetrics.Sample{}, err
+	}
+	return mongoMetrics.Sample{
+		App:         c.AppName,
+		Unit:        c.ID,
+		Process:     c.ProcessName,
+		Timestamp:   timestamp,
+		CPU:         cpuPercent(previous, current),
+		Memory:      current.MemoryStats.Usage,
+		MemoryLimit: current.MemoryStats.Limit,
+		NetRx:       current.Network.RxBytes,
+		NetTx:       current.Network.TxBytes,
+	}, nil
+}
+
+// collectMetricsOnce stores a sample of the resource usage of every running
+// container. All samples share the same timestamp, so they can be summarized
+// across the units of each app.
+func (p *dockerProvisioner) collectMetricsOnce() error {
+	containers, err := p.listContainersBy(bson.M{
+		"status": bson.M{
+			"$in": []string{
+				provision.StatusStarting.String(),
+				provision.StatusStarted.String(),
+				provision.StatusError.String(),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	nodes, err := p.nodes()
+	if err != nil {
+		return err
+	}
+	clients := make(map[string]*docker.Client, len(nodes))
+	for i := range nodes {
+		client, err := nodes[i].Client()
+		if err != nil {
+			log.Errorf("[metrics] Unable to get client for node %s: %s", nodes[i].Address, err)
+			continue
+		}
+		clients[urlToHost(nodes[i].Address)] = client
+	}
+	timestamp := time.Now().Truncate(time.Second)
+	var mut sync.Mutex
+	var samples []mongoMetrics.Sample
+	var wg sync.WaitGroup
+	toCollect := make(chan container)
+	for i := 0; i < metricsWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range toCollect {
+				sample, err := containerSample(clients[c.HostAddr], c, timestamp)
+				if err != nil {
+					log.Errorf("[metrics] Unable to get stats of container %s: %s", c.ID, err)
+					continue
+				}
+				mut.Lock()
+				samples = append(samples, sample)
+				mut.Unlock()
+			}
+		}()
+	}
+	for _, c := range containers {
+		if _, ok := clients[c.HostAddr]; ok {
+			toCollect <- c
+		}
+	}
+	close(toCollect)
+	wg.Wait()
+	return mongoMetrics.Add(samples...)
+}
+
+// metricsWorkers returns the number of containers whose stats are read
+// concurrently in each collection.
+func metricsWorkers() int {
+	workers, _ := config.GetInt("docker:metrics:collect-workers")
+	if workers <= 0 {
+		return defaultMetricsWorkers
+	}
+	return workers
+}
+
+func (p *dockerProvisioner) runMetricsCollector(interval time.Duration) {
+	for {
+		err := p.collectMetricsOnce()
+		if err != nil {
+			log.Errorf("[metrics] Unable to collect units metrics: %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCPUPercent(c *check.C) {
+	var previous, current docker.Stats
+	previous.CPUStats.CPUUsage.TotalUsage = 100
+	previous.CPUStats.SystemCPUUsage = 1000
+	current.CPUStats.CPUUsage.TotalUsage = 200
+	current.CPUStats.SystemCPUUsage = 2000
+	current.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 50}
+	c.Assert(cpuPercent(&previous, &current), check.Equals, 20.0)
+	c.Assert(cpuPercent(&current, &current), check.Equals, 0.0)
+}
+
+func (s *S) TestMetricsWorkers(c *check.C) {
+	c.Assert(metricsWorkers(), check.Equals, defaultMetricsWorkers)
+	config.Set("docker:metrics:collect-workers", 3)
+	defer config.Unset("docker:metrics:collect-workers")
+	c.Assert(metricsWorkers(), check.Equals, 3)
+	config.Set("docker:metrics:collect-workers", -1)
+	c.Assert(metricsWorkers(), check.Equals, defaultMetricsWorkers)
+}
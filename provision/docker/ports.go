@@ -0,0 +1,192 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+)
+
+var errRouterNotTCP = errors.New("the router of this app does not support tcp ports, remove the ports from tsuru.yaml or use another router")
+
+// imagePorts returns the extra ports declared in the tsuru.yaml of the image,
+// with the protocol defaulting to tcp.
+func imagePorts(imageId, appName string) ([]provision.TsuruYamlPort, error) {
+	yamlData, err := getImageTsuruYamlDataWithFallback(imageId, appName)
+	if err != nil {
+		return nil, err
+	}
+	ports := yamlData.Ports
+	for i := range ports {
+		if ports[i].Protocol == "" {
+			ports[i].Protocol = "tcp"
+		}
+	}
+	return ports, nil
+}
+
+func validatePorts(ports []provision.TsuruYamlPort) error {
+	httpPort, err := getPort()
+	if err != nil {
+		return err
+	}
+	seen := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		if port.Port < 1 || port.Port > 65535 {
+			return fmt.Errorf("invalid port %d in tsuru.yaml", port.Port)
+		}
+		if strconv.Itoa(port.Port) == httpPort {
+			return fmt.Errorf("port %d in tsuru.yaml is the http port of the app", port.Port)
+		}
+		if port.Protocol != "tcp" && port.Protocol != "http" {
+			return fmt.Errorf("invalid protocol %q for port %d in tsuru.yaml, must be tcp or http", port.Protocol, port.Port)
+		}
+		if seen[port.Port] {
+			return fmt.Errorf("port %d is declared more than once in tsuru.yaml", port.Port)
+		}
+		seen[port.Port] = true
+	}
+	return nil
+}
+
+// allocateAppPorts assigns an external port to each port declared in the
+// tsuru.yaml of the image, before units of the image are created. Ports
+// already assigned to the app keep their external port.
+func (p *dockerProvisioner) allocateAppPorts(app provision.App, imageId string, w io.Writer) error {
+	ports, err := imagePorts(imageId, app.GetName())
+	if err != nil || len(ports) == 0 {
+		return err
+	}
+	err = validatePorts(ports)
+	if err != nil {
+		return err
+	}
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.(router.TCPRouter); !ok {
+		return errRouterNotTCP
+	}
+	fmt.Fprintf(w, "\n---- Allocating %d ports ----\n", len(ports))
+	for _, port := range ports {
+		assignment, err := router.AllocatePort(app.GetName(), port.Port, port.Protocol)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, " ---> Port %d/%s exposed in external port %d\n", port.Port, port.Protocol, assignment.ExternalPort)
+	}
+	return nil
+}
+
+// releaseUndeclaredPorts releases the external ports assigned to ports that
+// are not declared in the tsuru.yaml of the image anymore, once the units of
+// the image replaced the old ones.
+func releaseUndeclaredPorts(appName, imageId string) error {
+	ports, err := imagePorts(imageId, appName)
+	if err != nil {
+		return err
+	}
+	declared := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		declared[port.Port] = true
+	}
+	assignments, err := router.AppPorts(appName)
+	if err != nil {
+		return err
+	}
+	for _, assignment := range assignments {
+		if !declared[assignment.Port] {
+			err = router.ReleasePort(appName, assignment.Port)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// extraPortsChanged returns whether the host ports of the extra ports of a
+// container changed, e.g. after the container is restarted.
+func extraPortsChanged(old, current map[string]string) bool {
+	if len(old) != len(current) {
+		return true
+	}
+	for port, hostPort := range current {
+		if old[port] != hostPort {
+			return true
+		}
+	}
+	return false
+}
+
+func dockerPort(port int) docker.Port {
+	return docker.Port(strconv.Itoa(port) + "/tcp")
+}
+
+// tcpRoutes returns the addresses of the extra ports of the container, keyed
+// by the external ports assigned to them.
+func (c *container) tcpRoutes() (map[int]string, error) {
+	if len(c.ExtraPorts) == 0 {
+		return nil, nil
+	}
+	assignments, err := router.AppPorts(c.AppName)
+	if err != nil {
+		return nil, err
+	}
+	routes := make(map[int]string, len(assignments))
+	for _, assignment := range assignments {
+		hostPort := c.ExtraPorts[strconv.Itoa(assignment.Port)]
+		if hostPort != "" {
+			routes[assignment.ExternalPort] = net.JoinHostPort(c.HostAddr, hostPort)
+		}
+	}
+	return routes, nil
+}
+
+// addTCPRoutes routes the external ports of the app to the extra ports of the
+// container, when the router of the app supports tcp routing.
+func (c *container) addTCPRoutes(r router.Router) error {
+	tcpRouter, ok := r.(router.TCPRouter)
+	if !ok {
+		return nil
+	}
+	routes, err := c.tcpRoutes()
+	if err != nil {
+		return err
+	}
+	for externalPort, address := range routes {
+		err = tcpRouter.AddTCPRoute(c.AppName, externalPort, address)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *container) removeTCPRoutes(r router.Router) error {
+	tcpRouter, ok := r.(router.TCPRouter)
+	if !ok {
+		return nil
+	}
+	routes, err := c.tcpRoutes()
+	if err != nil {
+		return err
+	}
+	for externalPort, address := range routes {
+		err = tcpRouter.RemoveTCPRoute(c.AppName, externalPort, address)
+		if err != nil && err != router.ErrRouteNotFound {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+// httpOnlyRouter hides the support to tcp routes of the fake router.
+type httpOnlyRouter struct {
+	router.Router
+}
+
+func init() {
+	router.Register("fake-http-only", func(prefix string) (router.Router, error) {
+		return httpOnlyRouter{&routertest.FakeRouter}, nil
+	})
+}
+
+func setTCPPortRange(min, max int) func() {
+	config.Set("tcp-ports:min", min)
+	config.Set("tcp-ports:max", max)
+	return func() {
+		config.Unset("tcp-ports:min")
+		config.Unset("tcp-ports:max")
+	}
+}
+
+func (s *S) TestAllocateAppPorts(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	err := saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"ports": []map[string]interface{}{
+			{"port": 5432},
+			{"port": 9000, "protocol": "http"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	var buf bytes.Buffer
+	err = s.p.allocateAppPorts(app, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.IsNil)
+	ports, err := router.AppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.DeepEquals, []router.PortAssignment{
+		{ExternalPort: 30000, App: "myapp", Port: 5432, Protocol: "tcp"},
+		{ExternalPort: 30001, App: "myapp", Port: 9000, Protocol: "http"},
+	})
+	c.Assert(buf.String(), check.Matches, `(?s).*Port 5432/tcp exposed in external port 30000.*`)
+}
+
+func (s *S) TestAllocateAppPortsInvalid(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	var tests = []struct {
+		ports   []map[string]interface{}
+		message string
+	}{
+		{[]map[string]interface{}{{"port": 70000}}, "invalid port 70000 in tsuru.yaml"},
+		{[]map[string]interface{}{{"port": 8888}}, "port 8888 in tsuru.yaml is the http port of the app"},
+		{[]map[string]interface{}{{"port": 53, "protocol": "udp"}}, `invalid protocol "udp" for port 53 in tsuru.yaml, must be tcp or http`},
+		{[]map[string]interface{}{{"port": 53}, {"port": 53}}, "port 53 is declared more than once in tsuru.yaml"},
+	}
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	for _, t := range tests {
+		coll, err := imageCustomDataColl()
+		c.Assert(err, check.IsNil)
+		coll.RemoveAll(nil)
+		coll.Close()
+		err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{"ports": t.ports})
+		c.Assert(err, check.IsNil)
+		err = s.p.allocateAppPorts(app, "tsuru/app-myapp:v1", &bytes.Buffer{})
+		c.Assert(err, check.NotNil)
+		c.Check(err.Error(), check.Equals, t.message)
+	}
+	ports, err := router.AppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 0)
+}
+
+func (s *S) TestAllocateAppPortsRouterWithoutTCP(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	config.Set("docker:router", "fake-http-only")
+	defer config.Set("docker:router", "fake")
+	err := saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"ports": []map[string]interface{}{{"port": 5432}},
+	})
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	var buf bytes.Buffer
+	err = s.p.allocateAppPorts(app, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.Equals, errRouterNotTCP)
+	c.Assert(buf.String(), check.Equals, "")
+	ports, err := router.AppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 0)
+}
+
+func (s *S) TestReleaseUndeclaredPorts(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	_, err := router.AllocatePort("myapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	_, err = router.AllocatePort("myapp", 6379, "tcp")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v2", map[string]interface{}{
+		"ports": []map[string]interface{}{{"port": 6379}},
+	})
+	c.Assert(err, check.IsNil)
+	err = releaseUndeclaredPorts("myapp", "tsuru/app-myapp:v2")
+	c.Assert(err, check.IsNil)
+	ports, err := router.AppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.DeepEquals, []router.PortAssignment{
+		{ExternalPort: 30001, App: "myapp", Port: 6379, Protocol: "tcp"},
+	})
+}
+
+func (s *S) TestContainerTCPRoutes(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	routertest.FakeRouter.AddBackend("myapp")
+	defer routertest.FakeRouter.RemoveBackend("myapp")
+	_, err := router.AllocatePort("myapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	cont := container{AppName: "myapp", HostAddr: "10.0.0.1", ExtraPorts: map[string]string{"5432": "49153"}}
+	err = cont.addTCPRoutes(&routertest.FakeRouter)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasTCPRoute("myapp", 30000, "10.0.0.1:49153"), check.Equals, true)
+	err = cont.removeTCPRoutes(&routertest.FakeRouter)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasTCPRoute("myapp", 30000, "10.0.0.1:49153"), check.Equals, false)
+	err = cont.removeTCPRoutes(&routertest.FakeRouter)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestContainerCreateWithExtraPorts(c *check.C) {
+	err := saveImageCustomData("tsuru/brainfuck", map[string]interface{}{
+		"ports": []map[string]interface{}{{"port": 5432}},
+	})
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("app-name", "brainfuck", 1)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	s.p.getCluster().PullImage(
+		docker.PullImageOptions{Repository: "tsuru/brainfuck"},
+		docker.AuthConfiguration{},
+	)
+	cont := container{Name: "myName", AppName: app.GetName(), Type: app.GetPlatform(), Status: "created"}
+	err = cont.create(runContainerActionsArgs{
+		app:         app,
+		imageID:     "tsuru/brainfuck",
+		commands:    []string{"docker", "run"},
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := s.p.getCluster().InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.Config.ExposedPorts, check.DeepEquals, map[docker.Port]struct{}{
+		"8888/tcp": {},
+		"5432/tcp": {},
+	})
+}
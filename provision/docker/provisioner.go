@@ -52,12 +52,14 @@ func getRouterForApp(app provision.App) (router.Router, error) {
 }
 
 type dockerProvisioner struct {
-	cluster        *cluster.Cluster
-	cmutex         sync.Mutex
-	collectionName string
-	storage        cluster.Storage
-	scheduler      *segregatedScheduler
-	dryMode        bool
+	cluster         *cluster.Cluster
+	clusters        map[string]*cluster.Cluster
+	cmutex          sync.Mutex
+	collectionName  string
+	storage         cluster.Storage
+	clusterStorages map[string]cluster.Storage
+	scheduler       *segregatedScheduler
+	dryMode         bool
 }
 
 func initDockerCluster(p *dockerProvisioner) {
@@ -65,18 +67,21 @@ func initDockerCluster(p *dockerProvisioner) {
 	clusterLog.SetDebug(debug)
 	clusterLog.SetLogger(log.GetStdLogger())
 	var err error
-	p.storage, err = buildClusterStorage()
+	p.storage, err = buildClusterStorage("")
 	if err != nil {
 		panic(err)
 	}
 	var nodes []cluster.Node
 	if isSegregateScheduler() {
 		totalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
+		totalCpuShareMetadata, _ := config.GetString("docker:scheduler:total-cpu-share-metadata")
 		maxUsedMemory, _ := config.GetFloat("docker:scheduler:max-used-memory")
 		p.scheduler = &segregatedScheduler{
-			maxMemoryRatio:      float32(maxUsedMemory),
-			totalMemoryMetadata: totalMemoryMetadata,
-			provisioner:         p,
+			maxMemoryRatio:        float32(maxUsedMemory),
+			totalMemoryMetadata:   totalMemoryMetadata,
+			totalCpuShareMetadata: totalCpuShareMetadata,
+			zoneMetadata:          zoneMetadata(),
+			provisioner:           p,
 		}
 	} else {
 		nodes = getDockerServers()
@@ -85,41 +90,43 @@ func initDockerCluster(p *dockerProvisioner) {
 	if err != nil {
 		panic(err)
 	}
-	autoHealingNodes, _ := config.GetBool("docker:healing:heal-nodes")
-	if autoHealingNodes {
-		disabledSeconds, _ := config.GetDuration("docker:healing:disabled-time")
-		if disabledSeconds <= 0 {
-			disabledSeconds = 30
-		}
-		maxFailures, _ := config.GetInt("docker:healing:max-failures")
-		if maxFailures <= 0 {
-			maxFailures = 5
-		}
-		waitSecondsNewMachine, _ := config.GetDuration("docker:healing:wait-new-time")
-		if waitSecondsNewMachine <= 0 {
-			waitSecondsNewMachine = 5 * 60
-		}
-		healer := Healer{
-			provisioner:           p,
-			disabledTime:          disabledSeconds * time.Second,
-			waitTimeNewMachine:    waitSecondsNewMachine * time.Second,
-			failuresBeforeHealing: maxFailures,
-		}
-		p.cluster.SetHealer(&healer)
-	}
+	p.setClusterHealing("", p.cluster)
+	initNamedClusters(p)
 	healNodesSeconds, _ := config.GetDuration("docker:healing:heal-containers-timeout")
 	if healNodesSeconds > 0 {
 		go p.runContainerHealer(healNodesSeconds * time.Second)
 	}
-	activeMonitoring, _ := config.GetDuration("docker:healing:active-monitoring-interval")
-	if activeMonitoring > 0 {
-		p.cluster.StartActiveMonitoring(activeMonitoring * time.Second)
+	livenessInterval, _ := config.GetDuration("docker:healing:liveness-check-interval")
+	if livenessInterval > 0 {
+		go p.runLivenessChecker(livenessInterval * time.Second)
+	}
+	metricsInterval, _ := config.GetDuration("docker:metrics:collect-interval")
+	if metricsInterval > 0 {
+		go p.runMetricsCollector(metricsInterval * time.Second)
+	}
+	imageGCInterval, _ := config.GetDuration("docker:image-gc:interval")
+	if imageGCInterval > 0 {
+		go p.runImageGC(imageGCInterval * time.Second)
+	}
+	sleepInterval, _ := config.GetDuration("docker:sleep:check-interval")
+	if sleepInterval > 0 {
+		go p.runSleepChecker(sleepInterval * time.Second)
+	}
+	autoScaleInterval, _ := config.GetDuration("docker:auto-scale:interval")
+	if autoScaleInterval > 0 {
+		go p.runAutoScale(autoScaleInterval * time.Second)
+	}
+	if wakerListen, _ := config.GetString("docker:sleep:waker-listen"); wakerListen != "" {
+		go p.runWaker(wakerListen)
 	}
 }
 
 func (p *dockerProvisioner) StopDryMode() {
 	if p.dryMode {
 		p.cluster.StopDryMode()
+		for _, c := range p.clusters {
+			c.StopDryMode()
+		}
 		p.collection().DropCollection()
 	}
 }
@@ -133,9 +140,11 @@ func (p *dockerProvisioner) DryMode(containersToCopy []container) (*dockerProvis
 	}
 	if p.scheduler != nil {
 		scheduler = &segregatedScheduler{
-			maxMemoryRatio:      p.scheduler.maxMemoryRatio,
-			totalMemoryMetadata: p.scheduler.totalMemoryMetadata,
-			provisioner:         overridenProvisioner,
+			maxMemoryRatio:        p.scheduler.maxMemoryRatio,
+			totalMemoryMetadata:   p.scheduler.totalMemoryMetadata,
+			totalCpuShareMetadata: p.scheduler.totalCpuShareMetadata,
+			zoneMetadata:          p.scheduler.zoneMetadata,
+			provisioner:           overridenProvisioner,
 		}
 	}
 	overridenProvisioner.cluster, err = cluster.New(scheduler, p.storage)
@@ -143,6 +152,18 @@ func (p *dockerProvisioner) DryMode(containersToCopy []container) (*dockerProvis
 		return nil, err
 	}
 	overridenProvisioner.cluster.DryMode()
+	if len(p.clusters) > 0 {
+		overridenProvisioner.clusters = make(map[string]*cluster.Cluster, len(p.clusters))
+		overridenProvisioner.clusterStorages = p.clusterStorages
+		for name := range p.clusters {
+			c, err := cluster.New(scheduler, p.clusterStorages[name])
+			if err != nil {
+				return nil, err
+			}
+			c.DryMode()
+			overridenProvisioner.clusters[name] = c
+		}
+	}
 	coll := overridenProvisioner.collection()
 	defer coll.Close()
 	err = coll.Insert(containersToCopy)
@@ -163,13 +184,19 @@ func (p *dockerProvisioner) getCluster() *cluster.Cluster {
 }
 
 func (p *dockerProvisioner) StartupMessage() (string, error) {
-	nodeList, err := p.getCluster().UnfilteredNodes()
+	byCluster, err := p.nodesByCluster(true)
 	if err != nil {
 		return "", err
 	}
 	out := "Docker provisioner reports the following nodes:\n"
-	for _, node := range nodeList {
-		out += fmt.Sprintf("    Docker node: %s\n", node.Address)
+	for _, clusterName := range p.clusterNames() {
+		for _, node := range byCluster[clusterName] {
+			if clusterName == "" {
+				out += fmt.Sprintf("    Docker node: %s\n", node.Address)
+			} else {
+				out += fmt.Sprintf("    Docker node: %s (cluster %s)\n", node.Address, clusterName)
+			}
+		}
 	}
 	return out, nil
 }
@@ -194,6 +221,14 @@ func (p *dockerProvisioner) Provision(app provision.App) error {
 }
 
 func (p *dockerProvisioner) Restart(a provision.App, w io.Writer) error {
+	err := checkNoActiveCanary(a.GetName())
+	if err != nil {
+		return err
+	}
+	err = p.wakeApp(a.GetName())
+	if err != nil {
+		return err
+	}
 	containers, err := p.listContainersByApp(a.GetName())
 	if err != nil {
 		return err
@@ -210,8 +245,50 @@ func (p *dockerProvisioner) Restart(a provision.App, w io.Writer) error {
 	return err
 }
 
-func (p *dockerProvisioner) Start(app provision.App) error {
-	containers, err := p.listContainersByApp(app.GetName())
+// MoveUnitsToPool replaces the containers of the app with new containers,
+// scheduled in the nodes of the pool of the app. The image of the app is only
+// available in the registry of its current cluster, so pools in other
+// clusters are rejected.
+func (p *dockerProvisioner) MoveUnitsToPool(a provision.App, pool string, w io.Writer) error {
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return nil
+	}
+	clusterName, err := appClusterName(a.GetName())
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if c.Cluster != clusterName {
+			return errMoveAcrossClusters
+		}
+	}
+	imageId, err := appCurrentImageName(a.GetName())
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	writer := &app.LogWriter{App: a, Writer: w}
+	if pool == "" {
+		fmt.Fprintf(writer, "\n---- Moving %d units to the pools of the team ----\n", len(containers))
+	} else {
+		fmt.Fprintf(writer, "\n---- Moving %d units to pool %s ----\n", len(containers), pool)
+	}
+	_, err = p.runReplaceUnitsPipeline(writer, a, containers, imageId)
+	return err
+}
+
+func (p *dockerProvisioner) Start(app provision.App, process string) error {
+	err := p.wakeApp(app.GetName())
+	if err != nil {
+		return err
+	}
+	containers, err := p.listContainersByProcess(app.GetName(), process)
 	if err != nil {
 		return errors.New(fmt.Sprintf("Got error while getting app containers: %s", err))
 	}
@@ -237,8 +314,12 @@ func (p *dockerProvisioner) Start(app provision.App) error {
 	return <-errCh
 }
 
-func (p *dockerProvisioner) Stop(app provision.App) error {
-	containers, err := p.listContainersByApp(app.GetName())
+func (p *dockerProvisioner) Stop(app provision.App, process string) error {
+	err := p.cancelSleep(app)
+	if err != nil {
+		log.Errorf("Failed to cancel sleep of app %q: %s", app.GetName(), err)
+	}
+	containers, err := p.listContainersByProcess(app.GetName(), process)
 	if err != nil {
 		log.Errorf("Got error while getting app containers: %s", err)
 		return nil
@@ -274,10 +355,20 @@ func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, w io.
 	if err != nil {
 		return "", err
 	}
-	if !isValid {
+	if isValid {
+		return imageId, p.deploy(app, imageId, w)
+	}
+	if !isExternalImage(imageId) {
 		return "", fmt.Errorf("invalid image for app %s: %s", app.GetName(), imageId)
 	}
-	return imageId, p.deploy(app, imageId, w)
+	if registry := imageRegistry(imageId); !registryAllowed(registry) {
+		return "", &registryNotAllowedError{registry: registry}
+	}
+	imageId, err = p.importExternalImage(app, imageId, w)
+	if err != nil {
+		return "", err
+	}
+	return imageId, p.deployAndClean(app, imageId, w)
 }
 
 func (p *dockerProvisioner) GitDeploy(app provision.App, version string, w io.Writer) (string, error) {
@@ -312,7 +403,10 @@ func (p *dockerProvisioner) UploadDeploy(app provision.App, archiveFile io.ReadC
 			Cmd:          []string{"/bin/bash", "-c", "cat > " + filePath},
 		},
 	}
-	cluster := p.getCluster()
+	cluster, _, err := p.clusterForApp(app.GetName())
+	if err != nil {
+		return "", err
+	}
 	_, container, err := cluster.CreateContainerSchedulerOpts(options, app.GetName())
 	if err != nil {
 		return "", err
@@ -359,19 +453,76 @@ func (p *dockerProvisioner) deployAndClean(a provision.App, imageId string, w io
 	err := p.deploy(a, imageId, w)
 	if err != nil {
 		p.cleanImage(a.GetName(), imageId)
+		return err
 	}
-	return err
+	err = releaseUndeclaredPorts(a.GetName(), imageId)
+	if err != nil {
+		log.Errorf("Failed to release undeclared ports of app %s: %s", a.GetName(), err.Error())
+	}
+	return nil
 }
 
 func (p *dockerProvisioner) deploy(a provision.App, imageId string, w io.Writer) error {
+	rolling := provision.RollingDeploySettings(a)
+	canary, err := getCanaryDeploy(a.GetName())
+	if err != nil && err != errNoCanary {
+		return err
+	}
+	if canary != nil && canary.active() {
+		return errCanaryInProgress
+	}
+	err = p.wakeApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	err = p.runReleaseHook(a, imageId, w)
+	if err != nil {
+		return err
+	}
+	err = p.allocateAppPorts(a, imageId, w)
+	if err != nil {
+		return err
+	}
 	containers, err := p.listContainersByApp(a.GetName())
 	if err != nil {
 		return err
 	}
+	if canary != nil && len(containers) > 0 {
+		_, err = p.runCanaryPipeline(w, a, containers, imageId, canary.Weight)
+		return err
+	}
+	if canary != nil {
+		err = removeCanaryDeploy(a.GetName())
+		if err != nil {
+			return err
+		}
+	}
 	if len(containers) == 0 {
-		_, err = p.runCreateUnitsPipeline(w, a, 1, imageId)
+		processes, err := getImageProcesses(imageId)
+		if err != nil {
+			return err
+		}
+		toAdd := map[string]int{"": 1}
+		if len(processes) > 0 {
+			toAdd = make(map[string]int, len(processes))
+			for _, process := range processes {
+				toAdd[process] = 1
+			}
+		}
+		_, err = p.runDeployCreateUnitsPipeline(w, a, toAdd, imageId)
+		return err
+	}
+	if !rolling.Rolling() {
+		yamlData, err := getImageTsuruYamlDataWithFallback(imageId, a.GetName())
+		if err != nil {
+			return err
+		}
+		rolling = yamlData.Deploy
+	}
+	if rolling.Rolling() {
+		_, err = p.runRollingReplaceUnits(w, a, containers, imageId, rolling)
 	} else {
-		_, err = p.runReplaceUnitsPipeline(w, a, containers, imageId)
+		_, err = p.runDeployReplaceUnitsPipeline(w, a, containers, imageId)
 	}
 	return err
 }
@@ -399,11 +550,23 @@ func (p *dockerProvisioner) Destroy(app provision.App) error {
 		}(c)
 	}
 	containersGroup.Wait()
+	err = p.cancelSleep(app)
+	if err != nil {
+		log.Errorf("Failed to cancel sleep of app %s: %s", app.GetName(), err.Error())
+	}
+	err = router.ReleaseAppPorts(app.GetName())
+	if err != nil {
+		log.Errorf("Failed to release ports of app %s: %s", app.GetName(), err.Error())
+	}
 	images, err := listAppImages(app.GetName())
 	if err != nil {
 		log.Errorf("Failed to get image ids for app %s: %s", app.GetName(), err.Error())
 	}
-	cluster := p.getCluster()
+	cluster, _, err := p.clusterForApp(app.GetName())
+	if err != nil {
+		log.Errorf("Failed to get the cluster of app %s: %s", app.GetName(), err.Error())
+		cluster = p.getCluster()
+	}
 	for _, imageId := range images {
 		err := cluster.RemoveImage(imageId)
 		if err != nil {
@@ -418,6 +581,10 @@ func (p *dockerProvisioner) Destroy(app provision.App) error {
 	if err != nil {
 		log.Errorf("Failed to remove image names from storage for app %s: %s", app.GetName(), err.Error())
 	}
+	err = removeCanaryDeploy(app.GetName())
+	if err != nil {
+		log.Errorf("Failed to remove canary deploy of app %s: %s", app.GetName(), err.Error())
+	}
 	r, err := getRouterForApp(app)
 	if err != nil {
 		log.Errorf("Failed to get router: %s", err.Error())
@@ -463,7 +630,10 @@ func (p *dockerProvisioner) runRestartAfterHooks(cont *container, w io.Writer) e
 func addContainersWithHost(args *changeUnitsPipelineArgs) ([]container, error) {
 	a := args.app
 	w := args.writer
-	units := args.unitsToAdd
+	var units int
+	for _, n := range args.toAdd {
+		units += n
+	}
 	imageId := args.imageId
 	var destinationHost []string
 	if args.toHost != "" {
@@ -480,34 +650,36 @@ func addContainersWithHost(args *changeUnitsPipelineArgs) ([]container, error) {
 		plural = "s"
 	}
 	fmt.Fprintf(w, "\n---- Starting %d new unit%s ----\n", units, plural)
-	for i := 0; i < units; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			c, err := args.provisioner.start(a, imageId, w, destinationHost...)
-			if err != nil {
-				errors <- err
-				return
-			}
-			unit := c.asUnit(a)
-			err = a.BindUnit(&unit)
-			if err != nil {
-				errors <- err
-				return
-			}
-			createdContainers <- c
-			err = runHealthcheck(c, w)
-			if err != nil {
-				errors <- err
-				return
-			}
-			err = args.provisioner.runRestartAfterHooks(c, w)
-			if err != nil {
-				errors <- err
-				return
-			}
-			fmt.Fprintf(w, " ---> Started unit %s...\n", c.shortID())
-		}()
+	for process, n := range args.toAdd {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(process string) {
+				defer wg.Done()
+				c, err := args.provisioner.start(a, imageId, process, w, destinationHost...)
+				if err != nil {
+					errors <- err
+					return
+				}
+				unit := c.asUnit(a)
+				err = a.BindUnit(&unit)
+				if err != nil {
+					errors <- err
+					return
+				}
+				createdContainers <- c
+				err = args.provisioner.runHealthcheck(c, w)
+				if err != nil {
+					errors <- err
+					return
+				}
+				err = args.provisioner.runRestartAfterHooks(c, w)
+				if err != nil {
+					errors <- err
+					return
+				}
+				fmt.Fprintf(w, " ---> Started unit %s...\n", c.shortID())
+			}(process)
+		}
 	}
 	wg.Wait()
 	close(errors)
@@ -536,7 +708,7 @@ func addContainersWithHost(args *changeUnitsPipelineArgs) ([]container, error) {
 	return result, nil
 }
 
-func (p *dockerProvisioner) AddUnits(a provision.App, units uint, w io.Writer) ([]provision.Unit, error) {
+func (p *dockerProvisioner) AddUnits(a provision.App, units uint, process string, w io.Writer) ([]provision.Unit, error) {
 	length, err := p.getContainerCountForAppName(a.GetName())
 	if err != nil {
 		return nil, err
@@ -555,7 +727,19 @@ func (p *dockerProvisioner) AddUnits(a provision.App, units uint, w io.Writer) (
 	if err != nil {
 		return nil, err
 	}
-	conts, err := p.runCreateUnitsPipeline(writer, a, int(units), imageId)
+	processes, err := getImageProcesses(imageId)
+	if err != nil {
+		return nil, err
+	}
+	if process == "" {
+		process, err = provision.DefaultProcess(processes)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(processes) > 0 && !processDeclared(processes, process) {
+		return nil, fmt.Errorf("process %q is not declared in the Procfile", process)
+	}
+	conts, err := p.runCreateUnitsPipeline(writer, a, map[string]int{process: int(units)}, imageId)
 	if err != nil {
 		return nil, err
 	}
@@ -566,20 +750,35 @@ func (p *dockerProvisioner) AddUnits(a provision.App, units uint, w io.Writer) (
 	return result, nil
 }
 
-func (p *dockerProvisioner) RemoveUnits(a provision.App, units uint) error {
+func (p *dockerProvisioner) RemoveUnits(a provision.App, units uint, process string) error {
 	if a == nil {
 		return errors.New("remove units: app should not be nil")
 	}
 	if units < 1 {
 		return errors.New("remove units: units must be at least 1")
 	}
-	containers, err := p.listContainersByAppOrderedByStatus(a.GetName())
+	allContainers, err := p.listContainersByAppOrderedByStatus(a.GetName())
 	if err != nil {
 		return err
 	}
-	if units >= uint(len(containers)) {
+	if units >= uint(len(allContainers)) {
 		return errors.New("remove units: cannot remove all units from app")
 	}
+	if process == "" {
+		process, err = provision.DefaultProcess(containersProcesses(allContainers))
+		if err != nil {
+			return err
+		}
+	}
+	var containers []container
+	for _, c := range allContainers {
+		if c.ProcessName == process {
+			containers = append(containers, c)
+		}
+	}
+	if units > uint(len(containers)) {
+		return fmt.Errorf("remove units: the process %q has only %d units", process, len(containers))
+	}
 	var wg sync.WaitGroup
 	for i := 0; i < int(units); i++ {
 		wg.Add(1)
@@ -689,16 +888,34 @@ func (p *dockerProvisioner) AdminCommands() []cmd.Command {
 		&moveContainerCmd{},
 		&moveContainersCmd{},
 		&rebalanceContainersCmd{},
+		&imageGCCmd{},
+		&setRegistryCredentialsCmd{},
+		&removeRegistryCredentialsCmd{},
+		listRegistryCredentialsCmd{},
 		&addNodeToSchedulerCmd{},
 		&removeNodeFromSchedulerCmd{},
 		&listNodesInTheSchedulerCmd{},
+		&nodeUsageCmd{},
+		cordonNodeCmd{},
+		uncordonNodeCmd{},
+		&drainNodeCmd{},
 		addPoolToSchedulerCmd{},
 		&removePoolFromSchedulerCmd{},
 		listPoolsInTheSchedulerCmd{},
+		setPoolStrategyCmd{},
+		setPoolClusterCmd{},
+		setTeamDefaultPoolCmd{},
+		&setPoolAutoScaleCmd{},
 		addTeamsToPoolCmd{},
 		removeTeamsFromPoolCmd{},
 		fixContainersCmd{},
 		&listHealingHistoryCmd{},
+		&listAutoScaleHistoryCmd{},
+		setCanaryWeightCmd{},
+		&promoteCanaryCmd{},
+		&abortCanaryCmd{},
+		&cancelDeployCmd{},
+		changeAppPoolCmd{},
 	}
 }
 
@@ -725,21 +942,30 @@ func (p *dockerProvisioner) PlatformAdd(name string, args map[string]string, w i
 	if _, err := url.ParseRequestURI(args["dockerfile"]); err != nil {
 		return errors.New("dockerfile parameter should be an url.")
 	}
-	imageName := platformImageName(name)
-	cluster := p.getCluster()
-	buildOptions := docker.BuildImageOptions{
-		Name:           imageName,
-		NoCache:        true,
-		RmTmpContainer: true,
-		Remote:         args["dockerfile"],
-		InputStream:    nil,
-		OutputStream:   w,
-	}
-	err := cluster.BuildImage(buildOptions)
-	if err != nil {
-		return err
+	for _, clusterName := range p.clusterNames() {
+		cluster, err := p.getClusterByName(clusterName)
+		if err != nil {
+			return err
+		}
+		imageName := platformImageName(clusterName, name)
+		buildOptions := docker.BuildImageOptions{
+			Name:           imageName,
+			NoCache:        true,
+			RmTmpContainer: true,
+			Remote:         args["dockerfile"],
+			InputStream:    nil,
+			OutputStream:   w,
+		}
+		err = cluster.BuildImage(buildOptions)
+		if err != nil {
+			return err
+		}
+		err = p.pushImage(clusterName, imageName, "")
+		if err != nil {
+			return err
+		}
 	}
-	return p.pushImage(imageName, "")
+	return nil
 }
 
 func (p *dockerProvisioner) PlatformUpdate(name string, args map[string]string, w io.Writer) error {
@@ -747,12 +973,21 @@ func (p *dockerProvisioner) PlatformUpdate(name string, args map[string]string,
 }
 
 func (p *dockerProvisioner) PlatformRemove(name string) error {
-	err := p.getCluster().RemoveImage(platformImageName(name))
-	if err != nil && err == docker.ErrNoSuchImage {
-		log.Errorf("error on remove image %s from docker.", name)
-		return nil
+	for _, clusterName := range p.clusterNames() {
+		cluster, err := p.getClusterByName(clusterName)
+		if err != nil {
+			return err
+		}
+		err = cluster.RemoveImage(platformImageName(clusterName, name))
+		if err != nil && err == docker.ErrNoSuchImage {
+			log.Errorf("error on remove image %s from docker.", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	return nil
 }
 
 func (p *dockerProvisioner) Units(app provision.App) []provision.Unit {
@@ -802,6 +1037,49 @@ func (p *dockerProvisioner) Shell(app provision.App, conn net.Conn, width, heigh
 	return c.shell(p, conn, conn, conn, pty{width: width, height: height})
 }
 
+// unitContainer returns the container of the unit, checking that it belongs
+// to the app.
+func (p *dockerProvisioner) unitContainer(app provision.App, unit provision.Unit) (*container, error) {
+	c, err := p.getContainer(unit.Name)
+	if err != nil {
+		return nil, err
+	}
+	if c.AppName != app.GetName() {
+		return nil, fmt.Errorf("unit %s does not belong to app %s", c.shortID(), app.GetName())
+	}
+	return c, nil
+}
+
+func (p *dockerProvisioner) DownloadUnitFiles(app provision.App, unit provision.Unit, path string, w io.Writer) error {
+	c, err := p.unitContainer(app, unit)
+	if err != nil {
+		return err
+	}
+	client, err := c.nodeClient(p)
+	if err != nil {
+		return err
+	}
+	return client.DownloadFromContainer(c.ID, docker.DownloadFromContainerOptions{
+		Path:         path,
+		OutputStream: w,
+	})
+}
+
+func (p *dockerProvisioner) UploadUnitFiles(app provision.App, unit provision.Unit, path string, r io.Reader) error {
+	c, err := p.unitContainer(app, unit)
+	if err != nil {
+		return err
+	}
+	client, err := c.nodeClient(p)
+	if err != nil {
+		return err
+	}
+	return client.UploadToContainer(c.ID, docker.UploadToContainerOptions{
+		Path:        path,
+		InputStream: r,
+	})
+}
+
 func (p *dockerProvisioner) ValidAppImages(appName string) ([]string, error) {
 	return listValidAppImages(appName)
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/docker-cluster/cluster"
 	"github.com/tsuru/docker-cluster/storage"
+	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/api/apitest"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/cmd"
@@ -53,7 +54,7 @@ func (s *S) TestProvisionerRestart(c *check.C) {
 	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
 	c.Assert(err, check.IsNil)
 	defer s.removeTestContainer(cont)
-	err = s.p.Start(app)
+	err = s.p.Start(app, "")
 	c.Assert(err, check.IsNil)
 	dockerContainer, err := s.p.getCluster().InspectContainer(cont.ID)
 	c.Assert(err, check.IsNil)
@@ -75,6 +76,53 @@ func (s *S) TestProvisionerRestart(c *check.C) {
 	c.Assert(dbConts[0].HostPort, check.Equals, expectedPort)
 }
 
+func (s *S) TestProvisionerMoveUnitsToPool(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	var buf bytes.Buffer
+	err = s.p.MoveUnitsToPool(app, "staging", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, "(?s).*---- Moving 1 units to pool staging ----.*")
+	dbConts, err := s.p.listAllContainers()
+	c.Assert(err, check.IsNil)
+	c.Assert(dbConts, check.HasLen, 1)
+	c.Assert(dbConts[0].ID, check.Not(check.Equals), cont.ID)
+	c.Assert(dbConts[0].AppName, check.Equals, app.GetName())
+}
+
+func (s *S) TestProvisionerMoveUnitsToPoolInAnotherCluster(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	pool := Pool{Name: "staging", Teams: []string{"tsuruteam"}, Cluster: "cluster1"}
+	err := coll.Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(pool.Name)
+	a := app.App{Name: "almah", Platform: "static", Pool: pool.Name}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	var buf bytes.Buffer
+	err = s.p.MoveUnitsToPool(&a, pool.Name, &buf)
+	c.Assert(err, check.Equals, errMoveAcrossClusters)
+	c.Assert(buf.String(), check.Equals, "")
+	dbConts, err := s.p.listAllContainers()
+	c.Assert(err, check.IsNil)
+	c.Assert(dbConts, check.HasLen, 1)
+	c.Assert(dbConts[0].ID, check.Equals, cont.ID)
+}
+
+func (s *S) TestProvisionerMoveUnitsToPoolWithoutUnits(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	var buf bytes.Buffer
+	err := s.p.MoveUnitsToPool(app, "staging", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "")
+}
+
 func (s *S) stopContainers(n uint) {
 	client, err := docker.NewClient(s.server.URL())
 	if err != nil {
@@ -137,6 +185,82 @@ func (s *S) TestDeploy(c *check.C) {
 	c.Assert(serviceBodies[0], check.Matches, ".*unit-host="+units[0].Ip)
 }
 
+func (s *S) TestDeployFirstUnitsFromProcfile(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/python")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/python", map[string]interface{}{
+		"procfile": "web: python app.py\nworker: python worker.py",
+	})
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("almah", "python", 0)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	err = s.p.deploy(app, "tsuru/python", nil)
+	c.Assert(err, check.IsNil)
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	count := processUnitsCount(containers)
+	c.Assert(count, check.DeepEquals, map[string]int{"web": 1, "worker": 1})
+	for _, cont := range containers {
+		hasRoute := routertest.FakeRouter.HasRoute(app.GetName(), cont.getAddress())
+		c.Assert(hasRoute, check.Equals, cont.ProcessName == "web")
+	}
+}
+
+func (s *S) TestDeployCanceled(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/python")
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("almah", "python", 0)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.RunningDeploys().Insert(bson.M{"_id": app.GetName(), "canceled": true})
+	c.Assert(err, check.IsNil)
+	defer conn.RunningDeploys().RemoveId(app.GetName())
+	err = s.p.deploy(app, "tsuru/python", nil)
+	c.Assert(err, check.Equals, action.ErrCanceled)
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+}
+
+func (s *S) TestProvisionerRestartIgnoresCanceledDeploy(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.RunningDeploys().Insert(bson.M{"_id": app.GetName(), "canceled": true})
+	c.Assert(err, check.IsNil)
+	defer conn.RunningDeploys().RemoveId(app.GetName())
+	err = s.p.Restart(app, nil)
+	c.Assert(err, check.IsNil)
+	dbConts, err := s.p.listAllContainers()
+	c.Assert(err, check.IsNil)
+	c.Assert(dbConts, check.HasLen, 1)
+	c.Assert(dbConts[0].ID, check.Not(check.Equals), cont.ID)
+}
+
+func (s *S) TestDeployCanceledFunc(c *check.C) {
+	canceled := deployCanceled("almah")
+	c.Assert(canceled(), check.Equals, false)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.RunningDeploys().Insert(bson.M{"_id": "almah", "canceled": false})
+	c.Assert(err, check.IsNil)
+	defer conn.RunningDeploys().RemoveId("almah")
+	c.Assert(canceled(), check.Equals, false)
+	err = app.CancelDeploy("almah")
+	c.Assert(err, check.IsNil)
+	c.Assert(canceled(), check.Equals, true)
+}
+
 func (s *S) TestDeployErasesOldImages(c *check.C) {
 	config.Set("docker:image-history-size", 1)
 	defer config.Unset("docker:image-history-size")
@@ -599,7 +723,7 @@ func (s *S) TestProvisionerAddUnits(c *check.C) {
 	defer s.p.Destroy(app)
 	_, err = s.newContainer(&newContainerOpts{AppName: app.GetName()})
 	c.Assert(err, check.IsNil)
-	units, err := s.p.AddUnits(app, 3, nil)
+	units, err := s.p.AddUnits(app, 3, "", nil)
 	c.Assert(err, check.IsNil)
 	coll := s.p.collection()
 	defer coll.Close()
@@ -610,6 +734,75 @@ func (s *S) TestProvisionerAddUnits(c *check.C) {
 	c.Assert(count, check.Equals, 4)
 }
 
+func (s *S) TestProvisionerAddUnitsWithProcess(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp")
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	s.p.Provision(app)
+	defer s.p.Destroy(app)
+	_, err = s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	units, err := s.p.AddUnits(app, 2, "worker", nil)
+	c.Assert(err, check.IsNil)
+	coll := s.p.collection()
+	defer coll.Close()
+	defer coll.RemoveAll(bson.M{"appname": app.GetName()})
+	c.Assert(units, check.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.ProcessName, check.Equals, "worker")
+	}
+	containers, err := s.p.listContainersByProcess(app.GetName(), "worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	for _, cont := range containers {
+		c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), check.Equals, false)
+	}
+}
+
+func (s *S) TestProvisionerAddUnitsUndeclaredProcess(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp")
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	s.p.Provision(app)
+	defer s.p.Destroy(app)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	imageId, err := appCurrentImageName(app.GetName())
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData(imageId, map[string]interface{}{
+		"procfile": "web: python app.py\nworker: python worker.py",
+	})
+	c.Assert(err, check.IsNil)
+	units, err := s.p.AddUnits(app, 1, "cron", nil)
+	c.Assert(units, check.IsNil)
+	c.Assert(err, check.ErrorMatches, `process "cron" is not declared in the Procfile`)
+}
+
+func (s *S) TestProvisionerAddUnitsDefaultProcess(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp")
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	s.p.Provision(app)
+	defer s.p.Destroy(app)
+	cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	imageId, err := appCurrentImageName(app.GetName())
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData(imageId, map[string]interface{}{
+		"procfile": "web: python app.py\nworker: python worker.py",
+	})
+	c.Assert(err, check.IsNil)
+	units, err := s.p.AddUnits(app, 1, "", nil)
+	c.Assert(err, check.IsNil)
+	coll := s.p.collection()
+	defer coll.Close()
+	defer coll.RemoveAll(bson.M{"appname": app.GetName()})
+	c.Assert(units, check.HasLen, 1)
+	c.Assert(units[0].ProcessName, check.Equals, "web")
+}
+
 func (s *S) TestProvisionerAddUnitsWithErrorDoesntLeaveLostUnits(c *check.C) {
 	callCount := 0
 	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -630,7 +823,7 @@ func (s *S) TestProvisionerAddUnitsWithErrorDoesntLeaveLostUnits(c *check.C) {
 	defer coll.Close()
 	coll.Insert(container{ID: "c-89320", AppName: app.GetName(), Version: "a345fe", Image: "tsuru/python"})
 	defer coll.RemoveId(bson.M{"id": "c-89320"})
-	_, err = s.p.AddUnits(app, 3, nil)
+	_, err = s.p.AddUnits(app, 3, "", nil)
 	c.Assert(err, check.NotNil)
 	count, err := coll.Find(bson.M{"appname": app.GetName()}).Count()
 	c.Assert(err, check.IsNil)
@@ -647,7 +840,7 @@ func (s *S) TestProvisionerAddZeroUnits(c *check.C) {
 	defer coll.Close()
 	coll.Insert(container{ID: "c-89320", AppName: app.GetName(), Version: "a345fe", Image: "tsuru/python"})
 	defer coll.RemoveId(bson.M{"id": "c-89320"})
-	units, err := s.p.AddUnits(app, 0, nil)
+	units, err := s.p.AddUnits(app, 0, "", nil)
 	c.Assert(units, check.IsNil)
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "Cannot add 0 units")
@@ -657,7 +850,7 @@ func (s *S) TestProvisionerAddUnitsWithoutContainers(c *check.C) {
 	app := provisiontest.NewFakeApp("myapp", "python", 1)
 	s.p.Provision(app)
 	defer s.p.Destroy(app)
-	units, err := s.p.AddUnits(app, 1, nil)
+	units, err := s.p.AddUnits(app, 1, "", nil)
 	c.Assert(units, check.IsNil)
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "New units can only be added after the first deployment")
@@ -680,7 +873,7 @@ func (s *S) TestProvisionerAddUnitsWithHost(c *check.C) {
 	c.Assert(err, check.IsNil)
 	units, err := addContainersWithHost(&changeUnitsPipelineArgs{
 		toHost:      "localhost",
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         app,
 		imageId:     imageId,
 		provisioner: p,
@@ -719,7 +912,7 @@ func (s *S) TestProvisionerRemoveUnits(c *check.C) {
 	app.BindUnit(&unit1)
 	app.BindUnit(&unit2)
 	app.BindUnit(&unit3)
-	err = s.p.RemoveUnits(app, 2)
+	err = s.p.RemoveUnits(app, 2, "")
 	c.Assert(err, check.IsNil)
 	_, err = s.p.getContainer(container1.ID)
 	c.Assert(err, check.NotNil)
@@ -737,23 +930,66 @@ func (s *S) TestProvisionerRemoveUnitsPriorityOrder(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer routertest.FakeRouter.RemoveBackend(container.AppName)
 	app := provisiontest.NewFakeApp(container.AppName, "python", 0)
-	_, err = s.p.AddUnits(app, 3, nil)
+	_, err = s.p.AddUnits(app, 3, "", nil)
 	c.Assert(err, check.IsNil)
-	err = s.p.RemoveUnits(app, 1)
+	err = s.p.RemoveUnits(app, 1, "")
 	c.Assert(err, check.IsNil)
 	_, err = s.p.getContainer(container.ID)
 	c.Assert(err, check.NotNil)
 	c.Assert(s.p.Units(app), check.HasLen, 3)
 }
 
+func (s *S) TestProvisionerRemoveUnitsWithProcess(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	web, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(web)
+	worker1, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "worker"})
+	c.Assert(err, check.IsNil)
+	worker2, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "worker"})
+	c.Assert(err, check.IsNil)
+	err = s.p.RemoveUnits(app, 3, "worker")
+	c.Assert(err, check.ErrorMatches, "remove units: cannot remove all units from app")
+	err = s.p.RemoveUnits(app, 2, "web")
+	c.Assert(err, check.ErrorMatches, `remove units: the process "web" has only 1 units`)
+	err = s.p.RemoveUnits(app, 2, "worker")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.getContainer(worker1.ID)
+	c.Assert(err, check.NotNil)
+	_, err = s.p.getContainer(worker2.ID)
+	c.Assert(err, check.NotNil)
+	_, err = s.p.getContainer(web.ID)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestProvisionerRemoveUnitsDefaultProcess(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	web1, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(web1)
+	web2, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(web2)
+	worker, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "worker"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(worker)
+	err = s.p.RemoveUnits(app, 1, "")
+	c.Assert(err, check.IsNil)
+	containers, err := s.p.listContainersByProcess(app.GetName(), "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 1)
+	_, err = s.p.getContainer(worker.ID)
+	c.Assert(err, check.IsNil)
+}
+
 func (s *S) TestProvisionerRemoveUnitsNotFound(c *check.C) {
-	err := s.p.RemoveUnits(nil, 1)
+	err := s.p.RemoveUnits(nil, 1, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "remove units: app should not be nil")
 }
 
 func (s *S) TestProvisionerRemoveUnitsZeroUnits(c *check.C) {
-	err := s.p.RemoveUnits(provisiontest.NewFakeApp("something", "python", 0), 0)
+	err := s.p.RemoveUnits(provisiontest.NewFakeApp("something", "python", 0), 0, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "remove units: units must be at least 1")
 }
@@ -765,9 +1001,9 @@ func (s *S) TestProvisionerRemoveUnitsTooManyUnits(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer routertest.FakeRouter.RemoveBackend(container.AppName)
 	app := provisiontest.NewFakeApp(container.AppName, "python", 0)
-	_, err = s.p.AddUnits(app, 2, nil)
+	_, err = s.p.AddUnits(app, 2, "", nil)
 	c.Assert(err, check.IsNil)
-	err = s.p.RemoveUnits(app, 3)
+	err = s.p.RemoveUnits(app, 3, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "remove units: cannot remove all units from app")
 }
@@ -944,16 +1180,34 @@ func (s *S) TestAdminCommands(c *check.C) {
 		&moveContainerCmd{},
 		&moveContainersCmd{},
 		&rebalanceContainersCmd{},
+		&imageGCCmd{},
+		&setRegistryCredentialsCmd{},
+		&removeRegistryCredentialsCmd{},
+		listRegistryCredentialsCmd{},
 		&addNodeToSchedulerCmd{},
 		&removeNodeFromSchedulerCmd{},
 		&listNodesInTheSchedulerCmd{},
+		&nodeUsageCmd{},
+		cordonNodeCmd{},
+		uncordonNodeCmd{},
+		&drainNodeCmd{},
 		addPoolToSchedulerCmd{},
 		&removePoolFromSchedulerCmd{},
 		listPoolsInTheSchedulerCmd{},
+		setPoolStrategyCmd{},
+		setPoolClusterCmd{},
+		setTeamDefaultPoolCmd{},
+		&setPoolAutoScaleCmd{},
 		addTeamsToPoolCmd{},
 		removeTeamsFromPoolCmd{},
 		fixContainersCmd{},
 		&listHealingHistoryCmd{},
+		&listAutoScaleHistoryCmd{},
+		setCanaryWeightCmd{},
+		&promoteCanaryCmd{},
+		&abortCanaryCmd{},
+		&cancelDeployCmd{},
+		changeAppPoolCmd{},
 	}
 	c.Assert(s.p.AdminCommands(), check.DeepEquals, expected)
 }
@@ -993,7 +1247,7 @@ func (s *S) TestProvisionerStart(c *check.C) {
 	dockerContainer, err := dcli.InspectContainer(container.ID)
 	c.Assert(err, check.IsNil)
 	c.Assert(dockerContainer.State.Running, check.Equals, false)
-	err = s.p.Start(app)
+	err = s.p.Start(app, "")
 	c.Assert(err, check.IsNil)
 	dockerContainer, err = dcli.InspectContainer(container.ID)
 	c.Assert(err, check.IsNil)
@@ -1018,13 +1272,36 @@ func (s *S) TestProvisionerStop(c *check.C) {
 	dockerContainer, err := dcli.InspectContainer(container.ID)
 	c.Assert(err, check.IsNil)
 	c.Assert(dockerContainer.State.Running, check.Equals, true)
-	err = s.p.Stop(app)
+	err = s.p.Stop(app, "")
 	c.Assert(err, check.IsNil)
 	dockerContainer, err = dcli.InspectContainer(container.ID)
 	c.Assert(err, check.IsNil)
 	c.Assert(dockerContainer.State.Running, check.Equals, false)
 }
 
+func (s *S) TestProvisionerStopProcess(c *check.C) {
+	dcli, _ := docker.NewClient(s.server.URL())
+	app := provisiontest.NewFakeApp("almah", "static", 2)
+	web, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(web)
+	worker, err := s.newContainer(&newContainerOpts{AppName: app.GetName(), ProcessName: "worker"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(worker)
+	err = dcli.StartContainer(web.ID, nil)
+	c.Assert(err, check.IsNil)
+	err = dcli.StartContainer(worker.ID, nil)
+	c.Assert(err, check.IsNil)
+	err = s.p.Stop(app, "worker")
+	c.Assert(err, check.IsNil)
+	dockerContainer, err := dcli.InspectContainer(web.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.State.Running, check.Equals, true)
+	dockerContainer, err = dcli.InspectContainer(worker.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.State.Running, check.Equals, false)
+}
+
 func (s *S) TestProvisionerStopSkipAlreadyStoppedContainers(c *check.C) {
 	dcli, _ := docker.NewClient(s.server.URL())
 	app := provisiontest.NewFakeApp("almah", "static", 2)
@@ -1046,7 +1323,7 @@ func (s *S) TestProvisionerStopSkipAlreadyStoppedContainers(c *check.C) {
 	dockerContainer2, err := dcli.InspectContainer(container2.ID)
 	c.Assert(err, check.IsNil)
 	c.Assert(dockerContainer2.State.Running, check.Equals, false)
-	err = s.p.Stop(app)
+	err = s.p.Stop(app, "")
 	c.Assert(err, check.IsNil)
 	dockerContainer, err = dcli.InspectContainer(container.ID)
 	c.Assert(err, check.IsNil)
@@ -1075,7 +1352,7 @@ func (s *S) TestProvisionerPlatformAdd(c *check.C) {
 	c.Assert(requests, check.HasLen, 3)
 	c.Assert(requests[0].URL.Path, check.Equals, "/build")
 	queryString := requests[0].URL.Query()
-	c.Assert(queryString.Get("t"), check.Equals, platformImageName("test"))
+	c.Assert(queryString.Get("t"), check.Equals, platformImageName("", "test"))
 	c.Assert(queryString.Get("remote"), check.Equals, "http://localhost/Dockerfile")
 	c.Assert(requests[1].URL.Path, check.Equals, "/images/localhost:3030/tsuru/test/json")
 	c.Assert(requests[2].URL.Path, check.Equals, "/images/localhost:3030/tsuru/test/push")
@@ -1392,7 +1669,7 @@ func (s *S) TestAddContainersWithHostFailsUnlessRestartAfter(c *check.C) {
 	defer s.p.Destroy(app)
 	var buf bytes.Buffer
 	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
-		unitsToAdd:  1,
+		toAdd:       map[string]int{"": 1},
 		app:         app,
 		writer:      &buf,
 		imageId:     "tsuru/app-" + a.Name,
@@ -1426,3 +1703,91 @@ func (s *S) TestShellToAnAppByAppName(c *check.C) {
 	err = s.p.Shell(app, conn, 10, 10, "")
 	c.Assert(err, check.IsNil)
 }
+
+func newArchiveProvisioner(c *check.C, handler http.HandlerFunc) (*dockerProvisioner, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	var p dockerProvisioner
+	var err error
+	p.cluster, err = cluster.New(nil, &cluster.MapStorage{},
+		cluster.Node{Address: server.URL},
+	)
+	c.Assert(err, check.IsNil)
+	return &p, server
+}
+
+func (s *S) TestDownloadUnitFiles(c *check.C) {
+	var paths []string
+	p, server := newArchiveProvisioner(c, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/containers/c-01/archive" {
+			paths = append(paths, r.URL.Query().Get("path"))
+			w.Header().Set("Content-Type", "application/x-tar")
+			w.Write([]byte("tar data"))
+		}
+	})
+	defer server.Close()
+	coll := p.collection()
+	defer coll.Close()
+	err := coll.Insert(container{ID: "c-01", AppName: "almah", HostAddr: "127.0.0.1"})
+	c.Assert(err, check.IsNil)
+	defer coll.Remove(bson.M{"id": "c-01"})
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	var buf bytes.Buffer
+	err = p.DownloadUnitFiles(app, provision.Unit{Name: "c-01"}, "/home/application/current", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "tar data")
+	c.Assert(paths, check.DeepEquals, []string{"/home/application/current"})
+}
+
+func (s *S) TestUploadUnitFiles(c *check.C) {
+	var paths []string
+	var body []byte
+	p, server := newArchiveProvisioner(c, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/containers/c-01/archive" {
+			paths = append(paths, r.URL.Query().Get("path"))
+			body, _ = ioutil.ReadAll(r.Body)
+		}
+	})
+	defer server.Close()
+	coll := p.collection()
+	defer coll.Close()
+	err := coll.Insert(container{ID: "c-01", AppName: "almah", HostAddr: "127.0.0.1"})
+	c.Assert(err, check.IsNil)
+	defer coll.Remove(bson.M{"id": "c-01"})
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	err = p.UploadUnitFiles(app, provision.Unit{Name: "c-01"}, "/tmp", strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, "tar data")
+	c.Assert(paths, check.DeepEquals, []string{"/tmp"})
+}
+
+func (s *S) TestUnitFilesUnitFromAnotherApp(c *check.C) {
+	p, server := newArchiveProvisioner(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Errorf("unexpected request to %s", r.URL.Path)
+	})
+	defer server.Close()
+	coll := p.collection()
+	defer coll.Close()
+	err := coll.Insert(container{ID: "c-01", AppName: "other", HostAddr: "127.0.0.1"})
+	c.Assert(err, check.IsNil)
+	defer coll.Remove(bson.M{"id": "c-01"})
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	var buf bytes.Buffer
+	err = p.DownloadUnitFiles(app, provision.Unit{Name: "c-01"}, "/tmp", &buf)
+	c.Assert(err, check.ErrorMatches, "unit c-01 does not belong to app almah")
+	err = p.UploadUnitFiles(app, provision.Unit{Name: "c-01"}, "/tmp", &buf)
+	c.Assert(err, check.ErrorMatches, "unit c-01 does not belong to app almah")
+}
+
+func (s *S) TestUnitFilesNodeNotFound(c *check.C) {
+	p, server := newArchiveProvisioner(c, func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	coll := p.collection()
+	defer coll.Close()
+	err := coll.Insert(container{ID: "c-01", AppName: "almah", HostAddr: "10.10.10.10"})
+	c.Assert(err, check.IsNil)
+	defer coll.Remove(bson.M{"id": "c-01"})
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	var buf bytes.Buffer
+	err = p.DownloadUnitFiles(app, provision.Unit{Name: "c-01"}, "/tmp", &buf)
+	c.Assert(err, check.ErrorMatches, "node of unit c-01 not found")
+}
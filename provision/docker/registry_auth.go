@@ -0,0 +1,262 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	errRegistryAuthSecretNotSet    = errors.New(`registry credentials require the config "docker:registry-auth:secret"`)
+	errRegistryCredentialsNotFound = errors.New("registry credentials not found")
+	errRegistryCredentialsOwner    = errors.New("registry credentials must belong to either an app or a team")
+	errRegistryCredentialsRegistry = errors.New("registry credentials require the registry")
+)
+
+// registryNotAllowedError is returned when deploying an image from a
+// registry that isn't in docker:registry-auth:allowed-registries.
+type registryNotAllowedError struct {
+	registry string
+}
+
+func (e *registryNotAllowedError) Error() string {
+	return fmt.Sprintf("images from the registry %q are not allowed", e.registry)
+}
+
+// registryCredentials are the credentials used to pull images from a private
+// registry. They belong either to an app or to a team, in which case they're
+// used by all apps of the team. The password is stored encrypted.
+type registryCredentials struct {
+	ID       string `bson:"_id" json:"-"`
+	App      string `json:",omitempty"`
+	Team     string `json:",omitempty"`
+	Registry string
+	Username string
+	Password string `json:"-"`
+}
+
+func registryCredentialsID(appName, teamName, registry string) string {
+	if appName != "" {
+		return fmt.Sprintf("app/%s/%s", appName, registry)
+	}
+	return fmt.Sprintf("team/%s/%s", teamName, registry)
+}
+
+func registryCredentialsColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_registry_credentials", name)), nil
+}
+
+// registryAuthKey returns the key used to encrypt registry passwords, derived
+// from the secret in the config.
+func registryAuthKey() ([]byte, error) {
+	secret, _ := config.GetString("docker:registry-auth:secret")
+	if secret == "" {
+		return nil, errRegistryAuthSecretNotSet
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:], nil
+}
+
+func registryAuthCipher() (cipher.AEAD, error) {
+	key, err := registryAuthKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptRegistryPassword(password string) (string, error) {
+	gcm, err := registryAuthCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(password), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptRegistryPassword(encrypted string) (string, error) {
+	gcm, err := registryAuthCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted registry password")
+	}
+	nonce := sealed[:gcm.NonceSize()]
+	password, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// setRegistryCredentials stores the credentials, replacing the ones of the
+// same owner for the same registry.
+func setRegistryCredentials(creds registryCredentials) error {
+	if (creds.App == "") == (creds.Team == "") {
+		return errRegistryCredentialsOwner
+	}
+	if creds.Registry == "" {
+		return errRegistryCredentialsRegistry
+	}
+	password, err := encryptRegistryPassword(creds.Password)
+	if err != nil {
+		return err
+	}
+	creds.Password = password
+	creds.ID = registryCredentialsID(creds.App, creds.Team, creds.Registry)
+	coll, err := registryCredentialsColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(creds.ID, creds)
+	return err
+}
+
+func removeRegistryCredentials(appName, teamName, registry string) error {
+	if (appName == "") == (teamName == "") {
+		return errRegistryCredentialsOwner
+	}
+	coll, err := registryCredentialsColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(registryCredentialsID(appName, teamName, registry))
+	if err == mgo.ErrNotFound {
+		return errRegistryCredentialsNotFound
+	}
+	return err
+}
+
+// listRegistryCredentials returns all stored credentials, with their
+// passwords still encrypted.
+func listRegistryCredentials() ([]registryCredentials, error) {
+	coll, err := registryCredentialsColl()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var creds []registryCredentials
+	err = coll.Find(nil).Sort("_id").All(&creds)
+	return creds, err
+}
+
+// registryAuthForApp returns the credentials the app uses to pull images
+// from the registry. Credentials of the app take precedence over the ones of
+// its owner team. Credentials of other teams with access to the app are never
+// used. Without credentials, the returned configuration is empty.
+func registryAuthForApp(appName, registry string) (docker.AuthConfiguration, error) {
+	ids := []string{registryCredentialsID(appName, "", registry)}
+	a, err := app.GetByName(appName)
+	if err != nil {
+		return docker.AuthConfiguration{}, err
+	}
+	if a.TeamOwner != "" {
+		ids = append(ids, registryCredentialsID("", a.TeamOwner, registry))
+	}
+	coll, err := registryCredentialsColl()
+	if err != nil {
+		return docker.AuthConfiguration{}, err
+	}
+	defer coll.Close()
+	var found []registryCredentials
+	err = coll.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&found)
+	if err != nil {
+		return docker.AuthConfiguration{}, err
+	}
+	for _, id := range ids {
+		for _, creds := range found {
+			if creds.ID != id {
+				continue
+			}
+			password, err := decryptRegistryPassword(creds.Password)
+			if err != nil {
+				return docker.AuthConfiguration{}, err
+			}
+			return docker.AuthConfiguration{
+				Username:      creds.Username,
+				Password:      password,
+				ServerAddress: registry,
+			}, nil
+		}
+	}
+	return docker.AuthConfiguration{}, nil
+}
+
+// imageRegistry returns the registry of the image, which is the first
+// component of its name when it looks like a host, or an empty string for
+// images without an explicit registry.
+func imageRegistry(imageName string) string {
+	parts := strings.SplitN(imageName, "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	if parts[0] == "localhost" || strings.ContainsAny(parts[0], ".:") {
+		return parts[0]
+	}
+	return ""
+}
+
+// registryAllowed returns whether images from the registry may be deployed,
+// according to the docker:registry-auth:allowed-registries setting.
+func registryAllowed(registry string) bool {
+	allowed, _ := config.GetList("docker:registry-auth:allowed-registries")
+	for _, r := range allowed {
+		if r == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// isExternalImage returns whether the image comes from a registry other than
+// the one tsuru stores app images.
+func isExternalImage(imageName string) bool {
+	registry := imageRegistry(imageName)
+	if registry == "" {
+		return false
+	}
+	tsuruRegistry, _ := config.GetString("docker:registry")
+	return registry != tsuruRegistry
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/apitest"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestRegistryPasswordEncryption(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	encrypted, err := encryptRegistryPassword("123456")
+	c.Assert(err, check.IsNil)
+	c.Assert(encrypted, check.Not(check.Equals), "123456")
+	other, err := encryptRegistryPassword("123456")
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Not(check.Equals), encrypted)
+	password, err := decryptRegistryPassword(encrypted)
+	c.Assert(err, check.IsNil)
+	c.Assert(password, check.Equals, "123456")
+	config.Set("docker:registry-auth:secret", "other secret")
+	_, err = decryptRegistryPassword(encrypted)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestRegistryPasswordEncryptionWithoutSecret(c *check.C) {
+	_, err := encryptRegistryPassword("123456")
+	c.Assert(err, check.Equals, errRegistryAuthSecretNotSet)
+}
+
+func (s *S) TestSetRegistryCredentials(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	err := setRegistryCredentials(registryCredentials{App: "myapp", Registry: "registry.example.com", Username: "user", Password: "123456"})
+	c.Assert(err, check.IsNil)
+	err = setRegistryCredentials(registryCredentials{App: "myapp", Registry: "registry.example.com", Username: "other", Password: "654321"})
+	c.Assert(err, check.IsNil)
+	creds, err := listRegistryCredentials()
+	c.Assert(err, check.IsNil)
+	c.Assert(creds, check.HasLen, 1)
+	c.Assert(creds[0].App, check.Equals, "myapp")
+	c.Assert(creds[0].Registry, check.Equals, "registry.example.com")
+	c.Assert(creds[0].Username, check.Equals, "other")
+	c.Assert(creds[0].Password, check.Not(check.Equals), "654321")
+	password, err := decryptRegistryPassword(creds[0].Password)
+	c.Assert(err, check.IsNil)
+	c.Assert(password, check.Equals, "654321")
+}
+
+func (s *S) TestSetRegistryCredentialsInvalid(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	err := setRegistryCredentials(registryCredentials{Registry: "registry.example.com"})
+	c.Assert(err, check.Equals, errRegistryCredentialsOwner)
+	err = setRegistryCredentials(registryCredentials{App: "myapp", Team: "myteam", Registry: "registry.example.com"})
+	c.Assert(err, check.Equals, errRegistryCredentialsOwner)
+	err = setRegistryCredentials(registryCredentials{App: "myapp"})
+	c.Assert(err, check.Equals, errRegistryCredentialsRegistry)
+}
+
+func (s *S) TestRemoveRegistryCredentials(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	err := setRegistryCredentials(registryCredentials{Team: "myteam", Registry: "registry.example.com", Username: "user", Password: "123456"})
+	c.Assert(err, check.IsNil)
+	err = removeRegistryCredentials("", "myteam", "registry.example.com")
+	c.Assert(err, check.IsNil)
+	creds, err := listRegistryCredentials()
+	c.Assert(err, check.IsNil)
+	c.Assert(creds, check.HasLen, 0)
+	err = removeRegistryCredentials("", "myteam", "registry.example.com")
+	c.Assert(err, check.Equals, errRegistryCredentialsNotFound)
+}
+
+func (s *S) TestRegistryAuthForApp(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	a := app.App{Name: "myapp", TeamOwner: "owner", Teams: []string{"other", "owner"}}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer conn.Apps().Remove(bson.M{"name": a.Name})
+	authConfig, err := registryAuthForApp("myapp", "registry.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(authConfig, check.DeepEquals, docker.AuthConfiguration{})
+	err = setRegistryCredentials(registryCredentials{Team: "other", Registry: "registry.example.com", Username: "other", Password: "1"})
+	c.Assert(err, check.IsNil)
+	authConfig, err = registryAuthForApp("myapp", "registry.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(authConfig, check.DeepEquals, docker.AuthConfiguration{})
+	err = setRegistryCredentials(registryCredentials{Team: "owner", Registry: "registry.example.com", Username: "owner", Password: "2"})
+	c.Assert(err, check.IsNil)
+	authConfig, err = registryAuthForApp("myapp", "registry.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(authConfig, check.DeepEquals, docker.AuthConfiguration{Username: "owner", Password: "2", ServerAddress: "registry.example.com"})
+	err = setRegistryCredentials(registryCredentials{App: "myapp", Registry: "registry.example.com", Username: "app", Password: "3"})
+	c.Assert(err, check.IsNil)
+	authConfig, err = registryAuthForApp("myapp", "registry.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(authConfig.Username, check.Equals, "app")
+	c.Assert(authConfig.Password, check.Equals, "3")
+	authConfig, err = registryAuthForApp("myapp", "other.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(authConfig, check.DeepEquals, docker.AuthConfiguration{})
+}
+
+func (s *S) TestImageRegistry(c *check.C) {
+	var tests = []struct {
+		image    string
+		registry string
+	}{
+		{"registry.example.com/team/app:1.0", "registry.example.com"},
+		{"registry:5000/app", "registry:5000"},
+		{"localhost/app:v1", "localhost"},
+		{"tsuru/app-myapp:v1", ""},
+		{"busybox", ""},
+	}
+	for _, t := range tests {
+		c.Check(imageRegistry(t.image), check.Equals, t.registry, check.Commentf("image %s", t.image))
+	}
+}
+
+func (s *S) TestIsExternalImage(c *check.C) {
+	c.Assert(isExternalImage("registry.example.com/team/app:1.0"), check.Equals, true)
+	c.Assert(isExternalImage("tsuru/app-myapp:v1"), check.Equals, false)
+	config.Set("docker:registry", "registry.example.com")
+	defer config.Unset("docker:registry")
+	c.Assert(isExternalImage("registry.example.com/team/app:1.0"), check.Equals, false)
+}
+
+func (s *S) TestRegistryAllowed(c *check.C) {
+	c.Assert(registryAllowed("registry.example.com"), check.Equals, false)
+	config.Set("docker:registry-auth:allowed-registries", []interface{}{"registry.example.com", "localhost:5000"})
+	defer config.Unset("docker:registry-auth:allowed-registries")
+	c.Assert(registryAllowed("registry.example.com"), check.Equals, true)
+	c.Assert(registryAllowed("localhost:5000"), check.Equals, true)
+	c.Assert(registryAllowed("evil.example.com"), check.Equals, false)
+}
+
+func (s *S) TestImageDeployExternalImageRegistryNotAllowed(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python"}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer conn.Apps().Remove(bson.M{"name": a.Name})
+	var buf bytes.Buffer
+	_, err = s.p.ImageDeploy(&a, "evil.example.com/team/app:1.0", &buf)
+	c.Assert(err, check.ErrorMatches, `images from the registry "evil.example.com" are not allowed`)
+	c.Assert(buf.String(), check.Equals, "")
+}
+
+func (s *S) TestImageDeployExternalImage(c *check.C) {
+	config.Set("docker:registry-auth:secret", "my secret")
+	defer config.Unset("docker:registry-auth:secret")
+	config.Set("docker:registry-auth:allowed-registries", []interface{}{"registry.example.com"})
+	defer config.Unset("docker:registry-auth:allowed-registries")
+	h := &apitest.TestHandler{}
+	gandalfServer := repositorytest.StartGandalfTestServer(h)
+	defer gandalfServer.Close()
+	go s.stopContainers(1)
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "python",
+	}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer conn.Apps().Remove(bson.M{"name": a.Name})
+	err = setRegistryCredentials(registryCredentials{App: a.Name, Registry: "registry.example.com", Username: "user", Password: "123456"})
+	c.Assert(err, check.IsNil)
+	s.p.Provision(&a)
+	defer s.p.Destroy(&a)
+	w := safe.NewBuffer(make([]byte, 2048))
+	err = app.Deploy(app.DeployOptions{
+		App:          &a,
+		OutputStream: w,
+		Image:        "registry.example.com/team/app:1.0",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(w.String(), check.Matches, `(?s).*---- Pulling image registry.example.com/team/app:1.0 ----.*Tagging image as tsuru/app-otherapp:v1.*`)
+	units := a.Units()
+	c.Assert(units, check.HasLen, 1)
+	images, err := listValidAppImages(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(images, check.DeepEquals, []string{"tsuru/app-otherapp:v1"})
+	imageCommand, err := usesImageCommand("tsuru/app-otherapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(imageCommand, check.Equals, true)
+	cont, err := s.p.getContainer(units[0].Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(cont.Image, check.Equals, "tsuru/app-otherapp:v1")
+	c.Assert(cont.User, check.Equals, "")
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// runReleaseHook runs the commands of the release hook in tsuru.yaml once
+// per image, in a one-off container created from the new image with the
+// environment of the app, before any unit of the new image starts. The
+// output of the commands is sent to the deploy log, and the deploy fails if
+// they exit with a non-zero status, keeping the units in the previous
+// version of the app. Images that already ran the hook, like the ones used
+// in rollbacks, don't run it again, and a canceled deploy doesn't start it.
+func (p *dockerProvisioner) runReleaseHook(app provision.App, imageId string, w io.Writer) error {
+	yamlData, err := getImageTsuruYamlDataWithFallback(imageId, app.GetName())
+	if err != nil {
+		return err
+	}
+	cmds := yamlData.Hooks.Release
+	if len(cmds) == 0 {
+		return nil
+	}
+	ran, err := releaseHookRan(imageId)
+	if err != nil {
+		return err
+	}
+	if ran {
+		fmt.Fprintf(w, "\n---- Release hook already ran for image %s, skipping ----\n", imageId)
+		return nil
+	}
+	if deployCanceled(app.GetName())() {
+		return action.ErrCanceled
+	}
+	imageCommand, err := usesImageCommand(imageId)
+	if err != nil {
+		return err
+	}
+	var user string
+	if !imageCommand {
+		user, _ = config.GetString("docker:ssh:user")
+	}
+	port, err := getPort()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n---- Running release hook ----\n")
+	opts := docker.CreateContainerOptions{
+		Config: &docker.Config{
+			Image:        imageId,
+			Cmd:          []string{"/bin/bash", "-lc", strings.Join(cmds, " && ")},
+			User:         user,
+			Env:          imageUnitEnvs(app, port),
+			AttachStdout: true,
+			AttachStderr: true,
+			Memory:       app.GetMemory(),
+			MemorySwap:   app.GetMemory() + app.GetSwap(),
+			CPUShares:    int64(app.GetCpuShare()),
+		},
+	}
+	cluster, _, err := p.clusterForApp(app.GetName())
+	if err != nil {
+		return err
+	}
+	_, cont, err := cluster.CreateContainerSchedulerOpts(opts, app.GetName())
+	if err != nil {
+		return err
+	}
+	defer cluster.RemoveContainer(docker.RemoveContainerOptions{ID: cont.ID, Force: true})
+	err = cluster.StartContainer(cont.ID, nil)
+	if err != nil {
+		return err
+	}
+	err = cluster.AttachToContainer(docker.AttachToContainerOptions{
+		Container:    cont.ID,
+		OutputStream: w,
+		ErrorStream:  w,
+		Logs:         true,
+		Stream:       true,
+		Stdout:       true,
+		Stderr:       true,
+	})
+	if err != nil {
+		return err
+	}
+	status, err := cluster.WaitContainer(cont.ID)
+	if err != nil {
+		log.Errorf("[docker] Failed to wait for release hook of app %q: %s", app.GetName(), err)
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("release hook exited with status %d", status)
+	}
+	return markReleaseHookRan(imageId)
+}
+
+func releaseHookRan(imageId string) (bool, error) {
+	coll, err := imageCustomDataColl()
+	if err != nil {
+		return false, err
+	}
+	defer coll.Close()
+	n, err := coll.Find(bson.M{"_id": imageId, "releasehookran": true}).Count()
+	return n > 0, err
+}
+
+// markReleaseHookRan records in the custom data of the image that its release
+// hook ran. Images without custom data, which take the hooks from the app,
+// aren't marked.
+func markReleaseHookRan(imageId string) error {
+	coll, err := imageCustomDataColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(imageId, bson.M{"$set": bson.M{"releasehookran": true}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestRunReleaseHook(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"hooks": map[string]interface{}{
+			"release": []string{"python manage.py migrate", "python manage.py clear_cache"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	var created []docker.Config
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+		var result docker.Config
+		err := json.Unmarshal(data, &result)
+		if err == nil {
+			created = append(created, result)
+		}
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	defer s.server.CustomHandler("/containers/create", s.server.DefaultHandler())
+	go s.stopContainers(1)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.SetEnv(bind.EnvVar{Name: "DATABASE_URL", Value: "mysql://db/myapp"})
+	var buf bytes.Buffer
+	err = s.p.runReleaseHook(a, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*---- Running release hook ----.*`)
+	c.Assert(created, check.HasLen, 1)
+	c.Assert(created[0].Image, check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(created[0].Cmd, check.DeepEquals, []string{"/bin/bash", "-lc", "python manage.py migrate && python manage.py clear_cache"})
+	c.Assert(created[0].Env, check.DeepEquals, []string{"DATABASE_URL=mysql://db/myapp", "PORT=8888"})
+	containers, err := s.p.getCluster().ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+}
+
+func (s *S) TestRunReleaseHookWithoutHook(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"hooks": map[string]interface{}{
+			"build": []string{"python manage.py collectstatic"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	var buf bytes.Buffer
+	err = s.p.runReleaseHook(a, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "")
+	containers, err := s.p.getCluster().ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+}
+
+func (s *S) TestRunReleaseHookFailure(c *check.C) {
+	s.server.PrepareFailure("failed to wait for the container", "/containers/.*/wait")
+	defer s.server.ResetFailure("failed to wait for the container")
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"hooks": map[string]interface{}{
+			"release": []string{"python manage.py migrate"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	go s.stopContainers(1)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	var buf bytes.Buffer
+	err = s.p.runReleaseHook(a, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.NotNil)
+	ran, err := releaseHookRan("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, false)
+	containers, err := s.p.getCluster().ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+}
+
+func (s *S) TestRunReleaseHookOncePerImage(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"hooks": map[string]interface{}{
+			"release": []string{"python manage.py migrate"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	var created int
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		created++
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	defer s.server.CustomHandler("/containers/create", s.server.DefaultHandler())
+	go s.stopContainers(1)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	var buf bytes.Buffer
+	err = s.p.runReleaseHook(a, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.IsNil)
+	ran, err := releaseHookRan("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, true)
+	buf.Reset()
+	err = s.p.runReleaseHook(a, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*Release hook already ran for image tsuru/app-myapp:v1, skipping.*`)
+	c.Assert(created, check.Equals, 1)
+	data, err := getImageTsuruYamlData("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(data.Hooks.Release, check.DeepEquals, []string{"python manage.py migrate"})
+}
+
+func (s *S) TestRunReleaseHookDeployCanceled(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"hooks": map[string]interface{}{
+			"release": []string{"python manage.py migrate"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.RunningDeploys().Insert(bson.M{"_id": "myapp", "canceled": true})
+	c.Assert(err, check.IsNil)
+	defer conn.RunningDeploys().RemoveId("myapp")
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	var buf bytes.Buffer
+	err = s.p.runReleaseHook(a, "tsuru/app-myapp:v1", &buf)
+	c.Assert(err, check.Equals, action.ErrCanceled)
+	c.Assert(buf.String(), check.Equals, "")
+	ran, err := releaseHookRan("tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, false)
+}
@@ -44,6 +44,16 @@ func (p *dockerProvisioner) listContainersByApp(appName string) ([]container, er
 	return p.listContainersBy(bson.M{"appname": appName})
 }
 
+// listContainersByProcess returns the containers of the app running the given
+// process, or all the containers of the app when the process is empty.
+func (p *dockerProvisioner) listContainersByProcess(appName, process string) ([]container, error) {
+	query := bson.M{"appname": appName}
+	if process != "" {
+		query["processname"] = process
+	}
+	return p.listContainersBy(query)
+}
+
 func (p *dockerProvisioner) listRunnableContainersByApp(appName string) ([]container, error) {
 	return p.listContainersBy(bson.M{
 		"appname": appName,
@@ -130,6 +140,9 @@ func (p *dockerProvisioner) listUnresponsiveContainers(maxUnresponsiveTime time.
 	return p.listContainersBy(bson.M{
 		"lastsuccessstatusupdate": bson.M{"$lt": now.Add(-maxUnresponsiveTime)},
 		"hostport":                bson.M{"$ne": ""},
-		"status":                  bson.M{"$ne": provision.StatusStopped.String()},
+		"status": bson.M{"$nin": []string{
+			provision.StatusStopped.String(),
+			provision.StatusAsleep.String(),
+		}},
 	})
 }
@@ -270,6 +270,20 @@ func (s *S) TestListUnresponsiveContainersStopped(c *check.C) {
 	c.Assert(result[0].ID, check.Equals, "c2")
 }
 
+func (s *S) TestListUnresponsiveContainersAsleep(c *check.C) {
+	coll := s.p.collection()
+	defer coll.Close()
+	now := time.Now().UTC()
+	coll.Insert(
+		container{ID: "c1", AppName: "app_time_test",
+			LastSuccessStatusUpdate: now.Add(-5 * time.Minute), HostPort: "80", Status: provision.StatusAsleep.String()},
+	)
+	defer coll.RemoveAll(bson.M{"appname": "app_time_test"})
+	result, err := s.p.listUnresponsiveContainers(3 * time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 0)
+}
+
 func (s *S) TestListRunnableContainersByApp(c *check.C) {
 	var result []container
 	coll := s.p.collection()
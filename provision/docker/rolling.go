@@ -0,0 +1,149 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+)
+
+func (p *dockerProvisioner) ValidateRollingDeploy(settings provision.TsuruYamlDeploy) error {
+	if settings.MaxSurge < 0 || settings.MaxUnavailable < 0 {
+		return fmt.Errorf("invalid rolling deploy settings: max surge and max unavailable must not be negative")
+	}
+	return nil
+}
+
+// runRollingReplaceUnits replaces the given containers with containers running
+// imageId in batches, one process at a time. In each batch, up to
+// MaxUnavailable old units are removed before starting the new ones, so at
+// most MaxSurge units run besides the original count. When a batch fails, the
+// units replaced in previous batches are replaced back with units running the
+// current image, which also happens when the deploy is canceled between
+// batches.
+func (p *dockerProvisioner) runRollingReplaceUnits(w io.Writer, a provision.App, toRemove []container, imageId string, settings provision.TsuruYamlDeploy) ([]container, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	oldImage, err := appCurrentImageName(a.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var processes []string
+	byProcess := make(map[string][]container)
+	for _, c := range toRemove {
+		if _, ok := byProcess[c.ProcessName]; !ok {
+			processes = append(processes, c.ProcessName)
+		}
+		byProcess[c.ProcessName] = append(byProcess[c.ProcessName], c)
+	}
+	batchSize := settings.MaxSurge + settings.MaxUnavailable
+	total := len(toRemove)
+	replaced := 0
+	batch := 1
+	var added []container
+	for _, process := range processes {
+		containers := byProcess[process]
+		for ; len(containers) > 0; batch++ {
+			size := batchSize
+			if size > len(containers) {
+				size = len(containers)
+			}
+			unavailable := settings.MaxUnavailable
+			if unavailable > size {
+				unavailable = size
+			}
+			fmt.Fprintf(w, "\n---- Rolling deploy: replacing units %d-%d of %d ----\n", replaced+1, replaced+size, total)
+			if unavailable > 0 {
+				args := changeUnitsPipelineArgs{
+					app:         a,
+					toRemove:    containers[:unavailable],
+					writer:      w,
+					provisioner: p,
+				}
+				pipeline := action.NewPipeline(&removeOldRoutes, &provisionRemoveOldUnits)
+				pipeline.SetCanceled(deployCanceled(a.GetName()))
+				err = pipeline.Execute(args)
+				if err != nil {
+					p.rollbackRollingDeploy(w, a, added, nil, oldImage)
+					return nil, err
+				}
+			}
+			args := changeUnitsPipelineArgs{
+				app:         a,
+				toRemove:    containers[unavailable:size],
+				toAdd:       map[string]int{process: size},
+				writer:      w,
+				imageId:     imageId,
+				provisioner: p,
+			}
+			pipeline := action.NewPipeline(
+				&provisionAddUnitsToHost,
+				&addNewRoutes,
+				&removeOldRoutes,
+				&provisionRemoveOldUnits,
+			)
+			pipeline.SetCanceled(deployCanceled(a.GetName()))
+			err = pipeline.Execute(args)
+			if err != nil {
+				fmt.Fprintf(w, "\n---- Rolling deploy failed in batch %d, rolling back ----\n", batch)
+				p.rollbackRollingDeploy(w, a, added, map[string]int{process: unavailable}, oldImage)
+				return nil, err
+			}
+			added = append(added, pipeline.Result().([]container)...)
+			containers = containers[size:]
+			replaced += size
+		}
+	}
+	args := changeUnitsPipelineArgs{
+		app:         a,
+		writer:      w,
+		imageId:     imageId,
+		provisioner: p,
+	}
+	err = action.NewPipeline(&updateAppImage).Execute(args)
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// rollbackRollingDeploy replaces the units added by a failed rolling deploy
+// with units running oldImage, also starting missing units to replace the
+// ones removed in the failed batch.
+func (p *dockerProvisioner) rollbackRollingDeploy(w io.Writer, a provision.App, added []container, missing map[string]int, oldImage string) {
+	toAdd := processUnitsCount(added)
+	for process, n := range missing {
+		if n > 0 {
+			toAdd[process] += n
+		}
+	}
+	if len(toAdd) == 0 {
+		return
+	}
+	args := changeUnitsPipelineArgs{
+		app:         a,
+		toRemove:    added,
+		toAdd:       toAdd,
+		writer:      w,
+		imageId:     oldImage,
+		provisioner: p,
+	}
+	pipeline := action.NewPipeline(
+		&provisionAddUnitsToHost,
+		&addNewRoutes,
+		&removeOldRoutes,
+		&provisionRemoveOldUnits,
+	)
+	err := pipeline.Execute(args)
+	if err != nil {
+		log.Errorf("Unable to roll back rolling deploy of app %s: %s", a.GetName(), err)
+	}
+}
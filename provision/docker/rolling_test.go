@@ -0,0 +1,116 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// rollingApp is an app carrying rolling deploy settings, like the ones given
+// by the app package to rolling deploys.
+type rollingApp struct {
+	*provisiontest.FakeApp
+	settings provision.TsuruYamlDeploy
+}
+
+func (a *rollingApp) RollingDeploy() provision.TsuruYamlDeploy {
+	return a.settings
+}
+
+func (s *S) TestValidateRollingDeploy(c *check.C) {
+	err := s.p.ValidateRollingDeploy(provision.TsuruYamlDeploy{MaxSurge: 2, MaxUnavailable: 1})
+	c.Assert(err, check.IsNil)
+	err = s.p.ValidateRollingDeploy(provision.TsuruYamlDeploy{MaxSurge: -1})
+	c.Assert(err, check.NotNil)
+	err = s.p.ValidateRollingDeploy(provision.TsuruYamlDeploy{MaxUnavailable: -1})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestDeployRolling(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	var oldConts []container
+	for i := 0; i < 3; i++ {
+		cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+		c.Assert(err, check.IsNil)
+		defer s.removeTestContainer(cont)
+		oldConts = append(oldConts, *cont)
+	}
+	var buf bytes.Buffer
+	err := s.p.deploy(&rollingApp{app, provision.TsuruYamlDeploy{MaxSurge: 2}}, "tsuru/python", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, "(?s).*Rolling deploy: replacing units 1-2 of 3.*Rolling deploy: replacing units 3-3 of 3.*")
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 3)
+	for _, cont := range containers {
+		c.Assert(cont.Image, check.Equals, "tsuru/python")
+		c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), check.Equals, true)
+	}
+	for _, cont := range oldConts {
+		c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), check.Equals, false)
+	}
+	imageId, err := appCurrentImageName(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(imageId, check.Equals, "tsuru/python")
+}
+
+func (s *S) TestDeployRollingMaxUnavailable(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	for i := 0; i < 2; i++ {
+		cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+		c.Assert(err, check.IsNil)
+		defer s.removeTestContainer(cont)
+	}
+	var buf bytes.Buffer
+	err := s.p.deploy(&rollingApp{app, provision.TsuruYamlDeploy{MaxUnavailable: 1}}, "tsuru/python", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, "(?s).*Rolling deploy: replacing units 1-1 of 2.*Rolling deploy: replacing units 2-2 of 2.*")
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	for _, cont := range containers {
+		c.Assert(cont.Image, check.Equals, "tsuru/python")
+	}
+}
+
+func (s *S) TestRunRollingReplaceUnitsDeployCanceled(c *check.C) {
+	app := provisiontest.NewFakeApp("almah", "static", 1)
+	var oldConts []container
+	for i := 0; i < 2; i++ {
+		cont, err := s.newContainer(&newContainerOpts{AppName: app.GetName()})
+		c.Assert(err, check.IsNil)
+		defer s.removeTestContainer(cont)
+		oldConts = append(oldConts, *cont)
+	}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.RunningDeploys().Insert(bson.M{"_id": app.GetName(), "canceled": true})
+	c.Assert(err, check.IsNil)
+	defer conn.RunningDeploys().RemoveId(app.GetName())
+	var buf bytes.Buffer
+	_, err = s.p.runRollingReplaceUnits(&buf, app, oldConts, "tsuru/python", provision.TsuruYamlDeploy{MaxSurge: 1})
+	c.Assert(err, check.Equals, action.ErrCanceled)
+	containers, err := s.p.listContainersByApp(app.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	ids := []string{containers[0].ID, containers[1].ID}
+	sort.Strings(ids)
+	oldIds := []string{oldConts[0].ID, oldConts[1].ID}
+	sort.Strings(oldIds)
+	c.Assert(ids, check.DeepEquals, oldIds)
+	for _, cont := range oldConts {
+		c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont.getAddress()), check.Equals, true)
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -22,7 +21,9 @@ import (
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"launchpad.net/gnuflag"
 )
 
 // errNoFallback is the error returned when no fallback hosts are configured in
@@ -32,20 +33,55 @@ var errNoFallback = errors.New("No fallback configured in the scheduler: you sho
 const schedulerCollection = "docker_scheduler"
 
 type Pool struct {
-	Name  string `bson:"_id"`
-	Teams []string
+	Name     string `bson:"_id"`
+	Teams    []string
+	Strategy string `bson:",omitempty" json:",omitempty"`
+	Cluster  string `bson:",omitempty" json:",omitempty"`
+	// DefaultTeams are the teams that have this pool as their default
+	// pool, used by apps created without a pool.
+	DefaultTeams []string `bson:",omitempty" json:",omitempty"`
+	// AutoScale holds the limits used to add and remove nodes of the pool
+	// automatically.
+	AutoScale *PoolAutoScale `bson:",omitempty" json:",omitempty"`
+}
+
+// allowsTeam returns whether apps of the team may run in the pool. Pools
+// without teams are available to all teams.
+func (p *Pool) allowsTeam(team string) bool {
+	if len(p.Teams) == 0 {
+		return true
+	}
+	for _, t := range p.Teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
 }
 
 type segregatedScheduler struct {
-	maxMemoryRatio      float32
-	totalMemoryMetadata string
-	provisioner         *dockerProvisioner
+	maxMemoryRatio        float32
+	totalMemoryMetadata   string
+	totalCpuShareMetadata string
+	zoneMetadata          string
+	provisioner           *dockerProvisioner
 }
 
 func (s segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateContainerOptions, schedulerOpts cluster.SchedulerOptions) (cluster.Node, error) {
 	appName, _ := schedulerOpts.(string)
 	a, _ := app.GetByName(appName)
-	nodes, err := nodesForApp(c, a)
+	pool, nodes, err := nodesForApp(c, a)
+	if err != nil {
+		return cluster.Node{}, err
+	}
+	nodes, err = filterCordonedNodes(nodes)
+	if err != nil {
+		return cluster.Node{}, err
+	}
+	if len(nodes) == 0 {
+		return cluster.Node{}, fmt.Errorf("All nodes available for %q are cordoned.", appName)
+	}
+	nodes, err = s.filterByVolumes(nodes, appName, pool)
 	if err != nil {
 		return cluster.Node{}, err
 	}
@@ -53,7 +89,15 @@ func (s segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCont
 	if err != nil {
 		return cluster.Node{}, err
 	}
-	node, err := s.chooseNode(nodes, opts.Name, appName)
+	nodes, err = s.filterByZone(nodes, appName)
+	if err != nil {
+		return cluster.Node{}, err
+	}
+	strategy, err := getSchedulingStrategy(pool.Strategy)
+	if err != nil {
+		return cluster.Node{}, err
+	}
+	node, err := s.chooseNodeWithStrategy(strategy, nodes, opts.Name, appName)
 	if err != nil {
 		return cluster.Node{}, err
 	}
@@ -64,22 +108,10 @@ func (s segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.Nod
 	if maxMemoryRatio == 0 || totalMemoryMetadata == "" {
 		return nodes, nil
 	}
-	hosts := make([]string, len(nodes))
-	for i := range nodes {
-		hosts[i] = urlToHost(nodes[i].Address)
-	}
-	containers, err := s.provisioner.listContainersBy(bson.M{"hostaddr": bson.M{"$in": hosts}})
+	hostReserved, err := s.reservedMemoryByHost(nodes)
 	if err != nil {
 		return nil, err
 	}
-	hostReserved := make(map[string]int64)
-	for _, cont := range containers {
-		a, err := app.GetByName(cont.AppName)
-		if err != nil {
-			return nil, err
-		}
-		hostReserved[cont.HostAddr] += a.Plan.Memory
-	}
 	megabyte := float64(1024 * 1024)
 	nodeList := make([]cluster.Node, 0, len(nodes))
 	for _, node := range nodes {
@@ -110,6 +142,28 @@ func (s segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.Nod
 	return nodeList, nil
 }
 
+// reservedMemoryByHost returns the memory reserved by the plans of the apps
+// of the containers running in each node, keyed by the host of the node.
+func (s segregatedScheduler) reservedMemoryByHost(nodes []cluster.Node) (map[string]int64, error) {
+	hosts := make([]string, len(nodes))
+	for i := range nodes {
+		hosts[i] = urlToHost(nodes[i].Address)
+	}
+	containers, err := s.provisioner.listContainersBy(bson.M{"hostaddr": bson.M{"$in": hosts}})
+	if err != nil {
+		return nil, err
+	}
+	hostReserved := make(map[string]int64)
+	for _, cont := range containers {
+		a, err := app.GetByName(cont.AppName)
+		if err != nil {
+			return nil, err
+		}
+		hostReserved[cont.HostAddr] += a.Plan.Memory
+	}
+	return hostReserved, nil
+}
+
 type nodeAggregate struct {
 	HostAddr string `bson:"_id"`
 	Count    int
@@ -149,44 +203,35 @@ func (s segregatedScheduler) aggregateContainersByHostApp(hosts []string, appNam
 // chooseNode finds which is the node with the minimum number
 // of containers and returns it
 func (s segregatedScheduler) chooseNode(nodes []cluster.Node, contName string, appName string) (string, error) {
+	return s.chooseNodeWithStrategy(spreadStrategy{}, nodes, contName, appName)
+}
+
+// chooseNodeWithStrategy finds the node for the container using the given
+// strategy and sets it as the host of the container.
+func (s segregatedScheduler) chooseNodeWithStrategy(strategy schedulingStrategy, nodes []cluster.Node, contName string, appName string) (string, error) {
 	var chosenNode string
 	hosts := make([]string, len(nodes))
-	hostsMap := make(map[string]string)
+	hostsMap := make(map[string]cluster.Node)
 	// Only hostname is saved in the docker containers collection
 	// so we need to extract and map then to the original node.
 	for i, node := range nodes {
 		host := urlToHost(node.Address)
 		hosts[i] = host
-		hostsMap[host] = node.Address
+		hostsMap[host] = node
 	}
 	log.Debugf("[scheduler] Possible nodes for container %s: %#v", contName, hosts)
 	hostMutex.Lock()
 	defer hostMutex.Unlock()
-	hostCountMap, err := s.aggregateContainersByHost(hosts)
-	if err != nil {
-		return chosenNode, err
-	}
-	appCountMap, err := s.aggregateContainersByHostApp(hosts, appName)
+	host, err := strategy.chooseHost(s, appName, hosts, hostsMap)
 	if err != nil {
 		return chosenNode, err
 	}
-	// Finally finding the host with the minimum value for
-	// the pair [appCount, hostCount]
-	var minHost string
-	minCount := math.MaxInt32
-	for _, host := range hosts {
-		adjCount := appCountMap[host]*10000 + hostCountMap[host]
-		if adjCount < minCount {
-			minCount = adjCount
-			minHost = host
-		}
-	}
-	chosenNode = hostsMap[minHost]
-	log.Debugf("[scheduler] Chosen node for container %s: %#v Count: %d", contName, chosenNode, minCount)
+	chosenNode = hostsMap[host].Address
+	log.Debugf("[scheduler] Chosen node for container %s: %#v", contName, chosenNode)
 	if contName != "" {
 		coll := s.provisioner.collection()
 		defer coll.Close()
-		err = coll.Update(bson.M{"name": contName}, bson.M{"$set": bson.M{"hostaddr": minHost}})
+		err = coll.Update(bson.M{"name": contName}, bson.M{"$set": bson.M{"hostaddr": host}})
 	}
 	return chosenNode, err
 }
@@ -199,6 +244,16 @@ func poolsForApp(app *app.App) ([]Pool, error) {
 		return nil, err
 	}
 	defer conn.Close()
+	if app != nil && app.Pool != "" {
+		err = conn.Collection(schedulerCollection).FindId(app.Pool).All(&pools)
+		if err != nil {
+			return nil, err
+		}
+		if len(pools) == 0 {
+			return nil, fmt.Errorf("pool %q of app %q not found", app.Pool, app.Name)
+		}
+		return pools, nil
+	}
 	if app != nil {
 		if app.TeamOwner != "" {
 			query = bson.M{"teams": app.TeamOwner}
@@ -220,18 +275,24 @@ func poolsForApp(app *app.App) ([]Pool, error) {
 	return pools, nil
 }
 
-func nodesForApp(c *cluster.Cluster, app *app.App) ([]cluster.Node, error) {
+// nodesForApp returns the first pool of the app that has nodes, along with
+// its nodes.
+func nodesForApp(c *cluster.Cluster, app *app.App) (*Pool, []cluster.Node, error) {
 	pools, err := poolsForApp(app)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	for _, pool := range pools {
+	for i, pool := range pools {
+		// the units of an app run in the cluster of its first pool
+		if pool.Cluster != pools[0].Cluster {
+			continue
+		}
 		nodes, err := c.NodesForMetadata(map[string]string{"pool": pool.Name})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if len(nodes) > 0 {
-			return nodes, nil
+			return &pools[i], nodes, nil
 		}
 	}
 	var nameList []string
@@ -239,7 +300,7 @@ func nodesForApp(c *cluster.Cluster, app *app.App) ([]cluster.Node, error) {
 		nameList = append(nameList, pool.Name)
 	}
 	poolsStr := strings.Join(nameList, ", pool=")
-	return nil, fmt.Errorf("No nodes found with one of the following metadata: pool=%s", poolsStr)
+	return nil, nil, fmt.Errorf("No nodes found with one of the following metadata: pool=%s", poolsStr)
 }
 
 func (segregatedScheduler) addPool(poolName string) error {
@@ -291,7 +352,108 @@ func (segregatedScheduler) removeTeamsFromPool(poolName string, teams []string)
 		return err
 	}
 	defer conn.Close()
-	return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$pullAll": bson.M{"teams": teams}})
+	return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$pullAll": bson.M{"teams": teams, "defaultteams": teams}})
+}
+
+// ValidateAppPool checks whether apps of the team may run in the pool. An
+// empty pool selects the default pool of the team, if there's one.
+func (p *dockerProvisioner) ValidateAppPool(team, poolName string) (string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	coll := conn.Collection(schedulerCollection)
+	var pool Pool
+	if poolName == "" {
+		err = coll.Find(bson.M{"defaultteams": team}).One(&pool)
+		if err == mgo.ErrNotFound {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return pool.Name, nil
+	}
+	err = coll.FindId(poolName).One(&pool)
+	if err == mgo.ErrNotFound {
+		return "", fmt.Errorf("pool %q not found", poolName)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !pool.allowsTeam(team) {
+		return "", fmt.Errorf("team %q is not allowed to use pool %q", team, poolName)
+	}
+	return pool.Name, nil
+}
+
+// AppPool returns the pool of the app or, for apps without a pool, the first
+// pool of its teams that has nodes, falling back to the public pools, just
+// like the scheduler does when choosing the nodes of new units.
+func (p *dockerProvisioner) AppPool(a provision.App) (string, error) {
+	dbApp, err := app.GetByName(a.GetName())
+	if err != nil {
+		return "", err
+	}
+	if dbApp.Pool != "" {
+		return dbApp.Pool, nil
+	}
+	cluster, _, err := p.clusterForApp(dbApp.Name)
+	if err != nil {
+		return "", err
+	}
+	pool, _, err := nodesForApp(cluster, dbApp)
+	if err != nil {
+		return "", err
+	}
+	return pool.Name, nil
+}
+
+// setTeamDefaultPool makes the pool the default pool of the team, replacing
+// its previous default pool. Only pools the team may use can be its default
+// pool.
+func (segregatedScheduler) setTeamDefaultPool(poolName, team string) error {
+	if team == "" {
+		return errors.New("Team name is required.")
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection(schedulerCollection)
+	var pool Pool
+	err = coll.FindId(poolName).One(&pool)
+	if err != nil {
+		return err
+	}
+	if !pool.allowsTeam(team) {
+		return fmt.Errorf("team %q is not allowed to use pool %q", team, poolName)
+	}
+	_, err = coll.UpdateAll(bson.M{"defaultteams": team}, bson.M{"$pull": bson.M{"defaultteams": team}})
+	if err != nil {
+		return err
+	}
+	return coll.UpdateId(poolName, bson.M{"$addToSet": bson.M{"defaultteams": team}})
+}
+
+// setPoolStrategy changes the scheduling strategy used to choose the nodes
+// of the pool for new containers. An empty strategy means the default one.
+func (segregatedScheduler) setPoolStrategy(poolName, strategy string) error {
+	_, err := getSchedulingStrategy(strategy)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if strategy == "" {
+		return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$unset": bson.M{"strategy": ""}})
+	}
+	return conn.Collection(schedulerCollection).UpdateId(poolName, bson.M{"$set": bson.M{"strategy": strategy}})
 }
 
 type addPoolToSchedulerCmd struct{}
@@ -374,7 +536,7 @@ func (listPoolsInTheSchedulerCmd) Info() *cmd.Info {
 }
 
 func (listPoolsInTheSchedulerCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
-	t := cmd.Table{Headers: cmd.Row([]string{"Pools", "Teams"})}
+	t := cmd.Table{Headers: cmd.Row([]string{"Pools", "Teams", "Strategy", "Cluster"})}
 	url, err := cmd.GetURL("/docker/pool")
 	if err != nil {
 		return err
@@ -392,13 +554,207 @@ func (listPoolsInTheSchedulerCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	var pools []Pool
 	err = json.Unmarshal(body, &pools)
 	for _, p := range pools {
-		t.AddRow(cmd.Row([]string{p.Name, strings.Join(p.Teams, ", ")}))
+		strategy := p.Strategy
+		if strategy == "" {
+			strategy = defaultSchedulingStrategy
+		}
+		teams := make([]string, len(p.Teams))
+		for i, team := range p.Teams {
+			teams[i] = team
+			for _, defaultTeam := range p.DefaultTeams {
+				if team == defaultTeam {
+					teams[i] = team + " (default)"
+				}
+			}
+		}
+		t.AddRow(cmd.Row([]string{p.Name, strings.Join(teams, ", "), strategy, p.Cluster}))
 	}
 	t.Sort()
 	ctx.Stdout.Write(t.Bytes())
 	return nil
 }
 
+type setPoolStrategyCmd struct{}
+
+func (setPoolStrategyCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-pool-strategy-set",
+		Usage: "docker-pool-strategy-set <pool> <strategy>",
+		Desc: `Set the strategy used to choose the node of the pool for new units.
+
+Available strategies:
+  spread      Spreads the units of each app across the nodes, using the total
+              number of units in each node to break ties. This is the default.
+  spread-app  Avoids putting two units of the same app in the same node,
+              falling back to the least used node when every node already
+              has units of the app.
+  binpack     Fills the nodes before using new ones, considering the memory
+              and CPU share of the plans against the node capacity metadata.`,
+		MinArgs: 2,
+	}
+}
+
+func (setPoolStrategyCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	body, err := json.Marshal(map[string]string{"pool": ctx.Args[0], "strategy": ctx.Args[1]})
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/pool/strategy")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Pool strategy successfully set.\n"))
+	return nil
+}
+
+type setPoolClusterCmd struct{}
+
+func (setPoolClusterCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-pool-cluster-set",
+		Usage: "docker-pool-cluster-set <pool> [cluster]",
+		Desc: `Assign the pool to one of the clusters declared in docker:clusters. Omit
+the cluster to assign the pool back to the default cluster.
+
+Only pools without nodes can be assigned to another cluster.`,
+		MinArgs: 1,
+	}
+}
+
+func (setPoolClusterCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	var clusterName string
+	if len(ctx.Args) > 1 {
+		clusterName = ctx.Args[1]
+	}
+	body, err := json.Marshal(map[string]string{"pool": ctx.Args[0], "cluster": clusterName})
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/pool/cluster")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Pool cluster successfully set.\n"))
+	return nil
+}
+
+type setTeamDefaultPoolCmd struct{}
+
+func (setTeamDefaultPoolCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-pool-default-set",
+		Usage: "docker-pool-default-set <pool> <team>",
+		Desc: `Set the default pool of the team, used by apps of the team created without
+a pool.`,
+		MinArgs: 2,
+	}
+}
+
+func (setTeamDefaultPoolCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	body, err := json.Marshal(map[string]string{"pool": ctx.Args[0], "team": ctx.Args[1]})
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/pool/default")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Default pool successfully set.\n"))
+	return nil
+}
+
+type setPoolAutoScaleCmd struct {
+	fs             *gnuflag.FlagSet
+	template       string
+	minNodes       int
+	maxNodes       int
+	scaleUpRatio   float64
+	scaleDownRatio float64
+	disable        bool
+}
+
+func (c *setPoolAutoScaleCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-pool-autoscale-set",
+		Usage: "docker-pool-autoscale-set <pool> [-t/--template name] [--min nodes] [--max nodes] [--scale-up ratio] [--scale-down ratio] [--disable]",
+		Desc: `Set the limits used to add and remove nodes of the pool automatically.
+
+New nodes are created from the IaaS template when the memory reserved by the
+units in the pool goes above the scale up ratio of the memory available to
+units in its nodes. Nodes created by an IaaS are drained and destroyed when the
+memory usage goes below the scale down ratio. A max of 0 means no limit.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *setPoolAutoScaleCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	params := map[string]string{"pool": ctx.Args[0], "enabled": strconv.FormatBool(!c.disable)}
+	if !c.disable {
+		params["template"] = c.template
+		params["min"] = strconv.Itoa(c.minNodes)
+		params["max"] = strconv.Itoa(c.maxNodes)
+		params["scale-up"] = strconv.FormatFloat(c.scaleUpRatio, 'f', -1, 64)
+		params["scale-down"] = strconv.FormatFloat(c.scaleDownRatio, 'f', -1, 64)
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetURL("/docker/pool/autoscale")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Pool auto scale successfully set.\n"))
+	return nil
+}
+
+func (c *setPoolAutoScaleCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		template := "IaaS template used to create new nodes"
+		c.fs.StringVar(&c.template, "template", "", template)
+		c.fs.StringVar(&c.template, "t", "", template)
+		c.fs.IntVar(&c.minNodes, "min", 0, "Minimum number of nodes in the pool")
+		c.fs.IntVar(&c.maxNodes, "max", 0, "Maximum number of nodes in the pool")
+		c.fs.Float64Var(&c.scaleUpRatio, "scale-up", 0.8, "Memory usage ratio above which a node is added")
+		c.fs.Float64Var(&c.scaleDownRatio, "scale-down", 0.4, "Memory usage ratio below which a node is removed")
+		c.fs.BoolVar(&c.disable, "disable", false, "Disable the auto scaling of the pool")
+	}
+	return c.fs
+}
+
 type addTeamsToPoolCmd struct{}
 
 func (addTeamsToPoolCmd) Info() *cmd.Info {
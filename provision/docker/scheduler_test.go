@@ -457,6 +457,191 @@ func (s *S) TestRemoveTeamsFromPool(c *check.C) {
 	c.Assert(p.Teams, check.DeepEquals, []string{"ateam"})
 }
 
+func (s *S) TestRemoveTeamsFromPoolRemovesDefaultTeams(c *check.C) {
+	var seg segregatedScheduler
+	coll := s.storage.Collection(schedulerCollection)
+	pool := Pool{Name: "pool1", Teams: []string{"test", "ateam"}, DefaultTeams: []string{"test"}}
+	err := coll.Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(pool.Name)
+	err = seg.removeTeamsFromPool(pool.Name, []string{"test"})
+	c.Assert(err, check.IsNil)
+	var p Pool
+	err = coll.FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.DefaultTeams, check.HasLen, 0)
+}
+
+func (s *S) TestSetTeamDefaultPool(c *check.C) {
+	var seg segregatedScheduler
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(
+		Pool{Name: "prod", Teams: []string{"ateam"}, DefaultTeams: []string{"ateam"}},
+		Pool{Name: "staging", Teams: []string{"ateam"}},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": bson.M{"$in": []string{"prod", "staging"}}})
+	err = seg.setTeamDefaultPool("staging", "ateam")
+	c.Assert(err, check.IsNil)
+	var prod, staging Pool
+	err = coll.FindId("prod").One(&prod)
+	c.Assert(err, check.IsNil)
+	c.Assert(prod.DefaultTeams, check.HasLen, 0)
+	err = coll.FindId("staging").One(&staging)
+	c.Assert(err, check.IsNil)
+	c.Assert(staging.DefaultTeams, check.DeepEquals, []string{"ateam"})
+}
+
+func (s *S) TestSetTeamDefaultPoolTeamNotAllowed(c *check.C) {
+	var seg segregatedScheduler
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(Pool{Name: "prod", Teams: []string{"ateam"}})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("prod")
+	err = seg.setTeamDefaultPool("prod", "bteam")
+	c.Assert(err, check.ErrorMatches, `team "bteam" is not allowed to use pool "prod"`)
+}
+
+func (s *S) TestValidateAppPool(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(
+		Pool{Name: "prod", Teams: []string{"ateam"}},
+		Pool{Name: "staging", Teams: []string{"ateam"}, DefaultTeams: []string{"ateam"}},
+		Pool{Name: "public"},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": bson.M{"$in": []string{"prod", "staging", "public"}}})
+	pool, err := s.p.ValidateAppPool("ateam", "prod")
+	c.Assert(err, check.IsNil)
+	c.Assert(pool, check.Equals, "prod")
+	pool, err = s.p.ValidateAppPool("ateam", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(pool, check.Equals, "staging")
+	pool, err = s.p.ValidateAppPool("bteam", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(pool, check.Equals, "")
+	pool, err = s.p.ValidateAppPool("bteam", "public")
+	c.Assert(err, check.IsNil)
+	c.Assert(pool, check.Equals, "public")
+	_, err = s.p.ValidateAppPool("bteam", "prod")
+	c.Assert(err, check.ErrorMatches, `team "bteam" is not allowed to use pool "prod"`)
+	_, err = s.p.ValidateAppPool("ateam", "unknown")
+	c.Assert(err, check.ErrorMatches, `pool "unknown" not found`)
+}
+
+func (s *S) TestAppPool(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(
+		Pool{Name: "empty", Teams: []string{"ateam"}},
+		Pool{Name: "prod", Teams: []string{"ateam"}},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": bson.M{"$in": []string{"empty", "prod"}}})
+	_, err = s.p.getCluster().Register("http://url0:1234", map[string]string{"pool": "prod"})
+	c.Assert(err, check.IsNil)
+	a1 := app.App{Name: "impius", TeamOwner: "ateam"}
+	a2 := app.App{Name: "mirror", TeamOwner: "ateam", Pool: "empty"}
+	err = s.storage.Apps().Insert(a1, a2)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": bson.M{"$in": []string{a1.Name, a2.Name}}})
+	pool, err := s.p.AppPool(&a1)
+	c.Assert(err, check.IsNil)
+	c.Assert(pool, check.Equals, "prod")
+	pool, err = s.p.AppPool(&a2)
+	c.Assert(err, check.IsNil)
+	c.Assert(pool, check.Equals, "empty")
+}
+
+func (s *S) TestPoolsForAppWithPool(c *check.C) {
+	coll := s.storage.Collection(schedulerCollection)
+	err := coll.Insert(
+		Pool{Name: "prod", Teams: []string{"ateam"}},
+		Pool{Name: "staging", Teams: []string{"ateam"}},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": bson.M{"$in": []string{"prod", "staging"}}})
+	pools, err := poolsForApp(&app.App{Name: "myapp", TeamOwner: "ateam", Pool: "staging"})
+	c.Assert(err, check.IsNil)
+	c.Assert(pools, check.HasLen, 1)
+	c.Assert(pools[0].Name, check.Equals, "staging")
+	_, err = poolsForApp(&app.App{Name: "myapp", TeamOwner: "ateam", Pool: "unknown"})
+	c.Assert(err, check.ErrorMatches, `pool "unknown" of app "myapp" not found`)
+}
+
+func (s *S) TestSetTeamDefaultPoolCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"pool1", "ateam"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]string
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, check.IsNil)
+			c.Assert(params, check.DeepEquals, map[string]string{"pool": "pool1", "team": "ateam"})
+			return req.URL.Path == "/docker/pool/default" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := setTeamDefaultPoolCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Default pool successfully set.\n")
+}
+
+func (s *S) TestSetPoolAutoScaleCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"pool1"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]string
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, check.IsNil)
+			c.Assert(params, check.DeepEquals, map[string]string{
+				"pool":       "pool1",
+				"enabled":    "true",
+				"template":   "tpl1",
+				"min":        "1",
+				"max":        "4",
+				"scale-up":   "0.9",
+				"scale-down": "0.4",
+			})
+			return req.URL.Path == "/docker/pool/autoscale" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := setPoolAutoScaleCmd{}
+	err := command.Flags().Parse(true, []string{"-t", "tpl1", "--min", "1", "--max", "4", "--scale-up", "0.9"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Pool auto scale successfully set.\n")
+}
+
+func (s *S) TestSetPoolAutoScaleCmdRunDisable(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"pool1"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]string
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, check.IsNil)
+			c.Assert(params, check.DeepEquals, map[string]string{"pool": "pool1", "enabled": "false"})
+			return req.URL.Path == "/docker/pool/autoscale" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := setPoolAutoScaleCmd{}
+	err := command.Flags().Parse(true, []string{"--disable"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Pool auto scale successfully set.\n")
+}
+
 func (s *S) TestAddPoolToSchedulerCmdInfo(c *check.C) {
 	expected := cmd.Info{
 		Name:    "docker-pool-add",
@@ -525,6 +710,46 @@ func (s *S) TestRemovePoolFromTheSchedulerCmdConfirmation(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, "Are you sure you want to remove \"poolX\" pool? (y/n) Abort.\n")
 }
 
+func (s *S) TestSetPoolStrategyCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"pool1", "binpack"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]string
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, check.IsNil)
+			c.Assert(params, check.DeepEquals, map[string]string{"pool": "pool1", "strategy": "binpack"})
+			return req.URL.Path == "/docker/pool/strategy" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := setPoolStrategyCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Pool strategy successfully set.\n")
+}
+
+func (s *S) TestSetPoolClusterCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"pool1", "cluster1"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]string
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, check.IsNil)
+			c.Assert(params, check.DeepEquals, map[string]string{"pool": "pool1", "cluster": "cluster1"})
+			return req.URL.Path == "/docker/pool/cluster" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := setPoolClusterCmd{}.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Pool cluster successfully set.\n")
+}
+
 func (s *S) TestListPoolsInTheSchedulerCmdInfo(c *check.C) {
 	expected := cmd.Info{
 		Name:  "docker-pool-list",
@@ -537,8 +762,9 @@ func (s *S) TestListPoolsInTheSchedulerCmdInfo(c *check.C) {
 
 func (s *S) TestListPoolsInTheSchedulerCmdRun(c *check.C) {
 	var buf bytes.Buffer
-	pool := Pool{Name: "pool1", Teams: []string{"tsuruteam", "ateam"}}
-	pools := []Pool{pool}
+	pool := Pool{Name: "pool1", Teams: []string{"tsuruteam", "ateam"}, DefaultTeams: []string{"ateam"}}
+	pool2 := Pool{Name: "pool2", Strategy: "binpack", Cluster: "cluster1"}
+	pools := []Pool{pool, pool2}
 	poolsJson, _ := json.Marshal(pools)
 	ctx := cmd.Context{Stdout: &buf}
 	trans := &cmdtest.ConditionalTransport{
@@ -551,11 +777,12 @@ func (s *S) TestListPoolsInTheSchedulerCmdRun(c *check.C) {
 	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
 	err := listPoolsInTheSchedulerCmd{}.Run(&ctx, client)
 	c.Assert(err, check.IsNil)
-	expected := `+-------+------------------+
-| Pools | Teams            |
-+-------+------------------+
-| pool1 | tsuruteam, ateam |
-+-------+------------------+
+	expected := `+-------+----------------------------+----------+----------+
+| Pools | Teams                      | Strategy | Cluster  |
++-------+----------------------------+----------+----------+
+| pool1 | tsuruteam, ateam (default) | spread   |          |
+| pool2 |                            | binpack  | cluster1 |
++-------+----------------------------+----------+----------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
 }
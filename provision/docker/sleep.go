@@ -0,0 +1,495 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	mongoMetrics "github.com/tsuru/tsuru/metrics/mongodb"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultIdleTraffic = 1024
+
+var (
+	errNoWakerAddress = errors.New("docker:sleep:waker-address is not configured")
+	errWakeAppLocked  = errors.New("the app is locked by another operation")
+)
+
+// sleepingApp holds the sleep state of an app. While the app is asleep, its
+// backend in the router points to the waker, which wakes the app on the
+// first request sent to any of its hosts.
+type sleepingApp struct {
+	AppName   string `bson:"_id"`
+	Asleep    bool
+	ChangedAt time.Time
+}
+
+var wakeLocks = struct {
+	sync.Mutex
+	apps map[string]*sync.Mutex
+}{apps: make(map[string]*sync.Mutex)}
+
+// wakeLock returns the lock serializing the wake ups of the app requested
+// by the waker, so concurrent requests to a sleeping app wait for the same
+// wake up instead of failing to acquire the app lock.
+func wakeLock(appName string) *sync.Mutex {
+	wakeLocks.Lock()
+	defer wakeLocks.Unlock()
+	mutex, ok := wakeLocks.apps[appName]
+	if !ok {
+		mutex = &sync.Mutex{}
+		wakeLocks.apps[appName] = mutex
+	}
+	return mutex
+}
+
+func sleepingAppsColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_sleeping_apps", name)), nil
+}
+
+func getSleepingApp(appName string) (*sleepingApp, error) {
+	coll, err := sleepingAppsColl()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var sleeping sleepingApp
+	err = coll.FindId(appName).One(&sleeping)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sleeping, nil
+}
+
+func wakerAddress() (string, error) {
+	addr, _ := config.GetString("docker:sleep:waker-address")
+	if addr == "" {
+		return "", errNoWakerAddress
+	}
+	return addr, nil
+}
+
+func routerHosts(r router.Router, appName string) ([]string, error) {
+	if hostsRouter, ok := r.(router.HostsRouter); ok {
+		return hostsRouter.Hosts(appName)
+	}
+	addr, err := r.Addr(appName)
+	if err != nil {
+		return nil, err
+	}
+	return []string{addr}, nil
+}
+
+// sleepApp puts the app to sleep: its routes are replaced by the waker and
+// its units are stopped, with the asleep status.
+func (p *dockerProvisioner) sleepApp(a provision.App) error {
+	waker, err := wakerAddress()
+	if err != nil {
+		return err
+	}
+	r, err := getRouterForApp(a)
+	if err != nil {
+		return err
+	}
+	containers, err := p.listContainersBy(bson.M{
+		"appname": a.GetName(),
+		"status":  bson.M{"$ne": provision.StatusStopped.String()},
+	})
+	if err != nil {
+		return err
+	}
+	coll, err := sleepingAppsColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	sleeping := sleepingApp{AppName: a.GetName(), Asleep: true, ChangedAt: time.Now().UTC()}
+	_, err = coll.UpsertId(sleeping.AppName, sleeping)
+	if err != nil {
+		return err
+	}
+	err = r.AddRoute(a.GetName(), waker)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if c.routable() {
+			err = r.RemoveRoute(c.AppName, c.getAddress())
+			if err != nil {
+				log.Errorf("[sleep] Unable to remove route of container %s: %s", c.ID, err)
+			}
+			err = c.removeTCPRoutes(r)
+			if err != nil {
+				log.Errorf("[sleep] Unable to remove tcp routes of container %s: %s", c.ID, err)
+			}
+		}
+		err = c.getCluster(p).StopContainer(c.ID, 10)
+		if err != nil {
+			log.Errorf("[sleep] Unable to stop container %s: %s", c.ID, err)
+		}
+		c.setStatus(p, provision.StatusAsleep.String())
+	}
+	return nil
+}
+
+// lockAndWakeApp wakes the app while holding its lock, as the waker doesn't
+// run under the lock of an API request.
+func (p *dockerProvisioner) lockAndWakeApp(appName string) error {
+	mutex := wakeLock(appName)
+	mutex.Lock()
+	defer mutex.Unlock()
+	sleeping, err := getSleepingApp(appName)
+	if err != nil {
+		return err
+	}
+	if sleeping == nil || !sleeping.Asleep {
+		return nil
+	}
+	locker := &appLocker{}
+	if !locker.lock(appName) {
+		return errWakeAppLocked
+	}
+	defer locker.unlock(appName)
+	return p.wakeApp(appName)
+}
+
+// wakeApp starts the asleep units of the app, waiting for their healthcheck
+// before adding them back to the router in place of the waker. It's a no-op
+// for apps that aren't asleep. Callers must hold the lock of the app.
+func (p *dockerProvisioner) wakeApp(appName string) error {
+	sleeping, err := getSleepingApp(appName)
+	if err != nil {
+		return err
+	}
+	if sleeping == nil || !sleeping.Asleep {
+		return nil
+	}
+	a, err := app.GetByName(appName)
+	if err != nil {
+		return err
+	}
+	r, err := getRouterForApp(a)
+	if err != nil {
+		return err
+	}
+	containers, err := p.listContainersBy(bson.M{"appname": appName, "status": provision.StatusAsleep.String()})
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(containers))
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c container) {
+			defer wg.Done()
+			err := p.wakeContainer(&c)
+			if err != nil {
+				errCh <- fmt.Errorf("unable to wake container %s: %s", c.ID, err)
+				return
+			}
+			if c.routable() {
+				err = r.AddRoute(c.AppName, c.getAddress())
+				if err == nil {
+					err = c.addTCPRoutes(r)
+				}
+				if err != nil {
+					errCh <- err
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(errCh)
+	if err := <-errCh; err != nil {
+		return err
+	}
+	waker, err := wakerAddress()
+	if err == nil {
+		r.RemoveRoute(appName, waker)
+	}
+	coll, err := sleepingAppsColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.UpdateId(appName, bson.M{"$set": bson.M{"asleep": false, "changedat": time.Now().UTC()}})
+}
+
+func (p *dockerProvisioner) wakeContainer(c *container) error {
+	err := c.start(p, false)
+	if err != nil {
+		return err
+	}
+	c.setStatus(p, provision.StatusStarting.String())
+	info, err := c.networkInfo(p)
+	if err != nil {
+		return err
+	}
+	if info.HTTPHostPort != "" {
+		c.IP = info.IP
+		c.HostPort = info.HTTPHostPort
+		c.ExtraPorts = info.ExtraPorts
+		coll := p.collection()
+		defer coll.Close()
+		err = coll.Update(bson.M{"id": c.ID}, c)
+		if err != nil {
+			return err
+		}
+	}
+	return p.runHealthcheck(c, ioutil.Discard)
+}
+
+// cancelSleep removes the sleep state of the app, taking the waker out of its
+// routes. It's used when the units of the app are explicitly stopped or
+// removed.
+func (p *dockerProvisioner) cancelSleep(a provision.App) error {
+	sleeping, err := getSleepingApp(a.GetName())
+	if err != nil || sleeping == nil {
+		return err
+	}
+	if sleeping.Asleep {
+		if waker, err := wakerAddress(); err == nil {
+			if r, err := getRouterForApp(a); err == nil {
+				r.RemoveRoute(a.GetName(), waker)
+			}
+		}
+	}
+	coll, err := sleepingAppsColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.RemoveId(a.GetName())
+}
+
+// sleepingAppByHost returns the name of the app with sleep state whose
+// router currently routes the host, including cnames set while the app was
+// asleep. It returns an empty name when there's no such app.
+func sleepingAppByHost(host string) (string, error) {
+	coll, err := sleepingAppsColl()
+	if err != nil {
+		return "", err
+	}
+	defer coll.Close()
+	var apps []sleepingApp
+	err = coll.Find(nil).All(&apps)
+	if err != nil {
+		return "", err
+	}
+	for _, sleeping := range apps {
+		a, err := app.GetByName(sleeping.AppName)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get app %s: %s", sleeping.AppName, err)
+			continue
+		}
+		r, err := getRouterForApp(a)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get router of app %s: %s", sleeping.AppName, err)
+			continue
+		}
+		hosts, err := routerHosts(r, a.Name)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get hosts of app %s: %s", sleeping.AppName, err)
+			continue
+		}
+		for _, h := range hosts {
+			if strings.EqualFold(h, host) {
+				return a.Name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// wakerHandler handles the requests sent by the router to sleeping apps,
+// waking the app owning the requested host and proxying the request to one
+// of its units.
+func (p *dockerProvisioner) wakerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		appName, err := sleepingAppByHost(host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if appName == "" {
+			http.Error(w, "App not found.", http.StatusNotFound)
+			return
+		}
+		err = p.lockAndWakeApp(appName)
+		if err != nil {
+			log.Errorf("[sleep] Unable to wake app %s: %s", appName, err)
+			http.Error(w, "Unable to wake the app.", http.StatusServiceUnavailable)
+			return
+		}
+		containers, err := p.listContainersBy(bson.M{
+			"appname": appName,
+			"status": bson.M{"$in": []string{
+				provision.StatusStarting.String(),
+				provision.StatusStarted.String(),
+			}},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, c := range containers {
+			if !c.routable() {
+				continue
+			}
+			target, err := url.Parse(c.getAddress())
+			if err != nil {
+				continue
+			}
+			httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "No units available.", http.StatusServiceUnavailable)
+	})
+}
+
+func (p *dockerProvisioner) runWaker(addr string) {
+	err := http.ListenAndServe(addr, p.wakerHandler())
+	if err != nil {
+		log.Errorf("[sleep] Unable to start the waker on %s: %s", addr, err)
+	}
+}
+
+func idleTraffic() uint64 {
+	traffic, err := config.GetInt("docker:sleep:idle-traffic")
+	if err != nil || traffic < 0 {
+		return defaultIdleTraffic
+	}
+	return uint64(traffic)
+}
+
+// appIdle returns whether the units of the app received at most the idle
+// traffic per minute in the last idle time, according to their metrics. Apps
+// without metrics covering at least half of the idle time aren't considered
+// idle.
+func appIdle(appName string, idle time.Duration, now time.Time) (bool, error) {
+	samples, err := mongoMetrics.List(appName, now.Add(-idle), now)
+	if err != nil {
+		return false, err
+	}
+	if len(samples) == 0 || samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp) < idle/2 {
+		return false, nil
+	}
+	first := make(map[string]uint64)
+	last := make(map[string]uint64)
+	for _, sample := range samples {
+		if previous, ok := last[sample.Unit]; ok && sample.NetRx < previous {
+			// the counter was reset, the unit restarted in the period.
+			return false, nil
+		}
+		if _, ok := first[sample.Unit]; !ok {
+			first[sample.Unit] = sample.NetRx
+		}
+		last[sample.Unit] = sample.NetRx
+	}
+	var received uint64
+	for unit, rx := range last {
+		received += rx - first[unit]
+	}
+	return received <= idleTraffic()*uint64(idle/time.Minute), nil
+}
+
+// sleepIdleAppsOnce puts to sleep the apps declaring an idle time in
+// tsuru.yaml that didn't receive requests in that time.
+func (p *dockerProvisioner) sleepIdleAppsOnce() error {
+	containers, err := p.listContainersBy(bson.M{"status": provision.StatusStarted.String()})
+	if err != nil {
+		return err
+	}
+	images := make(map[string]string)
+	for _, c := range containers {
+		images[c.AppName] = c.Image
+	}
+	now := time.Now().UTC()
+	locker := &appLocker{}
+	for appName, image := range images {
+		yamlData, err := getImageTsuruYamlDataWithFallback(image, appName)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get tsuru.yaml of app %s: %s", appName, err)
+			continue
+		}
+		idle := time.Duration(yamlData.Sleep.IdleTime) * time.Minute
+		if idle <= 0 {
+			continue
+		}
+		sleeping, err := getSleepingApp(appName)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get sleep state of app %s: %s", appName, err)
+			continue
+		}
+		if sleeping != nil && now.Sub(sleeping.ChangedAt) < idle {
+			continue
+		}
+		isIdle, err := appIdle(appName, idle, now)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get metrics of app %s: %s", appName, err)
+			continue
+		}
+		if !isIdle {
+			continue
+		}
+		a, err := app.GetByName(appName)
+		if err != nil {
+			log.Errorf("[sleep] Unable to get app %s: %s", appName, err)
+			continue
+		}
+		if !locker.lock(appName) {
+			continue
+		}
+		err = p.sleepApp(a)
+		locker.unlock(appName)
+		if err != nil {
+			log.Errorf("[sleep] Unable to put app %s to sleep: %s", appName, err)
+		}
+	}
+	return nil
+}
+
+func (p *dockerProvisioner) runSleepChecker(interval time.Duration) {
+	for {
+		err := p.sleepIdleAppsOnce()
+		if err != nil {
+			log.Errorf("[sleep] Unable to check idle apps: %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	mongoMetrics "github.com/tsuru/tsuru/metrics/mongodb"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const testWakerAddress = "http://waker.tsuru.io:8080"
+
+func (s *S) TestSleepApp(c *check.C) {
+	config.Set("docker:sleep:waker-address", testWakerAddress)
+	defer config.Unset("docker:sleep:waker-address")
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.sleepApp(&a)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, cont.getAddress()), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, testWakerAddress), check.Equals, true)
+	dbCont, err := s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Status, check.Equals, provision.StatusAsleep.String())
+	sleeping, err := getSleepingApp(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sleeping.Asleep, check.Equals, true)
+}
+
+func (s *S) TestSleepAppRemovesTCPRoutes(c *check.C) {
+	config.Set("docker:sleep:waker-address", testWakerAddress)
+	defer config.Unset("docker:sleep:waker-address")
+	defer setTCPPortRange(30000, 30010)()
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	_, err = router.AllocatePort(a.Name, 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	defer router.ReleaseAppPorts(a.Name)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	cont.ExtraPorts = map[string]string{"5432": "49153"}
+	coll := s.p.collection()
+	defer coll.Close()
+	err = coll.Update(bson.M{"id": cont.ID}, cont)
+	c.Assert(err, check.IsNil)
+	err = cont.addTCPRoutes(&routertest.FakeRouter)
+	c.Assert(err, check.IsNil)
+	address := net.JoinHostPort(cont.HostAddr, "49153")
+	c.Assert(routertest.FakeRouter.HasTCPRoute(a.Name, 30000, address), check.Equals, true)
+	err = s.p.sleepApp(&a)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasTCPRoute(a.Name, 30000, address), check.Equals, false)
+}
+
+func (s *S) TestSleepAppWithoutWakerAddress(c *check.C) {
+	a := app.App{Name: "myapp"}
+	err := s.p.sleepApp(&a)
+	c.Assert(err, check.Equals, errNoWakerAddress)
+}
+
+func (s *S) TestWakeApp(c *check.C) {
+	config.Set("docker:sleep:waker-address", testWakerAddress)
+	defer config.Unset("docker:sleep:waker-address")
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.sleepApp(&a)
+	c.Assert(err, check.IsNil)
+	err = s.p.wakeApp(a.Name)
+	c.Assert(err, check.IsNil)
+	dbCont, err := s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Status, check.Equals, provision.StatusStarting.String())
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, dbCont.getAddress()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, testWakerAddress), check.Equals, false)
+	sleeping, err := getSleepingApp(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sleeping.Asleep, check.Equals, false)
+}
+
+func (s *S) TestLockAndWakeAppLocked(c *check.C) {
+	config.Set("docker:sleep:waker-address", testWakerAddress)
+	defer config.Unset("docker:sleep:waker-address")
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.sleepApp(&a)
+	c.Assert(err, check.IsNil)
+	locked, err := app.AcquireApplicationLock(a.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = s.p.lockAndWakeApp(a.Name)
+	c.Assert(err, check.Equals, errWakeAppLocked)
+	sleeping, err := getSleepingApp(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sleeping.Asleep, check.Equals, true)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "someone")
+	app.ReleaseApplicationLock(a.Name)
+	err = s.p.lockAndWakeApp(a.Name)
+	c.Assert(err, check.IsNil)
+	sleeping, err = getSleepingApp(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sleeping.Asleep, check.Equals, false)
+	dbApp, err = app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, false)
+}
+
+func (s *S) TestWakeAppNotAsleep(c *check.C) {
+	err := s.p.wakeApp("myapp")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestCancelSleep(c *check.C) {
+	config.Set("docker:sleep:waker-address", testWakerAddress)
+	defer config.Unset("docker:sleep:waker-address")
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.sleepApp(&a)
+	c.Assert(err, check.IsNil)
+	err = s.p.cancelSleep(&a)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, testWakerAddress), check.Equals, false)
+	sleeping, err := getSleepingApp(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sleeping, check.IsNil)
+}
+
+func (s *S) TestAppIdle(c *check.C) {
+	now := time.Now().UTC().Truncate(time.Second)
+	err := mongoMetrics.Add(
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-9 * time.Minute), NetRx: 1000},
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-5 * time.Minute), NetRx: 2000},
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-time.Minute), NetRx: 3000},
+	)
+	c.Assert(err, check.IsNil)
+	idle, err := appIdle("myapp", 10*time.Minute, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(idle, check.Equals, true)
+	config.Set("docker:sleep:idle-traffic", 100)
+	defer config.Unset("docker:sleep:idle-traffic")
+	idle, err = appIdle("myapp", 10*time.Minute, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(idle, check.Equals, false)
+}
+
+func (s *S) TestAppIdleWithoutEnoughSamples(c *check.C) {
+	now := time.Now().UTC().Truncate(time.Second)
+	err := mongoMetrics.Add(
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-2 * time.Minute), NetRx: 1000},
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-time.Minute), NetRx: 1000},
+	)
+	c.Assert(err, check.IsNil)
+	idle, err := appIdle("myapp", 10*time.Minute, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(idle, check.Equals, false)
+}
+
+func (s *S) TestAppIdleUnitRestarted(c *check.C) {
+	now := time.Now().UTC().Truncate(time.Second)
+	err := mongoMetrics.Add(
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-9 * time.Minute), NetRx: 5000},
+		mongoMetrics.Sample{App: "myapp", Unit: "u1", Timestamp: now.Add(-time.Minute), NetRx: 10},
+	)
+	c.Assert(err, check.IsNil)
+	idle, err := appIdle("myapp", 10*time.Minute, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(idle, check.Equals, false)
+}
+
+func (s *S) TestSleepIdleAppsOnce(c *check.C) {
+	config.Set("docker:sleep:waker-address", testWakerAddress)
+	defer config.Unset("docker:sleep:waker-address")
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	now := time.Now().UTC().Truncate(time.Second)
+	err = mongoMetrics.Add(
+		mongoMetrics.Sample{App: a.Name, Unit: cont.ID, Timestamp: now.Add(-9 * time.Minute), NetRx: 100},
+		mongoMetrics.Sample{App: a.Name, Unit: cont.ID, Timestamp: now.Add(-time.Minute), NetRx: 100},
+	)
+	c.Assert(err, check.IsNil)
+	err = s.p.sleepIdleAppsOnce()
+	c.Assert(err, check.IsNil)
+	dbCont, err := s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Status, check.Equals, provision.StatusStarted.String())
+	err = saveImageCustomData(cont.Image, map[string]interface{}{
+		"sleep": map[string]interface{}{"idle_time": 10},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.p.sleepIdleAppsOnce()
+	c.Assert(err, check.IsNil)
+	dbCont, err = s.p.getContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Status, check.Equals, provision.StatusAsleep.String())
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, testWakerAddress), check.Equals, true)
+}
+
+func (s *S) TestWakerHandler(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer server.Close()
+	a := app.App{Name: "myapp"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Status: provision.StatusStarted.String()})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	url, _ := url.Parse(server.URL)
+	cont.HostAddr, cont.HostPort, _ = net.SplitHostPort(url.Host)
+	coll := s.p.collection()
+	defer coll.Close()
+	err = coll.Update(bson.M{"id": cont.ID}, cont)
+	c.Assert(err, check.IsNil)
+	sleepingColl, err := sleepingAppsColl()
+	c.Assert(err, check.IsNil)
+	defer sleepingColl.Close()
+	err = sleepingColl.Insert(sleepingApp{AppName: a.Name})
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.SetCName("myapp.tsuru.io", a.Name)
+	c.Assert(err, check.IsNil)
+	defer routertest.FakeRouter.UnsetCName("myapp.tsuru.io", a.Name)
+	request, err := http.NewRequest("GET", "/some/path", nil)
+	c.Assert(err, check.IsNil)
+	request.Host = "myapp.tsuru.io:80"
+	recorder := httptest.NewRecorder()
+	s.p.wakerHandler().ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	body, err := ioutil.ReadAll(recorder.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, "hello from /some/path")
+}
+
+func (s *S) TestWakerHandlerUnknownHost(c *check.C) {
+	request, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	request.Host = "unknown.tsuru.io"
+	recorder := httptest.NewRecorder()
+	s.p.wakerHandler().ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,199 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// schedulingStrategy decides in which node of a pool a new container of an
+// app will be created.
+type schedulingStrategy interface {
+	// chooseHost returns one of the given hosts. nodes maps each host to
+	// its node in the cluster.
+	chooseHost(s segregatedScheduler, appName string, hosts []string, nodes map[string]cluster.Node) (string, error)
+}
+
+const defaultSchedulingStrategy = "spread"
+
+var schedulingStrategies = map[string]schedulingStrategy{
+	"spread":     spreadStrategy{},
+	"spread-app": spreadAppStrategy{},
+	"binpack":    binpackStrategy{},
+}
+
+func getSchedulingStrategy(name string) (schedulingStrategy, error) {
+	if name == "" {
+		name = defaultSchedulingStrategy
+	}
+	strategy, ok := schedulingStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduling strategy: %q", name)
+	}
+	return strategy, nil
+}
+
+// spreadStrategy chooses the host with less units of the app, using the
+// total number of units in the host to break ties.
+type spreadStrategy struct{}
+
+func (spreadStrategy) chooseHost(s segregatedScheduler, appName string, hosts []string, nodes map[string]cluster.Node) (string, error) {
+	hostCountMap, err := s.aggregateContainersByHost(hosts)
+	if err != nil {
+		return "", err
+	}
+	appCountMap, err := s.aggregateContainersByHostApp(hosts, appName)
+	if err != nil {
+		return "", err
+	}
+	// Finally finding the host with the minimum value for
+	// the pair [appCount, hostCount]
+	var minHost string
+	minCount := math.MaxInt32
+	for _, host := range hosts {
+		adjCount := appCountMap[host]*10000 + hostCountMap[host]
+		if adjCount < minCount {
+			minCount = adjCount
+			minHost = host
+		}
+	}
+	return minHost, nil
+}
+
+// spreadAppStrategy avoids putting two units of the same app in the same
+// host, choosing the host with less units among the ones without units of the
+// app. When every host already has units of the app, it falls back to the
+// host with less units of the app, using the total number of units in the
+// host to break ties.
+type spreadAppStrategy struct{}
+
+func (spreadAppStrategy) chooseHost(s segregatedScheduler, appName string, hosts []string, nodes map[string]cluster.Node) (string, error) {
+	hostCountMap, err := s.aggregateContainersByHost(hosts)
+	if err != nil {
+		return "", err
+	}
+	appCountMap, err := s.aggregateContainersByHostApp(hosts, appName)
+	if err != nil {
+		return "", err
+	}
+	var minHost, fallbackHost string
+	minCount, fallbackCount := math.MaxInt32, math.MaxInt32
+	for _, host := range hosts {
+		if appCountMap[host] > 0 {
+			adjCount := appCountMap[host]*10000 + hostCountMap[host]
+			if adjCount < fallbackCount {
+				fallbackCount = adjCount
+				fallbackHost = host
+			}
+			continue
+		}
+		if hostCountMap[host] < minCount {
+			minCount = hostCountMap[host]
+			minHost = host
+		}
+	}
+	if minHost == "" {
+		return fallbackHost, nil
+	}
+	return minHost, nil
+}
+
+// binpackStrategy fills the hosts before using new ones, choosing the most
+// used host that still has enough memory and CPU share for the unit. The
+// capacity of each host is read from the node metadata set in
+// docker:scheduler:total-memory-metadata and
+// docker:scheduler:total-cpu-share-metadata. Resources without capacity
+// metadata are ignored.
+type binpackStrategy struct{}
+
+type hostUsage struct {
+	memory   int64
+	cpuShare int
+	count    int
+}
+
+func (binpackStrategy) usage(s segregatedScheduler, hosts []string) (map[string]hostUsage, error) {
+	containers, err := s.provisioner.listContainersBy(bson.M{"hostaddr": bson.M{"$in": hosts}})
+	if err != nil {
+		return nil, err
+	}
+	apps := make(map[string]*app.App)
+	usage := make(map[string]hostUsage, len(hosts))
+	for _, cont := range containers {
+		a, ok := apps[cont.AppName]
+		if !ok {
+			a, err = app.GetByName(cont.AppName)
+			if err != nil {
+				return nil, err
+			}
+			apps[cont.AppName] = a
+		}
+		u := usage[cont.HostAddr]
+		u.memory += a.Plan.Memory
+		u.cpuShare += a.Plan.CpuShare
+		u.count++
+		usage[cont.HostAddr] = u
+	}
+	return usage, nil
+}
+
+func (b binpackStrategy) chooseHost(s segregatedScheduler, appName string, hosts []string, nodes map[string]cluster.Node) (string, error) {
+	var plan app.Plan
+	if a, err := app.GetByName(appName); err == nil {
+		plan = a.Plan
+	}
+	usage, err := b.usage(s, hosts)
+	if err != nil {
+		return "", err
+	}
+	maxMemoryRatio := float64(s.maxMemoryRatio)
+	if maxMemoryRatio == 0 {
+		maxMemoryRatio = 1
+	}
+	var chosenHost string
+	maxScore := -1.0
+	for _, host := range hosts {
+		u := usage[host]
+		node := nodes[host]
+		var memoryRatio, cpuRatio float64
+		if s.totalMemoryMetadata != "" {
+			totalMemory, _ := strconv.ParseFloat(node.Metadata[s.totalMemoryMetadata], 64)
+			if totalMemory > 0 {
+				memoryRatio = float64(u.memory+plan.Memory) / totalMemory
+				if memoryRatio > maxMemoryRatio {
+					continue
+				}
+			}
+		}
+		if s.totalCpuShareMetadata != "" {
+			totalCpuShare, _ := strconv.ParseFloat(node.Metadata[s.totalCpuShareMetadata], 64)
+			if totalCpuShare > 0 {
+				cpuRatio = float64(u.cpuShare+plan.CpuShare) / totalCpuShare
+				if cpuRatio > 1 {
+					continue
+				}
+			}
+		}
+		score := math.Max(memoryRatio, cpuRatio)
+		if score == 0 {
+			// Without capacity metadata, prefer the host with more units.
+			score = float64(u.count) / math.MaxInt32
+		}
+		if score > maxScore {
+			maxScore = score
+			chosenHost = host
+		}
+	}
+	if chosenHost == "" {
+		return "", fmt.Errorf("No nodes found with enough memory and CPU share for container of %q.", appName)
+	}
+	return chosenHost, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestGetSchedulingStrategy(c *check.C) {
+	strategy, err := getSchedulingStrategy("")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.Equals, spreadStrategy{})
+	strategy, err = getSchedulingStrategy("binpack")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.Equals, binpackStrategy{})
+	_, err = getSchedulingStrategy("random")
+	c.Assert(err, check.ErrorMatches, `unknown scheduling strategy: "random"`)
+}
+
+func strategyNodes(addresses ...string) ([]string, map[string]cluster.Node) {
+	hosts := make([]string, len(addresses))
+	nodes := make(map[string]cluster.Node, len(addresses))
+	for i, addr := range addresses {
+		hosts[i] = urlToHost(addr)
+		nodes[hosts[i]] = cluster.Node{Address: addr}
+	}
+	return hosts, nodes
+}
+
+func (s *S) TestSpreadAppStrategy(c *check.C) {
+	contColl := s.p.collection()
+	defer contColl.Close()
+	err := contColl.Insert(
+		container{ID: "1", AppName: "myapp", HostAddr: "server1"},
+		container{ID: "2", AppName: "otherapp", HostAddr: "server2"},
+		container{ID: "3", AppName: "otherapp", HostAddr: "server2"},
+	)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	hosts, nodes := strategyNodes("http://server1:1234", "http://server2:1234", "http://server3:1234")
+	host, err := spreadAppStrategy{}.chooseHost(sched, "myapp", hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server3")
+	err = contColl.Insert(container{ID: "4", AppName: "myapp", HostAddr: "server3"})
+	c.Assert(err, check.IsNil)
+	host, err = spreadAppStrategy{}.chooseHost(sched, "myapp", hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server2")
+	err = contColl.Insert(container{ID: "5", AppName: "myapp", HostAddr: "server2"})
+	c.Assert(err, check.IsNil)
+	host, err = spreadAppStrategy{}.chooseHost(sched, "myapp", hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server1")
+	err = contColl.Insert(container{ID: "6", AppName: "myapp", HostAddr: "server1"})
+	c.Assert(err, check.IsNil)
+	host, err = spreadAppStrategy{}.chooseHost(sched, "myapp", hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server3")
+}
+
+func (s *S) TestBinpackStrategy(c *check.C) {
+	big := app.App{Name: "big", Plan: app.Plan{Memory: 600, CpuShare: 50}}
+	small := app.App{Name: "small", Plan: app.Plan{Memory: 100, CpuShare: 10}}
+	err := s.storage.Apps().Insert(big, small)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": bson.M{"$in": []string{big.Name, small.Name}}})
+	contColl := s.p.collection()
+	defer contColl.Close()
+	err = contColl.Insert(
+		container{ID: "1", AppName: big.Name, HostAddr: "server1"},
+		container{ID: "2", AppName: small.Name, HostAddr: "server2"},
+	)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{
+		provisioner:           s.p,
+		totalMemoryMetadata:   "memory",
+		totalCpuShareMetadata: "cpushare",
+	}
+	hosts, nodes := strategyNodes("http://server1:1234", "http://server2:1234", "http://server3:1234")
+	for _, host := range hosts {
+		node := nodes[host]
+		node.Metadata = map[string]string{"memory": "1000", "cpushare": "100"}
+		nodes[host] = node
+	}
+	host, err := binpackStrategy{}.chooseHost(sched, small.Name, hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server1")
+	host, err = binpackStrategy{}.chooseHost(sched, big.Name, hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server2")
+	err = contColl.Insert(
+		container{ID: "3", AppName: big.Name, HostAddr: "server2"},
+		container{ID: "4", AppName: big.Name, HostAddr: "server3"},
+	)
+	c.Assert(err, check.IsNil)
+	_, err = binpackStrategy{}.chooseHost(sched, big.Name, hosts, nodes)
+	c.Assert(err, check.ErrorMatches, `No nodes found with enough memory and CPU share for container of "big".`)
+}
+
+func (s *S) TestBinpackStrategyCpuShare(c *check.C) {
+	cpuBound := app.App{Name: "cpubound", Plan: app.Plan{Memory: 10, CpuShare: 60}}
+	err := s.storage.Apps().Insert(cpuBound)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": cpuBound.Name})
+	contColl := s.p.collection()
+	defer contColl.Close()
+	err = contColl.Insert(container{ID: "1", AppName: cpuBound.Name, HostAddr: "server1"})
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{
+		provisioner:           s.p,
+		totalMemoryMetadata:   "memory",
+		totalCpuShareMetadata: "cpushare",
+	}
+	hosts, nodes := strategyNodes("http://server1:1234", "http://server2:1234")
+	for _, host := range hosts {
+		node := nodes[host]
+		node.Metadata = map[string]string{"memory": "1000", "cpushare": "100"}
+		nodes[host] = node
+	}
+	host, err := binpackStrategy{}.chooseHost(sched, cpuBound.Name, hosts, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(host, check.Equals, "server2")
+}
+
+func (s *S) TestSchedulerScheduleWithPoolStrategy(c *check.C) {
+	a := app.App{Name: "impius", Teams: []string{"tsuruteam"}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	coll := s.storage.Collection(schedulerCollection)
+	p := Pool{Name: "pool1", Teams: []string{"tsuruteam"}, Strategy: "spread-app"}
+	err = coll.Insert(p)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": p.Name})
+	contColl := s.p.collection()
+	defer contColl.Close()
+	err = contColl.Insert(
+		container{ID: "1", AppName: a.Name, HostAddr: "url0"},
+		container{ID: "2", AppName: "otherapp", HostAddr: "url0"},
+		container{ID: "3", AppName: a.Name, HostAddr: "url1"},
+	)
+	c.Assert(err, check.IsNil)
+	scheduler := segregatedScheduler{provisioner: s.p}
+	clusterInstance, err := cluster.New(&scheduler, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url0:1234", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url1:1234", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	node, err := scheduler.Schedule(clusterInstance, docker.CreateContainerOptions{}, a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, "http://url1:1234")
+}
+
+func (s *S) TestSetPoolStrategy(c *check.C) {
+	var seg segregatedScheduler
+	coll := s.storage.Collection(schedulerCollection)
+	pool := Pool{Name: "pool1"}
+	err := coll.Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(pool.Name)
+	err = seg.setPoolStrategy(pool.Name, "binpack")
+	c.Assert(err, check.IsNil)
+	var p Pool
+	err = coll.FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Strategy, check.Equals, "binpack")
+	err = seg.setPoolStrategy(pool.Name, "")
+	c.Assert(err, check.IsNil)
+	p = Pool{}
+	err = coll.FindId(pool.Name).One(&p)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Strategy, check.Equals, "")
+}
+
+func (s *S) TestSetPoolStrategyUnknownStrategy(c *check.C) {
+	var seg segregatedScheduler
+	coll := s.storage.Collection(schedulerCollection)
+	pool := Pool{Name: "pool1"}
+	err := coll.Insert(pool)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(pool.Name)
+	err = seg.setPoolStrategy(pool.Name, "random")
+	c.Assert(err, check.ErrorMatches, `unknown scheduling strategy: "random"`)
+}
@@ -90,6 +90,7 @@ func (s *S) SetUpTest(c *check.C) {
 		cluster.Node{Address: s.server.URL()},
 	)
 	c.Assert(err, check.IsNil)
+	s.p.clusters = nil
 	mainDockerProvisioner = s.p
 	coll := s.p.collection()
 	defer coll.Close()
@@ -102,6 +103,10 @@ func (s *S) SetUpTest(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer healingColl.Close()
 	healingColl.RemoveAll(nil)
+	autoScaleColl, err := autoScaleCollection()
+	c.Assert(err, check.IsNil)
+	defer autoScaleColl.Close()
+	autoScaleColl.RemoveAll(nil)
 }
 
 func clearClusterStorage() error {
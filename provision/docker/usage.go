@@ -0,0 +1,188 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+)
+
+// nodeUsageTopApps is the number of apps listed as the top consumers of each
+// node.
+const nodeUsageTopApps = 3
+
+// resourceUsage holds the memory, swap and CPU share reserved by the plans of
+// the units in a set of nodes, the capacity declared in the metadata of the
+// nodes and the number of units in each status.
+type resourceUsage struct {
+	Memory        int64
+	Swap          int64
+	CpuShare      int
+	TotalMemory   int64
+	TotalCpuShare int
+	Containers    map[string]int
+}
+
+func (u *resourceUsage) addUnit(plan app.Plan, status string) {
+	u.Memory += plan.Memory
+	u.Swap += plan.Swap
+	u.CpuShare += plan.CpuShare
+	if u.Containers == nil {
+		u.Containers = make(map[string]int)
+	}
+	u.Containers[status]++
+}
+
+func (u *resourceUsage) addUsage(other resourceUsage) {
+	u.Memory += other.Memory
+	u.Swap += other.Swap
+	u.CpuShare += other.CpuShare
+	u.TotalMemory += other.TotalMemory
+	u.TotalCpuShare += other.TotalCpuShare
+	if u.Containers == nil {
+		u.Containers = make(map[string]int)
+	}
+	for status, count := range other.Containers {
+		u.Containers[status] += count
+	}
+}
+
+type appUsage struct {
+	App      string
+	Units    int
+	Memory   int64
+	Swap     int64
+	CpuShare int
+}
+
+type appUsageList []appUsage
+
+func (l appUsageList) Len() int      { return len(l) }
+func (l appUsageList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l appUsageList) Less(i, j int) bool {
+	if l[i].Memory != l[j].Memory {
+		return l[i].Memory > l[j].Memory
+	}
+	if l[i].CpuShare != l[j].CpuShare {
+		return l[i].CpuShare > l[j].CpuShare
+	}
+	if l[i].Units != l[j].Units {
+		return l[i].Units > l[j].Units
+	}
+	return l[i].App < l[j].App
+}
+
+type nodeUsage struct {
+	Address string
+	Pool    string
+	Usage   resourceUsage
+	TopApps []appUsage
+}
+
+type poolUsage struct {
+	Pool  string
+	Nodes int
+	Usage resourceUsage
+}
+
+type usageReport struct {
+	Nodes []nodeUsage
+	Pools []poolUsage
+}
+
+// nodesUsage reports the resources reserved in each node, and in each pool,
+// against the capacity read from the metadata set in
+// docker:scheduler:total-memory-metadata and
+// docker:scheduler:total-cpu-share-metadata. When poolName is not empty, only
+// nodes of the given pool are reported.
+func (p *dockerProvisioner) nodesUsage(poolName string) (*usageReport, error) {
+	nodes, err := p.unfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := p.listAllContainers()
+	if err != nil {
+		return nil, err
+	}
+	totalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
+	totalCpuShareMetadata, _ := config.GetString("docker:scheduler:total-cpu-share-metadata")
+	plans := make(map[string]app.Plan)
+	byHost := make(map[string]*nodeUsage, len(nodes))
+	appsByHost := make(map[string]map[string]*appUsage, len(nodes))
+	var hosts []string
+	for _, node := range nodes {
+		if poolName != "" && node.Metadata["pool"] != poolName {
+			continue
+		}
+		usage := nodeUsage{Address: node.Address, Pool: node.Metadata["pool"]}
+		if totalMemoryMetadata != "" {
+			totalMemory, _ := strconv.ParseFloat(node.Metadata[totalMemoryMetadata], 64)
+			usage.Usage.TotalMemory = int64(totalMemory)
+		}
+		if totalCpuShareMetadata != "" {
+			usage.Usage.TotalCpuShare, _ = strconv.Atoi(node.Metadata[totalCpuShareMetadata])
+		}
+		host := urlToHost(node.Address)
+		byHost[host] = &usage
+		appsByHost[host] = make(map[string]*appUsage)
+		hosts = append(hosts, host)
+	}
+	for _, c := range containers {
+		usage, ok := byHost[c.HostAddr]
+		if !ok {
+			continue
+		}
+		plan, ok := plans[c.AppName]
+		if !ok {
+			if a, err := app.GetByName(c.AppName); err == nil {
+				plan = a.Plan
+			}
+			plans[c.AppName] = plan
+		}
+		usage.Usage.addUnit(plan, c.Status)
+		appUsed := appsByHost[c.HostAddr][c.AppName]
+		if appUsed == nil {
+			appUsed = &appUsage{App: c.AppName}
+			appsByHost[c.HostAddr][c.AppName] = appUsed
+		}
+		appUsed.Units++
+		appUsed.Memory += plan.Memory
+		appUsed.Swap += plan.Swap
+		appUsed.CpuShare += plan.CpuShare
+	}
+	sort.Strings(hosts)
+	var report usageReport
+	pools := make(map[string]*poolUsage)
+	var poolNames []string
+	for _, host := range hosts {
+		usage := byHost[host]
+		apps := make(appUsageList, 0, len(appsByHost[host]))
+		for _, appUsed := range appsByHost[host] {
+			apps = append(apps, *appUsed)
+		}
+		sort.Sort(apps)
+		if len(apps) > nodeUsageTopApps {
+			apps = apps[:nodeUsageTopApps]
+		}
+		usage.TopApps = apps
+		report.Nodes = append(report.Nodes, *usage)
+		pool, ok := pools[usage.Pool]
+		if !ok {
+			pool = &poolUsage{Pool: usage.Pool}
+			pools[usage.Pool] = pool
+			poolNames = append(poolNames, usage.Pool)
+		}
+		pool.Nodes++
+		pool.Usage.addUsage(usage.Usage)
+	}
+	sort.Strings(poolNames)
+	for _, name := range poolNames {
+		report.Pools = append(report.Pools, *pools[name])
+	}
+	return &report, nil
+}
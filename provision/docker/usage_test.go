@@ -0,0 +1,118 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestNodesUsage(c *check.C) {
+	config.Set("docker:scheduler:total-memory-metadata", "totalMemory")
+	defer config.Unset("docker:scheduler:total-memory-metadata")
+	config.Set("docker:scheduler:total-cpu-share-metadata", "totalCpuShare")
+	defer config.Unset("docker:scheduler:total-cpu-share-metadata")
+	var p dockerProvisioner
+	var err error
+	p.cluster, err = cluster.New(nil, &cluster.MapStorage{},
+		cluster.Node{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1", "totalMemory": "4096", "totalCpuShare": "100"}},
+		cluster.Node{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1", "totalMemory": "2048"}},
+		cluster.Node{Address: "http://server3:1234", Metadata: map[string]string{"pool": "pool2"}},
+	)
+	c.Assert(err, check.IsNil)
+	apps := []app.App{
+		{Name: "big", Plan: app.Plan{Memory: 1024, Swap: 512, CpuShare: 20}},
+		{Name: "small", Plan: app.Plan{Memory: 256, CpuShare: 5}},
+		{Name: "tiny", Plan: app.Plan{Memory: 128, CpuShare: 2}},
+		{Name: "nano", Plan: app.Plan{Memory: 64, CpuShare: 1}},
+	}
+	for _, a := range apps {
+		err = s.storage.Apps().Insert(a)
+		c.Assert(err, check.IsNil)
+	}
+	defer s.storage.Apps().RemoveAll(bson.M{"name": bson.M{"$in": []string{"big", "small", "tiny", "nano"}}})
+	coll := p.collection()
+	defer coll.Close()
+	started := provision.StatusStarted.String()
+	stopped := provision.StatusStopped.String()
+	err = coll.Insert(
+		container{ID: "1", AppName: "big", HostAddr: "server1", Status: started},
+		container{ID: "2", AppName: "big", HostAddr: "server1", Status: started},
+		container{ID: "3", AppName: "small", HostAddr: "server1", Status: stopped},
+		container{ID: "4", AppName: "tiny", HostAddr: "server1", Status: started},
+		container{ID: "5", AppName: "nano", HostAddr: "server1", Status: started},
+		container{ID: "6", AppName: "small", HostAddr: "server2", Status: started},
+		container{ID: "7", AppName: "small", HostAddr: "server9", Status: started},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"id": bson.M{"$in": []string{"1", "2", "3", "4", "5", "6", "7"}}})
+	report, err := p.nodesUsage("")
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Nodes, check.DeepEquals, []nodeUsage{
+		{
+			Address: "http://server1:1234",
+			Pool:    "pool1",
+			Usage: resourceUsage{
+				Memory:        2496,
+				Swap:          1024,
+				CpuShare:      48,
+				TotalMemory:   4096,
+				TotalCpuShare: 100,
+				Containers:    map[string]int{started: 4, stopped: 1},
+			},
+			TopApps: []appUsage{
+				{App: "big", Units: 2, Memory: 2048, Swap: 1024, CpuShare: 40},
+				{App: "small", Units: 1, Memory: 256, CpuShare: 5},
+				{App: "tiny", Units: 1, Memory: 128, CpuShare: 2},
+			},
+		},
+		{
+			Address: "http://server2:1234",
+			Pool:    "pool1",
+			Usage: resourceUsage{
+				Memory:      256,
+				CpuShare:    5,
+				TotalMemory: 2048,
+				Containers:  map[string]int{started: 1},
+			},
+			TopApps: []appUsage{
+				{App: "small", Units: 1, Memory: 256, CpuShare: 5},
+			},
+		},
+		{
+			Address: "http://server3:1234",
+			Pool:    "pool2",
+			TopApps: []appUsage{},
+		},
+	})
+	c.Assert(report.Pools, check.DeepEquals, []poolUsage{
+		{
+			Pool:  "pool1",
+			Nodes: 2,
+			Usage: resourceUsage{
+				Memory:        2752,
+				Swap:          1024,
+				CpuShare:      53,
+				TotalMemory:   6144,
+				TotalCpuShare: 100,
+				Containers:    map[string]int{started: 5, stopped: 1},
+			},
+		},
+		{
+			Pool:  "pool2",
+			Nodes: 1,
+			Usage: resourceUsage{Containers: map[string]int{}},
+		},
+	})
+	report, err = p.nodesUsage("pool2")
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Nodes, check.HasLen, 1)
+	c.Assert(report.Nodes[0].Address, check.Equals, "http://server3:1234")
+	c.Assert(report.Pools, check.HasLen, 1)
+}
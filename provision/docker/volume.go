@@ -0,0 +1,55 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/volume"
+)
+
+// filterByVolumes keeps the nodes able to mount the volumes bound to the app.
+// All the volumes must be in the pool of the app, and volumes pinned to a node
+// restrict the units of the app to that node.
+func (s segregatedScheduler) filterByVolumes(nodes []cluster.Node, appName string, pool *Pool) ([]cluster.Node, error) {
+	binds, err := volume.ListAppBinds(appName)
+	if err != nil {
+		return nil, err
+	}
+	for _, bind := range binds {
+		if bind.Pool != pool.Name {
+			return nil, fmt.Errorf("Volume %q is in pool %q, but units of %q run in pool %q.", bind.Volume, bind.Pool, appName, pool.Name)
+		}
+		if bind.Node == "" {
+			continue
+		}
+		result := make([]cluster.Node, 0, len(nodes))
+		for _, node := range nodes {
+			if node.Address == bind.Node || urlToHost(node.Address) == bind.Node {
+				result = append(result, node)
+			}
+		}
+		if len(result) == 0 {
+			return nil, fmt.Errorf("Node %q, required by volume %q, is not available for %q.", bind.Node, bind.Volume, appName)
+		}
+		nodes = result
+	}
+	return nodes, nil
+}
+
+// appVolumeBinds returns the binds of the volumes attached to the app, in the
+// docker format.
+func appVolumeBinds(appName string) ([]string, error) {
+	binds, err := volume.ListAppBinds(appName)
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]string, len(binds))
+	for i := range binds {
+		specs[i] = binds[i].Spec()
+	}
+	return specs, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"github.com/tsuru/tsuru/volume"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestFilterByVolumes(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1", Node: "10.0.0.2"})
+	c.Assert(err, check.IsNil)
+	err = volume.Create(&volume.Volume{Name: "uploads", Type: volume.TypeDocker, Source: "uploads", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	nodes := []cluster.Node{
+		{Address: "http://10.0.0.1:2375"},
+		{Address: "http://10.0.0.2:2375"},
+	}
+	var scheduler segregatedScheduler
+	pool := &Pool{Name: "pool1"}
+	result, err := scheduler.filterByVolumes(nodes, "myapp", pool)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes)
+	err = volume.BindApp("uploads", "myapp", "/uploads", false)
+	c.Assert(err, check.IsNil)
+	result, err = scheduler.filterByVolumes(nodes, "myapp", pool)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes)
+	err = volume.BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	result, err = scheduler.filterByVolumes(nodes, "myapp", pool)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []cluster.Node{{Address: "http://10.0.0.2:2375"}})
+	_, err = scheduler.filterByVolumes(nodes[:1], "myapp", pool)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `Node "10.0.0.2", required by volume "data", is not available for "myapp".`)
+}
+
+func (s *S) TestFilterByVolumesOtherPool(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool2"})
+	c.Assert(err, check.IsNil)
+	err = volume.BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	var scheduler segregatedScheduler
+	_, err = scheduler.filterByVolumes([]cluster.Node{{Address: "http://10.0.0.1:2375"}}, "myapp", &Pool{Name: "pool1"})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `Volume "data" is in pool "pool2", but units of "myapp" run in pool "pool1".`)
+}
+
+func (s *S) TestContainerCreateWithVolumes(c *check.C) {
+	err := volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = volume.BindApp("data", "app-name", "/data", false)
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("app-name", "brainfuck", 1)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	s.p.getCluster().PullImage(
+		docker.PullImageOptions{Repository: "tsuru/brainfuck"},
+		docker.AuthConfiguration{},
+	)
+	cont := container{Name: "myName", AppName: app.GetName(), Type: app.GetPlatform(), Status: "created"}
+	err = cont.create(runContainerActionsArgs{
+		app:         app,
+		imageID:     s.p.getBuildImage(app),
+		commands:    []string{"docker", "run"},
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := s.p.getCluster().InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.Config.Volumes, check.DeepEquals, map[string]struct{}{"/data": {}})
+}
+
+func (s *S) TestContainerStartWithVolumes(c *check.C) {
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp"})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = volume.Create(&volume.Volume{Name: "data", Type: volume.TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = volume.BindApp("data", "myapp", "/data", true)
+	c.Assert(err, check.IsNil)
+	contPath := fmt.Sprintf("/containers/%s/start", cont.ID)
+	var binds []string
+	s.server.CustomHandler(contPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := docker.HostConfig{}
+		err := json.NewDecoder(r.Body).Decode(&result)
+		if err == nil {
+			binds = result.Binds
+		}
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	defer s.server.CustomHandler(contPath, s.server.DefaultHandler())
+	err = cont.start(s.p, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+	err = cont.stop(s.p)
+	c.Assert(err, check.IsNil)
+	err = cont.start(s.p, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []string{"/mnt/data:/data:ro"})
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// zoneMetadata returns the node metadata key used to group nodes in zones,
+// configured in docker:scheduler:zone-metadata. An empty value means that
+// zones are disabled.
+func zoneMetadata() string {
+	key, _ := config.GetString("docker:scheduler:zone-metadata")
+	return key
+}
+
+// hostZones maps the host of each node to its zone.
+func hostZones(nodes []cluster.Node, zoneKey string) map[string]string {
+	zones := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		zones[urlToHost(node.Address)] = node.Metadata[zoneKey]
+	}
+	return zones
+}
+
+// filterByZone returns the nodes in the zones with less units of the app, so
+// units of the app are spread across all zones before any zone gets a second
+// unit.
+func (s segregatedScheduler) filterByZone(nodes []cluster.Node, appName string) ([]cluster.Node, error) {
+	if s.zoneMetadata == "" || len(nodes) == 0 {
+		return nodes, nil
+	}
+	zones := hostZones(nodes, s.zoneMetadata)
+	hosts := make([]string, 0, len(zones))
+	zoneCount := make(map[string]int)
+	for host, zone := range zones {
+		hosts = append(hosts, host)
+		zoneCount[zone] = 0
+	}
+	appCountMap, err := s.aggregateContainersByHostApp(hosts, appName)
+	if err != nil {
+		return nil, err
+	}
+	for host, count := range appCountMap {
+		zoneCount[zones[host]] += count
+	}
+	minCount := -1
+	for _, count := range zoneCount {
+		if minCount == -1 || count < minCount {
+			minCount = count
+		}
+	}
+	result := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if zoneCount[zones[urlToHost(node.Address)]] == minCount {
+			result = append(result, node)
+		}
+	}
+	return result, nil
+}
+
+// zoneDistribution returns the number of units of each app in each zone. When
+// appName is not empty, only units of the given app are considered.
+func (p *dockerProvisioner) zoneDistribution(zoneKey, appName string) (map[string]map[string]int, error) {
+	nodes, err := p.unfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	zones := hostZones(nodes, zoneKey)
+	query := bson.M{}
+	if appName != "" {
+		query["appname"] = appName
+	}
+	containers, err := p.listContainersBy(query)
+	if err != nil {
+		return nil, err
+	}
+	distribution := make(map[string]map[string]int)
+	for _, c := range containers {
+		if distribution[c.AppName] == nil {
+			distribution[c.AppName] = make(map[string]int)
+		}
+		distribution[c.AppName][zones[c.HostAddr]]++
+	}
+	return distribution, nil
+}
+
+// logZoneDistribution writes the number of units of each app in each zone to
+// the encoder.
+func (p *dockerProvisioner) logZoneDistribution(encoder *json.Encoder, zoneKey string) error {
+	distribution, err := p.zoneDistribution(zoneKey, "")
+	if err != nil {
+		return err
+	}
+	appNames := make([]string, 0, len(distribution))
+	for appName := range distribution {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		zones := make([]string, 0, len(distribution[appName]))
+		for zone, count := range distribution[appName] {
+			zones = append(zones, fmt.Sprintf("%s: %d", zone, count))
+		}
+		sort.Strings(zones)
+		logProgress(encoder, "Units of %q per %s: %s.", appName, zoneKey, strings.Join(zones, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestFilterByZone(c *check.C) {
+	contColl := s.p.collection()
+	defer contColl.Close()
+	err := contColl.Insert(
+		container{ID: "1", AppName: "myapp", HostAddr: "server1"},
+		container{ID: "2", AppName: "myapp", HostAddr: "server2"},
+		container{ID: "3", AppName: "otherapp", HostAddr: "server3"},
+	)
+	c.Assert(err, check.IsNil)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"zone": "a"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"zone": "b"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"zone": "c"}},
+		{Address: "http://server4:1234", Metadata: map[string]string{"zone": "a"}},
+	}
+	sched := segregatedScheduler{provisioner: s.p, zoneMetadata: "zone"}
+	filtered, err := sched.filterByZone(nodes, "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(filtered, check.DeepEquals, []cluster.Node{nodes[2]})
+	filtered, err = sched.filterByZone(nodes, "otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(filtered, check.DeepEquals, []cluster.Node{nodes[0], nodes[1], nodes[3]})
+}
+
+func (s *S) TestFilterByZoneWithoutZoneMetadata(c *check.C) {
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"zone": "a"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"zone": "b"}},
+	}
+	sched := segregatedScheduler{provisioner: s.p}
+	filtered, err := sched.filterByZone(nodes, "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(filtered, check.DeepEquals, nodes)
+}
+
+func (s *S) TestSchedulerScheduleSpreadsAcrossZones(c *check.C) {
+	a := app.App{Name: "impius", Teams: []string{"tsuruteam"}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().RemoveAll(bson.M{"name": a.Name})
+	coll := s.storage.Collection(schedulerCollection)
+	p := Pool{Name: "pool1", Teams: []string{"tsuruteam"}}
+	err = coll.Insert(p)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"_id": p.Name})
+	contColl := s.p.collection()
+	defer contColl.Close()
+	err = contColl.Insert(
+		container{ID: "1", AppName: "otherapp", HostAddr: "url2"},
+		container{ID: "2", AppName: "otherapp", HostAddr: "url2"},
+		container{ID: "3", AppName: a.Name, HostAddr: "url0"},
+	)
+	c.Assert(err, check.IsNil)
+	scheduler := segregatedScheduler{provisioner: s.p, zoneMetadata: "zone"}
+	clusterInstance, err := cluster.New(&scheduler, &cluster.MapStorage{})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url0:1234", map[string]string{"pool": "pool1", "zone": "a"})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url1:1234", map[string]string{"pool": "pool1", "zone": "a"})
+	c.Assert(err, check.IsNil)
+	_, err = clusterInstance.Register("http://url2:1234", map[string]string{"pool": "pool1", "zone": "b"})
+	c.Assert(err, check.IsNil)
+	node, err := scheduler.Schedule(clusterInstance, docker.CreateContainerOptions{}, a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, "http://url2:1234")
+}
+
+func (s *S) TestZoneDistribution(c *check.C) {
+	var p dockerProvisioner
+	var err error
+	p.cluster, err = cluster.New(nil, &cluster.MapStorage{},
+		cluster.Node{Address: "http://server1:1234", Metadata: map[string]string{"zone": "a"}},
+		cluster.Node{Address: "http://server2:1234", Metadata: map[string]string{"zone": "b"}},
+	)
+	c.Assert(err, check.IsNil)
+	coll := p.collection()
+	defer coll.Close()
+	err = coll.Insert(
+		container{ID: "1", AppName: "myapp", HostAddr: "server1"},
+		container{ID: "2", AppName: "myapp", HostAddr: "server2"},
+		container{ID: "3", AppName: "myapp", HostAddr: "server2"},
+		container{ID: "4", AppName: "otherapp", HostAddr: "server1"},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"id": bson.M{"$in": []string{"1", "2", "3", "4"}}})
+	distribution, err := p.zoneDistribution("zone", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(distribution, check.DeepEquals, map[string]map[string]int{
+		"myapp":    {"a": 1, "b": 2},
+		"otherapp": {"a": 1},
+	})
+	distribution, err = p.zoneDistribution("zone", "otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(distribution, check.DeepEquals, map[string]map[string]int{
+		"otherapp": {"a": 1},
+	})
+	var buf bytes.Buffer
+	err = p.logZoneDistribution(json.NewEncoder(&buf), "zone")
+	c.Assert(err, check.IsNil)
+	parts := strings.Split(buf.String(), "\n")
+	var logEntry progressLog
+	json.Unmarshal([]byte(parts[0]), &logEntry)
+	c.Assert(logEntry.Message, check.Equals, `Units of "myapp" per zone: a: 1, b: 2.`)
+	json.Unmarshal([]byte(parts[1]), &logEntry)
+	c.Assert(logEntry.Message, check.Equals, `Units of "otherapp" per zone: a: 1.`)
+}
@@ -0,0 +1,329 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+)
+
+var (
+	errNoProcfile = errors.New("the deployed archive has no Procfile")
+
+	procfileLine = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+	versionName  = regexp.MustCompile(`^v(\d+)$`)
+)
+
+func (p *localProvisioner) ArchiveDeploy(app provision.App, archiveURL string, w io.Writer) (string, error) {
+	archive, err := openArchive(archiveURL)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+	return p.deployArchive(app, archive, w)
+}
+
+func (p *localProvisioner) UploadDeploy(app provision.App, file io.ReadCloser, w io.Writer) (string, error) {
+	defer file.Close()
+	return p.deployArchive(app, file, w)
+}
+
+// ImageDeploy deploys again a version previously unpacked in the work
+// directory, as listed by ValidAppImages.
+func (p *localProvisioner) ImageDeploy(app provision.App, version string, w io.Writer) (string, error) {
+	versions, err := appVersions(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	for _, v := range versions {
+		if v == version {
+			return version, p.deploy(app, version, w)
+		}
+	}
+	return "", fmt.Errorf("invalid version for app %s: %s", app.GetName(), version)
+}
+
+// openArchive opens the archive in the given URL, downloading it when it's
+// an http URL.
+func openArchive(archiveURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return os.Open(u.Path)
+	case "http", "https":
+		resp, err := http.Get(archiveURL)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download archive %s: %s", archiveURL, resp.Status)
+		}
+		return resp.Body, nil
+	}
+	return nil, fmt.Errorf("unsupported archive URL: %s", archiveURL)
+}
+
+func (p *localProvisioner) deployArchive(app provision.App, archive io.Reader, w io.Writer) (string, error) {
+	version, dir, err := newVersionDir(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "\n---- Extracting archive to %s ----\n", dir)
+	err = extractArchive(archive, dir)
+	if err == nil {
+		err = p.deploy(app, version, w)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return version, nil
+}
+
+// appVersions returns the versions of the app unpacked in the work
+// directory, from the oldest to the newest.
+func appVersions(appName string) ([]string, error) {
+	entries, err := ioutil.ReadDir(appDir(appName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, entry := range entries {
+		if m := versionName.FindStringSubmatch(entry.Name()); m != nil && entry.IsDir() {
+			n, _ := strconv.Atoi(m[1])
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	versions := make([]string, len(numbers))
+	for i, n := range numbers {
+		versions[i] = fmt.Sprintf("v%d", n)
+	}
+	return versions, nil
+}
+
+func newVersionDir(appName string) (string, string, error) {
+	versions, err := appVersions(appName)
+	if err != nil {
+		return "", "", err
+	}
+	next := 1
+	if len(versions) > 0 {
+		last, _ := strconv.Atoi(versions[len(versions)-1][1:])
+		next = last + 1
+	}
+	version := fmt.Sprintf("v%d", next)
+	dir := versionDir(appName, version)
+	return version, dir, os.MkdirAll(dir, 0755)
+}
+
+// extractArchive unpacks a tar archive, optionally compressed with gzip, in
+// dir.
+func extractArchive(archive io.Reader, dir string) error {
+	reader := bufio.NewReader(archive)
+	var input io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		input = gzipReader
+	}
+	root := filepath.Clean(dir) + string(filepath.Separator)
+	tarReader := tar.NewReader(input)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, header.Name)
+		if !strings.HasPrefix(target+string(filepath.Separator), root) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			link := header.Linkname
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(filepath.Dir(target), link)
+			}
+			if !strings.HasPrefix(filepath.Clean(link)+string(filepath.Separator), root) {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s", header.Name, header.Linkname)
+			}
+		}
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(target, tarReader, mode)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, content io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, content)
+	return err
+}
+
+// readProcfile returns the commands of the processes declared in the
+// Procfile of the release directory, keyed by process name.
+func readProcfile(dir string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Procfile"))
+	if os.IsNotExist(err) {
+		return nil, errNoProcfile
+	}
+	if err != nil {
+		return nil, err
+	}
+	processes := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if m := procfileLine.FindStringSubmatch(line); m != nil {
+			processes[m[1]] = m[2]
+		}
+	}
+	if len(processes) == 0 {
+		return nil, errNoProcfile
+	}
+	return processes, nil
+}
+
+func processNames(processes map[string]string) []string {
+	names := make([]string, 0, len(processes))
+	for name := range processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// routable reports whether the units of the process should receive requests
+// from the router: only the web process is routed, unless the app has a
+// single process.
+func routable(processes map[string]string, process string) bool {
+	return process == "web" || len(processes) == 1
+}
+
+// deploy replaces the units of the app with units running the given version,
+// keeping the number of units of each process. Processes that had no units
+// get one unit.
+func (p *localProvisioner) deploy(app provision.App, version string, w io.Writer) error {
+	dir := versionDir(app.GetName(), version)
+	processes, err := readProcfile(dir)
+	if err != nil {
+		return err
+	}
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	state := p.appState(app.GetName())
+	p.mut.Lock()
+	oldUnits := state.units
+	p.mut.Unlock()
+	counts := make(map[string]int)
+	for _, u := range oldUnits {
+		counts[u.processName]++
+	}
+	fmt.Fprintf(w, "\n---- Starting units of version %s ----\n", version)
+	var newUnits []*unit
+	for _, name := range processNames(processes) {
+		count := counts[name]
+		if count == 0 {
+			count = 1
+		}
+		units, err := startUnits(app, r, dir, name, processes[name], routable(processes, name), count, w)
+		newUnits = append(newUnits, units...)
+		if err != nil {
+			removeUnits(app, r, newUnits)
+			return err
+		}
+	}
+	p.mut.Lock()
+	state.version = version
+	state.processes = processes
+	state.units = newUnits
+	p.mut.Unlock()
+	if len(oldUnits) > 0 {
+		fmt.Fprintf(w, "\n---- Removing %d old units ----\n", len(oldUnits))
+	}
+	removeUnits(app, r, oldUnits)
+	return nil
+}
+
+// startUnits starts n units of the process and, when the process is
+// routable, adds their routes.
+func startUnits(app provision.App, r router.Router, dir, process, command string, routable bool, n int, w io.Writer) ([]*unit, error) {
+	units := make([]*unit, 0, n)
+	for i := 0; i < n; i++ {
+		u, err := newUnit(app, dir, process, command, routable)
+		if err != nil {
+			return units, err
+		}
+		u.start()
+		units = append(units, u)
+		if routable {
+			err = r.AddRoute(app.GetName(), u.address())
+			if err != nil {
+				return units, err
+			}
+		}
+		fmt.Fprintf(w, " ---> Started unit %s [%s] on port %d\n", u.name, process, u.port)
+	}
+	return units, nil
+}
+
+// removeUnits removes the routes of the units and stops them.
+func removeUnits(app provision.App, r router.Router, units []*unit) {
+	for _, u := range units {
+		if u.routable {
+			err := r.RemoveRoute(app.GetName(), u.address())
+			if err != nil && err != router.ErrRouteNotFound {
+				app.Log(fmt.Sprintf("failed to remove route of unit %s: %s", u.name, err), "tsuru", "api")
+			}
+		}
+		u.stop()
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestExtractArchive(c *check.C) {
+	dir := c.MkDir()
+	archive := buildArchive(c, map[string]string{
+		"Procfile":      "web: ./run",
+		"static/app.js": "alert(1)",
+	})
+	err := extractArchive(archive, dir)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "static", "app.js"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "alert(1)")
+}
+
+func (s *S) TestExtractArchiveWithoutCompression(c *check.C) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	err := tarWriter.WriteHeader(&tar.Header{Name: "Procfile", Mode: 0644, Size: 10})
+	c.Assert(err, check.IsNil)
+	tarWriter.Write([]byte("web: ./run"))
+	c.Assert(tarWriter.Close(), check.IsNil)
+	dir := c.MkDir()
+	err = extractArchive(&buf, dir)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Procfile"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "web: ./run")
+}
+
+func (s *S) TestExtractArchiveOutsideDir(c *check.C) {
+	archive := buildArchive(c, map[string]string{"../evil": "rm -rf /"})
+	err := extractArchive(archive, c.MkDir())
+	c.Assert(err, check.ErrorMatches, "invalid path in archive: ../evil")
+}
+
+func (s *S) TestExtractArchiveSymlinkOutsideDir(c *check.C) {
+	for _, link := range []string{"/etc/passwd", "../../etc/passwd", "static/../../evil"} {
+		var buf bytes.Buffer
+		tarWriter := tar.NewWriter(&buf)
+		err := tarWriter.WriteHeader(&tar.Header{Name: "static/passwd", Typeflag: tar.TypeSymlink, Linkname: link})
+		c.Assert(err, check.IsNil)
+		c.Assert(tarWriter.Close(), check.IsNil)
+		err = extractArchive(&buf, c.MkDir())
+		c.Assert(err, check.ErrorMatches, "invalid symlink in archive: static/passwd -> "+link)
+	}
+}
+
+func (s *S) TestExtractArchiveSymlinkInsideDir(c *check.C) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	err := tarWriter.WriteHeader(&tar.Header{Name: "Procfile", Mode: 0644, Size: 10})
+	c.Assert(err, check.IsNil)
+	tarWriter.Write([]byte("web: ./run"))
+	err = tarWriter.WriteHeader(&tar.Header{Name: "static/Procfile", Typeflag: tar.TypeSymlink, Linkname: "../Procfile"})
+	c.Assert(err, check.IsNil)
+	c.Assert(tarWriter.Close(), check.IsNil)
+	dir := c.MkDir()
+	err = os.MkdirAll(filepath.Join(dir, "static"), 0755)
+	c.Assert(err, check.IsNil)
+	err = extractArchive(&buf, dir)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "static", "Procfile"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "web: ./run")
+}
+
+func (s *S) TestReadProcfile(c *check.C) {
+	dir := c.MkDir()
+	procfile := "web: python app.py --port $PORT\n\n# comment\nworker:celery worker\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "Procfile"), []byte(procfile), 0644)
+	c.Assert(err, check.IsNil)
+	processes, err := readProcfile(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(processes, check.DeepEquals, map[string]string{
+		"web":    "python app.py --port $PORT",
+		"worker": "celery worker",
+	})
+	err = ioutil.WriteFile(filepath.Join(dir, "Procfile"), []byte("# nothing\n"), 0644)
+	c.Assert(err, check.IsNil)
+	_, err = readProcfile(dir)
+	c.Assert(err, check.Equals, errNoProcfile)
+	_, err = readProcfile(c.MkDir())
+	c.Assert(err, check.Equals, errNoProcfile)
+}
@@ -0,0 +1,15 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package local provides a provisioner implementation that runs the processes
+// of apps as local processes, without docker. It's meant for development
+// and integration tests.
+//
+// Deployed archives are unpacked in a directory per version of the app, under
+// the local:workdir setting. Each unit runs a process of the Procfile in the
+// version directory, listening in the port in the PORT environment variable,
+// and is restarted whenever it exits. The environment of the process has only
+// the environment variables of the app and PORT. Units of the web process, or
+// of the only process of the app, are added to the router of the app.
+package local
@@ -0,0 +1,376 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+)
+
+var (
+	errNotDeployed       = errors.New("New units can only be added after the first deployment")
+	errUnitNotFound      = errors.New("unit not found")
+	errShellNotSupported = errors.New("the local provisioner does not support shell")
+)
+
+func init() {
+	provision.Register("local", newLocalProvisioner())
+}
+
+// appState holds the version deployed in an app and its running units. Units
+// live in memory only, they're not restored when the tsuru API restarts.
+type appState struct {
+	version   string
+	processes map[string]string
+	units     []*unit
+}
+
+type localProvisioner struct {
+	mut  sync.Mutex
+	apps map[string]*appState
+}
+
+func newLocalProvisioner() *localProvisioner {
+	return &localProvisioner{apps: make(map[string]*appState)}
+}
+
+func getRouterForApp(app provision.App) (router.Router, error) {
+	routerName, err := app.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+	return router.Get(routerName)
+}
+
+// workDir returns the directory where the archives of the apps are unpacked,
+// configured in local:workdir.
+func workDir() string {
+	dir, _ := config.GetString("local:workdir")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "tsuru-local")
+	}
+	return dir
+}
+
+func appDir(appName string) string {
+	return filepath.Join(workDir(), appName)
+}
+
+func versionDir(appName, version string) string {
+	return filepath.Join(appDir(appName), version)
+}
+
+// appState returns the state of the app, creating it with the last version
+// found in the work directory when the app is unknown.
+func (p *localProvisioner) appState(appName string) *appState {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	state, ok := p.apps[appName]
+	if !ok {
+		state = &appState{}
+		p.apps[appName] = state
+	}
+	if state.version == "" {
+		versions, err := appVersions(appName)
+		if err == nil && len(versions) > 0 {
+			version := versions[len(versions)-1]
+			processes, err := readProcfile(versionDir(appName, version))
+			if err == nil {
+				state.version = version
+				state.processes = processes
+			}
+		}
+	}
+	return state
+}
+
+func (p *localProvisioner) appUnits(appName string) []*unit {
+	state := p.appState(appName)
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	units := make([]*unit, len(state.units))
+	copy(units, state.units)
+	return units
+}
+
+func (p *localProvisioner) findUnit(appName, unitName string) (*unit, error) {
+	for _, u := range p.appUnits(appName) {
+		if u.name == unitName {
+			return u, nil
+		}
+	}
+	return nil, errUnitNotFound
+}
+
+func (p *localProvisioner) Provision(app provision.App) error {
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	err = app.Ready()
+	if err != nil {
+		return err
+	}
+	return r.AddBackend(app.GetName())
+}
+
+func (p *localProvisioner) Destroy(app provision.App) error {
+	for _, u := range p.appUnits(app.GetName()) {
+		u.stop()
+	}
+	p.mut.Lock()
+	delete(p.apps, app.GetName())
+	p.mut.Unlock()
+	err := os.RemoveAll(appDir(app.GetName()))
+	if err != nil {
+		log.Errorf("Failed to remove the directory of app %s: %s", app.GetName(), err)
+	}
+	r, err := getRouterForApp(app)
+	if err != nil {
+		log.Errorf("Failed to get router: %s", err)
+		return err
+	}
+	return r.RemoveBackend(app.GetName())
+}
+
+func (p *localProvisioner) AddUnits(app provision.App, n uint, process string, w io.Writer) ([]provision.Unit, error) {
+	if n == 0 {
+		return nil, errors.New("Cannot add 0 units")
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	state := p.appState(app.GetName())
+	p.mut.Lock()
+	version, processes := state.version, state.processes
+	p.mut.Unlock()
+	if version == "" {
+		return nil, errNotDeployed
+	}
+	process, err := defaultProcess(processes, process)
+	if err != nil {
+		return nil, err
+	}
+	command, ok := processes[process]
+	if !ok {
+		return nil, fmt.Errorf("process %q is not declared in the Procfile", process)
+	}
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return nil, err
+	}
+	units, err := startUnits(app, r, versionDir(app.GetName(), version), process, command, routable(processes, process), int(n), w)
+	if err != nil {
+		removeUnits(app, r, units)
+		return nil, err
+	}
+	p.mut.Lock()
+	state.units = append(state.units, units...)
+	p.mut.Unlock()
+	result := make([]provision.Unit, len(units))
+	for i, u := range units {
+		result[i] = u.asUnit()
+	}
+	return result, nil
+}
+
+// defaultProcess resolves an empty process name to the only process of the
+// app.
+func defaultProcess(processes map[string]string, process string) (string, error) {
+	if process != "" || len(processes) == 0 {
+		return process, nil
+	}
+	if len(processes) > 1 {
+		return "", errors.New("the process name is required for apps with more than one process")
+	}
+	return processNames(processes)[0], nil
+}
+
+func (p *localProvisioner) RemoveUnits(app provision.App, n uint, process string) error {
+	if n < 1 {
+		return errors.New("remove units: units must be at least 1")
+	}
+	state := p.appState(app.GetName())
+	p.mut.Lock()
+	process, err := defaultProcess(state.processes, process)
+	if err != nil {
+		p.mut.Unlock()
+		return err
+	}
+	if n >= uint(len(state.units)) {
+		p.mut.Unlock()
+		return errors.New("remove units: cannot remove all units from app")
+	}
+	var removed, kept []*unit
+	for i := len(state.units) - 1; i >= 0; i-- {
+		u := state.units[i]
+		if u.processName == process && uint(len(removed)) < n {
+			removed = append(removed, u)
+		} else {
+			kept = append([]*unit{u}, kept...)
+		}
+	}
+	if uint(len(removed)) < n {
+		p.mut.Unlock()
+		return fmt.Errorf("remove units: the process %q has only %d units", process, len(removed))
+	}
+	state.units = kept
+	p.mut.Unlock()
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return err
+	}
+	removeUnits(app, r, removed)
+	return nil
+}
+
+func (p *localProvisioner) RemoveUnit(target provision.Unit) error {
+	u, err := p.findUnit(target.AppName, target.Name)
+	if err != nil {
+		return err
+	}
+	state := p.appState(target.AppName)
+	p.mut.Lock()
+	for i, current := range state.units {
+		if current == u {
+			state.units = append(state.units[:i], state.units[i+1:]...)
+			break
+		}
+	}
+	p.mut.Unlock()
+	r, err := getRouterForApp(u.app)
+	if err != nil {
+		return err
+	}
+	removeUnits(u.app, r, []*unit{u})
+	return nil
+}
+
+func (p *localProvisioner) SetUnitStatus(unit provision.Unit, status provision.Status) error {
+	u, err := p.findUnit(unit.AppName, unit.Name)
+	if err != nil {
+		return err
+	}
+	u.setStatus(status)
+	return nil
+}
+
+func (p *localProvisioner) RegisterUnit(unit provision.Unit, customData map[string]interface{}) error {
+	return p.SetUnitStatus(unit, provision.StatusStarted)
+}
+
+// ExecuteCommand runs the command in the release directory of each unit of
+// the app, with the environment of the unit.
+func (p *localProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	units := p.appUnits(app.GetName())
+	if len(units) == 0 {
+		return provision.ErrEmptyApp
+	}
+	for _, u := range units {
+		err := u.run(stdout, stderr, cmd, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *localProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	units := p.appUnits(app.GetName())
+	if len(units) == 0 {
+		return provision.ErrEmptyApp
+	}
+	return units[0].run(stdout, stderr, cmd, args...)
+}
+
+func (u *unit) run(stdout, stderr io.Writer, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = u.dir
+	cmd.Env = u.env()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+func (p *localProvisioner) Restart(app provision.App, w io.Writer) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	for _, u := range p.appUnits(app.GetName()) {
+		u.stop()
+		u.start()
+		fmt.Fprintf(w, " ---> Restarted unit %s [%s]\n", u.name, u.processName)
+	}
+	return nil
+}
+
+// Stop stops the units of the process, or all the units of the app when
+// process is empty. Stopped units keep their routes.
+func (p *localProvisioner) Stop(app provision.App, process string) error {
+	for _, u := range p.appUnits(app.GetName()) {
+		if process == "" || u.processName == process {
+			u.stop()
+		}
+	}
+	return nil
+}
+
+func (p *localProvisioner) Start(app provision.App, process string) error {
+	for _, u := range p.appUnits(app.GetName()) {
+		if process == "" || u.processName == process {
+			u.start()
+		}
+	}
+	return nil
+}
+
+func (p *localProvisioner) Addr(app provision.App) (string, error) {
+	r, err := getRouterForApp(app)
+	if err != nil {
+		return "", err
+	}
+	return r.Addr(app.GetName())
+}
+
+func (p *localProvisioner) Swap(app1, app2 provision.App) error {
+	r, err := getRouterForApp(app1)
+	if err != nil {
+		return err
+	}
+	return r.Swap(app1.GetName(), app2.GetName())
+}
+
+func (p *localProvisioner) Units(app provision.App) []provision.Unit {
+	units := p.appUnits(app.GetName())
+	result := make([]provision.Unit, len(units))
+	for i, u := range units {
+		result[i] = u.asUnit()
+	}
+	return result
+}
+
+func (p *localProvisioner) Shell(app provision.App, conn net.Conn, width, height int, args ...string) error {
+	return errShellNotSupported
+}
+
+func (p *localProvisioner) ValidAppImages(appName string) ([]string, error) {
+	return appVersions(appName)
+}
+
+func (p *localProvisioner) StartupMessage() (string, error) {
+	return fmt.Sprintf("Local provisioner running units from %s.\n", workDir()), nil
+}
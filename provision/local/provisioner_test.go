@@ -0,0 +1,395 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/bind"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func waitFor(c *check.C, cond func() bool) {
+	timeout := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for condition")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func (s *S) deployApp(c *check.C, app provision.App, procfile string) string {
+	archive := buildArchive(c, map[string]string{"Procfile": procfile})
+	version, err := s.p.UploadDeploy(app, ioutil.NopCloser(archive), ioutil.Discard)
+	c.Assert(err, check.IsNil)
+	return version
+}
+
+func (s *S) TestShouldBeRegistered(c *check.C) {
+	p, err := provision.Get("local")
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.FitsTypeOf, &localProvisioner{})
+}
+
+func (s *S) TestProvision(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, true)
+}
+
+func (s *S) TestUploadDeploy(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	archive := buildArchive(c, map[string]string{
+		"Procfile": "web: echo listening on $PORT; sleep 30\nworker: sleep 30\n",
+	})
+	var buf bytes.Buffer
+	version, err := s.p.UploadDeploy(app, ioutil.NopCloser(archive), &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(version, check.Equals, "v1")
+	c.Assert(buf.String(), check.Matches, `(?s).*Started unit myapp-\w+ \[web\].*`)
+	units := s.p.appUnits("myapp")
+	c.Assert(units, check.HasLen, 2)
+	c.Assert(units[0].processName, check.Equals, "web")
+	c.Assert(units[1].processName, check.Equals, "worker")
+	c.Assert(routertest.FakeRouter.HasRoute("myapp", units[0].address()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute("myapp", units[1].address()), check.Equals, false)
+	web := units[0]
+	waitFor(c, func() bool {
+		return app.HasLog("web", web.name, "listening on "+strconv.Itoa(web.port))
+	})
+	_, err = os.Stat(versionDir("myapp", "v1"))
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUploadDeployReplacesUnits(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	_, err = s.p.AddUnits(app, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	oldUnits := s.p.appUnits("myapp")
+	c.Assert(oldUnits, check.HasLen, 2)
+	version := s.deployApp(c, app, "web: sleep 60")
+	c.Assert(version, check.Equals, "v2")
+	units := s.p.appUnits("myapp")
+	c.Assert(units, check.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.command, check.Equals, "sleep 60")
+		c.Assert(routertest.FakeRouter.HasRoute("myapp", u.address()), check.Equals, true)
+	}
+	for _, u := range oldUnits {
+		c.Assert(u.getStatus(), check.Equals, provision.StatusStopped)
+		c.Assert(routertest.FakeRouter.HasRoute("myapp", u.address()), check.Equals, false)
+	}
+	versions, err := s.p.ValidAppImages("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(versions, check.DeepEquals, []string{"v1", "v2"})
+}
+
+func (s *S) TestUploadDeployWithoutProcfile(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	archive := buildArchive(c, map[string]string{"app.py": "print 'hello'"})
+	_, err = s.p.UploadDeploy(app, ioutil.NopCloser(archive), ioutil.Discard)
+	c.Assert(err, check.Equals, errNoProcfile)
+	c.Assert(s.p.Units(app), check.HasLen, 0)
+	versions, err := s.p.ValidAppImages("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(versions, check.HasLen, 0)
+}
+
+func (s *S) TestArchiveDeploy(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	archive := buildArchive(c, map[string]string{"Procfile": "web: sleep 30"})
+	file, err := ioutil.TempFile(c.MkDir(), "archive")
+	c.Assert(err, check.IsNil)
+	defer file.Close()
+	_, err = file.Write(archive.Bytes())
+	c.Assert(err, check.IsNil)
+	version, err := s.p.ArchiveDeploy(app, "file://"+file.Name(), ioutil.Discard)
+	c.Assert(err, check.IsNil)
+	c.Assert(version, check.Equals, "v1")
+	c.Assert(s.p.Units(app), check.HasLen, 1)
+}
+
+func (s *S) TestImageDeploy(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	s.deployApp(c, app, "web: sleep 60")
+	version, err := s.p.ImageDeploy(app, "v1", ioutil.Discard)
+	c.Assert(err, check.IsNil)
+	c.Assert(version, check.Equals, "v1")
+	units := s.p.appUnits("myapp")
+	c.Assert(units, check.HasLen, 1)
+	c.Assert(units[0].command, check.Equals, "sleep 30")
+	_, err = s.p.ImageDeploy(app, "v3", ioutil.Discard)
+	c.Assert(err, check.ErrorMatches, "invalid version for app myapp: v3")
+}
+
+func (s *S) TestAddUnits(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30\nworker: sleep 30")
+	units, err := s.p.AddUnits(app, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.ProcessName, check.Equals, "web")
+		c.Assert(u.Ip, check.Equals, "127.0.0.1")
+		c.Assert(u.Type, check.Equals, "python")
+	}
+	c.Assert(s.p.Units(app), check.HasLen, 4)
+	routes, err := routertest.FakeRouter.Routes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 3)
+	_, err = s.p.AddUnits(app, 1, "", nil)
+	c.Assert(err, check.ErrorMatches, "the process name is required for apps with more than one process")
+	_, err = s.p.AddUnits(app, 1, "clock", nil)
+	c.Assert(err, check.ErrorMatches, `process "clock" is not declared in the Procfile`)
+	_, err = s.p.AddUnits(app, 0, "web", nil)
+	c.Assert(err, check.ErrorMatches, "Cannot add 0 units")
+}
+
+func (s *S) TestAddUnitsSingleProcessIsRouted(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "worker: sleep 30")
+	units, err := s.p.AddUnits(app, 1, "", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+	c.Assert(units[0].ProcessName, check.Equals, "worker")
+	routes, err := routertest.FakeRouter.Routes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+}
+
+func (s *S) TestAddUnitsBeforeDeploy(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	_, err := s.p.AddUnits(app, 1, "web", nil)
+	c.Assert(err, check.Equals, errNotDeployed)
+}
+
+func (s *S) TestAddUnitsAfterRestart(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	for _, u := range s.p.appUnits("myapp") {
+		u.stop()
+	}
+	p := newLocalProvisioner()
+	units, err := p.AddUnits(app, 1, "", nil)
+	c.Assert(err, check.IsNil)
+	defer p.appUnits("myapp")[0].stop()
+	c.Assert(units, check.HasLen, 1)
+	c.Assert(units[0].ProcessName, check.Equals, "web")
+}
+
+func (s *S) TestRemoveUnits(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30\nworker: sleep 30")
+	_, err = s.p.AddUnits(app, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = s.p.RemoveUnits(app, 4, "web")
+	c.Assert(err, check.ErrorMatches, "remove units: cannot remove all units from app")
+	err = s.p.RemoveUnits(app, 2, "worker")
+	c.Assert(err, check.ErrorMatches, `remove units: the process "worker" has only 1 units`)
+	removed := s.p.appUnits("myapp")[2:]
+	err = s.p.RemoveUnits(app, 2, "web")
+	c.Assert(err, check.IsNil)
+	units := s.p.Units(app)
+	c.Assert(units, check.HasLen, 2)
+	c.Assert(units[0].ProcessName, check.Equals, "web")
+	c.Assert(units[1].ProcessName, check.Equals, "worker")
+	for _, u := range removed {
+		c.Assert(u.getStatus(), check.Equals, provision.StatusStopped)
+		c.Assert(routertest.FakeRouter.HasRoute("myapp", u.address()), check.Equals, false)
+	}
+}
+
+func (s *S) TestRemoveUnitsDefaultProcess(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "worker: sleep 30")
+	_, err = s.p.AddUnits(app, 1, "", nil)
+	c.Assert(err, check.IsNil)
+	err = s.p.RemoveUnits(app, 1, "")
+	c.Assert(err, check.IsNil)
+	units := s.p.Units(app)
+	c.Assert(units, check.HasLen, 1)
+	c.Assert(units[0].ProcessName, check.Equals, "worker")
+	s.deployApp(c, app, "web: sleep 30\nworker: sleep 30")
+	err = s.p.RemoveUnits(app, 1, "")
+	c.Assert(err, check.ErrorMatches, "the process name is required for apps with more than one process")
+}
+
+func (s *S) TestRemoveUnit(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	u := s.p.appUnits("myapp")[0]
+	err = s.p.RemoveUnit(u.asUnit())
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Units(app), check.HasLen, 0)
+	c.Assert(routertest.FakeRouter.HasRoute("myapp", u.address()), check.Equals, false)
+	err = s.p.RemoveUnit(u.asUnit())
+	c.Assert(err, check.Equals, errUnitNotFound)
+}
+
+func (s *S) TestUnitIsRestartedWhenItExits(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: echo started >> started.log; exit 1")
+	u := s.p.appUnits("myapp")[0]
+	waitFor(c, func() bool {
+		data, _ := ioutil.ReadFile(u.dir + "/started.log")
+		return string(data) == "started\nstarted\n"
+	})
+}
+
+func (s *S) TestStopAndStart(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30\nworker: sleep 30")
+	err = s.p.Stop(app, "worker")
+	c.Assert(err, check.IsNil)
+	units := s.p.Units(app)
+	c.Assert(units[0].Status, check.Equals, provision.StatusStarting)
+	c.Assert(units[1].Status, check.Equals, provision.StatusStopped)
+	err = s.p.Stop(app, "")
+	c.Assert(err, check.IsNil)
+	units = s.p.Units(app)
+	c.Assert(units[0].Status, check.Equals, provision.StatusStopped)
+	err = s.p.Start(app, "")
+	c.Assert(err, check.IsNil)
+	for _, u := range s.p.Units(app) {
+		c.Assert(u.Status, check.Equals, provision.StatusStarting)
+	}
+}
+
+func (s *S) TestRestart(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: echo started >> started.log; sleep 30")
+	u := s.p.appUnits("myapp")[0]
+	logFile := u.dir + "/started.log"
+	waitFor(c, func() bool {
+		data, _ := ioutil.ReadFile(logFile)
+		return string(data) == "started\n"
+	})
+	var buf bytes.Buffer
+	err = s.p.Restart(app, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, " ---> Restarted unit "+u.name+" [web]\n")
+	waitFor(c, func() bool {
+		data, _ := ioutil.ReadFile(logFile)
+		return string(data) == "started\nstarted\n"
+	})
+}
+
+func (s *S) TestRegisterUnit(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	unit := s.p.Units(app)[0]
+	err = s.p.RegisterUnit(unit, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Units(app)[0].Status, check.Equals, provision.StatusStarted)
+	err = s.p.SetUnitStatus(unit, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Units(app)[0].Status, check.Equals, provision.StatusError)
+}
+
+func (s *S) TestExecuteCommand(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	_, err = s.p.AddUnits(app, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units := s.p.appUnits("myapp")
+	var stdout, stderr bytes.Buffer
+	err = s.p.ExecuteCommand(&stdout, &stderr, app, "/bin/sh", "-c", "cat Procfile; echo; echo $PORT")
+	c.Assert(err, check.IsNil)
+	expected := "web: sleep 30\n" + strconv.Itoa(units[0].port) + "\n" +
+		"web: sleep 30\n" + strconv.Itoa(units[1].port) + "\n"
+	c.Assert(stdout.String(), check.Equals, expected)
+	stdout.Reset()
+	err = s.p.ExecuteCommandOnce(&stdout, &stderr, app, "/bin/sh", "-c", "echo $PORT")
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, strconv.Itoa(units[0].port)+"\n")
+}
+
+func (s *S) TestExecuteCommandEnvironment(c *check.C) {
+	os.Setenv("TSURU_LOCAL_TEST_SECRET", "secret")
+	defer os.Unsetenv("TSURU_LOCAL_TEST_SECRET")
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	app.SetEnv(bind.EnvVar{Name: "DATABASE_HOST", Value: "localhost"})
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	u := s.p.appUnits("myapp")[0]
+	var stdout bytes.Buffer
+	err = s.p.ExecuteCommandOnce(&stdout, ioutil.Discard, app, "/bin/sh", "-c", "echo $DATABASE_HOST $PORT $TSURU_LOCAL_TEST_SECRET")
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "localhost "+strconv.Itoa(u.port)+"\n")
+	c.Assert(u.env(), check.DeepEquals, []string{"DATABASE_HOST=localhost", "PORT=" + strconv.Itoa(u.port)})
+}
+
+func (s *S) TestExecuteCommandWithoutUnits(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.ExecuteCommand(ioutil.Discard, ioutil.Discard, app, "ls")
+	c.Assert(err, check.Equals, provision.ErrEmptyApp)
+	err = s.p.ExecuteCommandOnce(ioutil.Discard, ioutil.Discard, app, "ls")
+	c.Assert(err, check.Equals, provision.ErrEmptyApp)
+}
+
+func (s *S) TestDestroy(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	s.deployApp(c, app, "web: sleep 30")
+	u := s.p.appUnits("myapp")[0]
+	err = s.p.Destroy(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.getStatus(), check.Equals, provision.StatusStopped)
+	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, false)
+	_, err = os.Stat(appDir("myapp"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestShell(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.Shell(app, nil, 80, 24)
+	c.Assert(err, check.Equals, errShellNotSupported)
+}
@@ -0,0 +1,296 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+)
+
+const (
+	unitHost = "127.0.0.1"
+
+	stopTimeout     = 10 * time.Second
+	startTimeout    = time.Minute
+	minRestartDelay = time.Second
+	maxRestartDelay = 30 * time.Second
+)
+
+// unit is a process of the Procfile of an app, running in the release
+// directory of the app. The process is restarted by a supervisor goroutine
+// whenever it exits, until the unit is stopped.
+type unit struct {
+	name        string
+	app         provision.App
+	processName string
+	command     string
+	dir         string
+	port        int
+	routable    bool
+
+	mut    sync.Mutex
+	status provision.Status
+	cmd    *exec.Cmd
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+func newUnit(app provision.App, dir, processName, command string, routable bool) (*unit, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 6)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	return &unit{
+		name:        fmt.Sprintf("%s-%s", app.GetName(), hex.EncodeToString(id)),
+		app:         app,
+		processName: processName,
+		command:     command,
+		dir:         dir,
+		port:        port,
+		routable:    routable,
+		status:      provision.StatusCreated,
+	}, nil
+}
+
+// freePort asks the kernel for a port that is free in the loopback
+// interface.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", unitHost+":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (u *unit) address() string {
+	return fmt.Sprintf("http://%s:%d", unitHost, u.port)
+}
+
+// env returns the environment of the process of the unit: the environment
+// variables of the app and the PORT. The environment of the tsuru server is
+// not inherited.
+func (u *unit) env() []string {
+	appEnvs := u.app.Envs()
+	env := make([]string, 0, len(appEnvs)+1)
+	names := make([]string, 0, len(appEnvs))
+	for name := range appEnvs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, fmt.Sprintf("%s=%s", name, appEnvs[name].Value))
+	}
+	return append(env, "PORT="+strconv.Itoa(u.port))
+}
+
+func (u *unit) getStatus() provision.Status {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	return u.status
+}
+
+func (u *unit) setStatus(status provision.Status) {
+	u.mut.Lock()
+	u.status = status
+	u.mut.Unlock()
+}
+
+func (u *unit) asUnit() provision.Unit {
+	return provision.Unit{
+		Name:        u.name,
+		AppName:     u.app.GetName(),
+		ProcessName: u.processName,
+		Type:        u.app.GetPlatform(),
+		Ip:          unitHost,
+		Status:      u.getStatus(),
+	}
+}
+
+// start launches the supervisor of the unit. Starting a running unit is a
+// no-op.
+func (u *unit) start() {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if u.quit != nil {
+		return
+	}
+	u.quit = make(chan struct{})
+	u.done = make(chan struct{})
+	u.status = provision.StatusStarting
+	go u.supervise(u.quit, u.done)
+}
+
+// stop terminates the process of the unit and its children, killing them if
+// they don't exit in stopTimeout. Stopping a stopped unit is a no-op.
+func (u *unit) stop() {
+	u.mut.Lock()
+	if u.quit == nil {
+		u.mut.Unlock()
+		return
+	}
+	close(u.quit)
+	u.quit = nil
+	done := u.done
+	u.signal(syscall.SIGTERM)
+	u.mut.Unlock()
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		u.mut.Lock()
+		u.signal(syscall.SIGKILL)
+		u.mut.Unlock()
+		<-done
+	}
+}
+
+// signal sends sig to the process group of the unit. The caller must hold
+// u.mut.
+func (u *unit) signal(sig syscall.Signal) {
+	if u.cmd != nil && u.cmd.Process != nil {
+		syscall.Kill(-u.cmd.Process.Pid, sig)
+	}
+}
+
+func (u *unit) supervise(quit, done chan struct{}) {
+	defer close(done)
+	delay := minRestartDelay
+	for {
+		output := &logWriter{app: u.app, source: u.processName, unit: u.name}
+		cmd := exec.Command("/bin/sh", "-c", u.command)
+		cmd.Dir = u.dir
+		cmd.Env = u.env()
+		cmd.Stdout = output
+		cmd.Stderr = output
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		u.mut.Lock()
+		select {
+		case <-quit:
+			u.status = provision.StatusStopped
+			u.mut.Unlock()
+			return
+		default:
+		}
+		err := cmd.Start()
+		if err == nil {
+			u.cmd = cmd
+			u.status = provision.StatusStarting
+		}
+		u.mut.Unlock()
+		if err == nil {
+			startedAt := time.Now()
+			go u.waitListening(cmd)
+			err = cmd.Wait()
+			output.Flush()
+			if time.Since(startedAt) > maxRestartDelay {
+				delay = minRestartDelay
+			}
+		}
+		u.mut.Lock()
+		u.cmd = nil
+		select {
+		case <-quit:
+			u.status = provision.StatusStopped
+			u.mut.Unlock()
+			return
+		default:
+		}
+		u.status = provision.StatusError
+		u.mut.Unlock()
+		log.Errorf("[local] unit %s exited (%v), restarting in %s", u.name, err, delay)
+		select {
+		case <-quit:
+			u.setStatus(provision.StatusStopped)
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// waitListening marks the unit as started once its process accepts
+// connections in the port of the unit.
+func (u *unit) waitListening(cmd *exec.Cmd) {
+	address := net.JoinHostPort(unitHost, strconv.Itoa(u.port))
+	timeout := time.After(startTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			u.mut.Lock()
+			if u.cmd == cmd && u.status == provision.StatusStarting {
+				u.status = provision.StatusStarted
+			}
+			u.mut.Unlock()
+			return
+		}
+		select {
+		case <-timeout:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		u.mut.Lock()
+		running := u.cmd == cmd
+		u.mut.Unlock()
+		if !running {
+			return
+		}
+	}
+}
+
+// logWriter sends each line written by the process of a unit to the logs of
+// the app.
+type logWriter struct {
+	app    provision.App
+	source string
+	unit   string
+	mut    sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.buf.Write(data)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			w.buf.Write(line)
+			break
+		}
+		w.app.Log(string(bytes.TrimRight(line, "\r\n")), w.source, w.unit)
+	}
+	return len(data), nil
+}
+
+// Flush sends the last line written by the process, when it doesn't end
+// with a newline.
+func (w *logWriter) Flush() {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.buf.Len() > 0 {
+		w.app.Log(w.buf.String(), w.source, w.unit)
+		w.buf.Reset()
+	}
+}
@@ -19,6 +19,28 @@ var ErrInvalidStatus = errors.New("invalid status")
 
 var ErrEmptyApp = errors.New("no units for this app")
 
+var ErrProcessRequired = errors.New("the app runs multiple processes and none of them is web, the process is required")
+
+// DefaultProcess returns the process run by units added to or removed from an
+// app without naming a process, given the processes of the app: the only
+// process of the app, or the web process when the app has many. It returns an
+// empty string for apps without processes, whose units run all the commands
+// of the app.
+func DefaultProcess(processes []string) (string, error) {
+	switch len(processes) {
+	case 0:
+		return "", nil
+	case 1:
+		return processes[0], nil
+	}
+	for _, process := range processes {
+		if process == "web" {
+			return process, nil
+		}
+	}
+	return "", ErrProcessRequired
+}
+
 // Status represents the status of a unit in tsuru.
 type Status string
 
@@ -40,6 +62,8 @@ func ParseStatus(status string) (Status, error) {
 		return StatusStarting, nil
 	case "stopped":
 		return StatusStopped, nil
+	case "asleep":
+		return StatusAsleep, nil
 	}
 	return Status(""), ErrInvalidStatus
 }
@@ -87,16 +111,21 @@ const (
 
 	// StatusStopped is for cases where the unit has been stopped.
 	StatusStopped = Status("stopped")
+
+	// StatusAsleep is for units stopped because the app was idle, they're
+	// started again on the next request sent to the app.
+	StatusAsleep = Status("asleep")
 )
 
 // Unit represents a provision unit. Can be a machine, container or anything
 // IP-addressable.
 type Unit struct {
-	Name    string
-	AppName string
-	Type    string
-	Ip      string
-	Status  Status
+	Name        string
+	AppName     string
+	ProcessName string
+	Type        string
+	Ip          string
+	Status      Status
 }
 
 // GetIp returns the Unit.IP.
@@ -189,6 +218,80 @@ type ImageDeployer interface {
 	ImageDeploy(app App, image string, w io.Writer) (string, error)
 }
 
+// DockerfileDeployer is a provisioner that can deploy the application from
+// an uploaded build context, a tar archive containing a Dockerfile.
+type DockerfileDeployer interface {
+	DockerfileDeploy(app App, buildContext io.ReadCloser, w io.Writer) (string, error)
+}
+
+// CanaryDeployer is a provisioner that supports canary deploys, where the
+// new version of the application runs alongside the current one, receiving
+// only a percentage of the traffic until it's promoted or aborted.
+type CanaryDeployer interface {
+	// StartCanary makes the next deploy of the app a canary deploy, in
+	// which new units receive weight percent of the app traffic.
+	StartCanary(app App, weight int) error
+
+	// SetCanaryWeight changes the percentage of traffic sent to the units
+	// of an ongoing canary deploy.
+	SetCanaryWeight(app App, weight int) error
+
+	// PromoteCanary replaces all units of the app with units running the
+	// canary version.
+	PromoteCanary(app App, w io.Writer) error
+
+	// AbortCanary removes the canary units, sending all the traffic back
+	// to the units running the current version.
+	AbortCanary(app App, w io.Writer) error
+}
+
+// RollingDeployer is a provisioner that can replace the units of an app in
+// batches during a deploy. The settings of a rolling deploy are carried by
+// the app given to the deploy methods, see RollingDeployApp.
+type RollingDeployer interface {
+	// ValidateRollingDeploy checks whether the provisioner is able to run a
+	// rolling deploy with the given settings.
+	ValidateRollingDeploy(settings TsuruYamlDeploy) error
+}
+
+// RollingDeployApp is an app given to the deploy methods of a provisioner,
+// carrying the rolling deploy settings of that deploy, which override the
+// ones in the tsuru.yaml.
+type RollingDeployApp interface {
+	App
+
+	RollingDeploy() TsuruYamlDeploy
+}
+
+// PoolProvisioner is a provisioner that groups its nodes in pools, letting
+// each app choose the pool where its units run.
+type PoolProvisioner interface {
+	// ValidateAppPool checks whether apps owned by the team may run in the
+	// pool, returning the pool to be used by the app. An empty pool selects
+	// the default pool of the team, if there's one.
+	ValidateAppPool(team, pool string) (string, error)
+
+	// AppPool returns the pool where the units of the app run, which is
+	// chosen by the provisioner for apps without a pool.
+	AppPool(app App) (string, error)
+
+	// MoveUnitsToPool replaces the units of the app with new units in the
+	// nodes of the pool. It's called after the pool of the app is changed.
+	MoveUnitsToPool(app App, pool string, w io.Writer) error
+}
+
+// UnitFileCopier is a provisioner that can copy files to and from the units
+// of apps, using tar archives.
+type UnitFileCopier interface {
+	// DownloadUnitFiles writes to w a tar archive with the file or
+	// directory at path in the unit.
+	DownloadUnitFiles(app App, unit Unit, path string, w io.Writer) error
+
+	// UploadUnitFiles extracts the tar archive read from r into the
+	// directory at path in the unit.
+	UploadUnitFiles(app App, unit Unit, path string, r io.Reader) error
+}
+
 // Provisioner is the basic interface of this package.
 //
 // Any tsuru provisioner must implement this interface in order to provision
@@ -201,14 +304,18 @@ type Provisioner interface {
 	Destroy(App) error
 
 	// AddUnits adds units to an app. The first parameter is the app, the
-	// second is the number of units to be added.
+	// second is the number of units to be added and the third is the name
+	// of the process, from the app Procfile, that the units will run. An
+	// empty process name means the default process of the app, as returned
+	// by DefaultProcess.
 	//
 	// It returns a slice containing all added units
-	AddUnits(App, uint, io.Writer) ([]Unit, error)
+	AddUnits(App, uint, string, io.Writer) ([]Unit, error)
 
 	// RemoveUnits "undoes" AddUnits, removing the given number of units
-	// from the app.
-	RemoveUnits(App, uint) error
+	// running the given process from the app. An empty process name means
+	// the default process of the app, as in AddUnits.
+	RemoveUnits(App, uint, string) error
 
 	// RemoveUnit removes a unit from the app. It receives the unit to be
 	// removed.
@@ -224,10 +331,14 @@ type Provisioner interface {
 	ExecuteCommandOnce(stdout, stderr io.Writer, app App, cmd string, args ...string) error
 
 	Restart(App, io.Writer) error
-	Stop(App) error
 
-	// Start start the app units.
-	Start(App) error
+	// Stop stops the app units running the given process, or all the units
+	// when the process name is empty.
+	Stop(App, string) error
+
+	// Start starts the app units running the given process, or all the
+	// units when the process name is empty.
+	Start(App, string) error
 
 	// Addr returns the address for an app.
 	//
@@ -321,17 +432,77 @@ type TsuruYamlRestartHooks struct {
 type TsuruYamlHooks struct {
 	Restart TsuruYamlRestartHooks
 	Build   []string
+	Release []string
 }
 
+// TsuruYamlHealthcheck holds the healthcheck run on new units during deploys.
+// Type is one of "http" (the default), "tcp" or "command". Timeout, Interval
+// and MaxTime are in seconds.
 type TsuruYamlHealthcheck struct {
+	Type            string
 	Path            string
 	Method          string
 	Status          int
 	Match           string
+	Headers         map[string]string
+	Command         string
 	AllowedFailures int `json:"allowed_failures"`
+	Timeout         int
+	Interval        int
+	MaxTime         int `json:"max_time" bson:"max_time"`
+}
+
+// TsuruYamlLiveness holds the liveness check of an app, probed continuously
+// on its running units. Interval and Timeout are in seconds, units failing
+// FailureThreshold consecutive checks are healed.
+type TsuruYamlLiveness struct {
+	Path             string
+	Interval         int
+	Timeout          int
+	FailureThreshold int `json:"failure_threshold" bson:"failure_threshold"`
+}
+
+// TsuruYamlDeploy holds the rolling deploy settings of an app. When any of
+// them is set, units are replaced in batches of MaxSurge+MaxUnavailable units.
+type TsuruYamlDeploy struct {
+	MaxSurge       int `json:"max_surge" bson:"max_surge"`
+	MaxUnavailable int `json:"max_unavailable" bson:"max_unavailable"`
+}
+
+// Rolling returns whether the settings enable rolling deploys.
+func (d TsuruYamlDeploy) Rolling() bool {
+	return d.MaxSurge > 0 || d.MaxUnavailable > 0
+}
+
+// RollingDeploySettings returns the rolling deploy settings carried by an app
+// given to a deploy, or empty settings when the app doesn't carry them.
+func RollingDeploySettings(app App) TsuruYamlDeploy {
+	if a, ok := app.(RollingDeployApp); ok {
+		return a.RollingDeploy()
+	}
+	return TsuruYamlDeploy{}
+}
+
+// TsuruYamlSleep holds the sleep settings of an app. When IdleTime is set,
+// the units of the app are put to sleep after IdleTime minutes without
+// requests.
+type TsuruYamlSleep struct {
+	IdleTime int `json:"idle_time" bson:"idle_time"`
+}
+
+// TsuruYamlPort is a port exposed by the units of an app besides its main
+// HTTP port. Protocol is "tcp" (the default) or "http". Connections to an
+// external port allocated to the app are forwarded to the port.
+type TsuruYamlPort struct {
+	Port     int
+	Protocol string
 }
 
 type TsuruYamlData struct {
 	Hooks       TsuruYamlHooks
 	Healthcheck TsuruYamlHealthcheck
+	Liveness    TsuruYamlLiveness
+	Deploy      TsuruYamlDeploy
+	Sleep       TsuruYamlSleep
+	Ports       []TsuruYamlPort
 }
@@ -71,6 +71,7 @@ func (ProvisionSuite) TestStatuses(c *check.C) {
 	c.Check(StatusStarted.String(), check.Equals, "started")
 	c.Check(StatusStopped.String(), check.Equals, "stopped")
 	c.Check(StatusStarting.String(), check.Equals, "starting")
+	c.Check(StatusAsleep.String(), check.Equals, "asleep")
 }
 
 func (ProvisionSuite) TestParseStatus(c *check.C) {
@@ -85,6 +86,7 @@ func (ProvisionSuite) TestParseStatus(c *check.C) {
 		{"started", StatusStarted, nil},
 		{"stopped", StatusStopped, nil},
 		{"starting", StatusStarting, nil},
+		{"asleep", StatusAsleep, nil},
 		{"something", Status(""), ErrInvalidStatus},
 		{"otherthing", Status(""), ErrInvalidStatus},
 	}
@@ -116,3 +118,22 @@ func (ProvisionSuite) TestUnitGetIp(c *check.C) {
 	u := Unit{Ip: "10.3.3.1"}
 	c.Assert(u.Ip, check.Equals, u.GetIp())
 }
+
+func (ProvisionSuite) TestDefaultProcess(c *check.C) {
+	var tests = []struct {
+		processes []string
+		expected  string
+		err       error
+	}{
+		{nil, "", nil},
+		{[]string{""}, "", nil},
+		{[]string{"worker"}, "worker", nil},
+		{[]string{"worker", "web"}, "web", nil},
+		{[]string{"worker", "clock"}, "", ErrProcessRequired},
+	}
+	for _, t := range tests {
+		process, err := DefaultProcess(t.processes)
+		c.Check(process, check.Equals, t.expected)
+		c.Check(err, check.Equals, t.err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"sync"
 	"time"
@@ -344,6 +345,37 @@ func (p *FakeProvisioner) Stops(app provision.App) int {
 	return p.apps[app.GetName()].stops
 }
 
+// CanaryWeight returns the traffic weight of the ongoing canary deploy of the
+// given app, or zero if there's no canary deploy.
+func (p *FakeProvisioner) CanaryWeight(app provision.App) int {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].canary
+}
+
+// RollingDeploy returns the rolling deploy settings used by the last deploy
+// of the given app.
+func (p *FakeProvisioner) RollingDeploy(app provision.App) provision.TsuruYamlDeploy {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].rolling
+}
+
+// Pool returns the pool where the units of the given app were moved to by
+// MoveUnitsToPool.
+func (p *FakeProvisioner) Pool(app provision.App) string {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].pool
+}
+
+// UnitFiles returns the archive uploaded to the path in the unit of the app.
+func (p *FakeProvisioner) UnitFiles(app provision.App, unitName, path string) []byte {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].unitFiles[unitName+":"+path]
+}
+
 func (p *FakeProvisioner) CustomData(app provision.App) map[string]interface{} {
 	p.mut.RLock()
 	defer p.mut.RUnlock()
@@ -456,6 +488,7 @@ func (p *FakeProvisioner) GitDeploy(app provision.App, version string, w io.Writ
 		return "", errNotProvisioned
 	}
 	w.Write([]byte("Git deploy called"))
+	pApp.rolling = provision.RollingDeploySettings(app)
 	pApp.version = version
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
@@ -472,6 +505,7 @@ func (p *FakeProvisioner) ArchiveDeploy(app provision.App, archiveURL string, w
 		return "", errNotProvisioned
 	}
 	w.Write([]byte("Archive deploy called"))
+	pApp.rolling = provision.RollingDeploySettings(app)
 	pApp.lastArchive = archiveURL
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
@@ -488,11 +522,29 @@ func (p *FakeProvisioner) UploadDeploy(app provision.App, file io.ReadCloser, w
 		return "", errNotProvisioned
 	}
 	w.Write([]byte("Upload deploy called"))
+	pApp.rolling = provision.RollingDeploySettings(app)
 	pApp.lastFile = file
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
 }
 
+func (p *FakeProvisioner) DockerfileDeploy(app provision.App, buildContext io.ReadCloser, w io.Writer) (string, error) {
+	if err := p.getError("DockerfileDeploy"); err != nil {
+		return "", err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return "", errNotProvisioned
+	}
+	w.Write([]byte("Dockerfile deploy called"))
+	pApp.rolling = provision.RollingDeploySettings(app)
+	pApp.lastFile = buildContext
+	p.apps[app.GetName()] = pApp
+	return "app-image", nil
+}
+
 func (p *FakeProvisioner) ImageDeploy(app provision.App, img string, w io.Writer) (string, error) {
 	if err := p.getError("ImageDeploy"); err != nil {
 		return "", err
@@ -504,10 +556,138 @@ func (p *FakeProvisioner) ImageDeploy(app provision.App, img string, w io.Writer
 		return "", errNotProvisioned
 	}
 	w.Write([]byte("Image deploy called"))
+	pApp.rolling = provision.RollingDeploySettings(app)
 	p.apps[app.GetName()] = pApp
 	return img, nil
 }
 
+func (p *FakeProvisioner) ValidateRollingDeploy(settings provision.TsuruYamlDeploy) error {
+	return p.getError("ValidateRollingDeploy")
+}
+
+func (p *FakeProvisioner) StartCanary(app provision.App, weight int) error {
+	if err := p.getError("StartCanary"); err != nil {
+		return err
+	}
+	return p.setCanary(app, weight)
+}
+
+func (p *FakeProvisioner) SetCanaryWeight(app provision.App, weight int) error {
+	if err := p.getError("SetCanaryWeight"); err != nil {
+		return err
+	}
+	p.mut.RLock()
+	canary := p.apps[app.GetName()].canary
+	p.mut.RUnlock()
+	if canary == 0 {
+		return errors.New("no canary deploy in progress")
+	}
+	return p.setCanary(app, weight)
+}
+
+func (p *FakeProvisioner) PromoteCanary(app provision.App, w io.Writer) error {
+	if err := p.getError("PromoteCanary"); err != nil {
+		return err
+	}
+	w.Write([]byte("Canary promoted"))
+	return p.setCanary(app, 0)
+}
+
+func (p *FakeProvisioner) AbortCanary(app provision.App, w io.Writer) error {
+	if err := p.getError("AbortCanary"); err != nil {
+		return err
+	}
+	w.Write([]byte("Canary aborted"))
+	return p.setCanary(app, 0)
+}
+
+func (p *FakeProvisioner) setCanary(app provision.App, weight int) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	pApp.canary = weight
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+func (p *FakeProvisioner) ValidateAppPool(team, pool string) (string, error) {
+	if err := p.getError("ValidateAppPool"); err != nil {
+		return "", err
+	}
+	return pool, nil
+}
+
+func (p *FakeProvisioner) AppPool(app provision.App) (string, error) {
+	if err := p.getError("AppPool"); err != nil {
+		return "", err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return "", errNotProvisioned
+	}
+	return pApp.pool, nil
+}
+
+func (p *FakeProvisioner) MoveUnitsToPool(app provision.App, pool string, w io.Writer) error {
+	if err := p.getError("MoveUnitsToPool"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	pApp.pool = pool
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+func (p *FakeProvisioner) DownloadUnitFiles(app provision.App, unit provision.Unit, path string, w io.Writer) error {
+	if err := p.getError("DownloadUnitFiles"); err != nil {
+		return err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	data, ok := pApp.unitFiles[unit.Name+":"+path]
+	if !ok {
+		return fmt.Errorf("%s: no such file or directory", path)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (p *FakeProvisioner) UploadUnitFiles(app provision.App, unit provision.Unit, path string, r io.Reader) error {
+	if err := p.getError("UploadUnitFiles"); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	if pApp.unitFiles == nil {
+		pApp.unitFiles = make(map[string][]byte)
+	}
+	pApp.unitFiles[unit.Name+":"+path] = data
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
 func (p *FakeProvisioner) Provision(app provision.App) error {
 	if err := p.getError("Provision"); err != nil {
 		return err
@@ -542,7 +722,7 @@ func (p *FakeProvisioner) Restart(app provision.App, w io.Writer) error {
 	return nil
 }
 
-func (p *FakeProvisioner) Start(app provision.App) error {
+func (p *FakeProvisioner) Start(app provision.App, process string) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
 	pApp, ok := p.apps[app.GetName()]
@@ -550,6 +730,12 @@ func (p *FakeProvisioner) Start(app provision.App) error {
 		return errNotProvisioned
 	}
 	pApp.starts++
+	for i, u := range pApp.units {
+		if process == "" || u.ProcessName == process {
+			u.Status = provision.StatusStarted
+			pApp.units[i] = u
+		}
+	}
 	p.apps[app.GetName()] = pApp
 	return nil
 }
@@ -567,7 +753,24 @@ func (p *FakeProvisioner) Destroy(app provision.App) error {
 	return nil
 }
 
-func (p *FakeProvisioner) AddUnits(app provision.App, n uint, w io.Writer) ([]provision.Unit, error) {
+// defaultProcess resolves an empty process to the default process of the
+// app, based on the processes run by its units.
+func defaultProcess(units []provision.Unit, process string) (string, error) {
+	if process != "" {
+		return process, nil
+	}
+	var processes []string
+	seen := make(map[string]bool)
+	for _, u := range units {
+		if !seen[u.ProcessName] {
+			seen[u.ProcessName] = true
+			processes = append(processes, u.ProcessName)
+		}
+	}
+	return provision.DefaultProcess(processes)
+}
+
+func (p *FakeProvisioner) AddUnits(app provision.App, n uint, process string, w io.Writer) ([]provision.Unit, error) {
 	if err := p.getError("AddUnits"); err != nil {
 		return nil, err
 	}
@@ -580,16 +783,21 @@ func (p *FakeProvisioner) AddUnits(app provision.App, n uint, w io.Writer) ([]pr
 	if !ok {
 		return nil, errNotProvisioned
 	}
+	process, err := defaultProcess(pApp.units, process)
+	if err != nil {
+		return nil, err
+	}
 	name := app.GetName()
 	platform := app.GetPlatform()
 	length := uint(len(pApp.units))
 	for i := uint(0); i < n; i++ {
 		unit := provision.Unit{
-			Name:    fmt.Sprintf("%s-%d", name, pApp.unitLen),
-			AppName: name,
-			Type:    platform,
-			Status:  provision.StatusStarted,
-			Ip:      fmt.Sprintf("10.10.10.%d", length+i+1),
+			Name:        fmt.Sprintf("%s-%d", name, pApp.unitLen),
+			AppName:     name,
+			ProcessName: process,
+			Type:        platform,
+			Status:      provision.StatusStarted,
+			Ip:          fmt.Sprintf("10.10.10.%d", length+i+1),
 		}
 		pApp.units = append(pApp.units, unit)
 		pApp.unitLen++
@@ -603,7 +811,7 @@ func (p *FakeProvisioner) AddUnits(app provision.App, n uint, w io.Writer) ([]pr
 	return result, nil
 }
 
-func (p *FakeProvisioner) RemoveUnits(app provision.App, n uint) error {
+func (p *FakeProvisioner) RemoveUnits(app provision.App, n uint, process string) error {
 	if err := p.getError("RemoveUnits"); err != nil {
 		return err
 	}
@@ -616,7 +824,23 @@ func (p *FakeProvisioner) RemoveUnits(app provision.App, n uint) error {
 	if n >= uint(len(pApp.units)) {
 		return errors.New("too many units to remove")
 	}
-	pApp.units = pApp.units[int(n):]
+	process, err := defaultProcess(pApp.units, process)
+	if err != nil {
+		return err
+	}
+	var units []provision.Unit
+	removed := uint(0)
+	for _, u := range pApp.units {
+		if removed < n && u.ProcessName == process {
+			removed++
+			continue
+		}
+		units = append(units, u)
+	}
+	if removed < n {
+		return errors.New("too many units to remove")
+	}
+	pApp.units = units
 	pApp.unitLen -= int(n)
 	p.apps[app.GetName()] = pApp
 	return nil
@@ -822,7 +1046,7 @@ func (p *FakeProvisioner) HasCName(app provision.App, cname string) bool {
 	return false
 }
 
-func (p *FakeProvisioner) Stop(app provision.App) error {
+func (p *FakeProvisioner) Stop(app provision.App, process string) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
 	pApp, ok := p.apps[app.GetName()]
@@ -831,8 +1055,10 @@ func (p *FakeProvisioner) Stop(app provision.App) error {
 	}
 	pApp.stops++
 	for i, u := range pApp.units {
-		u.Status = provision.StatusStopped
-		pApp.units[i] = u
+		if process == "" || u.ProcessName == process {
+			u.Status = provision.StatusStopped
+			pApp.units[i] = u
+		}
 	}
 	p.apps[app.GetName()] = pApp
 	return nil
@@ -986,6 +1212,10 @@ type provisionedApp struct {
 	addr        string
 	unitLen     int
 	lastData    map[string]interface{}
+	canary      int
+	rolling     provision.TsuruYamlDeploy
+	pool        string
+	unitFiles   map[string][]byte
 }
 
 type provisionedPlatform struct {
@@ -467,7 +467,7 @@ func (s *S) TestStart(c *check.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	err := p.Start(app)
+	err := p.Start(app, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(p.Starts(app), check.Equals, 1)
 }
@@ -476,11 +476,29 @@ func (s *S) TestStop(c *check.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	err := p.Stop(app)
+	err := p.Stop(app, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(p.Stops(app), check.Equals, 1)
 }
 
+func (s *S) TestStopProcess(c *check.C) {
+	app := NewFakeApp("kid-gloves", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	_, err := p.AddUnits(app, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	_, err = p.AddUnits(app, 1, "worker", nil)
+	c.Assert(err, check.IsNil)
+	err = p.Stop(app, "worker")
+	c.Assert(err, check.IsNil)
+	units := p.GetUnits(app)
+	c.Assert(units[0].Status, check.Equals, provision.StatusStarted)
+	c.Assert(units[1].Status, check.Equals, provision.StatusStopped)
+	err = p.Start(app, "worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.GetUnits(app)[1].Status, check.Equals, provision.StatusStarted)
+}
+
 func (s *S) TestRestartNotProvisioned(c *check.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
@@ -526,7 +544,7 @@ func (s *S) TestAddUnits(c *check.C) {
 	app := NewFakeApp("mystic-rhythms", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	units, err := p.AddUnits(app, 2, nil)
+	units, err := p.AddUnits(app, 2, "", nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(p.GetUnits(app), check.HasLen, 2)
 	c.Assert(units, check.HasLen, 2)
@@ -537,7 +555,7 @@ func (s *S) TestAddUnitsCopiesTheUnitsSlice(c *check.C) {
 	p := NewFakeProvisioner()
 	p.Provision(app)
 	defer p.Destroy(app)
-	units, err := p.AddUnits(app, 3, nil)
+	units, err := p.AddUnits(app, 3, "", nil)
 	c.Assert(err, check.IsNil)
 	units[0].Name = "something-else"
 	c.Assert(units[0].Name, check.Not(check.Equals), p.GetUnits(app)[1].Name)
@@ -545,7 +563,7 @@ func (s *S) TestAddUnitsCopiesTheUnitsSlice(c *check.C) {
 
 func (s *S) TestAddZeroUnits(c *check.C) {
 	p := NewFakeProvisioner()
-	units, err := p.AddUnits(nil, 0, nil)
+	units, err := p.AddUnits(nil, 0, "", nil)
 	c.Assert(units, check.IsNil)
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "Cannot add 0 units.")
@@ -554,7 +572,7 @@ func (s *S) TestAddZeroUnits(c *check.C) {
 func (s *S) TestAddUnitsUnprovisionedApp(c *check.C) {
 	app := NewFakeApp("mystic-rhythms", "rush", 0)
 	p := NewFakeProvisioner()
-	units, err := p.AddUnits(app, 1, nil)
+	units, err := p.AddUnits(app, 1, "", nil)
 	c.Assert(units, check.IsNil)
 	c.Assert(err, check.Equals, errNotProvisioned)
 }
@@ -562,7 +580,7 @@ func (s *S) TestAddUnitsUnprovisionedApp(c *check.C) {
 func (s *S) TestAddUnitsFailure(c *check.C) {
 	p := NewFakeProvisioner()
 	p.PrepareFailure("AddUnits", errors.New("Cannot add more units."))
-	units, err := p.AddUnits(nil, 10, nil)
+	units, err := p.AddUnits(nil, 10, "", nil)
 	c.Assert(units, check.IsNil)
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "Cannot add more units.")
@@ -572,21 +590,41 @@ func (s *S) TestRemoveUnits(c *check.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 5, nil)
+	_, err := p.AddUnits(app, 5, "", nil)
 	c.Assert(err, check.IsNil)
-	err = p.RemoveUnits(app, 3)
+	err = p.RemoveUnits(app, 3, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(p.GetUnits(app), check.HasLen, 2)
 	c.Assert(p.GetUnits(app)[0].Name, check.Equals, "hemispheres-3")
 }
 
+func (s *S) TestAddAndRemoveUnitsWithProcess(c *check.C) {
+	app := NewFakeApp("hemispheres", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	units, err := p.AddUnits(app, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(units[0].ProcessName, check.Equals, "web")
+	_, err = p.AddUnits(app, 2, "worker", nil)
+	c.Assert(err, check.IsNil)
+	err = p.RemoveUnits(app, 2, "worker")
+	c.Assert(err, check.IsNil)
+	units = p.GetUnits(app)
+	c.Assert(units, check.HasLen, 2)
+	c.Assert(units[0].ProcessName, check.Equals, "web")
+	c.Assert(units[1].ProcessName, check.Equals, "web")
+	err = p.RemoveUnits(app, 1, "worker")
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "too many units to remove")
+}
+
 func (s *S) TestRemoveUnitsTooManyUnits(c *check.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 1, nil)
+	_, err := p.AddUnits(app, 1, "", nil)
 	c.Assert(err, check.IsNil)
-	err = p.RemoveUnits(app, 3)
+	err = p.RemoveUnits(app, 3, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "too many units to remove")
 }
@@ -594,14 +632,14 @@ func (s *S) TestRemoveUnitsTooManyUnits(c *check.C) {
 func (s *S) TestRemoveUnitsUnprovisionedApp(c *check.C) {
 	app := NewFakeApp("tears", "bruce", 0)
 	p := NewFakeProvisioner()
-	err := p.RemoveUnits(app, 1)
+	err := p.RemoveUnits(app, 1, "")
 	c.Assert(err, check.Equals, errNotProvisioned)
 }
 
 func (s *S) TestRemoveUnitsFailure(c *check.C) {
 	p := NewFakeProvisioner()
 	p.PrepareFailure("RemoveUnits", errors.New("This program has performed an illegal operation."))
-	err := p.RemoveUnits(nil, 0)
+	err := p.RemoveUnits(nil, 0, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "This program has performed an illegal operation.")
 }
@@ -610,7 +648,7 @@ func (s *S) TestRemoveUnit(c *check.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	units, err := p.AddUnits(app, 2, nil)
+	units, err := p.AddUnits(app, 2, "", nil)
 	c.Assert(err, check.IsNil)
 	err = p.RemoveUnit(units[0])
 	c.Assert(err, check.IsNil)
@@ -622,7 +660,7 @@ func (s *S) TestRemoveUnitNotFound(c *check.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	units, err := p.AddUnits(app, 2, nil)
+	units, err := p.AddUnits(app, 2, "", nil)
 	c.Assert(err, check.IsNil)
 	err = p.RemoveUnit(provision.Unit{Name: units[0].Name + "wat", AppName: "hemispheres"})
 	c.Assert(err, check.NotNil)
@@ -29,6 +29,7 @@ type BackendParams struct {
 	Ip          string `json:"ip"`
 	Port        int    `json:"port"`
 	BackendPool string `json:"backendpool"`
+	Weight      int    `json:"weight,omitempty"`
 }
 
 type RuleParams struct {
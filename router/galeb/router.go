@@ -171,6 +171,17 @@ func (r *galebRouter) RemoveBackend(name string) error {
 }
 
 func (r *galebRouter) AddRoute(name, address string) error {
+	return r.addRoute(name, address, 0)
+}
+
+func (r *galebRouter) AddWeightedRoute(name, address string, weight int) error {
+	if weight < 1 {
+		return router.ErrInvalidWeight
+	}
+	return r.addRoute(name, address, weight)
+}
+
+func (r *galebRouter) addRoute(name, address string, weight int) error {
 	backendName, err := router.Retrieve(name)
 	if err != nil {
 		return err
@@ -183,22 +194,86 @@ func (r *galebRouter) AddRoute(name, address string) error {
 	if err != nil {
 		return err
 	}
+	address = hostFromAddress(address)
+	backendId, err := client.AddBackend(backendParams(address, data.BackendPoolId, weight))
+	if err != nil {
+		return err
+	}
+	return data.addReal(address, backendId, weight)
+}
+
+// SetRouteWeight replaces the backend of the route in galeb, as the weight of
+// an existing backend cannot be updated.
+func (r *galebRouter) SetRouteWeight(name, address string, weight int) error {
+	if weight < 1 {
+		return router.ErrInvalidWeight
+	}
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	data, err := getGalebData(backendName)
+	if err != nil {
+		return err
+	}
+	client, err := r.getClient()
+	if err != nil {
+		return err
+	}
+	address = hostFromAddress(address)
+	for _, real := range data.Reals {
+		if real.Real == address {
+			err = client.RemoveResource(real.BackendId)
+			if err != nil {
+				return err
+			}
+			backendId, err := client.AddBackend(backendParams(address, data.BackendPoolId, weight))
+			if err != nil {
+				return err
+			}
+			return data.updateReal(address, backendId, weight)
+		}
+	}
+	return router.ErrRouteNotFound
+}
+
+func (r *galebRouter) RouteWeights(name string) (map[string]int, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := getGalebData(backendName)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]int, len(data.Reals))
+	for _, real := range data.Reals {
+		weight := real.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		weights[real.Real] = weight
+	}
+	return weights, nil
+}
+
+func hostFromAddress(address string) string {
 	parsed, _ := url.Parse(address)
 	if parsed != nil && parsed.Host != "" {
-		address = parsed.Host
+		return parsed.Host
 	}
+	return address
+}
+
+func backendParams(address, backendPool string, weight int) *galebClient.BackendParams {
 	host, portStr, _ := net.SplitHostPort(address)
 	port, _ := strconv.Atoi(portStr)
-	params := galebClient.BackendParams{
+	return &galebClient.BackendParams{
 		Ip:          host,
 		Port:        port,
-		BackendPool: data.BackendPoolId,
-	}
-	backendId, err := client.AddBackend(&params)
-	if err != nil {
-		return err
+		BackendPool: backendPool,
+		Weight:      weight,
 	}
-	return data.addReal(address, backendId)
 }
 
 func (r *galebRouter) RemoveRoute(name, address string) error {
@@ -214,10 +289,7 @@ func (r *galebRouter) RemoveRoute(name, address string) error {
 	if err != nil {
 		return err
 	}
-	parsed, _ := url.Parse(address)
-	if parsed != nil && parsed.Host != "" {
-		address = parsed.Host
-	}
+	address = hostFromAddress(address)
 	for _, real := range data.Reals {
 		if real.Real == address {
 			err = client.RemoveResource(real.BackendId)
@@ -304,6 +304,106 @@ func (s *S) TestRoutes(c *check.C) {
 	c.Assert(routes, check.DeepEquals, []string{"10.1.1.10", "10.1.1.11"})
 }
 
+func (s *S) TestAddWeightedRoute(c *check.C) {
+	err := router.Store("myapp", "myapp", routerName)
+	c.Assert(err, check.IsNil)
+	data := galebData{
+		Name:          "myapp",
+		BackendPoolId: "mybackendpoolid",
+	}
+	err = data.save()
+	c.Assert(err, check.IsNil)
+	s.handler.ConditionalContent = map[string]interface{}{
+		"/api/backend/": `{"_links":{"self":"backend1"}}`,
+	}
+	s.handler.RspCode = http.StatusCreated
+	gRouter, err := createRouter("galeb")
+	c.Assert(err, check.IsNil)
+	err = gRouter.(router.WeightedRouter).AddWeightedRoute("myapp", "10.9.2.1:44001", 3)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.handler.Url, check.DeepEquals, []string{"/api/backend/"})
+	dbData, err := getGalebData("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbData.Reals, check.DeepEquals, []galebRealData{
+		{Real: "10.9.2.1:44001", BackendId: "backend1", Weight: 3},
+	})
+	result := map[string]interface{}{}
+	err = json.Unmarshal(s.handler.Body[0], &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, map[string]interface{}{
+		"ip": "10.9.2.1", "port": float64(44001), "backendpool": "mybackendpoolid", "weight": float64(3),
+	})
+}
+
+func (s *S) TestAddWeightedRouteInvalidWeight(c *check.C) {
+	gRouter, err := createRouter("galeb")
+	c.Assert(err, check.IsNil)
+	err = gRouter.(router.WeightedRouter).AddWeightedRoute("myapp", "10.9.2.1:44001", 0)
+	c.Assert(err, check.Equals, router.ErrInvalidWeight)
+	c.Assert(s.handler.Url, check.HasLen, 0)
+}
+
+func (s *S) TestSetRouteWeight(c *check.C) {
+	err := router.Store("myapp", "myapp", routerName)
+	c.Assert(err, check.IsNil)
+	data := galebData{
+		Name:          "myapp",
+		BackendPoolId: "mybackendpoolid",
+		Reals: []galebRealData{
+			{Real: "10.1.1.10:1010", BackendId: s.server.URL + "/api/backend1"},
+			{Real: "10.1.1.11:1010", BackendId: s.server.URL + "/api/backend2"},
+		},
+	}
+	err = data.save()
+	c.Assert(err, check.IsNil)
+	s.handler.RspCode = http.StatusNoContent
+	s.handler.ConditionalContent = map[string]interface{}{
+		"/api/backend/": []string{"201", `{"_links":{"self":"backend3"}}`},
+	}
+	gRouter, err := createRouter("galeb")
+	c.Assert(err, check.IsNil)
+	err = gRouter.(router.WeightedRouter).SetRouteWeight("myapp", "http://10.1.1.10:1010", 5)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.handler.Url, check.DeepEquals, []string{"/api/backend1", "/api/backend/"})
+	dbData, err := getGalebData("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbData.Reals, check.DeepEquals, []galebRealData{
+		{Real: "10.1.1.10:1010", BackendId: "backend3", Weight: 5},
+		{Real: "10.1.1.11:1010", BackendId: s.server.URL + "/api/backend2"},
+	})
+}
+
+func (s *S) TestSetRouteWeightRouteNotFound(c *check.C) {
+	err := router.Store("myapp", "myapp", routerName)
+	c.Assert(err, check.IsNil)
+	data := galebData{Name: "myapp"}
+	err = data.save()
+	c.Assert(err, check.IsNil)
+	gRouter, err := createRouter("galeb")
+	c.Assert(err, check.IsNil)
+	err = gRouter.(router.WeightedRouter).SetRouteWeight("myapp", "10.1.1.10:1010", 5)
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+}
+
+func (s *S) TestRouteWeights(c *check.C) {
+	err := router.Store("myapp", "myapp", routerName)
+	c.Assert(err, check.IsNil)
+	data := galebData{
+		Name: "myapp",
+		Reals: []galebRealData{
+			{Real: "10.1.1.10", BackendId: s.server.URL + "/api/backend1"},
+			{Real: "10.1.1.11", BackendId: s.server.URL + "/api/backend2", Weight: 4},
+		},
+	}
+	err = data.save()
+	c.Assert(err, check.IsNil)
+	gRouter, err := createRouter("galeb")
+	c.Assert(err, check.IsNil)
+	weights, err := gRouter.(router.WeightedRouter).RouteWeights("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"10.1.1.10": 1, "10.1.1.11": 4})
+}
+
 func (s *S) TestSwap(c *check.C) {
 	s.handler.RspCode = http.StatusNoContent
 	s.handler.ConditionalContent = map[string]interface{}{
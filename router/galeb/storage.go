@@ -14,6 +14,7 @@ type galebCNameData struct {
 type galebRealData struct {
 	Real      string
 	BackendId string
+	Weight    int `bson:",omitempty"`
 }
 
 type galebData struct {
@@ -33,13 +34,26 @@ func (g *galebData) save() error {
 	return coll.Insert(g)
 }
 
-func (g *galebData) addReal(address, backendId string) error {
+func (g *galebData) addReal(address, backendId string, weight int) error {
 	coll, err := collection()
 	if err != nil {
 		return err
 	}
-	return coll.UpdateId(g.Name, bson.M{"$push": bson.M{
-		"reals": bson.M{"real": address, "backendid": backendId},
+	real := bson.M{"real": address, "backendid": backendId}
+	if weight > 0 {
+		real["weight"] = weight
+	}
+	return coll.UpdateId(g.Name, bson.M{"$push": bson.M{"reals": real}})
+}
+
+func (g *galebData) updateReal(address, backendId string, weight int) error {
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	return coll.Update(bson.M{"_id": g.Name, "reals.real": address}, bson.M{"$set": bson.M{
+		"reals.$.backendid": backendId,
+		"reals.$.weight":    weight,
 	}})
 }
 
@@ -16,6 +16,7 @@ package hipache
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/garyburd/redigo/redis"
@@ -92,10 +93,18 @@ func (r hipacheRouter) RemoveBackend(name string) error {
 	if err != nil {
 		return &routeError{"remove", err}
 	}
+	_, err = conn.Do("DEL", "weight:"+backendName)
+	if err != nil {
+		return &routeError{"remove", err}
+	}
 	err = router.Remove(backendName)
 	if err != nil {
 		return &routeError{"remove", err}
 	}
+	err = r.removeTCPFrontends(backendName)
+	if err != nil {
+		return err
+	}
 	cnames, err := r.getCNames(backendName)
 	if err != nil {
 		return err
@@ -116,6 +125,26 @@ func (r hipacheRouter) RemoveBackend(name string) error {
 	return nil
 }
 
+func (r hipacheRouter) removeTCPFrontends(backendName string) error {
+	conn := r.connect()
+	defer conn.Close()
+	ports, err := redis.Strings(conn.Do("SMEMBERS", "tcpports:"+backendName))
+	if err != nil && err != redis.ErrNil {
+		return &routeError{"remove", err}
+	}
+	for _, port := range ports {
+		_, err = conn.Do("DEL", "tcp:"+port)
+		if err != nil {
+			return &routeError{"remove", err}
+		}
+	}
+	_, err = conn.Do("DEL", "tcpports:"+backendName)
+	if err != nil {
+		return &routeError{"remove", err}
+	}
+	return nil
+}
+
 func (r hipacheRouter) AddRoute(name, address string) error {
 	backendName, err := router.Retrieve(name)
 	if err != nil {
@@ -159,6 +188,148 @@ func (r hipacheRouter) addRoute(name, address string) error {
 	return nil
 }
 
+// AddWeightedRoute adds a route with the given weight. Hipache doesn't
+// support weights, so the route is added weight times to the frontend, as
+// hipache picks one of the frontend entries randomly.
+func (r hipacheRouter) AddWeightedRoute(name, address string, weight int) error {
+	if weight < 1 {
+		return router.ErrInvalidWeight
+	}
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	domain, err := config.GetString(r.prefix + ":domain")
+	if err != nil {
+		return &routeError{"add", err}
+	}
+	frontends, err := r.frontends(backendName, domain)
+	if err != nil {
+		return err
+	}
+	for _, frontend := range frontends {
+		for i := 0; i < weight; i++ {
+			err = r.addRoute(frontend, address)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return r.storeWeight(backendName, address, weight)
+}
+
+func (r hipacheRouter) SetRouteWeight(name, address string, weight int) error {
+	if weight < 1 {
+		return router.ErrInvalidWeight
+	}
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	domain, err := config.GetString(r.prefix + ":domain")
+	if err != nil {
+		return &routeError{"weight", err}
+	}
+	frontends, err := r.frontends(backendName, domain)
+	if err != nil {
+		return err
+	}
+	conn := r.connect()
+	defer conn.Close()
+	for _, frontend := range frontends {
+		routes, err := redis.Strings(conn.Do("LRANGE", frontend, 0, -1))
+		if err != nil {
+			return &routeError{"weight", err}
+		}
+		if !hasRoute(routes, address) {
+			return router.ErrRouteNotFound
+		}
+	}
+	for _, frontend := range frontends {
+		_, err = conn.Do("LREM", frontend, 0, address)
+		if err != nil {
+			return &routeError{"weight", err}
+		}
+		for j := 0; j < weight; j++ {
+			err = r.addRoute(frontend, address)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return r.storeWeight(backendName, address, weight)
+}
+
+func (r hipacheRouter) RouteWeights(name string) (map[string]int, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := r.Routes(name)
+	if err != nil {
+		return nil, err
+	}
+	conn := r.connect()
+	defer conn.Close()
+	pairs, err := redis.Strings(conn.Do("HGETALL", "weight:"+backendName))
+	if err != nil && err != redis.ErrNil {
+		return nil, &routeError{"weight", err}
+	}
+	stored := make(map[string]int, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		weight, err := strconv.Atoi(pairs[i+1])
+		if err != nil {
+			return nil, &routeError{"weight", err}
+		}
+		stored[pairs[i]] = weight
+	}
+	weights := make(map[string]int, len(routes))
+	for _, route := range routes {
+		if route == backendName {
+			continue
+		}
+		weight, ok := stored[route]
+		if !ok {
+			weight = 1
+		}
+		weights[route] = weight
+	}
+	return weights, nil
+}
+
+// hasRoute returns whether the routes of a frontend, which start with the
+// name of the backend, include the address.
+func hasRoute(routes []string, address string) bool {
+	for i := 1; i < len(routes); i++ {
+		if routes[i] == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (r hipacheRouter) frontends(backendName, domain string) ([]string, error) {
+	frontends := []string{"frontend:" + backendName + "." + domain}
+	cnames, err := r.getCNames(backendName)
+	if err != nil {
+		return nil, err
+	}
+	for _, cname := range cnames {
+		frontends = append(frontends, "frontend:"+cname)
+	}
+	return frontends, nil
+}
+
+func (r hipacheRouter) storeWeight(backendName, address string, weight int) error {
+	conn := r.connect()
+	defer conn.Close()
+	_, err := conn.Do("HSET", "weight:"+backendName, address, weight)
+	if err != nil {
+		return &routeError{"weight", err}
+	}
+	return nil
+}
+
 func (r hipacheRouter) RemoveRoute(name, address string) error {
 	backendName, err := router.Retrieve(name)
 	if err != nil {
@@ -172,6 +343,12 @@ func (r hipacheRouter) RemoveRoute(name, address string) error {
 	if err := r.removeElement(frontend, address); err != nil {
 		return err
 	}
+	conn := r.connect()
+	defer conn.Close()
+	_, err = conn.Do("HDEL", "weight:"+backendName, address)
+	if err != nil {
+		return &routeError{"remove", err}
+	}
 	cnames, err := r.getCNames(backendName)
 	if err != nil {
 		return &routeError{"remove", err}
@@ -296,6 +473,22 @@ func (r hipacheRouter) Addr(name string) (string, error) {
 	return fmt.Sprintf("%s.%s", backendName, domain), nil
 }
 
+func (r hipacheRouter) Hosts(name string) ([]string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := config.GetString(r.prefix + ":domain")
+	if err != nil {
+		return nil, &routeError{"get", err}
+	}
+	cnames, err := r.getCNames(backendName)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{backendName + "." + domain}, cnames...), nil
+}
+
 func (r hipacheRouter) Routes(name string) ([]string, error) {
 	backendName, err := router.Retrieve(name)
 	if err != nil {
@@ -308,13 +501,98 @@ func (r hipacheRouter) Routes(name string) ([]string, error) {
 	frontend := "frontend:" + backendName + "." + domain
 	conn := r.connect()
 	defer conn.Close()
-	routes, err := redis.Strings(conn.Do("LRANGE", frontend, 0, -1))
+	entries, err := redis.Strings(conn.Do("LRANGE", frontend, 0, -1))
 	if err != nil {
 		return nil, &routeError{"routes", err}
 	}
+	// Weighted routes are added multiple times to the frontend.
+	seen := make(map[string]bool, len(entries))
+	routes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !seen[entry] {
+			seen[entry] = true
+			routes = append(routes, entry)
+		}
+	}
 	return routes, nil
 }
 
+// tcpFrontend returns the key of the list with the TCP routes of the external
+// port. Like in http frontends, the first entry is the backend name and the
+// other ones are the addresses connections are forwarded to. Hipache itself
+// only proxies http, these lists are meant for a TCP proxy sharing its Redis.
+func tcpFrontend(externalPort int) string {
+	return "tcp:" + strconv.Itoa(externalPort)
+}
+
+func (r hipacheRouter) AddTCPRoute(name string, externalPort int, address string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	frontend := tcpFrontend(externalPort)
+	conn := r.connect()
+	defer conn.Close()
+	owner, err := redis.String(conn.Do("LINDEX", frontend, 0))
+	if err == redis.ErrNil {
+		_, err = conn.Do("RPUSH", frontend, backendName)
+		if err != nil {
+			return &routeError{"add", err}
+		}
+		_, err = conn.Do("SADD", "tcpports:"+backendName, externalPort)
+		if err != nil {
+			return &routeError{"add", err}
+		}
+	} else if err != nil {
+		return &routeError{"add", err}
+	} else if owner != backendName {
+		return &routeError{"add", fmt.Errorf("external port %d is routed to %s", externalPort, owner)}
+	}
+	_, err = conn.Do("LREM", frontend, 0, address)
+	if err != nil {
+		return &routeError{"add", err}
+	}
+	_, err = conn.Do("RPUSH", frontend, address)
+	if err != nil {
+		return &routeError{"add", err}
+	}
+	return nil
+}
+
+func (r hipacheRouter) RemoveTCPRoute(name string, externalPort int, address string) error {
+	_, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	conn := r.connect()
+	defer conn.Close()
+	count, err := redis.Int(conn.Do("LREM", tcpFrontend(externalPort), 0, address))
+	if err != nil {
+		return &routeError{"remove", err}
+	}
+	if count == 0 {
+		return router.ErrRouteNotFound
+	}
+	return nil
+}
+
+func (r hipacheRouter) TCPRoutes(name string, externalPort int) ([]string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	conn := r.connect()
+	defer conn.Close()
+	entries, err := redis.Strings(conn.Do("LRANGE", tcpFrontend(externalPort), 0, -1))
+	if err != nil {
+		return nil, &routeError{"routes", err}
+	}
+	if len(entries) == 0 || entries[0] != backendName {
+		return nil, nil
+	}
+	return entries[1:], nil
+}
+
 func (r hipacheRouter) removeElement(name, address string) error {
 	conn := r.connect()
 	defer conn.Close()
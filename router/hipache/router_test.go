@@ -53,6 +53,8 @@ func (s *S) SetUpTest(c *check.C) {
 	conn = rtest.connect()
 	ClearRedisKeys("frontend*", c)
 	ClearRedisKeys("cname*", c)
+	ClearRedisKeys("weight*", c)
+	ClearRedisKeys("tcp*", c)
 	ClearRedisKeys("*.com", c)
 }
 
@@ -418,6 +420,20 @@ func (s *S) TestAddr(c *check.C) {
 	c.Assert(addr, check.Equals, "tip.golang.org")
 }
 
+func (s *S) TestHosts(c *check.C) {
+	router := hipacheRouter{prefix: "hipache"}
+	err := router.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	hosts, err := router.Hosts("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(hosts, check.DeepEquals, []string{"tip.golang.org"})
+	err = router.SetCName("tip.example.com", "tip")
+	c.Assert(err, check.IsNil)
+	hosts, err = router.Hosts("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(hosts, check.DeepEquals, []string{"tip.golang.org", "tip.example.com"})
+}
+
 func (s *S) TestAddrNoDomainConfigured(c *check.C) {
 	old, _ := config.Get("hipache:domain")
 	defer config.Set("hipache:domain", old)
@@ -484,6 +500,187 @@ func (s *S) TestRoutes(c *check.C) {
 	c.Assert(routes, check.DeepEquals, []string{"http://10.10.10.10:8080"})
 }
 
+func (s *S) TestAddWeightedRoute(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddRoute("tip", "http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("tip", "http://10.10.10.11:8080", 3)
+	c.Assert(err, check.IsNil)
+	entries, err := redis.Strings(conn.Do("LRANGE", "frontend:tip.golang.org", 0, -1))
+	c.Assert(err, check.IsNil)
+	expected := []string{"tip", "http://10.10.10.10:8080", "http://10.10.10.11:8080", "http://10.10.10.11:8080", "http://10.10.10.11:8080"}
+	c.Assert(entries, check.DeepEquals, expected)
+	routes, err := r.Routes("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []string{"tip", "http://10.10.10.10:8080", "http://10.10.10.11:8080"})
+	weights, err := r.RouteWeights("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"http://10.10.10.10:8080": 1, "http://10.10.10.11:8080": 3})
+}
+
+func (s *S) TestAddWeightedRouteInvalidWeight(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("tip", "http://10.10.10.11:8080", 0)
+	c.Assert(err, check.Equals, router.ErrInvalidWeight)
+}
+
+func (s *S) TestSetRouteWeight(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.SetCName("mycname.com", "tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("tip", "http://10.10.10.10:8080", 4)
+	c.Assert(err, check.IsNil)
+	err = r.SetRouteWeight("tip", "http://10.10.10.10:8080", 2)
+	c.Assert(err, check.IsNil)
+	count, err := redis.Int(conn.Do("LLEN", "frontend:tip.golang.org"))
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 3)
+	count, err = redis.Int(conn.Do("LLEN", "frontend:mycname.com"))
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 3)
+	weights, err := r.RouteWeights("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"http://10.10.10.10:8080": 2})
+}
+
+func (s *S) TestSetRouteWeightRouteNotFound(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.SetRouteWeight("tip", "http://10.10.10.10:8080", 2)
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+}
+
+func (s *S) TestSetRouteWeightRouteNotFoundInCName(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.SetCName("mycname.com", "tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("tip", "http://10.10.10.10:8080", 4)
+	c.Assert(err, check.IsNil)
+	_, err = conn.Do("LREM", "frontend:mycname.com", 0, "http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	err = r.SetRouteWeight("tip", "http://10.10.10.10:8080", 2)
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+	count, err := redis.Int(conn.Do("LLEN", "frontend:tip.golang.org"))
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 5)
+	count, err = redis.Int(conn.Do("LLEN", "frontend:mycname.com"))
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	weights, err := r.RouteWeights("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"http://10.10.10.10:8080": 4})
+}
+
+func (s *S) TestRemoveWeightedRoute(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("tip", "http://10.10.10.10:8080", 4)
+	c.Assert(err, check.IsNil)
+	err = r.RemoveRoute("tip", "http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	weights, err := r.RouteWeights("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{})
+	exists, err := redis.Bool(conn.Do("EXISTS", "weight:tip"))
+	c.Assert(err, check.IsNil)
+	c.Assert(exists, check.Equals, false)
+}
+
+func (s *S) TestRemoveWeightedRouteWithCName(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.SetCName("mycname.com", "tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("tip", "http://10.10.10.10:8080", 4)
+	c.Assert(err, check.IsNil)
+	err = r.RemoveRoute("tip", "http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	count, err := redis.Int(conn.Do("LLEN", "frontend:mycname.com"))
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	exists, err := redis.Bool(conn.Do("EXISTS", "weight:tip"))
+	c.Assert(err, check.IsNil)
+	c.Assert(exists, check.Equals, false)
+}
+
+func (s *S) TestAddTCPRoute(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tip", 30000, "10.10.10.11:5432")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.IsNil)
+	entries, err := redis.Strings(conn.Do("LRANGE", "tcp:30000", 0, -1))
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.DeepEquals, []string{"tip", "10.10.10.11:5432", "10.10.10.10:5432"})
+	routes, err := r.TCPRoutes("tip", 30000)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []string{"10.10.10.11:5432", "10.10.10.10:5432"})
+	routes, err = r.TCPRoutes("tip", 30001)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 0)
+}
+
+func (s *S) TestAddTCPRoutePortOfAnotherBackend(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("tap")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tap", 30000, "10.10.10.11:5432")
+	c.Assert(err, check.ErrorMatches, "Could not add route: external port 30000 is routed to tip")
+	routes, err := r.TCPRoutes("tap", 30000)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveTCPRoute(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.IsNil)
+	err = r.RemoveTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.IsNil)
+	routes, err := r.TCPRoutes("tip", 30000)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 0)
+	err = r.RemoveTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+}
+
+func (s *S) TestRemoveBackendRemovesTCPRoutes(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("tip", 30000, "10.10.10.10:5432")
+	c.Assert(err, check.IsNil)
+	err = r.RemoveBackend("tip")
+	c.Assert(err, check.IsNil)
+	exists, err := redis.Bool(conn.Do("EXISTS", "tcp:30000"))
+	c.Assert(err, check.IsNil)
+	c.Assert(exists, check.Equals, false)
+	exists, err = redis.Bool(conn.Do("EXISTS", "tcpports:tip"))
+	c.Assert(err, check.IsNil)
+	c.Assert(exists, check.Equals, false)
+}
+
 func (s *S) TestSwap(c *check.C) {
 	backend1 := "b1"
 	backend2 := "b2"
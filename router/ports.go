@@ -0,0 +1,142 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"errors"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrTCPPortsNotConfigured = errors.New("tcp ports are not available: tcp-ports:min and tcp-ports:max must be set")
+	ErrNoTCPPortAvailable    = errors.New("all the ports in the tcp port range are allocated")
+)
+
+// PortAssignment is an external port allocated to an app. Connections to the
+// external port are forwarded to Port in the units of the app.
+type PortAssignment struct {
+	ExternalPort int `bson:"_id"`
+	App          string
+	Port         int
+	Protocol     string
+}
+
+func portsCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("router_ports"), nil
+}
+
+func tcpPortRange() (int, int, error) {
+	min, err := config.GetInt("tcp-ports:min")
+	if err != nil {
+		return 0, 0, ErrTCPPortsNotConfigured
+	}
+	max, err := config.GetInt("tcp-ports:max")
+	if err != nil || max < min {
+		return 0, 0, ErrTCPPortsNotConfigured
+	}
+	return min, max, nil
+}
+
+// AllocatePort assigns an external port to the port of the app, taken from
+// the range in the tcp-ports:min and tcp-ports:max settings. Allocating an
+// already assigned port returns the existing assignment, with the protocol
+// updated.
+func AllocatePort(appName string, port int, protocol string) (*PortAssignment, error) {
+	min, max, err := tcpPortRange()
+	if err != nil {
+		return nil, err
+	}
+	coll, err := portsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var assignment PortAssignment
+	err = coll.Find(bson.M{"app": appName, "port": port}).One(&assignment)
+	if err == nil {
+		if assignment.Protocol != protocol {
+			assignment.Protocol = protocol
+			err = coll.UpdateId(assignment.ExternalPort, bson.M{"$set": bson.M{"protocol": protocol}})
+		}
+		return &assignment, err
+	}
+	if err != mgo.ErrNotFound {
+		return nil, err
+	}
+	for {
+		var used []PortAssignment
+		query := bson.M{"_id": bson.M{"$gte": min, "$lte": max}}
+		err = coll.Find(query).Select(bson.M{"_id": 1}).Sort("_id").All(&used)
+		if err != nil {
+			return nil, err
+		}
+		externalPort := min
+		for _, u := range used {
+			if u.ExternalPort != externalPort {
+				break
+			}
+			externalPort++
+		}
+		if externalPort > max {
+			return nil, ErrNoTCPPortAvailable
+		}
+		assignment = PortAssignment{ExternalPort: externalPort, App: appName, Port: port, Protocol: protocol}
+		err = coll.Insert(assignment)
+		if !mgo.IsDup(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// ReleasePort releases the external port assigned to the port of the app.
+func ReleasePort(appName string, port int) error {
+	coll, err := portsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"app": appName, "port": port})
+	return err
+}
+
+// ReleaseAppPorts releases all the external ports assigned to the app.
+func ReleaseAppPorts(appName string) error {
+	coll, err := portsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"app": appName})
+	return err
+}
+
+// AppPorts returns the external ports assigned to the app, ordered by the
+// port in the units.
+func AppPorts(appName string) ([]PortAssignment, error) {
+	coll, err := portsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var assignments []PortAssignment
+	err = coll.Find(bson.M{"app": appName}).Sort("port").All(&assignments)
+	if err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
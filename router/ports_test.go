@@ -0,0 +1,81 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func setTCPPortRange(min, max int) func() {
+	config.Set("tcp-ports:min", min)
+	config.Set("tcp-ports:max", max)
+	return func() {
+		config.Unset("tcp-ports:min")
+		config.Unset("tcp-ports:max")
+	}
+}
+
+func (s *S) TestAllocatePort(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	defer ReleaseAppPorts("myapp")
+	defer ReleaseAppPorts("otherapp")
+	assignment, err := AllocatePort("myapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	c.Assert(*assignment, check.DeepEquals, PortAssignment{ExternalPort: 30000, App: "myapp", Port: 5432, Protocol: "tcp"})
+	assignment, err = AllocatePort("otherapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	c.Assert(assignment.ExternalPort, check.Equals, 30001)
+	assignment, err = AllocatePort("myapp", 5432, "http")
+	c.Assert(err, check.IsNil)
+	c.Assert(*assignment, check.DeepEquals, PortAssignment{ExternalPort: 30000, App: "myapp", Port: 5432, Protocol: "http"})
+	assignment, err = AllocatePort("myapp", 6379, "tcp")
+	c.Assert(err, check.IsNil)
+	c.Assert(assignment.ExternalPort, check.Equals, 30002)
+	ports, err := AppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.DeepEquals, []PortAssignment{
+		{ExternalPort: 30000, App: "myapp", Port: 5432, Protocol: "http"},
+		{ExternalPort: 30002, App: "myapp", Port: 6379, Protocol: "tcp"},
+	})
+}
+
+func (s *S) TestAllocatePortReusesReleasedPorts(c *check.C) {
+	defer setTCPPortRange(30000, 30001)()
+	defer ReleaseAppPorts("myapp")
+	_, err := AllocatePort("myapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	_, err = AllocatePort("myapp", 6379, "tcp")
+	c.Assert(err, check.IsNil)
+	_, err = AllocatePort("myapp", 11211, "tcp")
+	c.Assert(err, check.Equals, ErrNoTCPPortAvailable)
+	err = ReleasePort("myapp", 5432)
+	c.Assert(err, check.IsNil)
+	assignment, err := AllocatePort("myapp", 11211, "tcp")
+	c.Assert(err, check.IsNil)
+	c.Assert(assignment.ExternalPort, check.Equals, 30000)
+}
+
+func (s *S) TestAllocatePortNotConfigured(c *check.C) {
+	_, err := AllocatePort("myapp", 5432, "tcp")
+	c.Assert(err, check.Equals, ErrTCPPortsNotConfigured)
+}
+
+func (s *S) TestReleaseAppPorts(c *check.C) {
+	defer setTCPPortRange(30000, 30010)()
+	_, err := AllocatePort("myapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	_, err = AllocatePort("otherapp", 5432, "tcp")
+	c.Assert(err, check.IsNil)
+	defer ReleaseAppPorts("otherapp")
+	err = ReleaseAppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	ports, err := AppPorts("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 0)
+	ports, err = AppPorts("otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 1)
+}
@@ -66,6 +66,37 @@ type Router interface {
 	Routes(name string) ([]string, error)
 }
 
+// WeightedRouter is a router that supports distributing the traffic of a
+// backend among its routes according to weights. A route receives
+// weight/sum(weights) of the backend traffic, routes added with AddRoute have
+// weight 1.
+type WeightedRouter interface {
+	AddWeightedRoute(name, address string, weight int) error
+	SetRouteWeight(name, address string, weight int) error
+
+	// RouteWeights returns the weight of each route of a backend.
+	RouteWeights(name string) (map[string]int, error)
+}
+
+var ErrInvalidWeight = errors.New("Route weight must be greater than zero")
+
+// HostsRouter is a router that knows every host name routed to a backend,
+// including its cnames.
+type HostsRouter interface {
+	Hosts(name string) ([]string, error)
+}
+
+// TCPRouter is a router that forwards raw TCP connections received in an
+// external port to the routes of a backend. Routes are addresses in the
+// host:port format.
+type TCPRouter interface {
+	AddTCPRoute(name string, externalPort int, address string) error
+	RemoveTCPRoute(name string, externalPort int, address string) error
+
+	// TCPRoutes returns the routes of a backend in an external port.
+	TCPRoutes(name string, externalPort int) ([]string, error)
+}
+
 type MessageRouter interface {
 	StartupMessage() (string, error)
 }
@@ -35,6 +35,9 @@ func createHCRouter(prefix string) (router.Router, error) {
 type fakeRouter struct {
 	backends     map[string][]string
 	failuresByIp map[string]bool
+	weights      map[string]map[string]int
+	tcpRoutes    map[string]map[int][]string
+	cnames       map[string][]string
 	mutex        sync.Mutex
 }
 
@@ -87,6 +90,8 @@ func (r *fakeRouter) RemoveBackend(name string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	delete(r.backends, backendName)
+	delete(r.weights, backendName)
+	delete(r.tcpRoutes, backendName)
 	return nil
 }
 
@@ -135,9 +140,65 @@ func (r *fakeRouter) RemoveRoute(name, ip string) error {
 	}
 	routes[index] = routes[len(routes)-1]
 	r.backends[backendName] = routes[:len(routes)-1]
+	delete(r.weights[backendName], ip)
 	return nil
 }
 
+func (r *fakeRouter) AddWeightedRoute(name, ip string, weight int) error {
+	if weight < 1 {
+		return router.ErrInvalidWeight
+	}
+	err := r.AddRoute(name, ip)
+	if err != nil {
+		return err
+	}
+	return r.SetRouteWeight(name, ip, weight)
+}
+
+func (r *fakeRouter) SetRouteWeight(name, ip string, weight int) error {
+	if weight < 1 {
+		return router.ErrInvalidWeight
+	}
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasRoute(backendName, ip) {
+		return router.ErrRouteNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.weights == nil {
+		r.weights = make(map[string]map[string]int)
+	}
+	if r.weights[backendName] == nil {
+		r.weights[backendName] = make(map[string]int)
+	}
+	r.weights[backendName][ip] = weight
+	return nil
+}
+
+func (r *fakeRouter) RouteWeights(name string) (map[string]int, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !r.HasBackend(backendName) {
+		return nil, ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	weights := make(map[string]int)
+	for _, route := range r.backends[backendName] {
+		weight, ok := r.weights[backendName][route]
+		if !ok {
+			weight = 1
+		}
+		weights[route] = weight
+	}
+	return weights, nil
+}
+
 func (r *fakeRouter) SetCName(cname, name string) error {
 	backendName, err := router.Retrieve(name)
 	if err != nil {
@@ -150,10 +211,25 @@ func (r *fakeRouter) SetCName(cname, name string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	r.backends[cname] = append(r.backends[backendName])
+	if r.cnames == nil {
+		r.cnames = make(map[string][]string)
+	}
+	r.cnames[backendName] = append(r.cnames[backendName], cname)
 	return nil
 }
 
 func (r *fakeRouter) UnsetCName(cname, name string) error {
+	if backendName, err := router.Retrieve(name); err == nil {
+		r.mutex.Lock()
+		cnames := r.cnames[backendName]
+		for i, c := range cnames {
+			if c == cname {
+				r.cnames[backendName] = append(cnames[:i], cnames[i+1:]...)
+				break
+			}
+		}
+		r.mutex.Unlock()
+	}
 	return r.RemoveBackend(cname)
 }
 
@@ -166,11 +242,88 @@ func (r *fakeRouter) Addr(name string) (string, error) {
 	return "", ErrBackendNotFound
 }
 
+func (r *fakeRouter) Hosts(name string) ([]string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !r.HasBackend(backendName) {
+		return nil, ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{backendName}, r.cnames[backendName]...), nil
+}
+
+func (r *fakeRouter) HasTCPRoute(name string, externalPort int, address string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, route := range r.tcpRoutes[name][externalPort] {
+		if route == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeRouter) AddTCPRoute(name string, externalPort int, address string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.tcpRoutes == nil {
+		r.tcpRoutes = make(map[string]map[int][]string)
+	}
+	if r.tcpRoutes[backendName] == nil {
+		r.tcpRoutes[backendName] = make(map[int][]string)
+	}
+	r.tcpRoutes[backendName][externalPort] = append(r.tcpRoutes[backendName][externalPort], address)
+	return nil
+}
+
+func (r *fakeRouter) RemoveTCPRoute(name string, externalPort int, address string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes := r.tcpRoutes[backendName][externalPort]
+	for i := range routes {
+		if routes[i] == address {
+			r.tcpRoutes[backendName][externalPort] = append(routes[:i], routes[i+1:]...)
+			return nil
+		}
+	}
+	return router.ErrRouteNotFound
+}
+
+func (r *fakeRouter) TCPRoutes(name string, externalPort int) ([]string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.tcpRoutes[backendName][externalPort], nil
+}
+
 func (r *fakeRouter) Reset() {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	r.backends = make(map[string][]string)
 	r.failuresByIp = make(map[string]bool)
+	r.weights = make(map[string]map[string]int)
+	r.tcpRoutes = make(map[string]map[int][]string)
+	r.cnames = make(map[string][]string)
 }
 
 func (r *fakeRouter) Routes(name string) ([]string, error) {
@@ -136,6 +136,34 @@ func (s *S) TestUnsetCName(c *check.C) {
 	c.Assert(r.HasBackend("myapp.com"), check.Equals, false)
 }
 
+func (s *S) TestHosts(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	hosts, err := r.Hosts("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(hosts, check.DeepEquals, []string{"name"})
+	hosts, err = r.Hosts("unknown")
+	c.Assert(hosts, check.IsNil)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestHostsWithCName(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	err = r.SetCName("myapp.com", "name")
+	c.Assert(err, check.IsNil)
+	hosts, err := r.Hosts("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(hosts, check.DeepEquals, []string{"name", "myapp.com"})
+	err = r.UnsetCName("myapp.com", "name")
+	c.Assert(err, check.IsNil)
+	hosts, err = r.Hosts("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(hosts, check.DeepEquals, []string{"name"})
+}
+
 func (s *S) TestAddr(c *check.C) {
 	r := fakeRouter{backends: make(map[string][]string)}
 	err := r.AddBackend("name")
@@ -212,3 +240,81 @@ func (s *S) TestSwap(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(addr, check.Equals, "127.0.0.1")
 }
+
+func (s *S) TestAddWeightedRoute(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	err = r.AddRoute("name", "127.0.0.1")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("name", "127.0.0.2", 3)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.HasRoute("name", "127.0.0.2"), check.Equals, true)
+	weights, err := r.RouteWeights("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"127.0.0.1": 1, "127.0.0.2": 3})
+}
+
+func (s *S) TestAddWeightedRouteInvalidWeight(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("name", "127.0.0.2", 0)
+	c.Assert(err, check.Equals, router.ErrInvalidWeight)
+	c.Assert(r.HasRoute("name", "127.0.0.2"), check.Equals, false)
+}
+
+func (s *S) TestSetRouteWeight(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	err = r.AddRoute("name", "127.0.0.1")
+	c.Assert(err, check.IsNil)
+	err = r.SetRouteWeight("name", "127.0.0.1", 7)
+	c.Assert(err, check.IsNil)
+	weights, err := r.RouteWeights("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"127.0.0.1": 7})
+	err = r.SetRouteWeight("name", "127.0.0.2", 7)
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+}
+
+func (s *S) TestRemoveWeightedRoute(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	err = r.AddWeightedRoute("name", "127.0.0.1", 5)
+	c.Assert(err, check.IsNil)
+	err = r.RemoveRoute("name", "127.0.0.1")
+	c.Assert(err, check.IsNil)
+	err = r.AddRoute("name", "127.0.0.1")
+	c.Assert(err, check.IsNil)
+	weights, err := r.RouteWeights("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(weights, check.DeepEquals, map[string]int{"127.0.0.1": 1})
+}
+
+func (s *S) TestTCPRoutes(c *check.C) {
+	r := fakeRouter{backends: make(map[string][]string)}
+	err := r.AddBackend("name")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("name", 30000, "10.0.0.1:49153")
+	c.Assert(err, check.IsNil)
+	err = r.AddTCPRoute("name", 30000, "10.0.0.2:49153")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.HasTCPRoute("name", 30000, "10.0.0.1:49153"), check.Equals, true)
+	c.Assert(r.HasTCPRoute("name", 30001, "10.0.0.1:49153"), check.Equals, false)
+	routes, err := r.TCPRoutes("name", 30000)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []string{"10.0.0.1:49153", "10.0.0.2:49153"})
+	err = r.RemoveTCPRoute("name", 30000, "10.0.0.1:49153")
+	c.Assert(err, check.IsNil)
+	err = r.RemoveTCPRoute("name", 30000, "10.0.0.1:49153")
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+	routes, err = r.TCPRoutes("name", 30000)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []string{"10.0.0.2:49153"})
+	err = r.RemoveBackend("name")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.HasTCPRoute("name", 30000, "10.0.0.2:49153"), check.Equals, false)
+}
@@ -83,7 +83,7 @@ func (s *BindSuite) TestBindUnit(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 1, nil)
+	app.Provisioner.AddUnits(&a, 1, "", nil)
 	err = instance.BindUnit(&a, a.GetUnits()[0])
 	c.Assert(err, check.IsNil)
 	c.Assert(called, check.Equals, true)
@@ -102,7 +102,7 @@ func (s *BindSuite) TestBindAppFailsWhenEndpointIsDown(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 1, nil)
+	app.Provisioner.AddUnits(&a, 1, "", nil)
 	err = instance.BindApp(&a, nil)
 	c.Assert(err, check.NotNil)
 }
@@ -154,7 +154,7 @@ func (s *BindSuite) TestBindCallTheServiceAPIAndSetsEnvironmentVariableReturnedF
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 1, nil)
+	app.Provisioner.AddUnits(&a, 1, "", nil)
 	err = instance.BindApp(&a, nil)
 	c.Assert(err, check.IsNil)
 	newApp, err := app.GetByName(a.Name)
@@ -216,7 +216,7 @@ func (s *BindSuite) TestBindAppMultiUnits(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 1, nil)
+	app.Provisioner.AddUnits(&a, 1, "", nil)
 	err = instance.BindApp(&a, nil)
 	c.Assert(err, check.IsNil)
 	ok := make(chan bool)
@@ -335,7 +335,7 @@ func (s *BindSuite) TestUnbindUnit(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 1, nil)
+	app.Provisioner.AddUnits(&a, 1, "", nil)
 	err = instance.UnbindUnit(&a, a.GetUnits()[0])
 	c.Assert(err, check.IsNil)
 	c.Assert(called, check.Equals, true)
@@ -367,7 +367,7 @@ func (s *BindSuite) TestUnbindMultiUnits(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 2, nil)
+	app.Provisioner.AddUnits(&a, 2, "", nil)
 	err = instance.UnbindApp(&a, nil)
 	c.Assert(err, check.IsNil)
 	ok := make(chan bool, 1)
@@ -513,7 +513,7 @@ func (s *BindSuite) TestUnbindCallsTheUnbindMethodFromAPI(c *check.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	app.Provisioner.Provision(&a)
 	defer app.Provisioner.Destroy(&a)
-	app.Provisioner.AddUnits(&a, 1, nil)
+	app.Provisioner.AddUnits(&a, 1, "", nil)
 	err = instance.UnbindApp(&a, nil)
 	c.Assert(err, check.IsNil)
 	ch := make(chan bool)
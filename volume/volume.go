@@ -0,0 +1,259 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package volume provides primitives for managing the persistent volumes
+// that teams attach to the units of their apps.
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// TypeHost is the type of volumes backed by a directory in the node
+	// running the unit.
+	TypeHost = "host"
+
+	// TypeDocker is the type of volumes backed by a named docker volume,
+	// created in the nodes by the administrator with any volume driver.
+	TypeDocker = "docker"
+)
+
+var (
+	ErrVolumeNotFound      = errors.New("volume not found")
+	ErrVolumeAlreadyExists = errors.New("there is already a volume with this name")
+	ErrVolumeBound         = errors.New("volume is bound to apps")
+	ErrBindNotFound        = errors.New("volume is not bound to the app at this mount point")
+	ErrBindAlreadyExists   = errors.New("there is already a volume bound to the app at this mount point")
+	ErrInvalidMountPoint   = &tsuruErrors.ValidationError{Message: "mount point must be an absolute path"}
+)
+
+// Volume is a persistent storage mounted in the units of the apps bound to
+// it. Source is the directory of host volumes or the name of docker volumes.
+// Volumes are pinned to a pool, and when Node is set, units of apps bound
+// to the volume only run in that node.
+type Volume struct {
+	Name   string `bson:"_id"`
+	Type   string
+	Source string
+	Pool   string
+	Node   string `bson:",omitempty" json:",omitempty"`
+	Binds  []Bind `bson:",omitempty" json:",omitempty"`
+}
+
+// Bind represents a volume attached to an app at a mount point.
+type Bind struct {
+	App        string
+	MountPoint string
+	ReadOnly   bool
+}
+
+// AppBind represents a volume attached to an app, as seen by the app.
+type AppBind struct {
+	Volume     string
+	Type       string
+	Source     string
+	Pool       string
+	Node       string `json:",omitempty"`
+	MountPoint string
+	ReadOnly   bool
+}
+
+// Spec returns the bind in the docker format, source:mountpoint:mode.
+func (b *AppBind) Spec() string {
+	mode := "rw"
+	if b.ReadOnly {
+		mode = "ro"
+	}
+	return fmt.Sprintf("%s:%s:%s", b.Source, b.MountPoint, mode)
+}
+
+func (v *Volume) validate() error {
+	if v.Name == "" {
+		return &tsuruErrors.ValidationError{Message: "volume name is required"}
+	}
+	if v.Pool == "" {
+		return &tsuruErrors.ValidationError{Message: "volume pool is required"}
+	}
+	switch v.Type {
+	case TypeHost:
+		if !path.IsAbs(v.Source) {
+			return &tsuruErrors.ValidationError{Message: "source of host volumes must be an absolute path"}
+		}
+	case TypeDocker:
+		if v.Source == "" || strings.Contains(v.Source, "/") {
+			return &tsuruErrors.ValidationError{Message: "source of docker volumes must be a volume name"}
+		}
+	default:
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid volume type %q, must be %q or %q", v.Type, TypeHost, TypeDocker)}
+	}
+	return nil
+}
+
+// Create validates and stores a new volume, without binds.
+func Create(v *Volume) error {
+	err := v.validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	v.Binds = nil
+	err = conn.Volumes().Insert(v)
+	if mgo.IsDup(err) {
+		return ErrVolumeAlreadyExists
+	}
+	return err
+}
+
+// Get returns the volume with the given name.
+func Get(name string) (*Volume, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var v Volume
+	err = conn.Volumes().FindId(name).One(&v)
+	if err == mgo.ErrNotFound {
+		return nil, ErrVolumeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List returns all the volumes, ordered by name.
+func List() ([]Volume, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var volumes []Volume
+	err = conn.Volumes().Find(nil).Sort("_id").All(&volumes)
+	if err != nil {
+		return nil, err
+	}
+	return volumes, nil
+}
+
+// Remove removes the volume, which must not be bound to any app. The data in
+// the source of the volume is kept.
+func Remove(name string) error {
+	v, err := Get(name)
+	if err != nil {
+		return err
+	}
+	if len(v.Binds) > 0 {
+		return ErrVolumeBound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Volumes().RemoveId(name)
+}
+
+// BindApp attaches the volume to the app at the mount point. Units started
+// after the bind mount the volume.
+func BindApp(name, appName, mountPoint string, readOnly bool) error {
+	if !path.IsAbs(mountPoint) {
+		return ErrInvalidMountPoint
+	}
+	mountPoint = path.Clean(mountPoint)
+	_, err := Get(name)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	n, err := conn.Volumes().Find(bson.M{"binds": bson.M{"$elemMatch": bson.M{"app": appName, "mountpoint": mountPoint}}}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrBindAlreadyExists
+	}
+	bind := Bind{App: appName, MountPoint: mountPoint, ReadOnly: readOnly}
+	return conn.Volumes().UpdateId(name, bson.M{"$push": bson.M{"binds": bind}})
+}
+
+// UnbindApp detaches the volume from the app at the mount point.
+func UnbindApp(name, appName, mountPoint string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	query := bson.M{"_id": name, "binds": bson.M{"$elemMatch": bson.M{"app": appName, "mountpoint": path.Clean(mountPoint)}}}
+	err = conn.Volumes().Update(query, bson.M{"$pull": bson.M{"binds": bson.M{"app": appName, "mountpoint": path.Clean(mountPoint)}}})
+	if err == mgo.ErrNotFound {
+		if _, err := Get(name); err != nil {
+			return err
+		}
+		return ErrBindNotFound
+	}
+	return err
+}
+
+// UnbindAllFromApp detaches all the volumes bound to the app, used when the
+// app is removed.
+func UnbindAllFromApp(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Volumes().UpdateAll(bson.M{"binds.app": appName}, bson.M{"$pull": bson.M{"binds": bson.M{"app": appName}}})
+	return err
+}
+
+// ListAppBinds returns the volumes bound to the app, ordered by volume name.
+func ListAppBinds(appName string) ([]AppBind, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var volumes []Volume
+	err = conn.Volumes().Find(bson.M{"binds.app": appName}).Sort("_id").All(&volumes)
+	if err != nil {
+		return nil, err
+	}
+	var binds []AppBind
+	for _, v := range volumes {
+		for _, b := range v.Binds {
+			if b.App != appName {
+				continue
+			}
+			binds = append(binds, AppBind{
+				Volume:     v.Name,
+				Type:       v.Type,
+				Source:     v.Source,
+				Pool:       v.Pool,
+				Node:       v.Node,
+				MountPoint: b.MountPoint,
+				ReadOnly:   b.ReadOnly,
+			})
+		}
+	}
+	return binds, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package volume
+
+import (
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCreate(c *check.C) {
+	v := Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1", Node: "10.0.0.1"}
+	err := Create(&v)
+	c.Assert(err, check.IsNil)
+	dbVolume, err := Get("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(*dbVolume, check.DeepEquals, v)
+	err = Create(&v)
+	c.Assert(err, check.Equals, ErrVolumeAlreadyExists)
+}
+
+func (s *S) TestCreateInvalid(c *check.C) {
+	var tests = []struct {
+		volume  Volume
+		message string
+	}{
+		{Volume{Type: TypeHost, Source: "/mnt/data", Pool: "pool1"}, "volume name is required"},
+		{Volume{Name: "data", Type: TypeHost, Source: "/mnt/data"}, "volume pool is required"},
+		{Volume{Name: "data", Type: TypeHost, Source: "mnt/data", Pool: "pool1"}, "source of host volumes must be an absolute path"},
+		{Volume{Name: "data", Type: TypeDocker, Source: "/mnt/data", Pool: "pool1"}, "source of docker volumes must be a volume name"},
+		{Volume{Name: "data", Type: "nfs", Source: "/mnt/data", Pool: "pool1"}, `invalid volume type "nfs", must be "host" or "docker"`},
+	}
+	for _, t := range tests {
+		err := Create(&t.volume)
+		c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+		c.Check(err.Error(), check.Equals, t.message)
+	}
+	volumes, err := List()
+	c.Assert(err, check.IsNil)
+	c.Assert(volumes, check.HasLen, 0)
+}
+
+func (s *S) TestGetNotFound(c *check.C) {
+	v, err := Get("data")
+	c.Assert(v, check.IsNil)
+	c.Assert(err, check.Equals, ErrVolumeNotFound)
+}
+
+func (s *S) TestList(c *check.C) {
+	err := Create(&Volume{Name: "uploads", Type: TypeDocker, Source: "uploads", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = Create(&Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	volumes, err := List()
+	c.Assert(err, check.IsNil)
+	c.Assert(volumes, check.HasLen, 2)
+	c.Assert(volumes[0].Name, check.Equals, "data")
+	c.Assert(volumes[1].Name, check.Equals, "uploads")
+	c.Assert(volumes[1].Type, check.Equals, TypeDocker)
+}
+
+func (s *S) TestRemove(c *check.C) {
+	err := Create(&Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	err = Remove("data")
+	c.Assert(err, check.Equals, ErrVolumeBound)
+	err = UnbindApp("data", "myapp", "/data")
+	c.Assert(err, check.IsNil)
+	err = Remove("data")
+	c.Assert(err, check.IsNil)
+	err = Remove("data")
+	c.Assert(err, check.Equals, ErrVolumeNotFound)
+}
+
+func (s *S) TestBindApp(c *check.C) {
+	err := Create(&Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "myapp", "/data/", false)
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "otherapp", "/var/data", true)
+	c.Assert(err, check.IsNil)
+	v, err := Get("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(v.Binds, check.DeepEquals, []Bind{
+		{App: "myapp", MountPoint: "/data"},
+		{App: "otherapp", MountPoint: "/var/data", ReadOnly: true},
+	})
+	err = BindApp("data", "myapp", "/data", true)
+	c.Assert(err, check.Equals, ErrBindAlreadyExists)
+	err = BindApp("data", "myapp", "data", true)
+	c.Assert(err, check.Equals, ErrInvalidMountPoint)
+	err = BindApp("unknown", "myapp", "/other", true)
+	c.Assert(err, check.Equals, ErrVolumeNotFound)
+}
+
+func (s *S) TestUnbindApp(c *check.C) {
+	err := Create(&Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	err = UnbindApp("data", "myapp", "/other")
+	c.Assert(err, check.Equals, ErrBindNotFound)
+	err = UnbindApp("unknown", "myapp", "/data")
+	c.Assert(err, check.Equals, ErrVolumeNotFound)
+	err = UnbindApp("data", "myapp", "/data")
+	c.Assert(err, check.IsNil)
+	v, err := Get("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(v.Binds, check.HasLen, 0)
+}
+
+func (s *S) TestUnbindAllFromApp(c *check.C) {
+	err := Create(&Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "myapp", "/data2", false)
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "otherapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	err = UnbindAllFromApp("myapp")
+	c.Assert(err, check.IsNil)
+	v, err := Get("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(v.Binds, check.DeepEquals, []Bind{{App: "otherapp", MountPoint: "/data"}})
+}
+
+func (s *S) TestListAppBinds(c *check.C) {
+	err := Create(&Volume{Name: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1", Node: "10.0.0.1"})
+	c.Assert(err, check.IsNil)
+	err = Create(&Volume{Name: "uploads", Type: TypeDocker, Source: "uploads", Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = BindApp("uploads", "myapp", "/uploads", true)
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "myapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	err = BindApp("data", "otherapp", "/data", false)
+	c.Assert(err, check.IsNil)
+	binds, err := ListAppBinds("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []AppBind{
+		{Volume: "data", Type: TypeHost, Source: "/mnt/data", Pool: "pool1", Node: "10.0.0.1", MountPoint: "/data"},
+		{Volume: "uploads", Type: TypeDocker, Source: "uploads", Pool: "pool1", MountPoint: "/uploads", ReadOnly: true},
+	})
+	c.Assert(binds[0].Spec(), check.Equals, "/mnt/data:/data:rw")
+	c.Assert(binds[1].Spec(), check.Equals, "uploads:/uploads:ro")
+}